@@ -0,0 +1,50 @@
+// Command multipart-upload uploads a file with an aws-sdk-go-v2
+// multipart upload, one part at a time, or several with
+// -max-concurrency.
+//
+//	go run ./examples/multipart-upload -bucket b -key big.iso -file ./big.iso -part-size 64MiB
+//	go run ./examples/multipart-upload -bucket b -key big.iso -file ./big.iso -max-concurrency 8
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk-v2/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", 1, "number of parts uploaded in parallel")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "destination key (required)")
+	file := flag.String("file", "", "file to upload (required)")
+	flag.Parse()
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client, err := utils.NewClient(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Now()
+	out, err := utils.ConcurrentMultipartUpload(ctx, client, *bucket, *key, *file, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("uploaded %s to s3://%s/%s in %s (ETag %s)", *file, *bucket, *key,
+		time.Since(start).Round(time.Millisecond), aws.ToString(out.ETag))
+}
@@ -0,0 +1,60 @@
+// Command upload uploads a file with aws-sdk-go-v2, choosing a single
+// PutObject for small files and a concurrent multipart upload for large
+// ones. Interrupting it, or reaching -timeout, cancels the requests in
+// flight and aborts a multipart upload.
+//
+//	go run ./examples/upload -bucket b -key big.iso -file ./big.iso
+//	go run ./examples/upload -bucket b -key big.iso -file ./big.iso -max-concurrency 8 -timeout 10m
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk-v2/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts uploaded in parallel (1 uploads parts sequentially)")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "destination key (required)")
+	file := flag.String("file", "", "file to upload (required)")
+	timeout := flag.Duration("timeout", 0, "cancel everything, client setup included, after this long (0 = no limit)")
+	flag.Parse()
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	client, err := utils.NewClient(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	out, err := utils.Upload(ctx, client, *bucket, *key, *file, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	method := "a single PUT"
+	if out.Parts > 0 {
+		method = fmt.Sprintf("%d parts", out.Parts)
+	}
+	log.Printf("uploaded %s (%s) to s3://%s/%s as %s in %s (ETag %s)", *file, utils.FormatBytes(out.Size), *bucket, *key,
+		method, time.Since(start).Round(time.Millisecond), out.ETag)
+}
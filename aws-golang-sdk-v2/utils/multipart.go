@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// MinPartSize is the smallest part S3 accepts, except for the last.
+	MinPartSize int64 = 5 << 20
+	// DefaultPartSize is used when UploadOptions.PartSize is zero.
+	DefaultPartSize int64 = 8 << 20
+	// DefaultConcurrency is the number of parts uploaded in parallel by
+	// ConcurrentMultipartUpload when UploadOptions.Concurrency is zero.
+	DefaultConcurrency = 4
+	// MaxParts is the S3 limit on parts per multipart upload.
+	MaxParts = 10000
+)
+
+// UploadOptions tunes the upload helpers. Zero values select the
+// defaults. Retries of individual requests are left to the client's
+// retryer (see s3.Options.Retryer).
+type UploadOptions struct {
+	PartSize    int64
+	Concurrency int
+	// MultipartThreshold is the size above which Upload switches from a
+	// single PutObject to a multipart upload. Zero selects
+	// DefaultMultipartThreshold.
+	MultipartThreshold int64
+	// MaxElapsedTime bounds the whole upload, as a deadline on top of
+	// the caller's context. Zero means no limit.
+	MaxElapsedTime time.Duration
+	// Metadata is stored with the object as x-amz-meta-* headers.
+	Metadata map[string]string
+}
+
+// RegisterFlags binds the options shared by the upload examples to fs.
+// Concurrency is registered separately by the examples that use it.
+func (o *UploadOptions) RegisterFlags(fs *flag.FlagSet) {
+	o.PartSize = DefaultPartSize
+	fs.Var((*ByteSize)(&o.PartSize), "part-size", "part size, e.g. 8MiB or 64MiB")
+	fs.Var((*ByteSize)(&o.MultipartThreshold), "multipart-threshold", "objects up to this size are sent with a single PutObject (default 16MiB)")
+	fs.DurationVar(&o.MaxElapsedTime, "max-elapsed-time", 0, "give up if the upload takes longer than this (0 = no limit)")
+}
+
+func (o *UploadOptions) setDefaults() {
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.MultipartThreshold <= 0 {
+		o.MultipartThreshold = DefaultMultipartThreshold
+	}
+}
+
+// withDeadline applies MaxElapsedTime to ctx.
+func (o *UploadOptions) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.MaxElapsedTime > 0 {
+		return context.WithTimeout(ctx, o.MaxElapsedTime)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Part is one byte range of a multipart upload.
+type Part struct {
+	Number int32
+	Offset int64
+	Size   int64
+}
+
+// PlanParts splits size bytes into parts of partSize, growing the part
+// size if needed to stay within MaxParts. An empty file is a single empty
+// part.
+func PlanParts(size, partSize int64) []Part {
+	if size/partSize >= MaxParts {
+		partSize = size/MaxParts + 1
+	}
+	if size == 0 {
+		return []Part{{Number: 1}}
+	}
+	parts := make([]Part, 0, (size+partSize-1)/partSize)
+	for off := int64(0); off < size; off += partSize {
+		parts = append(parts, Part{Number: int32(len(parts)) + 1, Offset: off, Size: min(partSize, size-off)})
+	}
+	return parts
+}
+
+// MultipartUpload uploads the file at path one part at a time.
+func MultipartUpload(ctx context.Context, svc S3API, bucket, key, path string, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	opts.Concurrency = 1
+	return multipartUpload(ctx, svc, bucket, key, path, opts)
+}
+
+// ConcurrentMultipartUpload uploads the file at path with up to
+// opts.Concurrency parts in flight.
+func ConcurrentMultipartUpload(ctx context.Context, svc S3API, bucket, key, path string, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	return multipartUpload(ctx, svc, bucket, key, path, opts)
+}
+
+// multipartUpload creates the upload, sends the parts and completes it.
+// If any part fails, or ctx is cancelled or past its deadline, the parts
+// still in flight are cancelled and the upload is aborted, so nothing is
+// left behind on the server.
+func multipartUpload(ctx context.Context, svc S3API, bucket, key, path string, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	opts.setDefaults()
+	ctx, cancel := opts.withDeadline(ctx)
+	defer cancel()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	parts := PlanParts(info.Size(), opts.PartSize)
+
+	create, err := svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		Metadata: opts.Metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create multipart upload: %w", err)
+	}
+	uploadID := create.UploadId
+
+	completed := make([]types.CompletedPart, len(parts))
+	errs := make([]error, len(parts))
+	partCtx, stopParts := context.WithCancel(ctx)
+	defer stopParts()
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.Concurrency, len(parts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				p := parts[i]
+				out, err := svc.UploadPart(partCtx, &s3.UploadPartInput{
+					Bucket:        aws.String(bucket),
+					Key:           aws.String(key),
+					UploadId:      uploadID,
+					PartNumber:    aws.Int32(p.Number),
+					Body:          io.NewSectionReader(f, p.Offset, p.Size),
+					ContentLength: aws.Int64(p.Size),
+				})
+				if err != nil {
+					if partCtx.Err() != nil {
+						// Cancelled with the others: ctx ended, which is
+						// reported below, or another part failed first.
+						continue
+					}
+					errs[i] = fmt.Errorf("upload part %d: %w", p.Number, err)
+					// One failed part fails the upload; stop the rest.
+					stopParts()
+					continue
+				}
+				completed[i] = types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(p.Number)}
+			}
+		}()
+	}
+send:
+	for i := range parts {
+		select {
+		case next <- i:
+		case <-partCtx.Done():
+			break send
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	if err == nil {
+		err = ctx.Err()
+	}
+	var out *s3.CompleteMultipartUploadOutput
+	if err == nil {
+		out, err = svc.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        uploadID,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+		})
+		if err != nil {
+			err = fmt.Errorf("complete multipart upload: %w", err)
+		}
+	}
+	if err != nil {
+		// The abort must go out even though ctx may be what failed the
+		// upload.
+		_, abortErr := svc.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: uploadID,
+		})
+		if abortErr != nil {
+			err = errors.Join(err, fmt.Errorf("abort upload %s: %w", aws.ToString(uploadID), abortErr))
+		}
+		if errors.Is(err, context.DeadlineExceeded) && opts.MaxElapsedTime > 0 {
+			return nil, fmt.Errorf("upload exceeded max elapsed time of %s: %w", opts.MaxElapsedTime, err)
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultMultipartThreshold is the size above which Upload switches from
+// a single PutObject to a multipart upload when
+// UploadOptions.MultipartThreshold is zero.
+const DefaultMultipartThreshold int64 = 16 << 20
+
+// UploadResult describes a finished upload, whichever method sent it.
+type UploadResult struct {
+	ETag      string
+	VersionID string
+	Size      int64
+	// Parts is the number of parts of a multipart upload, or zero when
+	// the object was sent with a single PutObject.
+	Parts int
+}
+
+// PutObject uploads the file at path with a single PutObject request,
+// which S3 limits to 5GiB. Upload picks between this and a multipart
+// upload by size.
+func PutObject(ctx context.Context, svc S3API, bucket, key, path string, opts UploadOptions) (*UploadResult, error) {
+	opts.setDefaults()
+	ctx, cancel := opts.withDeadline(ctx)
+	defer cancel()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// *os.File is seekable, so the SDK can rewind it to sign the payload
+	// and to retry.
+	out, err := svc.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          f,
+		ContentLength: aws.Int64(info.Size()),
+		Metadata:      opts.Metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("put object: %w", err)
+	}
+	return &UploadResult{
+		ETag:      aws.ToString(out.ETag),
+		VersionID: aws.ToString(out.VersionId),
+		Size:      info.Size(),
+	}, nil
+}
+
+// Upload uploads the file at path with the method that suits its size: a
+// single PutObject up to opts.MultipartThreshold, otherwise a multipart
+// upload with up to opts.Concurrency parts in flight.
+func Upload(ctx context.Context, svc S3API, bucket, key, path string, opts UploadOptions) (*UploadResult, error) {
+	opts.setDefaults()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size <= opts.MultipartThreshold {
+		return PutObject(ctx, svc, bucket, key, path, opts)
+	}
+	out, err := multipartUpload(ctx, svc, bucket, key, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadResult{
+		ETag:      aws.ToString(out.ETag),
+		VersionID: aws.ToString(out.VersionId),
+		Size:      size,
+		Parts:     len(PlanParts(size, opts.PartSize)),
+	}, nil
+}
@@ -0,0 +1,205 @@
+// Package utils is the aws-sdk-go-v2 counterpart of the v1 module's
+// utils package: connection settings, S3 client construction, PutObject
+// and multipart uploads. Every call takes a context.Context, which bounds
+// all the requests it sends, so callers cancel an upload or give it a
+// deadline the usual way.
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/term"
+)
+
+const (
+	// DefaultRegion is the signing region used when none is configured.
+	// Objectslite ignores the region but SigV4 requires one.
+	DefaultRegion = "us-east-1"
+
+	// EnvEndpoint, EnvUsername and EnvPassword are consulted when the
+	// corresponding flag is left empty. They are shared with the v1
+	// module, so both sets of examples run from the same environment.
+	EnvEndpoint = "OBJECTSLITE_ENDPOINT"
+	EnvUsername = "OBJECTSLITE_USERNAME"
+	EnvPassword = "OBJECTSLITE_PASSWORD"
+
+	// EnvAccessKey and EnvSecretKey select key-based authentication
+	// with keys issued through Prism IAM instead of the Prism password.
+	EnvAccessKey = "OBJECTSLITE_ACCESS_KEY"
+	EnvSecretKey = "OBJECTSLITE_SECRET_KEY"
+)
+
+// Config holds the connection settings shared by every example.
+type Config struct {
+	// Endpoint is the Objectslite S3 endpoint, e.g. https://10.0.0.10:9440.
+	Endpoint string
+	Region   string
+	Username string
+	Password string
+	// AccessKey and SecretKey, when set, are used instead of the encoded
+	// Prism username and password.
+	AccessKey string
+	SecretKey string
+	// Anonymous sends unsigned requests, for buckets that allow public
+	// read.
+	Anonymous bool
+	// Insecure skips TLS certificate verification. Prism Central ships
+	// with a self-signed certificate, so lab setups usually need this.
+	Insecure bool
+}
+
+// RegisterFlags binds the connection flags to fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Endpoint, "endpoint", "", "Objectslite endpoint URL (default $"+EnvEndpoint+")")
+	fs.StringVar(&c.Region, "region", "", "signing region (default "+DefaultRegion+")")
+	fs.StringVar(&c.Username, "username", "", "Prism username (default $"+EnvUsername+")")
+	fs.StringVar(&c.Password, "password", "", "Prism password (default $"+EnvPassword+", otherwise prompted)")
+	fs.StringVar(&c.AccessKey, "access-key", "", "S3 access key (default $"+EnvAccessKey+"); replaces username/password")
+	fs.StringVar(&c.SecretKey, "secret-key", "", "S3 secret key (default $"+EnvSecretKey+")")
+	fs.BoolVar(&c.Anonymous, "anonymous", false, "send unsigned requests (public-read buckets); no credentials needed")
+	fs.BoolVar(&c.Insecure, "insecure", false, "skip TLS certificate verification")
+}
+
+// Resolve fills unset fields from the environment and prompts for the
+// password on the terminal as a last resort. Username and password are
+// not needed when an access key pair is configured or in anonymous mode.
+func (c *Config) Resolve() error {
+	if c.Region == "" {
+		c.Region = DefaultRegion
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = os.Getenv(EnvEndpoint)
+	}
+	if c.Endpoint == "" {
+		return errors.New("no endpoint configured: set -endpoint or $" + EnvEndpoint)
+	}
+	if c.Anonymous {
+		return nil
+	}
+	if c.AccessKey == "" && c.Username == "" {
+		c.AccessKey = os.Getenv(EnvAccessKey)
+	}
+	if c.SecretKey == "" {
+		c.SecretKey = os.Getenv(EnvSecretKey)
+	}
+	if c.AccessKey != "" {
+		if c.SecretKey == "" {
+			return errors.New("access key configured without a secret key: set -secret-key or $" + EnvSecretKey)
+		}
+		return nil
+	}
+	if c.Username == "" {
+		c.Username = os.Getenv(EnvUsername)
+	}
+	if c.Username == "" {
+		return errors.New("no username configured: set -username or $" + EnvUsername)
+	}
+	if c.Password == "" {
+		c.Password = os.Getenv(EnvPassword)
+	}
+	if c.Password == "" {
+		password, err := PromptPassword(fmt.Sprintf("Password for %s: ", c.Username))
+		if err != nil {
+			return err
+		}
+		c.Password = password
+	}
+	return nil
+}
+
+// PromptPassword reads a password from the terminal without echoing it.
+func PromptPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("password required but stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+// EncodeCredentials returns the key Objectslite expects for a Prism user:
+// the base64 encoding of "username:password", used as both the access key
+// and the secret key.
+func EncodeCredentials(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// HTTPClient returns the HTTP client used for S3 traffic.
+func (c *Config) HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// Credentials returns the S3 credentials provider for the resolved
+// config.
+func (c *Config) Credentials() aws.CredentialsProvider {
+	switch {
+	case c.Anonymous:
+		return aws.AnonymousCredentials{}
+	case c.AccessKey != "":
+		return credentials.NewStaticCredentialsProvider(c.AccessKey, c.SecretKey, "")
+	}
+	key := EncodeCredentials(c.Username, c.Password)
+	return credentials.NewStaticCredentialsProvider(key, key, "")
+}
+
+// NewClient resolves cfg and returns an S3 client for it. optFns adjust
+// the client options after the Objectslite settings are applied, as they
+// do for s3.NewFromConfig. ctx only bounds loading the shared SDK
+// configuration; each call on the client takes its own.
+func NewClient(ctx context.Context, cfg Config, optFns ...func(*s3.Options)) (*s3.Client, error) {
+	if err := cfg.Resolve(); err != nil {
+		return nil, err
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsProvider(cfg.Credentials()),
+		config.WithHTTPClient(cfg.HTTPClient()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+	opts := append([]func(*s3.Options){func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(cfg.Endpoint)
+		o.UsePathStyle = true
+		// Newer SDK releases add CRC checksums to every upload and
+		// validate them on every download; Objectslite neither needs
+		// nor returns them.
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	}}, optFns...)
+	return s3.NewFromConfig(awsCfg, opts...), nil
+}
+
+// S3API is the subset of *s3.Client the upload helpers call. The v2 SDK
+// has no s3iface package; accepting this interface instead of the
+// concrete client lets tests and wrappers stand in for it.
+type S3API interface {
+	PutObject(ctx context.Context, in *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, in *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+var _ S3API = (*s3.Client)(nil)
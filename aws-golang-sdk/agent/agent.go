@@ -0,0 +1,201 @@
+// Package agent implements a long-lived local proxy that holds the
+// Objectslite credentials and a pool of warm TLS connections. Short-lived
+// CLI invocations send unsigned S3 requests to it over a unix socket; the
+// agent signs and forwards them, so scripts calling the examples hundreds
+// of times skip the password prompt and TLS handshake on every call.
+//
+// Anyone who can connect to the socket acts with the agent's credentials,
+// so the socket is created with mode 0600, and clients only connect to a
+// socket owned by their own user.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// maxIdleConns is the number of warm connections kept to the endpoint;
+// net/http keeps only two per host by default.
+const maxIdleConns = 64
+
+// DefaultSocket returns the per-user socket path used when none is given:
+// in $XDG_RUNTIME_DIR, which only the user can enter, or else in a
+// directory of its own under the temporary directory, which
+// ListenAndServe creates with mode 0700.
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "objectslite-agent.sock")
+	}
+	return filepath.Join(os.TempDir(), "objectslite-agent-"+strconv.Itoa(os.Getuid()), "agent.sock")
+}
+
+// Server forwards S3 requests received on a unix socket to Objectslite.
+type Server struct {
+	proxy *httputil.ReverseProxy
+	// readOnly refuses everything but GET and HEAD, whatever the client
+	// was configured with.
+	readOnly bool
+}
+
+// NewServer resolves cfg, prompting for the password if needed, and
+// returns a Server that forwards to cfg.Endpoint.
+func NewServer(cfg utils.Config) (*Server, error) {
+	cfg.Agent = ""
+	if err := cfg.Resolve(); err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	httpClient, err := cfg.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	transport := httpClient.Transport.(*http.Transport)
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConns
+
+	return &Server{readOnly: cfg.ReadOnly, proxy: &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = target.Scheme
+			r.Out.URL.Host = target.Host
+			r.Out.Host = ""
+		},
+		Transport: &signingTransport{
+			base:   transport,
+			signer: newSigner(cfg.Credentials()),
+			region: cfg.Region,
+			skew:   &utils.ClockSkew{},
+		},
+	}}, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "<Error><Code>AccessDenied</Code><Message>%s %s %s by the agent</Message></Error>", r.Method, r.URL.Path, utils.ErrReadOnly)
+		return
+	}
+	s.proxy.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on a unix socket at path until ctx is done. A
+// stale socket left by an agent that died is replaced; a live one is an
+// error. A missing directory is created with mode 0700; an existing one
+// must belong to the user or to root, as a directory another user owns
+// lets them replace the socket with their own.
+func (s *Server) ListenAndServe(ctx context.Context, path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := utils.CheckOwner(dir, 0); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("an agent is already listening on %s", path)
+	}
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return err
+	}
+
+	srv := &http.Server{Handler: s}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func newSigner(creds *credentials.Credentials) *v4.Signer {
+	return v4.NewSigner(creds, v4.WithUnsignedPayload, func(s *v4.Signer) {
+		// S3 signs the path as sent rather than escaping it twice.
+		s.DisableURIPathEscaping = true
+		// The payload is not passed to Sign; keep the body forwarded.
+		s.DisableRequestBodyOverwrite = true
+	})
+}
+
+// signingTransport signs each forwarded request with the agent's
+// credentials. The payload is left unsigned (its integrity is covered by
+// TLS and any Content-MD5 or checksum header the client sent), so bodies
+// stream through without being buffered for hashing.
+//
+// Requests are signed with the server's time once a RequestTimeTooSkewed
+// response has shown the clocks apart. The request that showed it is
+// sent again if it has no body; one with a body cannot be replayed and
+// fails, but the requests after it are signed correctly.
+type signingTransport struct {
+	base   http.RoundTripper
+	signer *v4.Signer
+	region string
+	skew   *utils.ClockSkew
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.send(req)
+	if err != nil || !t.skewed(resp) || req.Body != nil && req.Body != http.NoBody {
+		return resp, err
+	}
+	resp.Body.Close()
+	return t.send(req)
+}
+
+func (t *signingTransport) send(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for _, h := range []string{"Authorization", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"} {
+		req.Header.Del(h)
+	}
+	if _, err := t.signer.Sign(req, nil, "s3", t.region, t.skew.Now()); err != nil {
+		return nil, fmt.Errorf("sign request: %w", err)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// skewed reports whether resp rejected the request as
+// RequestTimeTooSkewed, correcting the skew if so. The error body is read
+// and put back for the client.
+func (t *signingTransport) skewed(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || !bytes.Contains(body, []byte("<Code>"+utils.ErrCodeRequestTimeTooSkewed+"</Code>")) {
+		return false
+	}
+	return t.skew.Correct(resp)
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// startAgent serves an agent for srv on a socket in a temporary directory
+// until the test ends, and returns a client configured to use it.
+func startAgent(t *testing.T, srv *objectslitetest.Server, readOnly bool) (*utils.Client, string) {
+	t.Helper()
+	cfg := srv.Config()
+	cfg.ReadOnly = readOnly
+	a, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.ListenAndServe(ctx, socket) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("agent: %v", err)
+		}
+		if _, err := os.Stat(socket); !os.IsNotExist(err) {
+			t.Errorf("socket left after the agent stopped: %v", err)
+		}
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("agent did not start listening")
+		}
+	}
+	client, err := utils.NewClient(utils.Config{Agent: socket})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, socket
+}
+
+func TestAgentSignsAndForwards(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	var mu sync.Mutex
+	var auth []string
+	srv.Fail = func(r *http.Request) bool {
+		mu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		return false
+	}
+	client, socket := startAgent(t, srv, false)
+
+	data := objectslitetest.Data(1 << 20)
+	_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{Bucket: aws.String("b"), Key: aws.String("k"), Body: bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(out.Body)
+	out.Body.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read back %d bytes (%v), want the %d written", len(got), err, len(data))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, a := range auth {
+		if !strings.HasPrefix(a, "AWS4-HMAC-SHA256 Credential=test/") {
+			t.Fatalf("request reached the endpoint with Authorization %q, want it signed with the agent's key", a)
+		}
+	}
+
+	other, err := NewServer(srv.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.ListenAndServe(ctx, socket); err == nil {
+		t.Fatal("a second agent replaced the socket of a live one")
+	}
+}
+
+func TestReadOnlyAgent(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.PutObject("b", "k", []byte("data"))
+	client, _ := startAgent(t, srv, true)
+
+	_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{Bucket: aws.String("b"), Key: aws.String("new"), Body: strings.NewReader("x")})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "AccessDenied" {
+		t.Fatalf("PUT through a read-only agent returned %v, want AccessDenied", err)
+	}
+	if _, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String("b"), Key: aws.String("k")}); err != nil {
+		t.Fatalf("HEAD through a read-only agent: %v", err)
+	}
+	objectslitetest.AssertKeys(t, srv, "b", "k")
+}
@@ -0,0 +1,149 @@
+// Package audit verifies that the objects described by a manifest are
+// present in a bucket and unchanged.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Status is the outcome of auditing one manifest entry.
+type Status string
+
+const (
+	StatusOK               Status = "ok"
+	StatusMissing          Status = "missing"
+	StatusSizeMismatch     Status = "size-mismatch"
+	StatusChecksumMismatch Status = "checksum-mismatch"
+	StatusError            Status = "error"
+)
+
+// Options configures an audit.
+type Options struct {
+	Bucket string
+	// Prefix is prepended to every manifest key.
+	Prefix string
+	// Deep downloads each object and hashes its body instead of trusting
+	// the ETag and the stored sha256 metadata.
+	Deep        bool
+	Concurrency int
+}
+
+// Finding is the audit result for one manifest entry.
+type Finding struct {
+	Key    string `json:"key"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Summary counts findings by status.
+type Summary map[Status]int
+
+// Problems returns the number of findings that are not StatusOK.
+func (s Summary) Problems() int {
+	n := 0
+	for status, count := range s {
+		if status != StatusOK {
+			n += count
+		}
+	}
+	return n
+}
+
+// Summarize counts findings by status.
+func Summarize(findings []Finding) Summary {
+	s := make(Summary)
+	for _, f := range findings {
+		s[f.Status]++
+	}
+	return s
+}
+
+// Run audits every entry and returns one finding per entry, in manifest
+// order.
+func Run(ctx context.Context, svc s3iface.S3API, entries []manifest.Entry, opts Options) []Finding {
+	findings := make([]Finding, len(entries))
+	utils.ForEach(ctx, len(entries), opts.Concurrency, func(i int) {
+		findings[i] = Check(ctx, svc, entries[i], opts)
+	})
+	for i := range findings {
+		if findings[i].Status == "" {
+			findings[i] = Finding{Key: opts.Prefix + entries[i].Key, Status: StatusError, Detail: ctx.Err().Error()}
+		}
+	}
+	return findings
+}
+
+// Check audits a single entry.
+func Check(ctx context.Context, svc s3iface.S3API, e manifest.Entry, opts Options) Finding {
+	key := opts.Prefix + e.Key
+	f := Finding{Key: key, Status: StatusOK}
+
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if utils.IsNotFound(err) {
+			f.Status = StatusMissing
+			return f
+		}
+		f.Status, f.Detail = StatusError, err.Error()
+		return f
+	}
+	if size := aws.Int64Value(head.ContentLength); e.Size != nil && size != *e.Size {
+		f.Status, f.Detail = StatusSizeMismatch, fmt.Sprintf("expected %d bytes, found %d", *e.Size, size)
+		return f
+	}
+	if e.ETag != "" && !utils.SameETag(e.ETag, aws.StringValue(head.ETag)) {
+		f.Status, f.Detail = StatusChecksumMismatch, fmt.Sprintf("expected ETag %s, found %s", e.ETag, aws.StringValue(head.ETag))
+		return f
+	}
+
+	// SHA-256 can be checked against stored metadata; xxHash64 always
+	// needs the body.
+	algorithm, sum := manifest.SHA256, ""
+	switch {
+	case e.SHA256 != "":
+		sum = utils.MetadataValue(head.Metadata, utils.MetaSHA256)
+	case e.XXHash64 != "":
+		algorithm = manifest.XXHash64
+	default:
+		return f
+	}
+	if opts.Deep || sum == "" {
+		sum, err = hashObject(ctx, svc, opts.Bucket, key, algorithm)
+		if err != nil {
+			f.Status, f.Detail = StatusError, err.Error()
+			return f
+		}
+	}
+	if want := e.Sum(algorithm); !strings.EqualFold(sum, want) {
+		f.Status, f.Detail = StatusChecksumMismatch, fmt.Sprintf("expected %s %s, found %s", algorithm, want, sum)
+	}
+	return f
+}
+
+func hashObject(ctx context.Context, svc s3iface.S3API, bucket, key string, algorithm manifest.Algorithm) (string, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+	sum, err := manifest.HashReader(out.Body, algorithm)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", key, err)
+	}
+	return sum, nil
+}
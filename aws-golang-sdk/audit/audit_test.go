@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestCheckSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		object []byte
+		line   string
+		want   Status
+	}{
+		{name: "size matches", object: []byte("abc"), line: `{"key":"k","size":3}`, want: StatusOK},
+		{name: "size differs", object: []byte("abc"), line: `{"key":"k","size":4}`, want: StatusSizeMismatch},
+		{name: "empty object recorded empty", object: nil, line: `{"key":"k","size":0}`, want: StatusOK},
+		{name: "empty file now holds data", object: []byte("abc"), line: `{"key":"k","size":0}`, want: StatusSizeMismatch},
+		{name: "size absent", object: []byte("abc"), line: `{"key":"k"}`, want: StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			srv.PutObject("b", "p/k", tt.object)
+			entries, err := manifest.Read(strings.NewReader(tt.line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := Check(context.Background(), srv.Client(t), entries[0], Options{Bucket: "b", Prefix: "p/"})
+			if f.Status != tt.want {
+				t.Fatalf("status %s (%s), want %s", f.Status, f.Detail, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Package backup snapshots a local directory to timestamped prefixes and
+// prunes old snapshots. A snapshot named 20240501T100000Z under prefix
+// "backups/" stores the files under "backups/20240501T100000Z/" and its
+// manifest at "backups/20240501T100000Z.manifest.jsonl". The manifest is
+// written last, so a snapshot is complete exactly when it has one; data
+// left behind by an interrupted run is never mistaken for a snapshot.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// TimeFormat is the layout of snapshot names, in UTC.
+const TimeFormat = "20060102T150405Z"
+
+// manifestSuffix follows the snapshot name in the manifest key.
+const manifestSuffix = ".manifest.jsonl"
+
+// Options configures a backup.
+type Options struct {
+	Bucket string
+	// Prefix holds the snapshots, one timestamped prefix each.
+	Prefix string
+	// Dir is the directory snapshotted.
+	Dir string
+	// Keep is the number of most recent snapshots retained after each
+	// backup. Zero keeps all of them.
+	Keep int
+	// Algorithm is the content hash recorded in the manifest.
+	Algorithm   manifest.Algorithm
+	Concurrency int
+	Upload      utils.UploadOptions
+	// ContinueOnError uploads every file even after some fail, and
+	// completes the snapshot with the files that succeeded (see Run).
+	ContinueOnError bool
+}
+
+func (o *Options) setDefaults() {
+	if o.Prefix != "" && !strings.HasSuffix(o.Prefix, "/") {
+		o.Prefix += "/"
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = manifest.SHA256
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = utils.DefaultConcurrency
+	}
+}
+
+// Snapshot is one complete backup.
+type Snapshot struct {
+	Name string
+	Time time.Time
+}
+
+// DataPrefix returns the prefix holding the snapshot's files; manifest
+// keys are relative to it.
+func (s Snapshot) DataPrefix(prefix string) string {
+	return withSlash(prefix) + s.Name + "/"
+}
+
+// ManifestKey returns the key of the snapshot's manifest.
+func (s Snapshot) ManifestKey(prefix string) string {
+	return withSlash(prefix) + s.Name + manifestSuffix
+}
+
+// Result summarizes one backup run.
+type Result struct {
+	Snapshot Snapshot
+	Files    int
+	Bytes    int64
+	Elapsed  time.Duration
+	// Pruned lists the snapshots deleted by retention afterwards.
+	Pruned []Snapshot
+	// Failed holds the error of each file left out of the snapshot,
+	// with Options.ContinueOnError.
+	Failed []error
+}
+
+// Run snapshots opts.Dir under a name taken from now, writes the
+// manifest, and then prunes snapshots beyond opts.Keep. A failed upload
+// fails the run without writing the manifest, so the partial snapshot is
+// not listed and is removed by a later prune.
+//
+// With opts.ContinueOnError, failed files are instead recorded in
+// Result.Failed and left out of the manifest, and the snapshot is
+// completed without them. Nothing is pruned after such a run, so the
+// last complete snapshot of those files survives.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options, now time.Time) (Result, error) {
+	opts.setDefaults()
+	opts.Upload.ShareMemory()
+	start := time.Now()
+	snap := Snapshot{Name: now.UTC().Format(TimeFormat), Time: now.UTC().Truncate(time.Second)}
+	r := Result{Snapshot: snap}
+
+	entries, err := manifest.FromDir(ctx, opts.Dir, opts.Algorithm, opts.Concurrency)
+	if err != nil {
+		return r, fmt.Errorf("scan %s: %w", opts.Dir, err)
+	}
+	data := snap.DataPrefix(opts.Prefix)
+	errs := utils.ForEachErr(ctx, len(entries), opts.Concurrency, opts.ContinueOnError, func(i int) error {
+		path := filepath.Join(opts.Dir, filepath.FromSlash(entries[i].Key))
+		out, err := utils.Upload(ctx, svc, opts.Bucket, data+entries[i].Key, path, opts.Upload)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entries[i].Key, err)
+		}
+		entries[i].ETag = out.ETag
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return r, err
+	}
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case opts.ContinueOnError:
+			r.Failed = append(r.Failed, err)
+		case !errors.Is(err, utils.ErrSkipped):
+			return r, err
+		}
+	}
+
+	var buf bytes.Buffer
+	w := manifest.NewWriter(&buf)
+	for i, e := range entries {
+		if errs[i] != nil {
+			continue
+		}
+		if err := w.Write(e); err != nil {
+			return r, err
+		}
+		r.Files++
+		r.Bytes += aws.Int64Value(e.Size)
+	}
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(opts.Bucket),
+		Key:         aws.String(snap.ManifestKey(opts.Prefix)),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return r, fmt.Errorf("write manifest: %w", err)
+	}
+	r.Elapsed = time.Since(start)
+
+	if opts.Keep > 0 && len(r.Failed) == 0 {
+		if r.Pruned, err = Prune(ctx, svc, opts.Bucket, opts.Prefix, opts.Keep); err != nil {
+			return r, fmt.Errorf("prune: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// List returns the complete snapshots under prefix, oldest first.
+func List(ctx context.Context, svc s3iface.S3API, bucket, prefix string) ([]Snapshot, error) {
+	snaps, _, err := list(ctx, svc, bucket, withSlash(prefix))
+	return snaps, err
+}
+
+// list returns the complete snapshots and the names of data prefixes
+// that have no manifest.
+func list(ctx context.Context, svc s3iface.S3API, bucket, prefix string) ([]Snapshot, []string, error) {
+	complete := map[string]bool{}
+	var dirs []string
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			name, ok := strings.CutSuffix(strings.TrimPrefix(aws.StringValue(o.Key), prefix), manifestSuffix)
+			if ok {
+				complete[name] = true
+			}
+		}
+		for _, p := range page.CommonPrefixes {
+			dirs = append(dirs, strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(p.Prefix), prefix), "/"))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var snaps []Snapshot
+	var partial []string
+	for name := range complete {
+		if t, err := time.Parse(TimeFormat, name); err == nil {
+			snaps = append(snaps, Snapshot{Name: name, Time: t})
+		}
+	}
+	for _, name := range dirs {
+		if _, err := time.Parse(TimeFormat, name); err == nil && !complete[name] {
+			partial = append(partial, name)
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	sort.Strings(partial)
+	return snaps, partial, nil
+}
+
+// Prune deletes all but the keep most recent snapshots under prefix and
+// returns the deleted ones. Data of interrupted runs older than the
+// newest complete snapshot is deleted too. Each snapshot's manifest is
+// deleted before its data, so a prune that fails halfway never leaves a
+// listed snapshot with missing files.
+func Prune(ctx context.Context, svc s3iface.S3API, bucket, prefix string, keep int) ([]Snapshot, error) {
+	prefix = withSlash(prefix)
+	snaps, partial, err := list(ctx, svc, bucket, prefix)
+	if err != nil || len(snaps) == 0 {
+		return nil, err
+	}
+	newest := snaps[len(snaps)-1]
+	var pruned []Snapshot
+	for _, s := range snaps[:max(len(snaps)-keep, 0)] {
+		if err := utils.DeleteObject(ctx, svc, bucket, s.ManifestKey(prefix)); err != nil {
+			return pruned, err
+		}
+		if err := deletePrefix(ctx, svc, bucket, s.DataPrefix(prefix)); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, s)
+	}
+	for _, name := range partial {
+		if name >= newest.Name {
+			continue // possibly a backup still running
+		}
+		if err := deletePrefix(ctx, svc, bucket, prefix+name+"/"); err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// ReadManifest fetches and parses a snapshot's manifest.
+func ReadManifest(ctx context.Context, svc s3iface.S3API, bucket, prefix string, s Snapshot) ([]manifest.Entry, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s.ManifestKey(prefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return manifest.Read(out.Body)
+}
+
+// deletePrefix deletes every object under prefix, stopping at the first
+// batch with a failure.
+func deletePrefix(ctx context.Context, svc s3iface.S3API, bucket, prefix string) error {
+	deleted, err := utils.DeletePrefix(ctx, svc, bucket, prefix, utils.DeleteOptions{StopOnError: true})
+	if err != nil {
+		return err
+	}
+	var failed []utils.DeletedObject
+	for _, d := range deleted {
+		if d.Err != nil && !errors.Is(d.Err, utils.ErrSkipped) {
+			failed = append(failed, d)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("delete %s: %w (and %d more)", failed[0].Key, failed[0].Err, len(failed)-1)
+	}
+	return nil
+}
+
+func withSlash(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
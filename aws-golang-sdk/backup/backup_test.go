@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+var files = map[string]int64{"a.txt": 10, "sub/b.bin": 2 << 20, "sub/empty": 0}
+
+func TestRunPruneRestore(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	dir := objectslitetest.TempTree(t, files)
+	opts := Options{Bucket: "b", Prefix: "backups", Dir: dir, Keep: 2}
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 3 {
+		r, err := Run(ctx, client, opts, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Files != len(files) || r.Bytes != 10+2<<20 {
+			t.Fatalf("run %d backed up %d files (%d bytes), want %d", i, r.Files, r.Bytes, len(files))
+		}
+		if wantPruned := i == 2; (len(r.Pruned) == 1) != wantPruned {
+			t.Fatalf("run %d pruned %v", i, r.Pruned)
+		}
+	}
+	snaps, err := List(ctx, client, "b", "backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].Name != "20260102T040405Z" || snaps[1].Name != "20260102T050405Z" {
+		t.Fatalf("snapshots %v, want the two most recent", snaps)
+	}
+	for _, key := range srv.Keys("b") {
+		if strings.Contains(key, "20260102T030405Z") {
+			t.Fatalf("%s of the pruned snapshot is left", key)
+		}
+	}
+
+	latest, err := Find(snaps, Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	results, err := Restore(ctx, client, "b", "backups", latest, downloads.ManifestOptions{Dir: out}, func(downloads.Result) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("restored %d files, want %d", len(results), len(files))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("restore %s: %v", r.Key, r.Err)
+		}
+		want, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(r.Key)))
+		got, _ := os.ReadFile(filepath.Join(out, filepath.FromSlash(r.Key)))
+		if !bytes.Equal(got, want) {
+			t.Fatalf("restored %s differs from the original", r.Key)
+		}
+	}
+}
+
+func TestRunWithFailedFile(t *testing.T) {
+	tests := []struct {
+		name            string
+		continueOnError bool
+		wantFiles       int
+		wantSnapshots   int
+	}{
+		// The partial snapshot has no manifest, so it is not listed.
+		{name: "fails the snapshot"},
+		{name: "continue on error", continueOnError: true, wantFiles: 2, wantSnapshots: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			srv.Fail = func(r *http.Request) bool {
+				return r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/a.txt")
+			}
+			client := srv.Client(t)
+			opts := Options{
+				Bucket:          "b",
+				Prefix:          "backups/",
+				Dir:             objectslitetest.TempTree(t, files),
+				Concurrency:     1,
+				ContinueOnError: tt.continueOnError,
+				Upload:          utils.UploadOptions{Retry: utils.RetryPolicy{MaxAttempts: 1}},
+			}
+
+			r, err := Run(ctx, client, opts, time.Now())
+			if !tt.continueOnError {
+				if err == nil {
+					t.Fatal("backup with a failed file succeeded")
+				}
+			} else if err != nil || len(r.Failed) != 1 {
+				t.Fatalf("backup returned %v with failures %v, want only a.txt left out", err, r.Failed)
+			}
+			snaps, err := List(ctx, client, "b", "backups/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snaps) != tt.wantSnapshots {
+				t.Fatalf("%d snapshots listed after the run, want %d", len(snaps), tt.wantSnapshots)
+			}
+			if r.Files != tt.wantFiles {
+				t.Fatalf("manifest lists %d files, want %d", r.Files, tt.wantFiles)
+			}
+		})
+	}
+}
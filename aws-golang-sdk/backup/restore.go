@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+)
+
+// Latest names the most recent snapshot in Find.
+const Latest = "latest"
+
+// Find returns the snapshot called name, or the newest one for Latest.
+// snaps must be ordered as List returns them.
+func Find(snaps []Snapshot, name string) (Snapshot, error) {
+	if len(snaps) == 0 {
+		return Snapshot{}, fmt.Errorf("no snapshots")
+	}
+	if name == Latest {
+		return snaps[len(snaps)-1], nil
+	}
+	for _, s := range snaps {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("no snapshot %q", name)
+}
+
+// Restore downloads snapshot s from bucket/prefix into opts.Dir and
+// checks every file against the size and hash in the snapshot manifest;
+// opts.Bucket, opts.Prefix and opts.Verify are set from the arguments.
+// report is passed to downloads.FromManifest.
+func Restore(ctx context.Context, svc s3iface.S3API, bucket, prefix string, s Snapshot, opts downloads.ManifestOptions, report func(downloads.Result)) ([]downloads.Result, error) {
+	entries, err := ReadManifest(ctx, svc, bucket, prefix, s)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest of %s: %w", s.Name, err)
+	}
+	opts.Bucket = bucket
+	opts.Prefix = s.DataPrefix(prefix)
+	opts.Verify = true
+	return downloads.FromManifest(ctx, svc, entries, opts, report), nil
+}
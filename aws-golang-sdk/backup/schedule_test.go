@@ -0,0 +1,44 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Friday.
+	from := time.Date(2026, 5, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{spec: "@hourly", want: time.Date(2026, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2026, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "@weekly", want: time.Date(2026, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90m", want: from.Add(90 * time.Minute)},
+		{spec: "*/15 * * * *", want: time.Date(2026, 5, 15, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 2 * * 1-5", want: time.Date(2026, 5, 18, 2, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2026, 5, 17, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matching is enough.
+		{spec: "0 0 1 * 6", want: time.Date(2026, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 30 2 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: next run %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@every -1m", "@yearly"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", spec)
+		}
+	}
+}
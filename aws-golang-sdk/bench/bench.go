@@ -0,0 +1,375 @@
+// Package bench measures PUT and GET throughput and latency against an
+// Objectslite bucket over a matrix of object sizes and concurrency
+// levels, and produces a report that can be attached to a support case to
+// compare releases or settings.
+package bench
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DefaultPrefix is where benchmark objects are written when
+// Options.Prefix is empty.
+const DefaultPrefix = "bench/"
+
+// Options configures a benchmark run. Every combination of Sizes,
+// Concurrency and PartOrders is measured.
+type Options struct {
+	Bucket string
+	Prefix string
+	Sizes  []int64
+	// Concurrency lists the numbers of objects transferred at once.
+	Concurrency []int
+	// PartOrders lists the part orders compared (see
+	// utils.UploadOptions.PartOrder). Empty measures Upload.PartOrder
+	// alone.
+	PartOrders []string
+	// Objects is the number of objects written and read in each cell.
+	Objects int
+	// Runs is the number of measured runs of each cell (default 1), and
+	// Warmup the number of unmeasured runs before them.
+	Runs   int
+	Warmup int
+	// Upload configures each PUT; objects above its multipart threshold
+	// are uploaded in parts. Objects are uploaded from a temporary file,
+	// as a real upload would be.
+	Upload utils.UploadOptions
+}
+
+// Settings is the part of the options recorded in a report.
+type Settings struct {
+	Bucket             string   `json:"bucket"`
+	Prefix             string   `json:"prefix"`
+	Sizes              []int64  `json:"sizes"`
+	Concurrency        []int    `json:"concurrency"`
+	PartOrders         []string `json:"part_orders,omitempty"`
+	Objects            int      `json:"objects"`
+	Runs               int      `json:"runs"`
+	Warmup             int      `json:"warmup"`
+	PartSize           int64    `json:"part_size"`
+	PartConcurrency    int      `json:"part_concurrency"`
+	MultipartThreshold int64    `json:"multipart_threshold"`
+	Checksum           string   `json:"checksum,omitempty"`
+}
+
+// Environment describes the client side of a run, and the server as far
+// as its responses reveal it.
+type Environment struct {
+	Time      time.Time `json:"time"`
+	Tool      string    `json:"tool"`
+	GoVersion string    `json:"go_version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	CPUs      int       `json:"cpus"`
+	Hostname  string    `json:"hostname"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	// Server is the Server header the endpoint returns.
+	Server string `json:"server,omitempty"`
+}
+
+// Cell identifies one combination of the settings matrix.
+type Cell struct {
+	Size        int64  `json:"size"`
+	Concurrency int    `json:"concurrency"`
+	PartOrder   string `json:"part_order,omitempty"`
+}
+
+// OpStats summarises one operation type within a cell.
+type OpStats struct {
+	Ops    int   `json:"ops"`
+	Errors int   `json:"errors"`
+	Bytes  int64 `json:"bytes"`
+	// Elapsed is the wall time of the phase, and Throughput the bytes
+	// transferred successfully over it.
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	Throughput float64       `json:"bytes_per_second"`
+	P50        time.Duration `json:"p50_ns"`
+	P99        time.Duration `json:"p99_ns"`
+	Max        time.Duration `json:"max_ns"`
+	// FirstError is kept so a failing cell can be diagnosed.
+	FirstError string `json:"first_error,omitempty"`
+}
+
+// Sample is one measured run of a cell.
+type Sample struct {
+	Put OpStats `json:"put"`
+	Get OpStats `json:"get"`
+}
+
+// Stat summarises a metric over the measured runs of a cell.
+type Stat struct {
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// Summary aggregates one operation type over the measured runs.
+type Summary struct {
+	Throughput Stat `json:"bytes_per_second"`
+	P50        Stat `json:"p50_ns"`
+	P99        Stat `json:"p99_ns"`
+	Errors     int  `json:"errors"`
+}
+
+// Result is the measurement of one cell.
+type Result struct {
+	Cell
+	Runs []Sample `json:"runs"`
+	Put  Summary  `json:"put"`
+	Get  Summary  `json:"get"`
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	Environment Environment `json:"environment"`
+	Settings    Settings    `json:"settings"`
+	Results     []Result    `json:"results"`
+}
+
+// Run measures every cell of the matrix in turn. Each cell writes
+// opts.Objects objects, reads them back and deletes them. Failed
+// operations are counted rather than ending the run; only an error
+// before the first cell, or ctx being done, is returned.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options) (*Report, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.Runs < 1 {
+		opts.Runs = 1
+	}
+	if len(opts.Sizes) == 0 || len(opts.Concurrency) == 0 || opts.Objects < 1 {
+		return nil, fmt.Errorf("bench: need at least one size, one concurrency level and one object")
+	}
+	r := &Report{
+		Environment: NewEnvironment(),
+		Settings: Settings{
+			Bucket:             opts.Bucket,
+			Prefix:             opts.Prefix,
+			Sizes:              opts.Sizes,
+			Concurrency:        opts.Concurrency,
+			PartOrders:         opts.PartOrders,
+			Objects:            opts.Objects,
+			Runs:               opts.Runs,
+			Warmup:             opts.Warmup,
+			PartSize:           cmp.Or(opts.Upload.PartSize, utils.DefaultPartSize),
+			PartConcurrency:    cmp.Or(opts.Upload.Concurrency, utils.DefaultConcurrency),
+			MultipartThreshold: cmp.Or(opts.Upload.MultipartThreshold, utils.DefaultMultipartThreshold),
+			Checksum:           opts.Upload.Checksum,
+		},
+	}
+	var server string
+	if _, err := svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(opts.Bucket)},
+		request.WithGetResponseHeader("Server", &server)); err != nil {
+		return nil, fmt.Errorf("head bucket %s: %w", opts.Bucket, err)
+	}
+	r.Environment.Server = server
+
+	orders := opts.PartOrders
+	if len(orders) == 0 {
+		orders = []string{opts.Upload.PartOrder}
+	}
+	for _, order := range orders {
+		if _, err := utils.UploadOrder(0, nil, order); err != nil {
+			return nil, fmt.Errorf("bench: %w", err)
+		}
+	}
+	payload := make([]byte, slices.Max(opts.Sizes))
+	if _, err := rand.Read(payload); err != nil {
+		return nil, err
+	}
+	for _, size := range opts.Sizes {
+		path, err := writePayload(payload[:size])
+		if err != nil {
+			return r, err
+		}
+		for _, conc := range opts.Concurrency {
+			for _, order := range orders {
+				res := Result{Cell: Cell{Size: size, Concurrency: conc, PartOrder: order}}
+				for i := range opts.Warmup + opts.Runs {
+					run := runCell(ctx, svc, opts, res.Cell, path)
+					if err := ctx.Err(); err != nil {
+						os.Remove(path)
+						return r, err
+					}
+					if i >= opts.Warmup {
+						res.Runs = append(res.Runs, run)
+					}
+				}
+				res.Put = summarize(res.Runs, func(r Sample) OpStats { return r.Put })
+				res.Get = summarize(res.Runs, func(r Sample) OpStats { return r.Get })
+				r.Results = append(r.Results, res)
+			}
+		}
+		os.Remove(path)
+	}
+	return r, nil
+}
+
+// writePayload writes b to a temporary file and returns its path.
+func writePayload(b []byte) (string, error) {
+	f, err := os.CreateTemp("", "objectslite-bench-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// NewEnvironment describes the machine running the benchmark.
+func NewEnvironment() Environment {
+	host, _ := os.Hostname()
+	return Environment{
+		Time:      time.Now().UTC(),
+		Tool:      checkpoint.Tool(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		Hostname:  host,
+	}
+}
+
+func runCell(ctx context.Context, svc s3iface.S3API, opts Options, cell Cell, path string) Sample {
+	keys := make([]string, opts.Objects)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s%d-%d/%06d", opts.Prefix, cell.Size, cell.Concurrency, i)
+	}
+	upload := opts.Upload
+	upload.PartOrder = cell.PartOrder
+	var res Sample
+	res.Put = measure(ctx, opts.Objects, cell.Concurrency, func(i int) (int64, error) {
+		out, err := utils.Upload(ctx, svc, opts.Bucket, keys[i], path, upload)
+		if err != nil {
+			return 0, err
+		}
+		return out.Size, nil
+	})
+	res.Get = measure(ctx, opts.Objects, cell.Concurrency, func(i int) (int64, error) {
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(opts.Bucket),
+			Key:    aws.String(keys[i]),
+		})
+		if err != nil {
+			return 0, err
+		}
+		defer out.Body.Close()
+		return io.Copy(io.Discard, out.Body)
+	})
+	// Clean up even when the run was interrupted.
+	cleanupCtx := context.WithoutCancel(ctx)
+	utils.ForEach(cleanupCtx, len(keys), cell.Concurrency, func(i int) {
+		svc.DeleteObjectWithContext(cleanupCtx, &s3.DeleteObjectInput{
+			Bucket: aws.String(opts.Bucket),
+			Key:    aws.String(keys[i]),
+		})
+	})
+	return res
+}
+
+// measure runs op for n items on workers goroutines and summarises the
+// outcome.
+func measure(ctx context.Context, n, workers int, op func(i int) (int64, error)) OpStats {
+	var (
+		mu        sync.Mutex
+		stats     OpStats
+		latencies []time.Duration
+	)
+	start := time.Now()
+	utils.ForEach(ctx, n, workers, func(i int) {
+		opStart := time.Now()
+		size, err := op(i)
+		d := time.Since(opStart)
+		mu.Lock()
+		defer mu.Unlock()
+		stats.Ops++
+		if err != nil {
+			stats.Errors++
+			if stats.FirstError == "" {
+				stats.FirstError = err.Error()
+			}
+			return
+		}
+		stats.Bytes += size
+		latencies = append(latencies, d)
+	})
+	stats.Elapsed = time.Since(start)
+	if stats.Elapsed > 0 {
+		stats.Throughput = float64(stats.Bytes) / stats.Elapsed.Seconds()
+	}
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		stats.P50 = percentile(latencies, 50)
+		stats.P99 = percentile(latencies, 99)
+		stats.Max = latencies[len(latencies)-1]
+	}
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted by nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+// summarize aggregates the stats op selects from each run.
+func summarize(runs []Sample, op func(Sample) OpStats) Summary {
+	var throughput, p50, p99 []float64
+	var sum Summary
+	for _, r := range runs {
+		stats := op(r)
+		throughput = append(throughput, stats.Throughput)
+		p50 = append(p50, float64(stats.P50))
+		p99 = append(p99, float64(stats.P99))
+		sum.Errors += stats.Errors
+	}
+	sum.Throughput, sum.P50, sum.P99 = newStat(throughput), newStat(p50), newStat(p99)
+	return sum
+}
+
+// newStat computes the mean, sample standard deviation, minimum and
+// maximum of values.
+func newStat(values []float64) Stat {
+	if len(values) == 0 {
+		return Stat{}
+	}
+	s := Stat{Min: slices.Min(values), Max: slices.Max(values)}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(values))
+	if len(values) > 1 {
+		var sq float64
+		for _, v := range values {
+			sq += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(sq / float64(len(values)-1))
+	}
+	return s
+}
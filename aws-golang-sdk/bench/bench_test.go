@@ -0,0 +1,104 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+// failingGet fails every GET, as an endpoint that accepts writes but
+// cannot serve them does.
+type failingGet struct {
+	s3iface.S3API
+}
+
+func (failingGet) GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error) {
+	return nil, errors.New("read refused")
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		failGets   bool
+		wantErrors int
+	}{
+		{name: "healthy"},
+		{name: "failed GETs are counted", failGets: true, wantErrors: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			var svc s3iface.S3API = srv.Client(t)
+			if tt.failGets {
+				svc = failingGet{svc}
+			}
+			opts := Options{Bucket: "b", Sizes: []int64{1 << 10, 1 << 20}, Concurrency: []int{1, 2}, Objects: 3, Runs: 2, Warmup: 1}
+
+			r, err := Run(context.Background(), svc, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.Results) != 4 {
+				t.Fatalf("%d cells measured, want 4", len(r.Results))
+			}
+			for _, res := range r.Results {
+				if len(res.Runs) != 2 {
+					t.Fatalf("cell %+v has %d runs, want the 2 after warmup", res.Cell, len(res.Runs))
+				}
+				for _, run := range res.Runs {
+					if run.Put.Ops != 3 || run.Put.Errors != 0 || run.Put.Bytes != 3*res.Size {
+						t.Errorf("cell %+v PUT %+v, want 3 objects of %d bytes", res.Cell, run.Put, res.Size)
+					}
+					if run.Get.Errors != tt.wantErrors || (tt.wantErrors > 0) != (run.Get.FirstError != "") {
+						t.Errorf("cell %+v GET had %d errors (%q), want %d", res.Cell, run.Get.Errors, run.Get.FirstError, tt.wantErrors)
+					}
+				}
+				if res.Get.Errors != 2*tt.wantErrors {
+					t.Errorf("cell %+v summary counts %d GET errors, want %d", res.Cell, res.Get.Errors, 2*tt.wantErrors)
+				}
+			}
+			// Every cell deletes what it wrote.
+			objectslitetest.AssertKeys(t, srv, "b")
+
+			var table bytes.Buffer
+			if err := r.WriteTable(&table); err != nil {
+				t.Fatal(err)
+			}
+			if rows := strings.Count(table.String(), "\n"); rows != 3+1+1+4 {
+				t.Fatalf("table has %d lines, want a 3-line header, a blank line, column names and 4 rows:\n%s", rows, table.String())
+			}
+		})
+	}
+}
+
+func TestSoak(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	reports := 0
+	st := Soak(context.Background(), srv.Client(t), SoakOptions{
+		Bucket:         "b",
+		Size:           1024,
+		Rate:           100,
+		Concurrency:    4,
+		Duration:       300 * time.Millisecond,
+		ReportInterval: 50 * time.Millisecond,
+	}, func(SoakStats) { reports++ })
+	if st.Cycles == 0 || st.Errors != 0 {
+		t.Fatalf("%d cycles with %d errors (%s), want some and none failed", st.Cycles, st.Errors, st.LastError)
+	}
+	if reports == 0 {
+		t.Fatal("no stats reported during the soak")
+	}
+	objectslitetest.AssertKeys(t, srv, "b")
+}
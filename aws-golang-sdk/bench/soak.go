@@ -0,0 +1,150 @@
+package bench
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/canary"
+)
+
+// SoakOptions configures Soak.
+type SoakOptions struct {
+	Bucket string
+	Prefix string
+	// Size is the payload of each PUT/GET/verify/DELETE cycle.
+	Size int
+	// Rate is the number of cycles started per second.
+	Rate float64
+	// Concurrency caps the cycles in flight. A cycle due while the cap is
+	// reached is skipped and counted, so a slow endpoint shows up as a
+	// shortfall rather than an ever-growing backlog.
+	Concurrency int
+	// Duration ends the soak; zero runs until ctx is done.
+	Duration time.Duration
+	// ReportInterval is how often stats are reported.
+	ReportInterval time.Duration
+}
+
+// SoakStats is a snapshot of a soak. Counters are cumulative since the
+// start; the Interval fields cover the time since the previous report.
+type SoakStats struct {
+	Elapsed        time.Duration          `json:"elapsed_ns"`
+	Cycles         int64                  `json:"cycles"`
+	Errors         int64                  `json:"errors"`
+	ErrorRate      float64                `json:"error_rate"`
+	ErrorsByStage  map[canary.Stage]int64 `json:"errors_by_stage,omitempty"`
+	Skipped        int64                  `json:"skipped"`
+	IntervalCycles int64                  `json:"interval_cycles"`
+	IntervalErrors int64                  `json:"interval_errors"`
+	// MeanCycle is the mean duration of the cycles in the interval.
+	MeanCycle time.Duration `json:"mean_cycle_ns"`
+	// Memory of this process, to catch client-side leaks over hours.
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"num_gc"`
+	Goroutines int    `json:"goroutines"`
+	// LastError is the most recent failure, if any.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Soak runs canary cycles at opts.Rate until opts.Duration passes or ctx
+// is done, calling report every opts.ReportInterval, and returns the
+// final stats once in-flight cycles finish.
+func Soak(ctx context.Context, svc s3iface.S3API, opts SoakOptions, report func(SoakStats)) SoakStats {
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	cycle := canary.Options{Bucket: opts.Bucket, Prefix: opts.Prefix, Size: opts.Size}
+	s := &soak{start: time.Now(), stats: SoakStats{ErrorsByStage: map[canary.Stage]int64{}}}
+	slots := make(chan struct{}, max(opts.Concurrency, 1))
+	// Cycles run to completion after the soak ends, so none leave
+	// objects behind.
+	cycleCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+
+	tick := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+	defer tick.Stop()
+	reportTick := time.NewTicker(opts.ReportInterval)
+	defer reportTick.Stop()
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-reportTick.C:
+			report(s.snapshot())
+		case <-tick.C:
+			select {
+			case slots <- struct{}{}:
+			default:
+				s.skip()
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				s.observe(canary.RunCycle(cycleCtx, svc, cycle))
+			}()
+		}
+	}
+	wg.Wait()
+	return s.snapshot()
+}
+
+type soak struct {
+	mu        sync.Mutex
+	start     time.Time
+	stats     SoakStats
+	cycleTime time.Duration
+}
+
+func (s *soak) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Skipped++
+}
+
+func (s *soak) observe(r canary.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Cycles++
+	s.stats.IntervalCycles++
+	for _, d := range r.Durations {
+		s.cycleTime += d
+	}
+	if !r.OK() {
+		s.stats.Errors++
+		s.stats.IntervalErrors++
+		s.stats.ErrorsByStage[r.FailedStage]++
+		s.stats.LastError = r.Err.Error()
+	}
+}
+
+// snapshot returns the current stats and starts a new interval.
+func (s *soak) snapshot() SoakStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.ErrorsByStage = make(map[canary.Stage]int64, len(s.stats.ErrorsByStage))
+	for stage, n := range s.stats.ErrorsByStage {
+		st.ErrorsByStage[stage] = n
+	}
+	st.Elapsed = time.Since(s.start)
+	if st.Cycles > 0 {
+		st.ErrorRate = float64(st.Errors) / float64(st.Cycles)
+	}
+	if st.IntervalCycles > 0 {
+		st.MeanCycle = s.cycleTime / time.Duration(st.IntervalCycles)
+	}
+	st.HeapAlloc, st.Sys, st.NumGC = mem.HeapAlloc, mem.Sys, mem.NumGC
+	st.Goroutines = runtime.NumGoroutine()
+	s.stats.IntervalCycles, s.stats.IntervalErrors, s.cycleTime = 0, 0, 0
+	return st
+}
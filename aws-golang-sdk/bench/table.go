@@ -0,0 +1,55 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// WriteTable renders r as a header describing the environment and
+// settings followed by one row per cell.
+func (r *Report) WriteTable(w io.Writer) error {
+	e, s := r.Environment, r.Settings
+	fmt.Fprintf(w, "run:      %s by %s (%s, %s/%s, %d CPUs, host %s)\n",
+		e.Time.Format(time.RFC3339), e.Tool, e.GoVersion, e.OS, e.Arch, e.CPUs, e.Hostname)
+	fmt.Fprintf(w, "target:   %s s3://%s/%s (server %q)\n", e.Endpoint, s.Bucket, s.Prefix, e.Server)
+	fmt.Fprintf(w, "settings: %d objects per cell, %d runs after %d warmup, part size %s, %d parts in flight, multipart above %s",
+		s.Objects, s.Runs, s.Warmup, utils.FormatBytes(s.PartSize), s.PartConcurrency, utils.FormatBytes(s.MultipartThreshold))
+	if s.Checksum != "" {
+		fmt.Fprintf(w, ", checksum %s", s.Checksum)
+	}
+	fmt.Fprint(w, "\n\n")
+
+	// Throughput is shown as mean ±stddev [min–max] over the runs;
+	// latencies as their mean.
+	// The part order gets a column only when several are compared.
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	orders := len(s.PartOrders) > 1
+	if orders {
+		fmt.Fprint(tw, "ORDER\t")
+	}
+	fmt.Fprintln(tw, "SIZE\tCONC\tPUT/s\tPUT p50\tPUT p99\tGET/s\tGET p50\tGET p99\tERRORS\t")
+	for _, res := range r.Results {
+		if orders {
+			fmt.Fprintf(tw, "%s\t", res.PartOrder)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t\n",
+			utils.FormatBytes(res.Size), res.Concurrency,
+			rate(res.Put.Throughput), latency(res.Put.P50), latency(res.Put.P99),
+			rate(res.Get.Throughput), latency(res.Get.P50), latency(res.Get.P99),
+			res.Put.Errors+res.Get.Errors)
+	}
+	return tw.Flush()
+}
+
+func rate(s Stat) string {
+	return fmt.Sprintf("%s ±%s [%s–%s]", utils.FormatBytes(int64(s.Mean)), utils.FormatBytes(int64(s.Stddev)),
+		utils.FormatBytes(int64(s.Min)), utils.FormatBytes(int64(s.Max)))
+}
+
+func latency(s Stat) time.Duration {
+	return time.Duration(s.Mean).Round(time.Millisecond)
+}
@@ -0,0 +1,416 @@
+// Package bundle packs many small files into a few large tar objects, so
+// a directory of thousands of tiny files costs a handful of requests to
+// upload instead of one (or more) each. A bundle set under prefix
+// "logs/2024-05/" is stored as:
+//
+//	logs/2024-05/bundle-00000.tar
+//	logs/2024-05/bundle-00001.tar
+//	...
+//	logs/2024-05/index.json
+//
+// The bundles are ordinary tar archives, readable with any tar tool. The
+// index lists every member with the bundle holding it and the offset of
+// its data there, so one file is fetched with a single ranged GET rather
+// than by reading its bundle. It is written last, so a bundle set is
+// complete exactly when it has one.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DefaultBundleSize is the size at which a bundle is closed and the next
+// one started when Options.BundleSize is zero.
+const DefaultBundleSize int64 = 64 << 20
+
+// IndexName follows the prefix in the key of a bundle set's index.
+const IndexName = "index.json"
+
+// blockSize is the tar block size: headers take one block and member data
+// is padded to a whole number of blocks.
+const blockSize = 512
+
+// Options configures Create.
+type Options struct {
+	Bucket string
+	// Prefix holds the bundles and the index.
+	Prefix string
+	// Dir is the directory bundled.
+	Dir string
+	// BundleSize is the approximate size of each bundle; a file larger
+	// than it gets a bundle of its own.
+	BundleSize int64
+	// Concurrency is the number of bundles built and uploaded at once.
+	Concurrency int
+	Upload      utils.UploadOptions
+}
+
+func (o *Options) setDefaults() {
+	if o.BundleSize <= 0 {
+		o.BundleSize = DefaultBundleSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = utils.DefaultConcurrency
+	}
+}
+
+// Bundle is one tar object of a bundle set.
+type Bundle struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+// Member is one file stored in a bundle.
+type Member struct {
+	// Name is the file's slash-separated path relative to the bundled
+	// directory, and its name in the tar archive.
+	Name string `json:"name"`
+	// Bundle indexes Index.Bundles.
+	Bundle int `json:"bundle"`
+	// Offset is the position of the file's data in the bundle, after its
+	// tar header.
+	Offset  int64     `json:"offset"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// Index describes a complete bundle set.
+type Index struct {
+	Created time.Time `json:"created"`
+	Bundles []Bundle  `json:"bundles"`
+	// Members is sorted by name.
+	Members []Member `json:"members"`
+}
+
+// Member returns the member with the given name.
+func (idx *Index) Member(name string) (Member, bool) {
+	i := sort.Search(len(idx.Members), func(i int) bool { return idx.Members[i].Name >= name })
+	if i < len(idx.Members) && idx.Members[i].Name == name {
+		return idx.Members[i], true
+	}
+	return Member{}, false
+}
+
+// IndexKey returns the key of the index of the bundle set under prefix.
+func IndexKey(prefix string) string {
+	return prefix + IndexName
+}
+
+// bundleKey returns the key of the i'th bundle under prefix.
+func bundleKey(prefix string, i int) string {
+	return fmt.Sprintf("%sbundle-%05d.tar", prefix, i)
+}
+
+// tarSize returns the space a regular file of size bytes with a short name
+// takes in a tar archive. Long names add PAX records, so this is an
+// estimate, which is all bundle sizing needs.
+func tarSize(size int64) int64 {
+	return blockSize + (size+blockSize-1)/blockSize*blockSize
+}
+
+// Create packs the files under opts.Dir into bundles of about
+// opts.BundleSize, in name order, uploads up to opts.Concurrency of them
+// at once, and then writes the index. Each bundle is built in a temporary
+// file so it can be uploaded with the usual part retries.
+func Create(ctx context.Context, svc s3iface.S3API, opts Options) (*Index, error) {
+	opts.setDefaults()
+	entries, err := manifest.FromDir(ctx, opts.Dir, manifest.SHA256, opts.Concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", opts.Dir, err)
+	}
+	idx := &Index{Created: time.Now().UTC().Truncate(time.Second)}
+	var groups [][]int
+	var size int64
+	for i, e := range entries {
+		if len(groups) == 0 || size+tarSize(aws.Int64Value(e.Size)) > opts.BundleSize && size > 0 {
+			groups = append(groups, nil)
+			size = 0
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], i)
+		size += tarSize(aws.Int64Value(e.Size))
+	}
+	idx.Bundles = make([]Bundle, len(groups))
+	members := make([][]Member, len(groups))
+	errs := utils.ForEachErr(ctx, len(groups), opts.Concurrency, false, func(b int) error {
+		var group []manifest.Entry
+		for _, i := range groups[b] {
+			group = append(group, entries[i])
+		}
+		var err error
+		idx.Bundles[b], members[b], err = upload(ctx, svc, opts, b, group)
+		return err
+	})
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, utils.ErrSkipped) {
+			return nil, err
+		}
+	}
+	for _, m := range members {
+		idx.Members = append(idx.Members, m...)
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(opts.Bucket),
+		Key:         aws.String(IndexKey(opts.Prefix)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("write index: %w", err)
+	}
+	return idx, nil
+}
+
+// upload builds bundle number b from the files of group and uploads it.
+func upload(ctx context.Context, svc s3iface.S3API, opts Options, b int, group []manifest.Entry) (Bundle, []Member, error) {
+	tmp, err := os.CreateTemp("", "bundle-*.tar")
+	if err != nil {
+		return Bundle{}, nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	out := &countingWriter{w: tmp}
+	tw := tar.NewWriter(out)
+	members := make([]Member, len(group))
+	for i, e := range group {
+		if members[i], err = add(tw, out, opts.Dir, e); err != nil {
+			return Bundle{}, nil, err
+		}
+		members[i].Bundle = b
+	}
+	if err := tw.Close(); err != nil {
+		return Bundle{}, nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Bundle{}, nil, err
+	}
+
+	key := bundleKey(opts.Prefix, b)
+	res, err := utils.Upload(ctx, svc, opts.Bucket, key, tmp.Name(), opts.Upload)
+	if err != nil {
+		return Bundle{}, nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return Bundle{Key: key, Size: out.n, ETag: res.ETag}, members, nil
+}
+
+// add writes the file of e to tw. WriteHeader flushes the previous
+// member's padding and writes the header, so the bytes counted by out
+// right after it are the offset of this member's data.
+func add(tw *tar.Writer, out *countingWriter, dir string, e manifest.Entry) (Member, error) {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(e.Key)))
+	if err != nil {
+		return Member{}, err
+	}
+	defer f.Close()
+	size := aws.Int64Value(e.Size)
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.Key,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  e.LastModified.Round(time.Second),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return Member{}, fmt.Errorf("%s: %w", e.Key, err)
+	}
+	m := Member{Name: e.Key, Offset: out.n, Size: size, ModTime: hdr.ModTime, SHA256: e.SHA256}
+	// A file that changed size since it was scanned would corrupt the
+	// archive; tar.Writer refuses to write more than the header says, and
+	// CopyN reports a short file.
+	if _, err := io.CopyN(tw, f, size); err != nil {
+		return Member{}, fmt.Errorf("%s: %w", e.Key, err)
+	}
+	return m, nil
+}
+
+// ReadIndex fetches and parses the index of the bundle set under prefix.
+func ReadIndex(ctx context.Context, svc s3iface.S3API, bucket, prefix string) (*Index, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(IndexKey(prefix)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+	defer out.Body.Close()
+	var idx Index
+	if err := json.NewDecoder(out.Body).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+	return &idx, nil
+}
+
+// Extract downloads every bundle of the set under prefix, up to
+// concurrency at once, and unpacks the members into dir. Each bundle is
+// read as a stream; nothing is staged on disk but the files themselves.
+// It returns the number of files and bytes written.
+func Extract(ctx context.Context, svc s3iface.S3API, bucket, prefix, dir string, concurrency int) (int, int64, error) {
+	idx, err := ReadIndex(ctx, svc, bucket, prefix)
+	if err != nil {
+		return 0, 0, err
+	}
+	files := make([]int, len(idx.Bundles))
+	sizes := make([]int64, len(idx.Bundles))
+	errs := utils.ForEachErr(ctx, len(idx.Bundles), concurrency, false, func(b int) error {
+		var err error
+		files[b], sizes[b], err = extractBundle(ctx, svc, bucket, idx.Bundles[b], dir)
+		return err
+	})
+	var n int
+	var total int64
+	for b, err := range errs {
+		if err != nil && !errors.Is(err, utils.ErrSkipped) {
+			return n, total, err
+		}
+		n += files[b]
+		total += sizes[b]
+	}
+	return n, total, nil
+}
+
+func extractBundle(ctx context.Context, svc s3iface.S3API, bucket string, b Bundle, dir string) (int, int64, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(b.Key),
+		IfMatch: aws.String(b.ETag),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("get %s: %w", b.Key, err)
+	}
+	defer out.Body.Close()
+	var files int
+	var total int64
+	tr := tar.NewReader(out.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, total, nil
+		}
+		if err != nil {
+			return files, total, fmt.Errorf("%s: %w", b.Key, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		path, err := downloads.LocalPath(dir, hdr.Name)
+		if err != nil {
+			return files, total, fmt.Errorf("%s: %w", b.Key, err)
+		}
+		n, err := writeFile(path, tr, hdr.ModTime)
+		if err != nil {
+			return files, total, fmt.Errorf("%s: %s: %w", b.Key, hdr.Name, err)
+		}
+		files++
+		total += n
+	}
+}
+
+// writeFile writes r to path and sets its modification time.
+func writeFile(path string, r io.Reader, modTime time.Time) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Chtimes(path, modTime, modTime)
+}
+
+// ExtractFile writes the member named name of the bundle set under prefix
+// to w. It costs two requests, for the index and the member; callers
+// fetching several members should ReadIndex once and call GetMember.
+func ExtractFile(ctx context.Context, svc s3iface.S3API, bucket, prefix, name string, w io.Writer) (int64, error) {
+	idx, err := ReadIndex(ctx, svc, bucket, prefix)
+	if err != nil {
+		return 0, err
+	}
+	m, ok := idx.Member(name)
+	if !ok {
+		return 0, fmt.Errorf("%s is not in the bundle set at %s", name, prefix)
+	}
+	return GetMember(ctx, svc, bucket, idx, m, w)
+}
+
+// GetMember writes member m of the bundle set described by idx to w,
+// fetching just its bytes with a ranged GET at the offset the index
+// records. The range is requested with If-Match on the bundle's ETag, so
+// a bundle rewritten since the index was read fails instead of returning
+// bytes from the wrong place, and the data is checked against the
+// member's SHA-256; a mismatch matches downloads.ErrChecksumMismatch.
+func GetMember(ctx context.Context, svc s3iface.S3API, bucket string, idx *Index, m Member, w io.Writer) (int64, error) {
+	if m.Bundle < 0 || m.Bundle >= len(idx.Bundles) {
+		return 0, fmt.Errorf("%s: bundle %d is not in the index", m.Name, m.Bundle)
+	}
+	h := sha256.New()
+	if m.Size > 0 {
+		b := idx.Bundles[m.Bundle]
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(b.Key),
+			Range:   aws.String(fmt.Sprintf("bytes=%d-%d", m.Offset, m.Offset+m.Size-1)),
+			IfMatch: aws.String(b.ETag),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("get %s from %s: %w", m.Name, b.Key, err)
+		}
+		defer out.Body.Close()
+		n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(out.Body, m.Size))
+		if err == nil && n != m.Size {
+			err = fmt.Errorf("got %d of %d bytes", n, m.Size)
+		}
+		if err != nil {
+			return n, fmt.Errorf("get %s from %s: %w", m.Name, b.Key, err)
+		}
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); m.SHA256 != "" && got != m.SHA256 {
+		return m.Size, fmt.Errorf("get %s: %w", m.Name, &downloads.ChecksumError{Key: m.Name, Source: "index sha256", Want: m.SHA256, Got: got})
+	}
+	return m.Size, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
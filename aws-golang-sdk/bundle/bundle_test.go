@@ -0,0 +1,89 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+var files = map[string]int64{"a": 100, "b": 3000, "c/empty": 0, "c/d": 700, "large": 10000}
+
+func TestCreateExtract(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	dir := objectslitetest.TempTree(t, files)
+
+	idx, err := Create(ctx, client, Options{Bucket: "b", Prefix: "set/", Dir: dir, BundleSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// In name order with tar overhead: [a] [b] [c/d c/empty] [large].
+	if len(idx.Bundles) != 4 || len(idx.Members) != len(files) {
+		t.Fatalf("%d bundles of %d members, want 4 of %d", len(idx.Bundles), len(idx.Members), len(files))
+	}
+	objectslitetest.AssertKeys(t, srv, "b", "set/bundle-00000.tar", "set/bundle-00001.tar",
+		"set/bundle-00002.tar", "set/bundle-00003.tar", "set/index.json")
+
+	for name := range files {
+		var buf bytes.Buffer
+		if _, err := ExtractFile(ctx, client, "b", "set/", name, &buf); err != nil {
+			t.Fatal(err)
+		}
+		want, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("extracted %d bytes of %s, want %d", buf.Len(), name, len(want))
+		}
+	}
+	if _, err := ExtractFile(ctx, client, "b", "set/", "nope", new(bytes.Buffer)); err == nil {
+		t.Fatal("extracted a file that is not in the set")
+	}
+
+	out := t.TempDir()
+	n, size, err := Extract(ctx, client, "b", "set/", out, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(files) || size != 100+3000+700+10000 {
+		t.Fatalf("extracted %d files of %d bytes", n, size)
+	}
+	for name := range files {
+		want, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%s differs after extraction (%v)", name, err)
+		}
+	}
+}
+
+func TestGetMemberVerifies(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	dir := objectslitetest.TempTree(t, files)
+	idx, err := Create(ctx, client, Options{Bucket: "b", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := idx.Member("b")
+
+	bad := m
+	bad.SHA256 = m.SHA256[1:] + m.SHA256[:1]
+	if _, err := GetMember(ctx, client, "b", idx, bad, new(bytes.Buffer)); !errors.Is(err, downloads.ErrChecksumMismatch) {
+		t.Fatalf("member with a wrong checksum returned %v, want ErrChecksumMismatch", err)
+	}
+
+	// A bundle rewritten after the index was read is refused.
+	srv.PutObject("b", idx.Bundles[0].Key, objectslitetest.Data(idx.Bundles[0].Size))
+	if _, err := GetMember(ctx, client, "b", idx, m, new(bytes.Buffer)); err == nil {
+		t.Fatal("read a member from a rewritten bundle")
+	}
+}
@@ -0,0 +1,160 @@
+// Package canary exercises an Objectslite bucket with a tiny
+// PUT/GET/DELETE cycle so operators can watch service health from a
+// client's point of view.
+package canary
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Stage names a step of the canary cycle.
+type Stage string
+
+const (
+	StagePut    Stage = "put"
+	StageGet    Stage = "get"
+	StageVerify Stage = "verify"
+	StageDelete Stage = "delete"
+)
+
+// Stages lists the cycle steps in execution order.
+var Stages = []Stage{StagePut, StageGet, StageVerify, StageDelete}
+
+// CleanupTimeout bounds the delete that ends every cycle. The delete runs
+// even once the cycle's context is cancelled, so an interrupted canary
+// does not leave its object behind.
+const CleanupTimeout = 30 * time.Second
+
+// Options configures a canary run.
+type Options struct {
+	Bucket string
+	// Prefix is prepended to every canary key.
+	Prefix string
+	// Size is the payload size in bytes.
+	Size int
+	// Interval is the delay between the start of consecutive cycles.
+	Interval time.Duration
+	// Count stops the run after this many cycles; zero runs until the
+	// context is cancelled.
+	Count int
+}
+
+// Result describes one completed cycle.
+type Result struct {
+	Start     time.Time
+	Key       string
+	Durations map[Stage]time.Duration
+	// FailedStage is empty when the cycle succeeded.
+	FailedStage Stage
+	Err         error
+}
+
+// OK reports whether every stage of the cycle succeeded.
+func (r Result) OK() bool { return r.Err == nil }
+
+// seq keeps keys unique when cycles run concurrently.
+var seq atomic.Int64
+
+// RunCycle writes a random payload, reads it back, verifies it and
+// deletes it. The object is deleted even if the read or verification
+// fails, or ctx is cancelled after the write, so a failing canary does
+// not leave garbage behind.
+func RunCycle(ctx context.Context, svc s3iface.S3API, opts Options) Result {
+	res := Result{
+		Start:     time.Now(),
+		Key:       fmt.Sprintf("%scanary-%d-%d", opts.Prefix, time.Now().UnixNano(), seq.Add(1)),
+		Durations: make(map[Stage]time.Duration),
+	}
+	fail := func(stage Stage, err error) Result {
+		if res.Err == nil {
+			res.FailedStage, res.Err = stage, err
+		}
+		return res
+	}
+
+	payload := make([]byte, opts.Size)
+	if _, err := rand.Read(payload); err != nil {
+		return fail(StagePut, err)
+	}
+
+	start := time.Now()
+	_, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(res.Key),
+		Body:   bytes.NewReader(payload),
+	})
+	res.Durations[StagePut] = time.Since(start)
+	if err != nil {
+		return fail(StagePut, err)
+	}
+
+	start = time.Now()
+	got, err := getObject(ctx, svc, opts.Bucket, res.Key)
+	res.Durations[StageGet] = time.Since(start)
+	if err != nil {
+		fail(StageGet, err)
+	} else {
+		start = time.Now()
+		if !bytes.Equal(got, payload) {
+			fail(StageVerify, fmt.Errorf("read back %d bytes that do not match the %d bytes written", len(got), len(payload)))
+		}
+		res.Durations[StageVerify] = time.Since(start)
+	}
+
+	start = time.Now()
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), CleanupTimeout)
+	defer cancel()
+	_, err = svc.DeleteObjectWithContext(cleanupCtx, &s3.DeleteObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(res.Key),
+	})
+	res.Durations[StageDelete] = time.Since(start)
+	if err != nil {
+		return fail(StageDelete, err)
+	}
+	return res
+}
+
+func getObject(ctx context.Context, svc s3iface.S3API, bucket, key string) ([]byte, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// Run executes cycles every opts.Interval until ctx is cancelled or
+// opts.Count cycles have completed, passing each result to report.
+// opts.Interval must be positive.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options, report func(Result)) error {
+	if opts.Interval <= 0 {
+		return fmt.Errorf("canary interval must be positive, got %s", opts.Interval)
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for n := 0; opts.Count == 0 || n < opts.Count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		report(RunCycle(ctx, svc, opts))
+	}
+	return nil
+}
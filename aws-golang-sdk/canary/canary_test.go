@@ -0,0 +1,80 @@
+package canary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+// cancellingGet cancels the cycle's context when the object is read back,
+// as an operator interrupting the canary mid-cycle does.
+type cancellingGet struct {
+	s3iface.S3API
+	cancel context.CancelFunc
+}
+
+func (c *cancellingGet) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	c.cancel()
+	return nil, ctx.Err()
+}
+
+func TestRunCycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		cancel    bool
+		wantStage Stage
+	}{
+		{name: "healthy"},
+		{name: "cancelled after the write", cancel: true, wantStage: StageGet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var svc s3iface.S3API = srv.Client(t)
+			if tt.cancel {
+				svc = &cancellingGet{S3API: svc, cancel: cancel}
+			}
+
+			r := RunCycle(ctx, svc, Options{Bucket: "b", Prefix: "canary/", Size: 1024})
+			if r.FailedStage != tt.wantStage {
+				t.Fatalf("failed at %q (%v), want %q", r.FailedStage, r.Err, tt.wantStage)
+			}
+			// The object is deleted either way.
+			objectslitetest.AssertKeys(t, srv, "b")
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	var results []Result
+	err := Run(context.Background(), srv.Client(t), Options{Bucket: "b", Size: 16, Interval: time.Millisecond, Count: 3}, func(r Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("%d cycles run, want 3", len(results))
+	}
+	for _, r := range results {
+		if !r.OK() {
+			t.Errorf("cycle %s failed at %s: %v", r.Key, r.FailedStage, r.Err)
+		}
+	}
+
+	if err := Run(context.Background(), srv.Client(t), Options{Bucket: "b", Count: 1}, func(Result) {}); err == nil {
+		t.Fatal("Run accepted a zero interval")
+	}
+}
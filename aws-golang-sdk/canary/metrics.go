@@ -0,0 +1,86 @@
+package canary
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Metrics accumulates canary results and exposes them in the Prometheus
+// text exposition format.
+type Metrics struct {
+	mu          sync.Mutex
+	cycles      uint64
+	failures    map[Stage]uint64
+	lastSeconds map[Stage]float64
+	lastSuccess time.Time
+}
+
+// NewMetrics returns an empty metrics set.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		failures:    make(map[Stage]uint64),
+		lastSeconds: make(map[Stage]float64),
+	}
+}
+
+// Observe records a cycle result.
+func (m *Metrics) Observe(r Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cycles++
+	for stage, d := range r.Durations {
+		m.lastSeconds[stage] = d.Seconds()
+	}
+	if r.OK() {
+		m.lastSuccess = r.Start
+	} else {
+		m.failures[r.FailedStage]++
+	}
+}
+
+// WriteTo writes the metrics in Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countingWriter{w: w}
+	fmt.Fprintln(cw, "# TYPE objectslite_canary_cycles_total counter")
+	fmt.Fprintf(cw, "objectslite_canary_cycles_total %d\n", m.cycles)
+	fmt.Fprintln(cw, "# TYPE objectslite_canary_failures_total counter")
+	for _, stage := range Stages {
+		fmt.Fprintf(cw, "objectslite_canary_failures_total{stage=%q} %d\n", stage, m.failures[stage])
+	}
+	fmt.Fprintln(cw, "# TYPE objectslite_canary_stage_duration_seconds gauge")
+	for _, stage := range Stages {
+		fmt.Fprintf(cw, "objectslite_canary_stage_duration_seconds{stage=%q} %g\n", stage, m.lastSeconds[stage])
+	}
+	if !m.lastSuccess.IsZero() {
+		fmt.Fprintln(cw, "# TYPE objectslite_canary_last_success_timestamp_seconds gauge")
+		fmt.Fprintf(cw, "objectslite_canary_last_success_timestamp_seconds %d\n", m.lastSuccess.Unix())
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics, typically on /metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
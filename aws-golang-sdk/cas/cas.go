@@ -0,0 +1,196 @@
+// Package cas stores files by content. The data of each file goes to an
+// object named by its SHA-256 under a shared prefix, "cas/<sha256>" by
+// default, and the file's logical name holds a small pointer object
+// naming that content:
+//
+//	{"object": "cas/9f86d0...", "size": 1048576, "sha256": "9f86d0..."}
+//
+// Content already in the store is not sent again, so uploading a tree
+// that is mostly the same as an earlier one, such as the next night's
+// backup, costs a pointer per unchanged file. Content objects are shared
+// between names and are never deleted by this package; removing a
+// pointer leaves its content in place.
+package cas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+const (
+	// DefaultPrefix holds the content objects when Options.Prefix is
+	// empty.
+	DefaultPrefix = "cas/"
+	// PointerContentType is the Content-Type of pointer objects.
+	PointerContentType = "application/vnd.objectslite.cas-pointer+json"
+	// metaObject is the user metadata of a pointer naming its content
+	// object, so it shows up in a HeadObject.
+	metaObject = "cas-object"
+	// maxPointerSize bounds what Resolve reads; real pointers are a few
+	// hundred bytes.
+	maxPointerSize = 64 << 10
+)
+
+// ErrNotPointer is matched, with errors.Is, by the error of Resolve for
+// an object that is not a pointer.
+var ErrNotPointer = errors.New("not a content-addressed pointer")
+
+// Pointer is the content of a pointer object.
+type Pointer struct {
+	// Object is the key of the content object.
+	Object string `json:"object"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Options configures content-addressed uploads. Zero values select the
+// defaults.
+type Options struct {
+	// Prefix holds the content objects.
+	Prefix string
+	// Upload tunes the upload of content objects.
+	Upload utils.UploadOptions
+	// Concurrency is the number of files UploadDir handles at once.
+	Concurrency int
+}
+
+func (o *Options) setDefaults() {
+	if o.Prefix == "" {
+		o.Prefix = DefaultPrefix
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = utils.DefaultConcurrency
+	}
+}
+
+// Result is the outcome of storing one file.
+type Result struct {
+	// Name is the key of the pointer.
+	Name    string
+	Pointer Pointer
+	// Stored is set when the content was uploaded; otherwise it was
+	// already in the store and only the pointer was written.
+	Stored bool
+	Err    error
+}
+
+// ContentKey returns the key of the content with the hex SHA-256 sum
+// under prefix.
+func ContentKey(prefix, sum string) string {
+	return prefix + strings.ToLower(sum)
+}
+
+// Upload stores the file at path under its content key, unless the store
+// already has it, and writes a pointer to it at name.
+func Upload(ctx context.Context, svc s3iface.S3API, bucket, name, path string, opts Options) (Result, error) {
+	opts.setDefaults()
+	size, err := utils.PathSize(path)
+	if err != nil {
+		return Result{Name: name}, err
+	}
+	sum, err := manifest.HashFile(path, manifest.SHA256)
+	if err != nil {
+		return Result{Name: name}, err
+	}
+	return put(ctx, svc, bucket, name, path, size, sum, opts)
+}
+
+// UploadDir stores every regular file under dir as Upload does, with its
+// pointer at namePrefix followed by the file's slash-separated path
+// relative to dir. report is called with the result of each file, from
+// several goroutines at once. A failed file does not stop the others.
+func UploadDir(ctx context.Context, svc s3iface.S3API, bucket, namePrefix, dir string, opts Options, report func(Result)) error {
+	opts.setDefaults()
+	entries, err := manifest.FromDir(ctx, dir, manifest.SHA256, opts.Concurrency)
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", dir, err)
+	}
+	utils.ForEach(ctx, len(entries), opts.Concurrency, func(i int) {
+		e := entries[i]
+		path := filepath.Join(dir, filepath.FromSlash(e.Key))
+		r, err := put(ctx, svc, bucket, namePrefix+e.Key, path, aws.Int64Value(e.Size), e.SHA256, opts)
+		r.Err = err
+		report(r)
+	})
+	return ctx.Err()
+}
+
+func put(ctx context.Context, svc s3iface.S3API, bucket, name, path string, size int64, sum string, opts Options) (Result, error) {
+	p := Pointer{Object: ContentKey(opts.Prefix, sum), Size: size, SHA256: sum}
+	r := Result{Name: name, Pointer: p}
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(p.Object)})
+	switch {
+	case err == nil && utils.MetadataValue(head.Metadata, utils.MetaSHA256) == sum:
+	case err == nil || utils.IsNotFound(err):
+		// An object without the hash, or with another one, under a
+		// content key was not written by a complete upload; replace it.
+		upload := opts.Upload
+		upload.Metadata = maps.Clone(upload.Metadata)
+		if upload.Metadata == nil {
+			upload.Metadata = make(map[string]*string)
+		}
+		upload.Metadata[utils.MetaSHA256] = aws.String(sum)
+		if _, err := utils.Upload(ctx, svc, bucket, p.Object, path, upload); err != nil {
+			return r, fmt.Errorf("store %s: %w", name, err)
+		}
+		r.Stored = true
+	default:
+		return r, fmt.Errorf("head %s: %w", p.Object, err)
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return r, err
+	}
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(name),
+		Body:        bytes.NewReader(append(body, '\n')),
+		ContentType: aws.String(PointerContentType),
+		Metadata:    map[string]*string{metaObject: aws.String(p.Object)},
+	})
+	if err != nil {
+		return r, fmt.Errorf("write pointer %s: %w", name, err)
+	}
+	return r, nil
+}
+
+// Resolve reads the pointer at name.
+func Resolve(ctx context.Context, svc s3iface.S3API, bucket, name string) (Pointer, error) {
+	b, err := downloads.GetObjectBytesLimited(ctx, svc, bucket, name, maxPointerSize)
+	if errors.Is(err, downloads.ErrObjectTooLarge) {
+		return Pointer{}, fmt.Errorf("%s: %w", name, ErrNotPointer)
+	}
+	if err != nil {
+		return Pointer{}, err
+	}
+	var p Pointer
+	if json.Unmarshal(b, &p) != nil || p.Object == "" {
+		return Pointer{}, fmt.Errorf("%s: %w", name, ErrNotPointer)
+	}
+	return p, nil
+}
+
+// Download writes the content the pointer at name refers to to path, and
+// checks it against the content's SHA-256 as downloads.DownloadFile does.
+func Download(ctx context.Context, svc s3iface.S3API, bucket, name, path string) (int64, error) {
+	p, err := Resolve(ctx, svc, bucket, name)
+	if err != nil {
+		return 0, err
+	}
+	return downloads.DownloadFile(ctx, svc, bucket, p.Object, path)
+}
@@ -0,0 +1,106 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestUploadDirDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	// Files of the same size hold the same bytes, so a and copy/a share
+	// their content.
+	dir := objectslitetest.TempTree(t, map[string]int64{"a": 1000, "copy/a": 1000, "b": 3 << 20})
+
+	run := func() map[string]Result {
+		t.Helper()
+		var mu sync.Mutex
+		results := map[string]Result{}
+		err := UploadDir(ctx, client, "b", "names/", dir, Options{}, func(r Result) {
+			mu.Lock()
+			results[r.Name] = r
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, r := range results {
+			if r.Err != nil {
+				t.Fatalf("%s: %v", name, r.Err)
+			}
+		}
+		return results
+	}
+	first := run()
+	if len(first) != 3 || first["names/a"].Pointer != first["names/copy/a"].Pointer {
+		t.Fatalf("first run: %+v", first)
+	}
+	// a and copy/a are uploaded at once, so either or both may store it.
+	if !first["names/a"].Stored && !first["names/copy/a"].Stored || !first["names/b"].Stored {
+		t.Fatalf("content not stored on the first run: %+v", first)
+	}
+	if len(srv.Keys("b")) != 5 {
+		t.Fatalf("bucket holds %v, want 3 pointers and 2 content objects", srv.Keys("b"))
+	}
+	for name, r := range run() {
+		if r.Stored {
+			t.Fatalf("second run stored the content of %s again", name)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "b")
+	if _, err := Download(ctx, client, "b", "names/b", out); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(filepath.Join(dir, "b"))
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, want) {
+		t.Fatal("downloaded content differs from the file")
+	}
+}
+
+func TestUploadReplacesPartialContent(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	path := objectslitetest.TempFile(t, 500)
+	sum, err := manifest.HashFile(path, manifest.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Left by an interrupted upload: the content key, without the hash.
+	srv.PutObject("b", ContentKey(DefaultPrefix, sum), []byte("partial"))
+
+	r, err := Upload(ctx, client, "b", "name", path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Stored {
+		t.Fatal("partial content kept")
+	}
+	objectslitetest.AssertObjectMatchesFile(t, srv, "b", r.Pointer.Object, path)
+	if p, err := Resolve(ctx, client, "b", "name"); err != nil || p != r.Pointer {
+		t.Fatalf("resolved %+v (%v), want %+v", p, err, r.Pointer)
+	}
+}
+
+func TestResolveNotPointer(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.PutObject("b", "plain", []byte("just a file"))
+	srv.PutObject("b", "large", objectslitetest.Data(maxPointerSize+1))
+	for _, name := range []string{"plain", "large"} {
+		if _, err := Resolve(context.Background(), srv.Client(t), "b", name); !errors.Is(err, ErrNotPointer) {
+			t.Errorf("resolve %s: %v, want ErrNotPointer", name, err)
+		}
+	}
+}
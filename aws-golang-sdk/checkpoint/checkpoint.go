@@ -0,0 +1,289 @@
+// Package checkpoint defines the on-disk record of a multipart upload in
+// progress: which file it reads, which UploadId it writes to, how the file
+// is split into parts and which parts the server already holds. Upload
+// plans, resume and crash recovery all read and write this one format.
+//
+// A checkpoint is a single JSON object:
+//
+//	{
+//	  "version": 2,
+//	  "tool": "github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk@v0.3.0",
+//	  "bucket": "backups",
+//	  "key": "db/2024-05-01.tar",
+//	  "upload_id": "2~abc...",
+//	  "file": {"path": "/data/db.tar", "size": 26214400, "mod_time": "2024-05-01T02:00:00Z"},
+//	  "part_size": 8388608,
+//	  "parts": [
+//	    {"number": 1, "offset": 0, "size": 8388608, "md5": "1B2M2Y8AsgTpgAmY7PhCfg==", "etag": "d41d8cd98f00b204e9800998ecf8427e"},
+//	    ...
+//	  ]
+//	}
+//
+// Parts are listed in number order, starting at 1, and always cover the
+// whole file. "md5" is the base64 Content-MD5 of the part, when it was
+// computed up front; "etag" is present once the server has acknowledged
+// the part. Readers accept every earlier version and migrate it to the
+// current one; files written by a newer version are rejected rather than
+// guessed at. With a Key, the same JSON is stored encrypted (see Key).
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Version is the checkpoint format version written by this package.
+//
+//	1  upload plan files: size and mod_time at the top level, no tool or
+//	   per-part ETags
+//	2  adds tool, groups the file fingerprint under "file" and records the
+//	   ETag of each uploaded part
+const Version = 2
+
+// Checkpoint is the serialised state of one multipart upload.
+type Checkpoint struct {
+	Version  int         `json:"version"`
+	Tool     string      `json:"tool"`
+	Bucket   string      `json:"bucket"`
+	Key      string      `json:"key"`
+	UploadID string      `json:"upload_id,omitempty"`
+	File     Fingerprint `json:"file"`
+	PartSize int64       `json:"part_size"`
+	Parts    []Part      `json:"parts"`
+}
+
+// Fingerprint identifies the local file a checkpoint was made from.
+type Fingerprint struct {
+	Path    string    `json:"path,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Part is one part of the upload.
+type Part struct {
+	Number int64 `json:"number"`
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// MD5 is the base64 MD5 of the part, sent as Content-MD5 so the server
+	// rejects data that differs from what was checkpointed.
+	MD5 string `json:"md5,omitempty"`
+	// ETag is set once the part has been uploaded.
+	ETag string `json:"etag,omitempty"`
+}
+
+// Tool identifies the code writing checkpoints, for diagnosing files
+// written by other builds.
+func Tool() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	return info.Main.Path + "@" + info.Main.Version
+}
+
+// FingerprintFile records the path, size and modification time of a file
+// or block device.
+func FingerprintFile(path string) (Fingerprint, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	size, err := utils.PathSize(path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	return Fingerprint{Path: path, Size: size, ModTime: info.ModTime().UTC()}, nil
+}
+
+// Check verifies that the file at path still has the fingerprinted size
+// and modification time. The path itself may differ, so a checkpoint can
+// be used on another host holding a copy of the file.
+func (f Fingerprint) Check(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	size, err := utils.PathSize(path)
+	if err != nil {
+		return err
+	}
+	if size != f.Size {
+		return fmt.Errorf("%s is %d bytes, checkpoint expects %d", path, size, f.Size)
+	}
+	if !info.ModTime().Equal(f.ModTime) {
+		return fmt.Errorf("%s was modified at %s, checkpoint expects %s", path, info.ModTime().UTC(), f.ModTime)
+	}
+	return nil
+}
+
+// Record marks part number as uploaded with the given ETag.
+func (c *Checkpoint) Record(number int64, etag string) error {
+	if number < 1 || number > int64(len(c.Parts)) {
+		return fmt.Errorf("part %d is outside the checkpoint (1-%d)", number, len(c.Parts))
+	}
+	c.Parts[number-1].ETag = etag
+	return nil
+}
+
+// Pending returns the parts without a recorded ETag.
+func (c *Checkpoint) Pending() []Part {
+	var pending []Part
+	for _, p := range c.Parts {
+		if p.ETag == "" {
+			pending = append(pending, p)
+		}
+	}
+	return pending
+}
+
+// Read loads a checkpoint, migrating older versions to the current one.
+// An encrypted checkpoint is decrypted with key.
+func Read(path string, key *Key) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = key.open(b); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	c, err := Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Decode parses a serialised checkpoint of any supported version.
+func Decode(b []byte) (*Checkpoint, error) {
+	var header struct {
+		Version int    `json:"version"`
+		Tool    string `json:"tool"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, err
+	}
+	switch {
+	case header.Version == Version:
+		var c Checkpoint
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	case header.Version == 1:
+		return migrateV1(b)
+	case header.Version > Version:
+		return nil, fmt.Errorf("version %d was written by %s; this build reads up to version %d", header.Version, header.Tool, Version)
+	default:
+		return nil, fmt.Errorf("unknown version %d", header.Version)
+	}
+}
+
+func migrateV1(b []byte) (*Checkpoint, error) {
+	var v1 struct {
+		Bucket   string    `json:"bucket"`
+		Key      string    `json:"key"`
+		UploadID string    `json:"upload_id"`
+		Size     int64     `json:"size"`
+		ModTime  time.Time `json:"mod_time"`
+		PartSize int64     `json:"part_size"`
+		Parts    []Part    `json:"parts"`
+	}
+	if err := json.Unmarshal(b, &v1); err != nil {
+		return nil, err
+	}
+	return &Checkpoint{
+		Version:  Version,
+		Tool:     Tool(),
+		Bucket:   v1.Bucket,
+		Key:      v1.Key,
+		UploadID: v1.UploadID,
+		File:     Fingerprint{Size: v1.Size, ModTime: v1.ModTime},
+		PartSize: v1.PartSize,
+		Parts:    v1.Parts,
+	}, nil
+}
+
+// Write saves the checkpoint to path. The new contents are written to a
+// temporary file in the same directory, flushed to disk, renamed over
+// path and the directory entry flushed in turn, so after a crash or power
+// loss path holds either the previous checkpoint or the new one, never a
+// truncated mix. With a non-nil key the file is encrypted and only
+// readable with the same passphrase.
+func (c *Checkpoint) Write(path string, key *Key) error {
+	c.Version = Version
+	c.Tool = Tool()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if b, err = key.seal(append(b, '\n')); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory so a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Saver records uploaded parts in a checkpoint and rewrites the checkpoint
+// file after each one, so an interrupted upload resumes from the last
+// acknowledged part. It is safe for concurrent use.
+type Saver struct {
+	mu   sync.Mutex
+	c    *Checkpoint
+	path string
+	key  *Key
+}
+
+// NewSaver returns a Saver that persists c to path, encrypted with key
+// when it is not nil.
+func NewSaver(c *Checkpoint, path string, key *Key) *Saver {
+	return &Saver{c: c, path: path, key: key}
+}
+
+// Record marks part number as uploaded and writes the checkpoint.
+func (s *Saver) Record(number int64, etag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.c.Record(number, etag); err != nil {
+		return err
+	}
+	return s.c.Write(s.path, s.key)
+}
@@ -0,0 +1,172 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		in      string
+		want    *Checkpoint
+		wantErr string
+	}{
+		{
+			name: "v1 migrated",
+			in: `{"version":1,"bucket":"b","key":"k","upload_id":"u","size":20,"mod_time":"2024-03-01T12:00:00Z","part_size":10,
+				"parts":[{"number":1,"offset":0,"size":10,"md5":"m1"},{"number":2,"offset":10,"size":10}]}`,
+			want: &Checkpoint{
+				Version:  Version,
+				Tool:     Tool(),
+				Bucket:   "b",
+				Key:      "k",
+				UploadID: "u",
+				File:     Fingerprint{Size: 20, ModTime: modTime},
+				PartSize: 10,
+				Parts:    []Part{{Number: 1, Size: 10, MD5: "m1"}, {Number: 2, Offset: 10, Size: 10}},
+			},
+		},
+		{
+			name: "current version",
+			in: `{"version":2,"tool":"t","bucket":"b","key":"k","file":{"path":"/f","size":10,"mod_time":"2024-03-01T12:00:00Z"},
+				"part_size":10,"parts":[{"number":1,"offset":0,"size":10,"etag":"\"e\""}]}`,
+			want: &Checkpoint{
+				Version:  2,
+				Tool:     "t",
+				Bucket:   "b",
+				Key:      "k",
+				File:     Fingerprint{Path: "/f", Size: 10, ModTime: modTime},
+				PartSize: 10,
+				Parts:    []Part{{Number: 1, Size: 10, ETag: `"e"`}},
+			},
+		},
+		{name: "newer version", in: `{"version":3,"tool":"next"}`, wantErr: "version 3 was written by next"},
+		{name: "no version", in: `{"bucket":"b"}`, wantErr: "unknown version 0"},
+		{name: "not JSON", in: `bucket=b`, wantErr: "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode([]byte(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		writeKey *Key
+		readKey  *Key
+		wantErr  error
+	}{
+		{name: "plain"},
+		{name: "encrypted", writeKey: NewKey("secret"), readKey: NewKey("secret")},
+		{name: "encrypted without key", writeKey: NewKey("secret"), wantErr: ErrKeyRequired},
+		{name: "wrong key", writeKey: NewKey("secret"), readKey: NewKey("other"), wantErr: ErrWrongKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "upload.ckpt")
+			c := &Checkpoint{Bucket: "b", Key: "k", UploadID: "u", PartSize: 10, Parts: []Part{{Number: 1, Size: 10}}}
+			if err := c.Write(path, tt.writeKey); err != nil {
+				t.Fatal(err)
+			}
+			// A second write replaces the first rather than appending to
+			// or truncating it.
+			if err := c.Record(1, `"e"`); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Write(path, tt.writeKey); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("directory holds %d files, want only the checkpoint: temporary files were left behind", len(entries))
+			}
+			got, err := Read(path, tt.readKey)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != Version || got.Tool != Tool() || !reflect.DeepEqual(got.Parts, c.Parts) {
+				t.Fatalf("read back %+v, want %+v", got, c)
+			}
+			if len(got.Pending()) != 0 {
+				t.Fatalf("parts %v still pending after Record", got.Pending())
+			}
+		})
+	}
+}
+
+func TestWriteKeepsPreviousOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "upload.ckpt")
+	c := &Checkpoint{Bucket: "b", Key: "k", Parts: []Part{{Number: 1, Size: 10}}}
+	if err := c.Write(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary file cannot be created in a read-only directory, so
+	// the write fails before the checkpoint is touched.
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0o700)
+	c.UploadID = "changed"
+	if err := c.Write(path, nil); err == nil {
+		t.Skip("directory is writable despite its mode (running as root)")
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Fatal("a failed write changed the checkpoint")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	c := &Checkpoint{Parts: []Part{{Number: 1}, {Number: 2}}}
+	for _, n := range []int64{0, 3} {
+		if err := c.Record(n, `"e"`); err == nil {
+			t.Errorf("Record(%d) accepted a part outside the checkpoint", n)
+		}
+	}
+	if err := c.Record(2, `"e"`); err != nil {
+		t.Fatal(err)
+	}
+	if p := c.Pending(); len(p) != 1 || p[0].Number != 1 {
+		t.Fatalf("pending %v, want part 1", p)
+	}
+}
@@ -0,0 +1,178 @@
+package checkpoint
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const (
+	// EnvPassphrase holds the passphrase checkpoints are encrypted with.
+	EnvPassphrase = "OBJECTSLITE_CHECKPOINT_PASSPHRASE"
+	// EnvKeyCommand names a command printing the passphrase, typically a
+	// keychain lookup such as "secret-tool lookup service objectslite" or
+	// "security find-generic-password -s objectslite -w". It is run
+	// through sh -c when EnvPassphrase is not set.
+	EnvKeyCommand = "OBJECTSLITE_CHECKPOINT_KEY_COMMAND"
+)
+
+// sealedMagic starts every encrypted checkpoint. It cannot start a JSON
+// document, so plaintext and encrypted files are told apart by content.
+var sealedMagic = []byte("objectslite-sealed-v1\n")
+
+const (
+	saltSize = 16
+	// kdfIterations is the PBKDF2-HMAC-SHA256 work factor. A Key derives
+	// once per salt, not on every checkpoint write.
+	kdfIterations = 600_000
+)
+
+var (
+	// ErrKeyRequired is returned when reading an encrypted checkpoint
+	// without a key.
+	ErrKeyRequired = errors.New("checkpoint is encrypted; set $" + EnvPassphrase + " or $" + EnvKeyCommand)
+	// ErrWrongKey is returned when an encrypted checkpoint does not
+	// decrypt: the passphrase differs or the file was altered.
+	ErrWrongKey = errors.New("checkpoint does not decrypt: wrong passphrase or corrupted file")
+)
+
+// Key encrypts checkpoints at rest with AES-256-GCM under a key derived
+// from a passphrase, for hosts where other users or backups can read the
+// checkpoint directory: a checkpoint names the bucket, key, UploadId and
+// source path of an upload, enough to complete, abort or inject parts
+// into it. A nil *Key reads and writes plaintext. Either kind of Key reads
+// plaintext checkpoints, so setting a passphrase part-way through an
+// upload encrypts the checkpoint from its next write on. It is safe for
+// concurrent use.
+type Key struct {
+	passphrase string
+
+	mu sync.Mutex
+	// salt is used for everything this Key seals; keys caches the
+	// derived key of each salt seen.
+	salt []byte
+	keys map[string]cipher.AEAD
+}
+
+// NewKey returns a Key for passphrase.
+func NewKey(passphrase string) *Key {
+	return &Key{passphrase: passphrase, keys: make(map[string]cipher.AEAD)}
+}
+
+// KeyFromEnv returns the Key named by $OBJECTSLITE_CHECKPOINT_PASSPHRASE
+// or, failing that, printed by $OBJECTSLITE_CHECKPOINT_KEY_COMMAND, or nil
+// when neither is set.
+func KeyFromEnv() (*Key, error) {
+	if p := os.Getenv(EnvPassphrase); p != "" {
+		return NewKey(p), nil
+	}
+	command := os.Getenv(EnvKeyCommand)
+	if command == "" {
+		return nil, nil
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("$%s: %w", EnvKeyCommand, err)
+	}
+	p := strings.TrimRight(string(out), "\r\n")
+	if p == "" {
+		return nil, fmt.Errorf("$%s printed an empty passphrase", EnvKeyCommand)
+	}
+	return NewKey(p), nil
+}
+
+// IsSealed reports whether b is an encrypted checkpoint.
+func IsSealed(b []byte) bool {
+	return bytes.HasPrefix(b, sealedMagic)
+}
+
+// seal encrypts b. The result is the magic, the salt, the nonce and the
+// sealed data, with the magic and salt authenticated as well.
+func (k *Key) seal(b []byte) ([]byte, error) {
+	if k == nil {
+		return b, nil
+	}
+	k.mu.Lock()
+	if k.salt == nil {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			k.mu.Unlock()
+			return nil, err
+		}
+		k.salt = salt
+	}
+	salt := k.salt
+	k.mu.Unlock()
+	aead, err := k.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte{}, sealedMagic...), salt...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(append(header, nonce...), nonce, b, header), nil
+}
+
+// open decrypts b if it is sealed and returns it unchanged otherwise.
+func (k *Key) open(b []byte) ([]byte, error) {
+	if !IsSealed(b) {
+		return b, nil
+	}
+	if k == nil {
+		return nil, ErrKeyRequired
+	}
+	headerSize := len(sealedMagic) + saltSize
+	if len(b) < headerSize {
+		return nil, ErrWrongKey
+	}
+	header := b[:headerSize]
+	aead, err := k.aead(header[len(sealedMagic):])
+	if err != nil {
+		return nil, err
+	}
+	rest := b[headerSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+// aead returns the cipher for salt, deriving its key on first use.
+func (k *Key) aead(salt []byte) (cipher.AEAD, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if aead, ok := k.keys[string(salt)]; ok {
+		return aead, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, k.passphrase, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k.keys[string(salt)] = aead
+	return aead, nil
+}
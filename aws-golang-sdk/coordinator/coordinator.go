@@ -0,0 +1,304 @@
+// Package coordinator spreads the parts of one planned multipart upload
+// across several hosts. A coordinator serves the plan over HTTP and leases
+// batches of parts to workers, each of which reads its own local copy of
+// the file; when every part is in, the coordinator completes the upload.
+// For very large files this is bounded by the hosts' combined NICs rather
+// than a single one.
+package coordinator
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/plan"
+)
+
+// DefaultLease is how long a worker may hold parts before they are handed
+// to someone else.
+const DefaultLease = 10 * time.Minute
+
+// DefaultMaxAttempts is how many times a part may fail before the upload
+// is given up.
+const DefaultMaxAttempts = 5
+
+// TokenHeader carries the shared secret on every request.
+const TokenHeader = "X-Coordinator-Token"
+
+type partState int
+
+const (
+	statePending partState = iota
+	stateLeased
+	stateDone
+)
+
+type part struct {
+	state    partState
+	worker   string
+	lease    int64
+	deadline time.Time
+	failures int
+}
+
+// Coordinator tracks which parts of a plan are pending, leased or done.
+type Coordinator struct {
+	plan        *plan.Plan
+	token       string
+	lease       time.Duration
+	maxAttempts int
+
+	mu     sync.Mutex
+	parts  map[int64]*part
+	leases int64
+	// err is set, and done closed, when a part has failed maxAttempts
+	// times.
+	err  error
+	done chan struct{}
+}
+
+// New returns a coordinator for p, which must already have an UploadId.
+// Parts listed in uploaded are treated as done, so a restarted coordinator
+// does not re-upload them. token, if set, must accompany every request.
+// A part failing maxAttempts times fails the upload; zero values of lease
+// and maxAttempts select the defaults.
+func New(p *plan.Plan, uploaded []int64, token string, lease time.Duration, maxAttempts int) *Coordinator {
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	c := &Coordinator{
+		plan:        p,
+		token:       token,
+		lease:       lease,
+		maxAttempts: maxAttempts,
+		parts:       make(map[int64]*part, len(p.Parts)),
+		done:        make(chan struct{}),
+	}
+	for _, pp := range p.Parts {
+		c.parts[pp.Number] = &part{}
+	}
+	for _, n := range uploaded {
+		if st, ok := c.parts[n]; ok {
+			st.state = stateDone
+		}
+	}
+	c.checkDone()
+	return c
+}
+
+// LeaseRequest asks for up to Max parts.
+type LeaseRequest struct {
+	Worker string `json:"worker"`
+	Max    int    `json:"max"`
+}
+
+// LeaseResponse assigns parts to a worker under the lease ID Lease. When
+// Parts is empty, Done says whether the upload is finished or the worker
+// should poll again because the remaining parts are leased to others.
+// Error is set, with Done, when the upload failed.
+type LeaseResponse struct {
+	Parts []int64 `json:"parts"`
+	Lease int64   `json:"lease"`
+	Done  bool    `json:"done"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Report tells the coordinator how a leased part went. Worker and Lease
+// must be those the part was leased with.
+type Report struct {
+	Worker string `json:"worker"`
+	Lease  int64  `json:"lease"`
+	Number int64  `json:"number"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Status summarises progress.
+type Status struct {
+	Total   int            `json:"total"`
+	Done    int            `json:"done"`
+	Leased  map[string]int `json:"leased"`
+	Pending int            `json:"pending"`
+	// Failures counts the failed attempts of each part that had any.
+	Failures map[int64]int `json:"failures,omitempty"`
+	// Error is why the upload failed, once it has.
+	Error string `json:"error,omitempty"`
+}
+
+// Lease hands out up to req.Max pending parts, reclaiming expired leases
+// first.
+func (c *Coordinator) Lease(req LeaseRequest) LeaseResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return LeaseResponse{Done: true, Error: c.err.Error()}
+	}
+	now := time.Now()
+	c.leases++
+	resp := LeaseResponse{Lease: c.leases}
+	for _, n := range c.sortedNumbers() {
+		st := c.parts[n]
+		if st.state == stateLeased && now.After(st.deadline) {
+			st.state = statePending
+		}
+		if st.state == statePending && len(resp.Parts) < max(req.Max, 1) {
+			st.state, st.worker, st.lease, st.deadline = stateLeased, req.Worker, resp.Lease, now.Add(c.lease)
+			resp.Parts = append(resp.Parts, n)
+		}
+	}
+	resp.Done = len(resp.Parts) == 0 && c.isDone()
+	return resp
+}
+
+// Report records the outcome of a leased part and reports whether it was
+// accepted. A report is refused unless the part is still leased to
+// r.Worker under r.Lease: once a lease expires the part may be uploading
+// elsewhere, and a late report must not finish or fail that attempt.
+// Failed parts go back to the pending pool for another worker to try,
+// until one has failed maxAttempts times, which fails the upload.
+func (c *Coordinator) Report(r Report) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.parts[r.Number]
+	if !ok || st.state != stateLeased || st.worker != r.Worker || st.lease != r.Lease || c.err != nil {
+		return false
+	}
+	if r.Error != "" {
+		st.state = statePending
+		st.failures++
+		if st.failures >= c.maxAttempts {
+			c.err = fmt.Errorf("part %d failed %d times, last on %s: %s", r.Number, st.failures, r.Worker, r.Error)
+			close(c.done)
+		}
+		return true
+	}
+	st.state = stateDone
+	c.checkDone()
+	return true
+}
+
+// Status returns the current progress.
+func (c *Coordinator) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Status{Total: len(c.parts), Leased: make(map[string]int)}
+	if c.err != nil {
+		s.Error = c.err.Error()
+	}
+	for n, st := range c.parts {
+		if st.failures > 0 {
+			if s.Failures == nil {
+				s.Failures = make(map[int64]int)
+			}
+			s.Failures[n] = st.failures
+		}
+		switch st.state {
+		case stateDone:
+			s.Done++
+		case stateLeased:
+			s.Leased[st.worker]++
+		default:
+			s.Pending++
+		}
+	}
+	return s
+}
+
+// Wait blocks until every part has been reported done, or returns the
+// error of a part that failed too often.
+func (c *Coordinator) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Coordinator) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkDone closes c.done once every part is done. c.mu must be held.
+func (c *Coordinator) checkDone() {
+	if c.isDone() {
+		return
+	}
+	for _, st := range c.parts {
+		if st.state != stateDone {
+			return
+		}
+	}
+	close(c.done)
+}
+
+func (c *Coordinator) sortedNumbers() []int64 {
+	numbers := make([]int64, 0, len(c.parts))
+	for n := range c.parts {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+// Handler returns the coordinator's HTTP API:
+//
+//	GET  /plan    the plan, including the UploadId
+//	POST /lease   LeaseRequest -> LeaseResponse
+//	POST /report  Report
+//	GET  /status  Status
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /plan", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.plan)
+	})
+	mux.HandleFunc("POST /lease", func(w http.ResponseWriter, r *http.Request) {
+		var req LeaseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, c.Lease(req))
+	})
+	mux.HandleFunc("POST /report", func(w http.ResponseWriter, r *http.Request) {
+		var rep Report
+		if err := json.NewDecoder(r.Body).Decode(&rep); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !c.Report(rep) {
+			http.Error(w, fmt.Sprintf("part %d is not leased to %s under lease %d", rep.Number, rep.Worker, rep.Lease), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.Status())
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(c.token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
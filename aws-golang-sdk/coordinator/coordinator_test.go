@@ -0,0 +1,222 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/plan"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// testPlan returns a plan of n parts with an upload ID.
+func testPlan(n int) *plan.Plan {
+	p := &plan.Plan{Checkpoint: checkpoint.Checkpoint{Bucket: "b", Key: "k", UploadID: "u"}}
+	for i := range n {
+		p.Parts = append(p.Parts, plan.Part{Number: int64(i) + 1, Offset: int64(i) * 10, Size: 10})
+	}
+	return p
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name string
+		// report is made after part 1 and 2 are leased to w1 under lease
+		// 1, and part 3 left pending.
+		report Report
+		want   bool
+	}{
+		{"holder", Report{Worker: "w1", Lease: 1, Number: 1}, true},
+		{"holder's failure", Report{Worker: "w1", Lease: 1, Number: 2, Error: "reset"}, true},
+		{"other worker", Report{Worker: "w2", Lease: 1, Number: 1}, false},
+		{"other lease", Report{Worker: "w1", Lease: 2, Number: 1}, false},
+		{"part not leased", Report{Worker: "w1", Lease: 1, Number: 3}, false},
+		{"part not in the plan", Report{Worker: "w1", Lease: 1, Number: 9}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(testPlan(3), nil, "", time.Hour, 0)
+			if got := c.Lease(LeaseRequest{Worker: "w1", Max: 2}); got.Lease != 1 || !slices.Equal(got.Parts, []int64{1, 2}) {
+				t.Fatalf("leased %+v, want parts 1 and 2 under lease 1", got)
+			}
+			if got := c.Report(tt.report); got != tt.want {
+				t.Fatalf("Report(%+v) = %v, want %v", tt.report, got, tt.want)
+			}
+			s := c.Status()
+			wantDone := 0
+			if tt.want && tt.report.Error == "" {
+				wantDone = 1
+			}
+			if s.Done != wantDone {
+				t.Fatalf("%d parts done, want %d", s.Done, wantDone)
+			}
+		})
+	}
+}
+
+func TestExpiredLease(t *testing.T) {
+	c := New(testPlan(1), nil, "", time.Millisecond, 0)
+	first := c.Lease(LeaseRequest{Worker: "w1", Max: 1})
+	if got := c.Lease(LeaseRequest{Worker: "w2", Max: 1}); len(got.Parts) != 0 || got.Done {
+		t.Fatalf("part leased twice before the lease expired: %+v", got)
+	}
+	time.Sleep(5 * time.Millisecond)
+	second := c.Lease(LeaseRequest{Worker: "w2", Max: 1})
+	if !slices.Equal(second.Parts, []int64{1}) {
+		t.Fatalf("expired part not re-leased: %+v", second)
+	}
+	// The first holder finishing late must not fail or finish the part
+	// under the second one.
+	if c.Report(Report{Worker: "w1", Lease: first.Lease, Number: 1, Error: "timeout"}) {
+		t.Fatal("report from the expired lease accepted")
+	}
+	if !c.Report(Report{Worker: "w2", Lease: second.Lease, Number: 1}) {
+		t.Fatal("report from the current lease refused")
+	}
+	if err := c.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	tests := []struct {
+		maxAttempts int
+		failures    int
+		wantErr     bool
+	}{
+		{maxAttempts: 3, failures: 2},
+		{maxAttempts: 3, failures: 3, wantErr: true},
+		{maxAttempts: 1, failures: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		c := New(testPlan(2), []int64{2}, "", time.Hour, tt.maxAttempts)
+		for range tt.failures {
+			l := c.Lease(LeaseRequest{Worker: "w", Max: 1})
+			if !c.Report(Report{Worker: "w", Lease: l.Lease, Number: 1, Error: "boom"}) {
+				t.Fatalf("failure of lease %+v refused", l)
+			}
+		}
+		s := c.Status()
+		if s.Failures[1] != tt.failures || (s.Error != "") != tt.wantErr {
+			t.Errorf("after %d of %d attempts failed: status %+v", tt.failures, tt.maxAttempts, s)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := c.Wait(ctx)
+		cancel()
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "part 1 failed") {
+				t.Errorf("Wait after %d of %d attempts = %v, want part 1's failure", tt.failures, tt.maxAttempts, err)
+			}
+			if l := c.Lease(LeaseRequest{Worker: "w", Max: 1}); !l.Done || l.Error == "" || len(l.Parts) != 0 {
+				t.Errorf("failed upload leased %+v", l)
+			}
+		} else if err != context.DeadlineExceeded {
+			t.Errorf("Wait after %d of %d attempts = %v, want it still waiting", tt.failures, tt.maxAttempts, err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := New(testPlan(1), nil, "s3cret", time.Hour, 0)
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+	post := func(path, token string, body any) *http.Response {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewReader(b))
+		req.Header.Set(TokenHeader, token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	lease := c.Lease(LeaseRequest{Worker: "w", Max: 1})
+	tests := []struct {
+		name   string
+		token  string
+		report Report
+		want   int
+	}{
+		{"wrong token", "guess", Report{Worker: "w", Lease: lease.Lease, Number: 1}, http.StatusUnauthorized},
+		{"stale lease", "s3cret", Report{Worker: "w", Lease: lease.Lease + 1, Number: 1}, http.StatusConflict},
+		{"holder", "s3cret", Report{Worker: "w", Lease: lease.Lease, Number: 1}, http.StatusNoContent},
+		{"already done", "s3cret", Report{Worker: "w", Lease: lease.Lease, Number: 1}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if got := post("/report", tt.token, tt.report).StatusCode; got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWorker(t *testing.T) {
+	tests := []struct {
+		name     string
+		failPart string // part number the server always fails
+		wantErr  string
+	}{
+		{name: "uploads every part"},
+		{name: "stops when a part fails too often", failPart: "2", wantErr: "part 2 failed 2 times"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			if tt.failPart != "" {
+				srv.Fail = func(r *http.Request) bool { return r.URL.Query().Get("partNumber") == tt.failPart }
+			}
+			client := srv.Client(t)
+			path := objectslitetest.TempFile(t, 5<<20)
+			p, err := plan.New(ctx, path, "b", "k", 1<<20, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Create(ctx, client); err != nil {
+				t.Fatal(err)
+			}
+			c := New(p, nil, "s3cret", time.Hour, 2)
+			hs := httptest.NewServer(c.Handler())
+			defer hs.Close()
+
+			w := &Worker{
+				URL:     hs.URL,
+				Token:   "s3cret",
+				Name:    "w",
+				File:    path,
+				Batch:   10,
+				Options: utils.UploadOptions{Concurrency: 2, Retry: utils.RetryPolicy{MaxAttempts: 1}},
+			}
+			err = w.Run(ctx, client)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run = %v, want %q", err, tt.wantErr)
+				}
+				if s := c.Status(); s.Failures[2] != 2 || s.Done != 4 {
+					t.Fatalf("status %+v, want 4 parts done and 2 failures of part 2", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.Complete(ctx, client); err != nil {
+				t.Fatal(err)
+			}
+			objectslitetest.AssertObjectMatchesFile(t, srv, "b", "k", path)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/plan"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// pollInterval is how long a worker waits when every remaining part is
+// leased to someone else.
+const pollInterval = 5 * time.Second
+
+// Worker leases parts from a coordinator and uploads them from a local
+// copy of the planned file.
+type Worker struct {
+	// URL is the coordinator base URL, e.g. http://10.0.0.5:8700.
+	URL   string
+	Token string
+	// Name identifies the worker in leases and status output.
+	Name string
+	// File is the local path of the planned file.
+	File string
+	// Batch is the number of parts leased at a time; it should be at
+	// least Options.Concurrency to keep every connection busy.
+	Batch      int
+	Options    utils.UploadOptions
+	HTTPClient *http.Client
+	// Report, if set, is called as each part finishes.
+	Report func(plan.Part, error)
+}
+
+// Run fetches the plan and uploads leased parts until the coordinator
+// reports the upload done.
+func (w *Worker) Run(ctx context.Context, svc s3iface.S3API) error {
+	if w.HTTPClient == nil {
+		w.HTTPClient = http.DefaultClient
+	}
+	var p plan.Plan
+	if err := w.call(ctx, http.MethodGet, "/plan", nil, &p); err != nil {
+		return fmt.Errorf("fetch plan: %w", err)
+	}
+	if err := p.CheckFile(w.File); err != nil {
+		return err
+	}
+
+	for {
+		var lease LeaseResponse
+		err := w.call(ctx, http.MethodPost, "/lease", LeaseRequest{Worker: w.Name, Max: max(w.Batch, 1)}, &lease)
+		if err != nil {
+			return fmt.Errorf("lease parts: %w", err)
+		}
+		if lease.Error != "" {
+			return fmt.Errorf("upload failed: %s", lease.Error)
+		}
+		if lease.Done {
+			return nil
+		}
+		if len(lease.Parts) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+
+		// Part failures are reported back so the coordinator can hand the
+		// part to another worker; only errors that prevent uploading at
+		// all, and cancellation, stop the worker.
+		var reported atomic.Int32
+		err = p.Upload(ctx, svc, w.File, lease.Parts, w.Options, func(pp plan.Part, err error) {
+			reported.Add(1)
+			rep := Report{Worker: w.Name, Lease: lease.Lease, Number: pp.Number}
+			if err != nil {
+				rep.Error = err.Error()
+			}
+			if rerr := w.call(ctx, http.MethodPost, "/report", rep, nil); rerr != nil && err == nil {
+				err = fmt.Errorf("report part %d: %w", pp.Number, rerr)
+			}
+			if w.Report != nil {
+				w.Report(pp, err)
+			}
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && reported.Load() == 0 {
+			return err
+		}
+	}
+}
+
+func (w *Worker) call(ctx context.Context, method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(w.URL, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	if w.Token != "" {
+		req.Header.Set(TokenHeader, w.Token)
+	}
+	resp, err := w.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("coordinator returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
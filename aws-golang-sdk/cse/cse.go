@@ -0,0 +1,280 @@
+// Package cse encrypts objects on the client before they are uploaded,
+// for data that must not be readable on the storage side.
+//
+// Each object is encrypted with its own random data key using AES-256-GCM
+// in 64KiB chunks, so objects of any size stream through in constant
+// memory and truncation or reordering is detected. The data key is
+// wrapped with a master key from a Keyring and stored, with the master
+// key's ID, in the object's user metadata. Rotating the master key
+// therefore only rewrites metadata (see Rewrap); the object data is not
+// downloaded again.
+package cse
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// User metadata keys (x-amz-meta-*) describing an encrypted object.
+const (
+	MetaKeyID      = "cse-key-id"
+	MetaWrappedKey = "cse-wrapped-key"
+	MetaNonce      = "cse-nonce"
+)
+
+const (
+	// KeySize is the size of master and data keys (AES-256).
+	KeySize = 32
+	// chunkSize is the plaintext size of each sealed chunk.
+	chunkSize = 64 << 10
+)
+
+// ErrNotEncrypted is returned for objects without encryption metadata.
+var ErrNotEncrypted = errors.New("object is not client-side encrypted")
+
+// Keyring holds the master keys by ID. Current names the key new objects
+// and rewrapped data keys are wrapped with; the others only unwrap.
+//
+// The file form is JSON with base64 keys:
+//
+//	{"current": "2024-06", "keys": {"2024-01": "...", "2024-06": "..."}}
+type Keyring struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// LoadKeyring reads and validates a keyring file.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kr Keyring
+	if err := json.Unmarshal(data, &kr); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for id, k := range kr.Keys {
+		if len(k) != KeySize {
+			return nil, fmt.Errorf("%s: key %q is %d bytes, want %d", path, id, len(k), KeySize)
+		}
+	}
+	if _, ok := kr.Keys[kr.Current]; !ok {
+		return nil, fmt.Errorf("%s: current key %q is not in the keyring", path, kr.Current)
+	}
+	return &kr, nil
+}
+
+// NewKey returns a random key.
+func NewKey() ([]byte, error) {
+	k := make([]byte, KeySize)
+	_, err := rand.Read(k)
+	return k, err
+}
+
+// envelope is the per-object key material kept in the metadata.
+type envelope struct {
+	keyID   string
+	dataKey []byte
+	nonce   []byte
+}
+
+// newEnvelope creates a data key and nonce for a new object.
+func newEnvelope(kr *Keyring) (*envelope, error) {
+	e := &envelope{keyID: kr.Current, nonce: make([]byte, 12)}
+	var err error
+	if e.dataKey, err = NewKey(); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(e.nonce); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// metadata wraps the data key with the envelope's master key.
+func (e *envelope) metadata(kr *Keyring) (map[string]string, error) {
+	master, ok := kr.Keys[e.keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not in the keyring", e.keyID)
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	wrapNonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(wrapNonce); err != nil {
+		return nil, err
+	}
+	wrapped := aead.Seal(wrapNonce, wrapNonce, e.dataKey, []byte(e.keyID))
+	return map[string]string{
+		MetaKeyID:      e.keyID,
+		MetaWrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		MetaNonce:      base64.StdEncoding.EncodeToString(e.nonce),
+	}, nil
+}
+
+// openEnvelope unwraps the data key described by an object's metadata.
+// lookup returns a metadata value by name.
+func openEnvelope(kr *Keyring, lookup func(string) string) (*envelope, error) {
+	e := &envelope{keyID: lookup(MetaKeyID)}
+	if e.keyID == "" {
+		return nil, ErrNotEncrypted
+	}
+	master, ok := kr.Keys[e.keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not in the keyring", e.keyID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(lookup(MetaWrappedKey))
+	if err != nil {
+		return nil, fmt.Errorf("wrapped key: %w", err)
+	}
+	if e.nonce, err = base64.StdEncoding.DecodeString(lookup(MetaNonce)); err != nil || len(e.nonce) != 12 {
+		return nil, fmt.Errorf("invalid %s", MetaNonce)
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	n := aead.NonceSize()
+	if e.dataKey, err = aead.Open(nil, wrapped[:n], wrapped[n:], []byte(e.keyID)); err != nil {
+		return nil, fmt.Errorf("unwrap data key with %q: %w", e.keyID, err)
+	}
+	return e, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce derives the nonce of chunk seq from the object's nonce.
+func chunkNonce(dst, base []byte, seq uint64) []byte {
+	dst = append(dst[:0], base...)
+	binary.BigEndian.PutUint64(dst[4:], binary.BigEndian.Uint64(base[4:])^seq)
+	return dst
+}
+
+// chunkAAD marks the last chunk, so a stream cut at a chunk boundary
+// fails to authenticate.
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// sealer encrypts a plaintext stream chunk by chunk.
+type sealer struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	base  []byte
+	nonce []byte
+	seq   uint64
+	plain []byte
+	buf   []byte
+	out   []byte
+	done  bool
+}
+
+func newSealer(src io.Reader, e *envelope) (*sealer, error) {
+	aead, err := newGCM(e.dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{src: bufio.NewReaderSize(src, chunkSize), aead: aead, base: e.nonce, plain: make([]byte, chunkSize)}, nil
+}
+
+// Read implements io.Reader.
+func (s *sealer) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(s.src, s.plain)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err == nil {
+			_, perr := s.src.Peek(1)
+			if perr != nil && perr != io.EOF {
+				return 0, perr
+			}
+			final = perr == io.EOF
+		} else if !final {
+			return 0, err
+		}
+		s.nonce = chunkNonce(s.nonce, s.base, s.seq)
+		s.buf = s.aead.Seal(s.buf[:0], s.nonce, s.plain[:n], chunkAAD(final))
+		s.out = s.buf
+		s.seq++
+		s.done = final
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// opener decrypts a stream written by sealer.
+type opener struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	base   []byte
+	nonce  []byte
+	seq    uint64
+	sealed []byte
+	buf    []byte
+	out    []byte
+	done   bool
+}
+
+func newOpener(src io.Reader, e *envelope) (*opener, error) {
+	aead, err := newGCM(e.dataKey)
+	if err != nil {
+		return nil, err
+	}
+	size := chunkSize + aead.Overhead()
+	return &opener{src: bufio.NewReaderSize(src, size), aead: aead, base: e.nonce, sealed: make([]byte, size)}, nil
+}
+
+// Read implements io.Reader.
+func (o *opener) Read(p []byte) (int, error) {
+	for len(o.out) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(o.src, o.sealed)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err == nil {
+			_, perr := o.src.Peek(1)
+			if perr != nil && perr != io.EOF {
+				return 0, perr
+			}
+			final = perr == io.EOF
+		} else if !final {
+			return 0, err
+		}
+		o.nonce = chunkNonce(o.nonce, o.base, o.seq)
+		if o.buf, err = o.aead.Open(o.buf[:0], o.nonce, o.sealed[:n], chunkAAD(final)); err != nil {
+			return 0, fmt.Errorf("chunk %d: %w", o.seq, err)
+		}
+		o.out = o.buf
+		o.seq++
+		o.done = final
+	}
+	n := copy(p, o.out)
+	o.out = o.out[n:]
+	return n, nil
+}
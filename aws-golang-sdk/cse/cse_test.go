@@ -0,0 +1,160 @@
+package cse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// truncatingGet cuts every object body short by one byte, as a
+// shortened or tampered object would read.
+type truncatingGet struct {
+	s3iface.S3API
+}
+
+func (t truncatingGet) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	out, err := t.S3API.GetObjectWithContext(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(out.Body, aws.Int64Value(out.ContentLength)-1), out.Body}
+	return out, nil
+}
+
+func newKeyring(t *testing.T, current string, ids ...string) *Keyring {
+	t.Helper()
+	kr := &Keyring{Current: current, Keys: map[string][]byte{}}
+	for _, id := range ids {
+		k, err := NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		kr.Keys[id] = k
+	}
+	return kr
+}
+
+func TestPutGet(t *testing.T) {
+	kr := newKeyring(t, "k1", "k1")
+	for _, size := range []int64{0, 1, chunkSize, 3*chunkSize + 5} {
+		ctx := context.Background()
+		srv := objectslitetest.NewServer(t)
+		srv.CreateBucket("b")
+		client := srv.Client(t)
+		data := objectslitetest.Data(size)
+
+		if _, err := Put(ctx, client, "b", "k", bytes.NewReader(data), kr, utils.UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		obj, _ := srv.Object("b", "k")
+		if size > 0 && bytes.Contains(obj.Data, data) {
+			t.Fatalf("%d bytes stored in the clear", size)
+		}
+		if obj.Metadata[MetaKeyID] != "k1" {
+			t.Fatalf("stored with key ID %q, want k1", obj.Metadata[MetaKeyID])
+		}
+
+		r, err := Get(ctx, client, "b", "k", kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%d bytes: decrypted %d bytes (%v)", size, len(got), err)
+		}
+
+		r, err = Get(ctx, truncatingGet{client}, "b", "k", kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(r); err == nil {
+			t.Fatalf("%d bytes: truncated object decrypted without an error", size)
+		}
+		r.Close()
+
+		if _, err := Get(ctx, client, "b", "k", newKeyring(t, "k2", "k2")); err == nil {
+			t.Fatalf("%d bytes: opened with a keyring missing its key", size)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	old := newKeyring(t, "k1", "k1")
+	data := objectslitetest.Data(2*chunkSize + 7)
+	for _, key := range []string{"p/a", "p/b"} {
+		if _, err := Put(ctx, client, "b", key, bytes.NewReader(data), old, utils.UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.PutObject("b", "p/plain", []byte("not encrypted"))
+	kr := newKeyring(t, "k2", "k2")
+	kr.Keys["k1"] = old.Keys["k1"]
+
+	rotate := func(opts RotateOptions) map[string]RotateResult {
+		t.Helper()
+		opts.Bucket, opts.Prefix, opts.Keyring = "b", "p/", kr
+		var mu sync.Mutex
+		results := map[string]RotateResult{}
+		if err := Rotate(ctx, client, opts, func(r RotateResult) {
+			mu.Lock()
+			results[r.Key] = r
+			mu.Unlock()
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	dry := rotate(RotateOptions{DryRun: true, SkipPlain: true})
+	if r := dry["p/a"]; r.Rewrapped || r.Skipped || r.Err != nil {
+		t.Fatalf("dry run reported %+v for an object under the old key", r)
+	}
+	if obj, _ := srv.Object("b", "p/a"); obj.Metadata[MetaKeyID] != "k1" {
+		t.Fatal("dry run rewrapped an object")
+	}
+
+	first := rotate(RotateOptions{})
+	if !first["p/a"].Rewrapped || !first["p/b"].Rewrapped {
+		t.Fatalf("first rotation: %+v", first)
+	}
+	if err := first["p/plain"].Err; !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("plain object reported %v, want ErrNotEncrypted", err)
+	}
+	again := rotate(RotateOptions{SkipPlain: true})
+	for key, r := range again {
+		if !r.Skipped || r.Err != nil {
+			t.Fatalf("second rotation reported %+v for %s, want it skipped", r, key)
+		}
+	}
+
+	// The old key can be retired: the objects open with the new one alone.
+	current := newKeyring(t, "k2")
+	current.Keys["k2"] = kr.Keys["k2"]
+	r, err := Get(ctx, client, "b", "p/a", current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("decrypted %d bytes after rotation (%v), want the %d written", len(got), err, len(data))
+	}
+}
@@ -0,0 +1,117 @@
+package cse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Put encrypts everything read from r under a new data key wrapped with
+// the keyring's current key and uploads it with utils.UploadStream. The
+// stored object is 16 bytes per 64KiB larger than the plaintext.
+func Put(ctx context.Context, svc s3iface.S3API, bucket, key string, r io.Reader, kr *Keyring, opts utils.UploadOptions) (*utils.UploadResult, error) {
+	e, err := newEnvelope(kr)
+	if err != nil {
+		return nil, err
+	}
+	md, err := e.metadata(kr)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]*string, len(opts.Metadata)+len(md))
+	for k, v := range opts.Metadata {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = aws.String(v)
+	}
+	opts.Metadata = merged
+	body, err := newSealer(r, e)
+	if err != nil {
+		return nil, err
+	}
+	return utils.UploadStream(ctx, svc, bucket, key, body, opts)
+}
+
+// Get downloads and decrypts an object written by Put. The returned
+// reader fails with an error, rather than returning EOF, if the object
+// was truncated or altered; callers must not trust data read before
+// such an error.
+func Get(ctx context.Context, svc s3iface.S3API, bucket, key string, kr *Keyring) (io.ReadCloser, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	e, err := openEnvelope(kr, func(name string) string { return utils.MetadataValue(out.Metadata, name) })
+	if err != nil {
+		out.Body.Close()
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	r, err := newOpener(out.Body, e)
+	if err != nil {
+		out.Body.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, out.Body}, nil
+}
+
+// Rewrap re-wraps the data key of one object with the keyring's current
+// key by rewriting its metadata in place; the data is not read. It
+// reports whether the object changed: objects already wrapped with the
+// current key are left alone, which makes a rotation safe to re-run.
+//
+// The copy is conditional on the ETag read, so an object overwritten
+// meanwhile is not given a key that does not belong to it. Objects over
+// utils.MaxCopyObjectSize are rewritten with a multipart copy (see
+// utils.ServerSideCopy), which changes their ETag.
+func Rewrap(ctx context.Context, svc s3iface.S3API, bucket, key string, kr *Keyring) (bool, error) {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, fmt.Errorf("head: %w", err)
+	}
+	lookup := func(name string) string { return utils.MetadataValue(head.Metadata, name) }
+	if id := lookup(MetaKeyID); id == kr.Current {
+		return false, nil
+	}
+	e, err := openEnvelope(kr, lookup)
+	if err != nil {
+		return false, err
+	}
+	e.keyID = kr.Current
+	wrapped, err := e.metadata(kr)
+	if err != nil {
+		return false, err
+	}
+
+	md := make(map[string]*string, len(head.Metadata))
+	for k, v := range head.Metadata {
+		md[strings.ToLower(k)] = v
+	}
+	for k, v := range wrapped {
+		md[k] = aws.String(v)
+	}
+	err = utils.ServerSideCopy(ctx, svc, bucket, key, bucket, key, utils.CopyOptions{
+		Metadata: md,
+		IfMatch:  aws.StringValue(head.ETag),
+	})
+	if err != nil {
+		return false, fmt.Errorf("copy: %w", err)
+	}
+	return true, nil
+}
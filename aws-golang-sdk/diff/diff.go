@@ -0,0 +1,358 @@
+// Package diff compares a local file with an object, or a local directory
+// with a bucket prefix, and reports what differs: presence, size, content
+// and Content-Type. Content is compared without downloading whole objects
+// where the object allows it: against its x-amz-meta-sha256 or its ETag,
+// which only need the local file hashed, or else by fetching a few
+// sampled ranges.
+package diff
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/dirsync"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Defaults for Options.
+const (
+	DefaultSamples     = 8
+	DefaultSampleSize  = 64 << 10
+	DefaultConcurrency = 8
+)
+
+// Mode selects how the content of a file and an object of the same size
+// is compared.
+type Mode string
+
+const (
+	// ModeAuto compares the file with the object's SHA-256 metadata or its
+	// ETag when either can decide, and samples ranges otherwise (the
+	// default).
+	ModeAuto Mode = ""
+	// ModeSize compares sizes only.
+	ModeSize Mode = "size"
+	// ModeSample always samples ranges, reading neither side in full. It
+	// finds changes in place only if they touch a sample.
+	ModeSample Mode = "sample"
+	// ModeFull downloads the whole object and compares it byte for byte.
+	ModeFull Mode = "full"
+)
+
+// Status is the outcome of comparing one file. A file is Same when no
+// property compared differs.
+type Status string
+
+const (
+	Same       Status = "same"
+	Differs    Status = "differs"
+	LocalOnly  Status = "local-only"
+	RemoteOnly Status = "remote-only"
+)
+
+// Options configures Compare.
+type Options struct {
+	Bucket string
+	// Key is the object compared with Path when Path is a file, or the
+	// prefix compared with it when Path is a directory.
+	Key  string
+	Path string
+	Mode Mode
+	// Samples ranges of SampleSize bytes, spread evenly from the start to
+	// the end of the object, are compared when sampling. Objects no
+	// larger than the samples together are compared in full.
+	Samples    int
+	SampleSize int64
+	// PartSize is the part size multipart objects were uploaded with,
+	// tried first when their ETag is recomputed (see utils.ETagPartSize).
+	PartSize int64
+	// Concurrency is the number of files compared at once.
+	Concurrency int
+	// ContentType also reports objects whose Content-Type is not the one
+	// the file's extension maps to. Uploads do not set one, so it is off
+	// by default; examples/update-metadata sets it afterwards.
+	ContentType bool
+}
+
+func (o *Options) setDefaults() {
+	if o.Samples <= 0 {
+		o.Samples = DefaultSamples
+	}
+	if o.SampleSize <= 0 {
+		o.SampleSize = DefaultSampleSize
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = utils.DefaultPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+}
+
+// Result is the comparison of one file with one object.
+type Result struct {
+	// Key is relative to the prefix when comparing a directory.
+	Key    string `json:"key"`
+	Status Status `json:"status"`
+	// Method is how the content was found the same or different: "sha256",
+	// "etag", "sample", "full" or "size". A file found the same by
+	// sampling may still differ outside the samples.
+	Method string `json:"method,omitempty"`
+	// Differences lists what differs, one item per property.
+	Differences []string `json:"differences,omitempty"`
+	LocalSize   int64    `json:"local_size"`
+	RemoteSize  int64    `json:"remote_size"`
+}
+
+// Compare compares opts.Path with opts.Key, or every file under a
+// directory at opts.Path with the objects under the prefix opts.Key, and
+// returns one result per file or object, sorted by key. Failures to
+// compare a pair are returned joined, after the results of the others.
+func Compare(ctx context.Context, svc s3iface.S3API, opts Options) ([]Result, error) {
+	switch opts.Mode {
+	case ModeAuto, ModeSize, ModeSample, ModeFull:
+	default:
+		return nil, fmt.Errorf("unknown compare mode %q", opts.Mode)
+	}
+	opts.setDefaults()
+	info, err := os.Stat(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		r, err := compareFile(ctx, svc, opts, opts.Key, opts.Path, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		return []Result{r}, nil
+	}
+
+	prefix := opts.Key
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	local, err := dirsync.ListLocal(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := dirsync.ListRemote(ctx, svc, opts.Bucket, prefix, opts.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	var both []string
+	for key, f := range local {
+		if _, ok := remote[key]; ok {
+			both = append(both, key)
+		} else {
+			results = append(results, Result{Key: key, Status: LocalOnly, LocalSize: f.Size})
+		}
+	}
+	for key, o := range remote {
+		if _, ok := local[key]; !ok {
+			results = append(results, Result{Key: key, Status: RemoteOnly, RemoteSize: o.Size})
+		}
+	}
+	compared := make([]Result, len(both))
+	errs := utils.ForEachErr(ctx, len(both), opts.Concurrency, true, func(i int) error {
+		key := both[i]
+		r, err := compareFile(ctx, svc, opts, prefix+key, filepath.Join(opts.Path, filepath.FromSlash(key)), local[key].Size)
+		r.Key = key
+		compared[i] = r
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		return nil
+	})
+	for i, err := range errs {
+		if err == nil {
+			results = append(results, compared[i])
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results, errors.Join(errs...)
+}
+
+// compareFile compares the file at path, of size bytes, with bucket/key.
+func compareFile(ctx context.Context, svc s3iface.S3API, opts Options, key, path string, size int64) (Result, error) {
+	r := Result{Key: key, LocalSize: size}
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(opts.Bucket), Key: aws.String(key)})
+	if utils.IsNotFound(err) {
+		r.Status = LocalOnly
+		return r, nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("head %s: %w", key, err)
+	}
+	r.RemoteSize = aws.Int64Value(head.ContentLength)
+	// A compressed object holds other bytes than the file; only its
+	// recorded size and SHA-256 can be compared.
+	compressed := utils.MetadataValue(head.Metadata, utils.MetaUncompressedSize) != ""
+	if compressed {
+		r.RemoteSize, _ = strconv.ParseInt(utils.MetadataValue(head.Metadata, utils.MetaUncompressedSize), 10, 64)
+	}
+
+	if want := mime.TypeByExtension(filepath.Ext(path)); opts.ContentType && want != "" {
+		got := aws.StringValue(head.ContentType)
+		if mt, _, err := mime.ParseMediaType(want); err == nil {
+			want = mt
+		}
+		if mt, _, err := mime.ParseMediaType(got); err == nil {
+			got = mt
+		}
+		if got != want {
+			r.Differences = append(r.Differences, fmt.Sprintf("content-type %s, want %s", cmp.Or(got, "none"), want))
+		}
+	}
+	switch {
+	case r.RemoteSize != size:
+		r.Method = "size"
+		r.Differences = append(r.Differences, fmt.Sprintf("size %d, local %d", r.RemoteSize, size))
+	case opts.Mode == ModeSize:
+		r.Method = "size"
+	default:
+		same, method, err := sameContent(ctx, svc, opts, key, path, size, head, compressed)
+		if err != nil {
+			return r, err
+		}
+		r.Method = method
+		if !same {
+			r.Differences = append(r.Differences, "content differs ("+method+")")
+		}
+	}
+	r.Status = Same
+	if len(r.Differences) > 0 {
+		r.Status = Differs
+	}
+	return r, nil
+}
+
+// sameContent compares the content of the file at path with the object
+// described by head, and returns how.
+func sameContent(ctx context.Context, svc s3iface.S3API, opts Options, key, path string, size int64, head *s3.HeadObjectOutput, compressed bool) (bool, string, error) {
+	if opts.Mode == ModeAuto {
+		if want := utils.MetadataValue(head.Metadata, utils.MetaSHA256); want != "" {
+			got, err := manifest.HashFile(path, manifest.SHA256)
+			if err != nil {
+				return false, "", err
+			}
+			return strings.EqualFold(got, want), "sha256", nil
+		}
+		if compressed {
+			return true, "size", nil
+		}
+		if same, ok, err := sameETag(path, aws.StringValue(head.ETag), size, opts.PartSize); err != nil || ok {
+			return same, "etag", err
+		}
+	}
+	if compressed {
+		return true, "size", nil
+	}
+	if opts.Mode == ModeFull || size <= int64(opts.Samples)*opts.SampleSize {
+		same, err := sameRange(ctx, svc, opts.Bucket, key, path, 0, size)
+		return same, "full", err
+	}
+	for _, off := range sampleOffsets(size, opts.Samples, opts.SampleSize) {
+		same, err := sameRange(ctx, svc, opts.Bucket, key, path, off, opts.SampleSize)
+		if err != nil || !same {
+			return same, "sample", err
+		}
+	}
+	return true, "sample", nil
+}
+
+// sameETag compares the file with etag, reporting false for ok when the
+// ETag cannot decide: it is not an MD5, as with some server-side
+// encryption, or it is a multipart ETag whose part layout cannot be
+// inferred, so that a mismatch would not mean the content differs.
+func sameETag(path, etag string, size, partSize int64) (same, ok bool, err error) {
+	sum, count, multipart := strings.Cut(strings.Trim(etag, `"`), "-")
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != md5.Size {
+		return false, false, nil
+	}
+	if !multipart {
+		same, err := utils.MatchesETag(path, etag, partSize)
+		return same, true, err
+	}
+	n, err := strconv.Atoi(count)
+	partSize = utils.ETagPartSize(etag, size, partSize)
+	if err != nil || len(utils.PlanParts(size, partSize)) != n {
+		return false, false, nil
+	}
+	same, err = utils.MatchesETag(path, etag, partSize)
+	// Parts of uneven sizes can add up to the same count; only a match is
+	// conclusive.
+	return same, same || err != nil, err
+}
+
+// sampleOffsets spreads n ranges of sampleSize bytes evenly over size
+// bytes, the first at the start and the last at the end. A single range
+// is taken from the middle.
+func sampleOffsets(size int64, n int, sampleSize int64) []int64 {
+	if n == 1 {
+		return []int64{(size - sampleSize) / 2}
+	}
+	offsets := make([]int64, n)
+	for i := range offsets {
+		offsets[i] = (size - sampleSize) * int64(i) / int64(n-1)
+	}
+	return offsets
+}
+
+// sameRange compares length bytes at off of the object and the file.
+func sameRange(ctx context.Context, svc s3iface.S3API, bucket, key, path string, off, length int64) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	in := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if length > 0 {
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	}
+	out, err := svc.GetObjectWithContext(ctx, in)
+	if err != nil {
+		return false, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer out.Body.Close()
+	return sameReaders(io.NewSectionReader(f, off, length), out.Body)
+}
+
+// sameReaders reports whether a and b yield the same bytes.
+func sameReaders(a, b io.Reader) (bool, error) {
+	bufA, bufB := make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		if !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case errA != nil && !doneA:
+			return false, errA
+		case errB != nil && !doneB:
+			return false, errB
+		case doneA || doneB:
+			return doneA == doneB, nil
+		}
+	}
+}
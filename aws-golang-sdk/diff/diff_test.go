@@ -0,0 +1,75 @@
+package diff
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestSampleOffsets(t *testing.T) {
+	tests := []struct {
+		name             string
+		size, sampleSize int64
+		n                int
+		want             []int64
+	}{
+		{"one sample is centred", 100, 10, 1, []int64{45}},
+		{"two samples at the ends", 100, 10, 2, []int64{0, 90}},
+		{"even spread", 100, 10, 4, []int64{0, 30, 60, 90}},
+		{"rounded down", 101, 10, 3, []int64{0, 45, 91}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sampleOffsets(tt.size, tt.n, tt.sampleSize)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("sampleOffsets(%d, %d, %d) = %v, want %v", tt.size, tt.n, tt.sampleSize, got, tt.want)
+			}
+			for _, off := range got {
+				if off < 0 || off+tt.sampleSize > tt.size {
+					t.Fatalf("offset %d puts a %d-byte sample outside %d bytes", off, tt.sampleSize, tt.size)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareSampleModes(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	path := objectslitetest.TempFile(t, 1<<20)
+	data := objectslitetest.Data(1 << 20)
+	srv.PutObject("b", "same", data)
+	changed := slices.Clone(data)
+	changed[len(changed)/2] ^= 0xff
+	srv.PutObject("b", "changed", changed)
+
+	tests := []struct {
+		key     string
+		samples int
+		want    Status
+	}{
+		{"same", 1, Same},
+		{"same", 4, Same},
+		// The middle byte is only inside the single centred sample.
+		{"changed", 1, Differs},
+		{"changed", 2, Same},
+	}
+	for _, tt := range tests {
+		results, err := Compare(context.Background(), srv.Client(t), Options{
+			Bucket:     "b",
+			Key:        tt.key,
+			Path:       path,
+			Mode:       ModeSample,
+			Samples:    tt.samples,
+			SampleSize: 4 << 10,
+		})
+		if err != nil {
+			t.Fatalf("%s with %d samples: %v", tt.key, tt.samples, err)
+		}
+		if len(results) != 1 || results[0].Status != tt.want {
+			t.Fatalf("%s with %d samples: got %+v, want status %v", tt.key, tt.samples, results, tt.want)
+		}
+	}
+}
@@ -0,0 +1,672 @@
+// Package dirsync mirrors a local directory and a bucket prefix in either
+// direction, transferring only the files that differ.
+package dirsync
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/estimate"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Direction says which side of a sync is the source.
+type Direction string
+
+const (
+	// Up copies the local directory to the bucket prefix.
+	Up Direction = "up"
+	// Down copies the bucket prefix to the local directory.
+	Down Direction = "down"
+)
+
+// Default worker counts.
+const (
+	DefaultListWorkers     = 8
+	DefaultUploadWorkers   = 4
+	DefaultDownloadWorkers = 8
+)
+
+// DefaultMaxDeletePercent is the share of destination files Run may
+// delete when Options.MaxDeletePercent is zero.
+const DefaultMaxDeletePercent = 50
+
+// ErrTooManyDeletes is returned, before anything is transferred or
+// deleted, when a sync would delete more than Options.MaxDeletePercent of
+// the destination.
+var ErrTooManyDeletes = errors.New("too many deletions")
+
+// Compare selects how Run decides that a file must be transferred. Every
+// mode transfers files missing from the destination or whose size
+// differs; they differ in how files of the same size are treated.
+type Compare string
+
+const (
+	// CompareNewer transfers the file if the source is newer (the
+	// default).
+	CompareNewer Compare = ""
+	// CompareSizeOnly never transfers a file of the same size. It is
+	// the fastest, and misses same-size edits.
+	CompareSizeOnly Compare = "size-only"
+	// CompareExactTimestamps transfers the file unless the times match
+	// exactly, so an older remote version replaces a newer local file.
+	// Objects record their upload time rather than the file's, so this
+	// only applies to syncing down; syncing up behaves as CompareNewer.
+	CompareExactTimestamps Compare = "exact-timestamps"
+	// CompareIgnoreMtime ignores times and compares content, hashing the
+	// local file against the object's ETag. It is the most accurate and
+	// reads every same-size local file. Multipart objects only match if
+	// they were uploaded with Upload.PartSize.
+	CompareIgnoreMtime Compare = "ignore-mtime"
+	// CompareXXHash compares content by xxHash64, which is not
+	// cryptographic but several times faster to compute than MD5. Uploads
+	// record the file's hash as utils.MetaXXHash64, and same-size files
+	// cost a HeadObject each to read it back. Objects without the hash
+	// are compared as with CompareIgnoreMtime. Compressed objects are
+	// compared too, since the hash covers the uncompressed content.
+	CompareXXHash Compare = "xxhash"
+)
+
+// Options configures a sync.
+type Options struct {
+	Bucket string
+	// Prefix is the remote counterpart of Dir; keys below it map to paths
+	// below Dir.
+	Prefix    string
+	Dir       string
+	Direction Direction
+	Compare   Compare
+	// ListWorkers lists that many remote "directories" at once, so huge
+	// prefixes are not listed one page at a time. UploadWorkers and
+	// DownloadWorkers bound the files transferred at once in each
+	// direction; listing does not wait for transfer slots.
+	ListWorkers     int
+	UploadWorkers   int
+	DownloadWorkers int
+	// Upload configures each upload; its Concurrency is the number of
+	// parts of one file in flight.
+	Upload utils.UploadOptions
+	// Bandwidth, when set, caps the combined rate of the downloads and
+	// divides it evenly between the files in flight.
+	Bandwidth *utils.Bandwidth
+	// Delete removes destination files that do not exist on the source:
+	// objects under Prefix when syncing up, files under Dir when syncing
+	// down. Deletions happen after the transfers.
+	Delete bool
+	// MaxDeletePercent aborts the sync if Delete would remove more than
+	// this share of the destination's files, which usually means Dir or
+	// Prefix is wrong. Zero selects DefaultMaxDeletePercent; 100 allows
+	// any deletion.
+	MaxDeletePercent float64
+	// ConfirmDelete, when set, is called with the number and total size
+	// of the files Delete would remove, before anything is transferred.
+	// An error aborts the sync without changes; see utils.Confirm.
+	ConfirmDelete func(count int, bytes int64) error
+	// DryRun reports what would be transferred or deleted without doing
+	// it.
+	DryRun bool
+	// Estimate, when set, is called with the predicted requests and bytes
+	// of the sync once it is planned, before anything is transferred or
+	// deleted. An error aborts the sync without changes.
+	Estimate func(*estimate.Estimate) error
+	// ContinueOnError keeps the sync going after a failed transfer or
+	// deletion. Otherwise the first failure stops it: no further
+	// transfers start, no deletions happen, and the actions not attempted
+	// are reported with utils.ErrSkipped.
+	ContinueOnError bool
+	// StatePath, when set, is a file caching the outcome of the previous
+	// sync (see State). Local files unchanged since then are skipped
+	// without comparing them, and when syncing up without Delete the
+	// remote prefix is not even listed. In that case objects changed or
+	// deleted by someone else go unnoticed until the state file is
+	// removed.
+	StatePath string
+}
+
+func (o *Options) setDefaults() {
+	if o.ListWorkers <= 0 {
+		o.ListWorkers = DefaultListWorkers
+	}
+	if o.UploadWorkers <= 0 {
+		o.UploadWorkers = DefaultUploadWorkers
+	}
+	if o.DownloadWorkers <= 0 {
+		o.DownloadWorkers = DefaultDownloadWorkers
+	}
+	if o.MaxDeletePercent <= 0 {
+		o.MaxDeletePercent = DefaultMaxDeletePercent
+	}
+	o.Prefix = withSlash(o.Prefix)
+}
+
+// withSlash ends a non-empty prefix with "/", so it names a directory.
+func withSlash(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return prefix + "/"
+	}
+	return prefix
+}
+
+// Op is what a sync does with one file.
+type Op string
+
+const (
+	OpUpload   Op = "upload"
+	OpDownload Op = "download"
+	// OpDelete removes a destination file missing from the source.
+	OpDelete Op = "delete"
+)
+
+// File describes one side of a file: Key is relative to the prefix (and
+// to Dir, with slashes).
+type File struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	// ETag is set for remote files.
+	ETag string
+}
+
+// Action is one transfer a sync performs.
+type Action struct {
+	Op  Op
+	Key string
+	// Path is the local file.
+	Path string
+	Size int64
+	// Reason says why the file is transferred.
+	Reason string
+}
+
+// Result is the outcome of one action.
+type Result struct {
+	Action
+	Err error
+}
+
+// Summary counts the outcome of a sync.
+type Summary struct {
+	// Remote is the number of objects listed, or known from the state
+	// file when the listing was skipped.
+	Local, Remote int
+	Transferred   int
+	Unchanged     int
+	Deleted       int
+	Failed        int
+	// Skipped counts the actions not attempted because an earlier one
+	// failed.
+	Skipped int
+	Bytes   int64
+}
+
+// Run compares Dir and Prefix and copies every file that is missing or
+// differs on the destination, calling report for each transfer. A file
+// differs when the sizes differ or the source is newer. With opts.Delete,
+// destination files missing from the source are then deleted. Failed
+// and skipped transfers and deletions are counted in the summary, not
+// returned.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options, report func(Result)) (Summary, error) {
+	opts.setDefaults()
+	opts.Upload.ShareMemory()
+	if opts.Direction != Up && opts.Direction != Down {
+		return Summary{}, fmt.Errorf("unknown sync direction %q", opts.Direction)
+	}
+	switch opts.Compare {
+	case CompareNewer, CompareSizeOnly, CompareExactTimestamps, CompareIgnoreMtime, CompareXXHash:
+	default:
+		return Summary{}, fmt.Errorf("unknown sync comparison %q", opts.Compare)
+	}
+
+	var state *State
+	if opts.StatePath != "" {
+		var err error
+		if state, err = LoadState(opts.StatePath, opts); err != nil {
+			return Summary{}, err
+		}
+	}
+	// Without deletions, syncing up only needs the remote side for files
+	// the state cannot vouch for, so a warm state skips the listing.
+	skipListing := state != nil && len(state.Files) > 0 && opts.Direction == Up && !opts.Delete
+
+	var local, remote map[string]File
+	var localErr, remoteErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		local, localErr = ListLocal(opts.Dir)
+	}()
+	go func() {
+		defer wg.Done()
+		if !skipListing {
+			remote, remoteErr = ListRemote(ctx, svc, opts.Bucket, opts.Prefix, opts.ListWorkers)
+		}
+	}()
+	wg.Wait()
+	if err := errors.Join(localErr, remoteErr); err != nil {
+		return Summary{}, err
+	}
+
+	sum := Summary{Local: len(local), Remote: len(remote)}
+	if skipListing {
+		sum.Remote = len(state.Files)
+	}
+	var next *State
+	if state != nil {
+		next = &State{Bucket: state.Bucket, Prefix: state.Prefix, Dir: state.Dir, Files: map[string]StateEntry{}}
+	}
+	src, dst, op, workers := local, remote, OpUpload, opts.UploadWorkers
+	if opts.Direction == Down {
+		src, dst, op, workers = remote, local, OpDownload, opts.DownloadWorkers
+	}
+	var actions []Action
+	for _, key := range sortedKeys(src) {
+		path, err := downloads.LocalPath(opts.Dir, key)
+		if err != nil {
+			return sum, err
+		}
+		d, exists := dst[key]
+		reason := ""
+		if state != nil {
+			if e, ok := state.unchanged(local[key]); ok && (skipListing || remote[key].ETag == e.ETag) {
+				sum.Unchanged++
+				next.Files[key] = e
+				continue
+			}
+		}
+		if skipListing {
+			reason = "changed since last sync"
+		} else if reason, err = opts.differs(ctx, svc, src[key], d, exists, path); err != nil {
+			return sum, err
+		}
+		if reason == "" {
+			sum.Unchanged++
+			if next != nil {
+				next.Files[key] = StateEntry{Size: local[key].Size, ModTime: local[key].ModTime, ETag: remote[key].ETag}
+			}
+			continue
+		}
+		actions = append(actions, Action{Op: op, Key: key, Path: path, Size: src[key].Size, Reason: reason})
+	}
+
+	var deletes []Action
+	if opts.Delete {
+		for _, key := range sortedKeys(dst) {
+			if _, ok := src[key]; ok {
+				continue
+			}
+			path, err := downloads.LocalPath(opts.Dir, key)
+			if err != nil {
+				return sum, err
+			}
+			deletes = append(deletes, Action{Op: OpDelete, Key: key, Path: path, Size: dst[key].Size, Reason: "not on source"})
+		}
+		if pct := 100 * float64(len(deletes)) / float64(max(len(dst), 1)); pct > opts.MaxDeletePercent {
+			return sum, fmt.Errorf("%w: %d of %d destination files (%.0f%%) are not on the source, above the %.0f%% limit",
+				ErrTooManyDeletes, len(deletes), len(dst), pct, opts.MaxDeletePercent)
+		}
+		if err := confirmDeletes(opts.ConfirmDelete, opts.DryRun, deletes); err != nil {
+			return sum, err
+		}
+	}
+	if opts.Estimate != nil {
+		e := &estimate.Estimate{Workers: workers}
+		for _, a := range actions {
+			if op == OpUpload {
+				e.Upload(a.Size, opts.Upload)
+			} else {
+				e.Download(a.Size)
+			}
+		}
+		if opts.Direction == Up {
+			e.Delete(len(deletes))
+		}
+		if err := opts.Estimate(e); err != nil {
+			return sum, err
+		}
+	}
+
+	// finish saves whatever was synced, even if the run is cut short.
+	finish := func(err error) (Summary, error) {
+		if next != nil && !opts.DryRun {
+			if serr := next.Save(opts.StatePath); err == nil {
+				err = serr
+			}
+		}
+		return sum, err
+	}
+
+	var mu sync.Mutex
+	errs := utils.ForEachErr(ctx, len(actions), workers, opts.ContinueOnError, func(i int) error {
+		a := actions[i]
+		var entry StateEntry
+		var err error
+		if !opts.DryRun {
+			entry, err = transfer(ctx, svc, opts, a, src[a.Key])
+		}
+		mu.Lock()
+		if err != nil {
+			sum.Failed++
+		} else {
+			sum.Transferred++
+			sum.Bytes += a.Size
+			if next != nil {
+				next.Files[a.Key] = entry
+			}
+		}
+		mu.Unlock()
+		report(Result{Action: a, Err: err})
+		return err
+	})
+	reportSkipped(&sum, actions, errs, report)
+	if ctx.Err() != nil || len(deletes) == 0 {
+		return finish(ctx.Err())
+	}
+
+	errs = make([]error, len(deletes))
+	var err error
+	switch {
+	case !opts.ContinueOnError && sum.Failed > 0:
+		skipRest(errs, 0)
+	case opts.DryRun:
+	case opts.Direction == Up:
+		err = deleteObjects(ctx, svc, opts.Bucket, opts.Prefix, deletes, errs, opts.ContinueOnError)
+	default:
+		for i, a := range deletes {
+			if errs[i] = os.Remove(a.Path); errs[i] != nil && !opts.ContinueOnError {
+				skipRest(errs, i+1)
+				break
+			}
+		}
+	}
+	countDeletes(&sum, deletes, errs, report)
+	if err != nil {
+		return finish(err)
+	}
+	return finish(ctx.Err())
+}
+
+// confirmDeletes asks confirm, if set, about the deletions of a sync that
+// is not a dry run.
+func confirmDeletes(confirm func(int, int64) error, dryRun bool, deletes []Action) error {
+	if confirm == nil || dryRun || len(deletes) == 0 {
+		return nil
+	}
+	var bytes int64
+	for _, a := range deletes {
+		bytes += a.Size
+	}
+	return confirm(len(deletes), bytes)
+}
+
+// reportSkipped counts and reports the actions ForEachErr never started
+// because an earlier one failed.
+func reportSkipped(sum *Summary, actions []Action, errs []error, report func(Result)) {
+	for i, err := range errs {
+		if errors.Is(err, utils.ErrSkipped) {
+			sum.Skipped++
+			report(Result{Action: actions[i], Err: err})
+		}
+	}
+}
+
+// countDeletes counts and reports the outcome of each deletion.
+func countDeletes(sum *Summary, deletes []Action, errs []error, report func(Result)) {
+	for i, a := range deletes {
+		switch {
+		case errors.Is(errs[i], utils.ErrSkipped):
+			sum.Skipped++
+		case errs[i] != nil:
+			sum.Failed++
+		default:
+			sum.Deleted++
+		}
+		report(Result{Action: a, Err: errs[i]})
+	}
+}
+
+// skipRest marks errs from index start on as skipped.
+func skipRest(errs []error, start int) {
+	for i := start; i < len(errs); i++ {
+		errs[i] = utils.ErrSkipped
+	}
+}
+
+// deleteObjects deletes the objects of actions with utils.DeleteObjects,
+// DefaultConcurrency batches at a time, recording each key's error at the
+// same index of errs. Unless continueOnError is set, no batch starts
+// after one with a failure. The error is that of the deletion as a whole,
+// such as ctx being cancelled; every key without an outcome of its own
+// fails with it.
+func deleteObjects(ctx context.Context, svc s3iface.S3API, bucket, prefix string, actions []Action, errs []error, continueOnError bool) error {
+	keys := make([]string, len(actions))
+	for i, a := range actions {
+		keys[i] = prefix + a.Key
+	}
+	deleted, err := utils.DeleteObjects(ctx, svc, bucket, keys, utils.DeleteOptions{StopOnError: !continueOnError})
+	for i := range errs {
+		if i < len(deleted) {
+			errs[i] = deleted[i].Err
+		} else {
+			errs[i] = err
+		}
+	}
+	return err
+}
+
+// differs returns why src must be copied over dst, or "" if it need not.
+// path is the local side of the pair.
+//
+// Objects compressed by o.Upload.Compression differ in size and ETag from
+// their files, so files the policy matches are compared by time alone,
+// or by their recorded xxHash64.
+func (o *Options) differs(ctx context.Context, svc s3iface.S3API, src, dst File, exists bool, path string) (string, error) {
+	compressed := o.Upload.Compression.Matches(path)
+	switch {
+	case !exists:
+		return "missing", nil
+	case src.Size != dst.Size && !compressed:
+		return "size differs", nil
+	}
+	mode := o.Compare
+	var recorded string
+	if mode == CompareXXHash {
+		head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(o.Bucket),
+			Key:    aws.String(o.Prefix + src.Key),
+		})
+		if err != nil {
+			return "", fmt.Errorf("head %s: %w", o.Prefix+src.Key, err)
+		}
+		if recorded = utils.MetadataValue(head.Metadata, utils.MetaXXHash64); recorded == "" {
+			mode = CompareIgnoreMtime
+		}
+	}
+	if compressed && mode != CompareSizeOnly && mode != CompareExactTimestamps && mode != CompareXXHash {
+		mode = CompareNewer
+	}
+	switch mode {
+	case CompareSizeOnly:
+	case CompareExactTimestamps:
+		if o.Direction == Down && !src.ModTime.Equal(dst.ModTime) {
+			return "time differs", nil
+		}
+		if o.Direction == Up && src.ModTime.After(dst.ModTime) {
+			return "source newer", nil
+		}
+	case CompareIgnoreMtime:
+		etag := cmp.Or(src.ETag, dst.ETag) // only the remote side has one
+		same, err := utils.MatchesETag(path, etag, cmp.Or(o.Upload.PartSize, utils.DefaultPartSize))
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return "content differs", nil
+		}
+	case CompareXXHash:
+		sum, err := manifest.HashFile(path, manifest.XXHash64)
+		if err != nil {
+			return "", err
+		}
+		if sum != recorded {
+			return "content differs", nil
+		}
+	default:
+		if src.ModTime.After(dst.ModTime) {
+			return "source newer", nil
+		}
+	}
+	return "", nil
+}
+
+// transfer copies one file and returns the state entry for the result.
+func transfer(ctx context.Context, svc s3iface.S3API, opts Options, a Action, src File) (StateEntry, error) {
+	if a.Op == OpUpload {
+		up := opts.Upload
+		if opts.Compare == CompareXXHash {
+			sum, err := manifest.HashFile(a.Path, manifest.XXHash64)
+			if err != nil {
+				return StateEntry{}, err
+			}
+			up.Metadata = maps.Clone(up.Metadata)
+			if up.Metadata == nil {
+				up.Metadata = map[string]*string{}
+			}
+			up.Metadata[utils.MetaXXHash64] = aws.String(sum)
+		}
+		out, err := utils.Upload(ctx, svc, opts.Bucket, opts.Prefix+a.Key, a.Path, up)
+		if err != nil {
+			return StateEntry{}, err
+		}
+		return StateEntry{Size: src.Size, ModTime: src.ModTime, ETag: out.ETag}, nil
+	}
+	if _, err := downloads.DownloadFileLimited(ctx, svc, opts.Bucket, opts.Prefix+a.Key, a.Path, opts.Bandwidth); err != nil {
+		return StateEntry{}, err
+	}
+	// Match the object's time so the next sync sees the file as current.
+	if err := os.Chtimes(a.Path, src.ModTime, src.ModTime); err != nil {
+		return StateEntry{}, err
+	}
+	// The file system may store the time at a coarser precision.
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return StateEntry{}, err
+	}
+	return StateEntry{Size: info.Size(), ModTime: info.ModTime(), ETag: src.ETag}, nil
+}
+
+// ListLocal returns the regular files under dir keyed by their slash
+// separated relative path.
+func ListLocal(dir string) (map[string]File, error) {
+	files := make(map[string]File)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				// Downloading into a directory that does not exist yet.
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		files[key] = File{Key: key, Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// ListRemote returns the objects under prefix keyed by their key relative
+// to it. Each level of "/"-delimited common prefixes is listed in
+// parallel, up to workers listings at once. Directory markers are
+// skipped.
+func ListRemote(ctx context.Context, svc s3iface.S3API, bucket, prefix string, workers int) (map[string]File, error) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string]File)
+		errs    []error
+		wg      sync.WaitGroup
+	)
+	sem := make(chan struct{}, max(workers, 1))
+	var list func(p string)
+	list = func(p string) {
+		defer wg.Done()
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		var subs []string
+		err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket:    aws.String(bucket),
+			Prefix:    aws.String(p),
+			Delimiter: aws.String("/"),
+		}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, o := range page.Contents {
+				key := strings.TrimPrefix(aws.StringValue(o.Key), prefix)
+				if key == "" || strings.HasSuffix(key, "/") {
+					continue
+				}
+				objects[key] = File{Key: key, Size: aws.Int64Value(o.Size), ModTime: aws.TimeValue(o.LastModified), ETag: aws.StringValue(o.ETag)}
+			}
+			for _, cp := range page.CommonPrefixes {
+				subs = append(subs, aws.StringValue(cp.Prefix))
+			}
+			return true
+		})
+		<-sem
+		if err != nil {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("list %s: %w", p, err))
+			mu.Unlock()
+			return
+		}
+		for _, sub := range subs {
+			wg.Add(1)
+			go list(sub)
+		}
+	}
+	wg.Add(1)
+	list(prefix)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return objects, errors.Join(errs...)
+}
+
+func sortedKeys(m map[string]File) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+package dirsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestRunDeleteGuards(t *testing.T) {
+	// The local side keeps a.bin; b.bin, c.bin and d.bin exist only in the
+	// bucket, so syncing up with Delete removes 3 of 4 objects (75%).
+	tests := []struct {
+		name       string
+		maxPercent float64
+		dryRun     bool
+		confirm    error
+		wantErr    error
+		wantAsked  bool
+		wantKeys   []string
+	}{
+		{name: "above the default threshold", wantErr: ErrTooManyDeletes,
+			wantKeys: []string{"p/a.bin", "p/b.bin", "p/c.bin", "p/d.bin"}},
+		{name: "just above a raised threshold", maxPercent: 74, wantErr: ErrTooManyDeletes,
+			wantKeys: []string{"p/a.bin", "p/b.bin", "p/c.bin", "p/d.bin"}},
+		{name: "at a raised threshold", maxPercent: 75, wantAsked: true, wantKeys: []string{"p/a.bin"}},
+		{name: "declined", maxPercent: 100, confirm: utils.ErrNotConfirmed, wantErr: utils.ErrNotConfirmed, wantAsked: true,
+			wantKeys: []string{"p/a.bin", "p/b.bin", "p/c.bin", "p/d.bin"}},
+		{name: "dry run does not ask", maxPercent: 100, dryRun: true,
+			wantKeys: []string{"p/a.bin", "p/b.bin", "p/c.bin", "p/d.bin"}},
+		{name: "confirmed", maxPercent: 100, wantAsked: true, wantKeys: []string{"p/a.bin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			dir := objectslitetest.TempTree(t, map[string]int64{"a.bin": 100})
+			for _, k := range []string{"a.bin", "b.bin", "c.bin", "d.bin"} {
+				srv.PutObject("b", "p/"+k, objectslitetest.Data(100))
+			}
+
+			var asked bool
+			var askedCount int
+			var askedBytes int64
+			sum, err := Run(context.Background(), srv.Client(t), Options{
+				Bucket:           "b",
+				Prefix:           "p",
+				Dir:              dir,
+				Direction:        Up,
+				Compare:          CompareSizeOnly,
+				Delete:           true,
+				MaxDeletePercent: tt.maxPercent,
+				DryRun:           tt.dryRun,
+				ConfirmDelete: func(count int, bytes int64) error {
+					asked, askedCount, askedBytes = true, count, bytes
+					return tt.confirm
+				},
+			}, func(Result) {})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if asked != tt.wantAsked {
+				t.Fatalf("confirmation asked: %v, want %v", asked, tt.wantAsked)
+			}
+			if asked && (askedCount != 3 || askedBytes != 300) {
+				t.Fatalf("confirmation asked about %d objects of %d bytes, want 3 of 300", askedCount, askedBytes)
+			}
+			if err == nil && !tt.dryRun && sum.Deleted != 3 {
+				t.Fatalf("summary counts %d deletions, want 3", sum.Deleted)
+			}
+			objectslitetest.AssertKeys(t, srv, "b", tt.wantKeys...)
+		})
+	}
+}
+
+func TestRunCompareXXHash(t *testing.T) {
+	data := objectslitetest.Data(100)
+	edited := bytes.Clone(data)
+	edited[0]++
+	tests := []struct {
+		name      string
+		direction Direction
+		remote    []byte
+		recorded  bool // remote was uploaded by a sync recording its hash
+		local     []byte
+		want      string // reason for the transfer, "" for none
+	}{
+		{name: "recorded, same content", direction: Up, remote: data, recorded: true, local: data},
+		{name: "recorded, same-size edit", direction: Up, remote: data, recorded: true, local: edited, want: "content differs"},
+		{name: "not recorded, same content", direction: Up, remote: data, local: data},
+		{name: "not recorded, same-size edit", direction: Up, remote: data, local: edited, want: "content differs"},
+		{name: "down, same-size edit", direction: Down, remote: data, recorded: true, local: edited, want: "content differs"},
+		{name: "down, same content", direction: Down, remote: data, recorded: true, local: data},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			client := srv.Client(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "a.bin")
+			opts := Options{Bucket: "b", Prefix: "p", Dir: dir, Direction: Up, Compare: CompareXXHash}
+			if err := os.WriteFile(path, tt.remote, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.recorded {
+				if _, err := Run(ctx, client, opts, func(Result) {}); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				srv.PutObject("b", "p/a.bin", tt.remote)
+			}
+			if obj, _ := srv.Object("b", "p/a.bin"); (obj.Metadata[utils.MetaXXHash64] != "") != tt.recorded {
+				t.Fatalf("object metadata %v, want the hash recorded: %v", obj.Metadata, tt.recorded)
+			}
+			// Times alone would never transfer the edit: the file is older
+			// than the object going up, and newer going down.
+			mtime := time.Now().Add(-time.Hour)
+			if tt.direction == Down {
+				mtime = time.Now().Add(time.Hour)
+			}
+			if err := os.WriteFile(path, tt.local, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			opts.Direction = tt.direction
+			var got []Result
+			sum, err := Run(ctx, client, opts, func(r Result) { got = append(got, r) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if sum.Transferred != 0 {
+					t.Fatalf("transferred %+v, want nothing", got)
+				}
+				return
+			}
+			if sum.Transferred != 1 || got[0].Reason != tt.want || got[0].Err != nil {
+				t.Fatalf("transferred %+v, want a.bin because %s", got, tt.want)
+			}
+			if tt.direction == Up {
+				objectslitetest.AssertObject(t, srv, "b", "p/a.bin", tt.local)
+				if obj, _ := srv.Object("b", "p/a.bin"); obj.Metadata[utils.MetaXXHash64] == "" {
+					t.Fatal("upload did not record the hash")
+				}
+			} else if b, _ := os.ReadFile(path); !bytes.Equal(b, tt.remote) {
+				t.Fatal("download did not replace the edited file")
+			}
+		})
+	}
+}
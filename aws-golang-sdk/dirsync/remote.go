@@ -0,0 +1,211 @@
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/estimate"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DefaultCopyWorkers is the number of objects copied at once when
+// RemoteOptions.CopyWorkers is zero.
+const DefaultCopyWorkers = 8
+
+// OpCopy copies an object from the source prefix to the destination.
+const OpCopy Op = "copy"
+
+// Location is one side of a bucket-to-bucket sync.
+type Location struct {
+	Svc    s3iface.S3API
+	Bucket string
+	Prefix string
+}
+
+// RemoteOptions configures RunRemote.
+type RemoteOptions struct {
+	Source, Dest Location
+	// ServerSide copies with CopyObject/UploadPartCopy issued to
+	// Dest.Svc, so data never passes through the client. It requires
+	// both locations on the same endpoint, with Dest's credentials able
+	// to read the source. Otherwise each object is streamed from Source
+	// to Dest, without its content type and user metadata.
+	ServerSide bool
+	// Compare works as for Run; CompareExactTimestamps behaves as
+	// CompareNewer, since copies get a new modification time.
+	// CompareIgnoreMtime and CompareXXHash compare ETags, which only match
+	// for objects that were not copied part by part.
+	Compare     Compare
+	ListWorkers int
+	CopyWorkers int
+	// Copy tunes server-side copies and Upload streamed ones.
+	Copy   utils.CopyOptions
+	Upload utils.UploadOptions
+	// Delete, MaxDeletePercent, ConfirmDelete and DryRun work as for
+	// Run, applied to Dest.
+	Delete           bool
+	MaxDeletePercent float64
+	ConfirmDelete    func(count int, bytes int64) error
+	DryRun           bool
+	// Estimate works as for Run.
+	Estimate func(*estimate.Estimate) error
+	// ContinueOnError works as for Run.
+	ContinueOnError bool
+}
+
+// RunRemote compares two bucket prefixes, possibly on different
+// endpoints, and copies every object that is missing or differs on Dest,
+// calling report for each copy and deletion. Failed and skipped actions
+// are counted in the summary, not returned. Summary.Local counts the source objects and
+// Summary.Remote the destination ones.
+func RunRemote(ctx context.Context, opts RemoteOptions, report func(Result)) (Summary, error) {
+	if opts.ListWorkers <= 0 {
+		opts.ListWorkers = DefaultListWorkers
+	}
+	if opts.CopyWorkers <= 0 {
+		opts.CopyWorkers = DefaultCopyWorkers
+	}
+	if opts.MaxDeletePercent <= 0 {
+		opts.MaxDeletePercent = DefaultMaxDeletePercent
+	}
+	for _, loc := range []*Location{&opts.Source, &opts.Dest} {
+		loc.Prefix = withSlash(loc.Prefix)
+	}
+
+	var src, dst map[string]File
+	var srcErr, dstErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		src, srcErr = ListRemote(ctx, opts.Source.Svc, opts.Source.Bucket, opts.Source.Prefix, opts.ListWorkers)
+	}()
+	go func() {
+		defer wg.Done()
+		dst, dstErr = ListRemote(ctx, opts.Dest.Svc, opts.Dest.Bucket, opts.Dest.Prefix, opts.ListWorkers)
+	}()
+	wg.Wait()
+	if err := errors.Join(srcErr, dstErr); err != nil {
+		return Summary{}, err
+	}
+
+	sum := Summary{Local: len(src), Remote: len(dst)}
+	var actions, deletes []Action
+	for _, key := range sortedKeys(src) {
+		d, exists := dst[key]
+		if reason := remoteDiffers(opts.Compare, src[key], d, exists); reason != "" {
+			actions = append(actions, Action{Op: OpCopy, Key: key, Size: src[key].Size, Reason: reason})
+		} else {
+			sum.Unchanged++
+		}
+	}
+	if opts.Delete {
+		for _, key := range sortedKeys(dst) {
+			if _, ok := src[key]; !ok {
+				deletes = append(deletes, Action{Op: OpDelete, Key: key, Size: dst[key].Size, Reason: "not on source"})
+			}
+		}
+		if pct := 100 * float64(len(deletes)) / float64(max(len(dst), 1)); pct > opts.MaxDeletePercent {
+			return sum, fmt.Errorf("%w: %d of %d destination objects (%.0f%%) are not on the source, above the %.0f%% limit",
+				ErrTooManyDeletes, len(deletes), len(dst), pct, opts.MaxDeletePercent)
+		}
+		if err := confirmDeletes(opts.ConfirmDelete, opts.DryRun, deletes); err != nil {
+			return sum, err
+		}
+	}
+	if opts.Estimate != nil {
+		e := &estimate.Estimate{Workers: opts.CopyWorkers}
+		for _, a := range actions {
+			if opts.ServerSide {
+				e.Copy(a.Size, opts.Copy)
+			} else {
+				e.Stream(a.Size, opts.Upload)
+			}
+		}
+		e.Delete(len(deletes))
+		if err := opts.Estimate(e); err != nil {
+			return sum, err
+		}
+	}
+
+	var mu sync.Mutex
+	errs := utils.ForEachErr(ctx, len(actions), opts.CopyWorkers, opts.ContinueOnError, func(i int) error {
+		a := actions[i]
+		var err error
+		if !opts.DryRun {
+			err = copyObject(ctx, opts, a.Key)
+		}
+		mu.Lock()
+		if err != nil {
+			sum.Failed++
+		} else {
+			sum.Transferred++
+			sum.Bytes += a.Size
+		}
+		mu.Unlock()
+		report(Result{Action: a, Err: err})
+		return err
+	})
+	reportSkipped(&sum, actions, errs, report)
+	if ctx.Err() != nil || len(deletes) == 0 {
+		return sum, ctx.Err()
+	}
+
+	errs = make([]error, len(deletes))
+	var err error
+	switch {
+	case !opts.ContinueOnError && sum.Failed > 0:
+		skipRest(errs, 0)
+	case !opts.DryRun:
+		err = deleteObjects(ctx, opts.Dest.Svc, opts.Dest.Bucket, opts.Dest.Prefix, deletes, errs, opts.ContinueOnError)
+	}
+	countDeletes(&sum, deletes, errs, report)
+	if err != nil {
+		return sum, err
+	}
+	return sum, ctx.Err()
+}
+
+func remoteDiffers(mode Compare, src, dst File, exists bool) string {
+	switch {
+	case !exists:
+		return "missing"
+	case src.Size != dst.Size:
+		return "size differs"
+	}
+	switch mode {
+	case CompareSizeOnly:
+	case CompareIgnoreMtime, CompareXXHash:
+		if !utils.SameETag(src.ETag, dst.ETag) {
+			return "ETag differs"
+		}
+	default:
+		if src.ModTime.After(dst.ModTime) {
+			return "source newer"
+		}
+	}
+	return ""
+}
+
+func copyObject(ctx context.Context, opts RemoteOptions, key string) error {
+	srcKey, dstKey := opts.Source.Prefix+key, opts.Dest.Prefix+key
+	if opts.ServerSide {
+		return utils.ServerSideCopy(ctx, opts.Dest.Svc, opts.Source.Bucket, srcKey, opts.Dest.Bucket, dstKey, opts.Copy)
+	}
+	out, err := opts.Source.Svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(opts.Source.Bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return fmt.Errorf("get %s: %w", srcKey, err)
+	}
+	defer out.Body.Close()
+	_, err = utils.UploadStream(ctx, opts.Dest.Svc, opts.Dest.Bucket, dstKey, out.Body, opts.Upload)
+	return err
+}
@@ -0,0 +1,81 @@
+package dirsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateEntry is what the last sync recorded about one file.
+type StateEntry struct {
+	// Size and ModTime describe the local file.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// ETag is the object's ETag.
+	ETag string `json:"etag"`
+}
+
+// State caches the outcome of the previous sync of one directory and
+// prefix. A local file whose size and modification time still match its
+// entry is known to be in sync with the object that has the recorded
+// ETag, so it is neither hashed nor compared again.
+type State struct {
+	Bucket string                `json:"bucket"`
+	Prefix string                `json:"prefix"`
+	Dir    string                `json:"dir"`
+	Files  map[string]StateEntry `json:"files"`
+}
+
+// LoadState reads the state file at path. A missing file, or one written
+// for a different bucket, prefix or directory, yields an empty state.
+func LoadState(path string, opts Options) (*State, error) {
+	s := &State{Bucket: opts.Bucket, Prefix: opts.Prefix, Dir: opts.Dir, Files: map[string]StateEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved State
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse sync state %s: %w", path, err)
+	}
+	if saved.Bucket != s.Bucket || saved.Prefix != s.Prefix || saved.Dir != s.Dir || saved.Files == nil {
+		return s, nil
+	}
+	return &saved, nil
+}
+
+// Save writes s to path, replacing it atomically.
+func (s *State) Save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// unchanged reports whether the local file still matches its entry, and
+// returns the entry.
+func (s *State) unchanged(local File) (StateEntry, bool) {
+	e, ok := s.Files[local.Key]
+	return e, ok && e.Size == local.Size && e.ModTime.Equal(local.ModTime)
+}
@@ -0,0 +1,82 @@
+package downloads
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DefaultMaxObjectBytes is the largest object GetObjectBytes reads.
+const DefaultMaxObjectBytes int64 = 64 << 20
+
+// ErrObjectTooLarge is matched, with errors.Is, by the error of
+// GetObjectBytes for an object over its limit.
+var ErrObjectTooLarge = errors.New("object too large to read into memory")
+
+// GetObjectBytes returns the content of a small object, such as a
+// configuration file or a manifest, without going through a temporary
+// file. It refuses objects over DefaultMaxObjectBytes; use
+// GetObjectBytesLimited for another limit and DownloadFile or Stream for
+// anything that may be large. The content is verified and decompressed as
+// DownloadFile does.
+func GetObjectBytes(ctx context.Context, svc s3iface.S3API, bucket, key string) ([]byte, error) {
+	return GetObjectBytesLimited(ctx, svc, bucket, key, DefaultMaxObjectBytes)
+}
+
+// GetObjectBytesLimited is GetObjectBytes refusing objects over limit
+// bytes, counted after decompression. The object's Content-Length is
+// checked before the body is read, and the body is cut off at the limit
+// in case the length was not sent.
+func GetObjectBytesLimited(ctx context.Context, svc s3iface.S3API, bucket, key string, limit int64) ([]byte, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	compressed := isCompressed(out)
+	if !compressed && aws.Int64Value(out.ContentLength) > limit {
+		return nil, fmt.Errorf("get %s: %d bytes: %w (limit %d)", key, *out.ContentLength, ErrObjectTooLarge, limit)
+	}
+	v := newVerifier(key, out.Metadata, out.ChecksumCRC32C, out.ChecksumSHA256, compressed)
+	body := &countingReader{r: io.TeeReader(out.Body, v.writer(false))}
+	var r io.Reader = body
+	if compressed {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("get %s: %w", key, err)
+		}
+		r = io.TeeReader(zr, v.writer(true))
+	}
+	var buf bytes.Buffer
+	if out.ContentLength != nil && !compressed {
+		buf.Grow(int(*out.ContentLength))
+	}
+	// Reading one byte past the limit tells an object of exactly limit
+	// bytes from a larger one.
+	n, err := buf.ReadFrom(io.LimitReader(r, limit+1))
+	if err == nil && n > limit {
+		err = fmt.Errorf("over %d bytes: %w", limit, ErrObjectTooLarge)
+	}
+	if err == nil && out.ContentLength != nil && body.n != *out.ContentLength {
+		err = fmt.Errorf("got %d of %d bytes", body.n, *out.ContentLength)
+	}
+	if err == nil {
+		err = v.verify()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return buf.Bytes(), nil
+}
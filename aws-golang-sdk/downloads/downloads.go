@@ -0,0 +1,130 @@
+// Package downloads fetches objects to local files, writers and memory.
+//
+// DownloadFile and GetObject read an object with one GET, and
+// GetObjectBytes reads a small one into memory. ResumableDownload (also
+// available as ConcurrentMultipartDownload) splits a large object into
+// ranges fetched by a pool of workers and written at their offsets of the
+// destination file, and Stream fetches ranges ahead
+// of a writer that needs the bytes in order. RangeGet reads a single byte
+// range. Every whole-object download is checked against the object's
+// checksums.
+package downloads
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DownloadFile writes the object to path. The body is written to a
+// temporary file next to path and renamed into place only once it is
+// complete, so path never holds a partial download. It returns the number
+// of bytes written. Objects gzipped by a utils.CompressionPolicy are
+// decompressed.
+//
+// The content is checked against the x-amz-meta-sha256 metadata and the
+// x-amz-checksum-* headers the object has, if any. On a mismatch the
+// temporary file is removed and the error matches ErrChecksumMismatch.
+func DownloadFile(ctx context.Context, svc s3iface.S3API, bucket, key, path string) (int64, error) {
+	return DownloadFileLimited(ctx, svc, bucket, key, path, nil)
+}
+
+// DownloadFileLimited is DownloadFile reading the body at its turn of bw,
+// which the other downloads of the process may share.
+func DownloadFileLimited(ctx context.Context, svc s3iface.S3API, bucket, key, path string, bw *utils.Bandwidth) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".part*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := getObject(ctx, svc, bucket, key, tmp, bw)
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("download %s: %w", key, cerr)
+	}
+	if err == nil {
+		if rerr := os.Rename(tmp.Name(), path); rerr != nil {
+			err = fmt.Errorf("download %s: %w", key, rerr)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// GetObject writes the object to w with a single GET, decompressed and
+// verified as DownloadFile does, and returns the number of bytes written.
+// w has every byte by the time the checksums are compared, so on an
+// error matching ErrChecksumMismatch the caller must discard what it
+// wrote. For large objects ResumableDownload and Stream fetch ranges in
+// parallel instead.
+func GetObject(ctx context.Context, svc s3iface.S3API, bucket, key string, w io.Writer) (int64, error) {
+	return getObject(ctx, svc, bucket, key, w, nil)
+}
+
+func getObject(ctx context.Context, svc s3iface.S3API, bucket, key string, w io.Writer, bw *utils.Bandwidth) (int64, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	compressed := isCompressed(out)
+	v := newVerifier(key, out.Metadata, out.ChecksumCRC32C, out.ChecksumSHA256, compressed)
+	body := &countingReader{r: io.TeeReader(bw.Flow().Reader(ctx, out.Body), v.writer(false))}
+	var n int64
+	if compressed {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(body); err == nil {
+			n, err = io.Copy(io.MultiWriter(w, v.writer(true)), zr)
+		}
+	} else {
+		n, err = io.Copy(w, body)
+	}
+	if err == nil && out.ContentLength != nil && body.n != *out.ContentLength {
+		err = fmt.Errorf("got %d of %d bytes", body.n, *out.ContentLength)
+	}
+	if err == nil {
+		err = v.verify()
+	}
+	if err != nil {
+		return n, fmt.Errorf("download %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// isCompressed reports whether the object was gzipped by a compression
+// policy. When the HTTP transport has already decompressed the body it
+// drops Content-Encoding, so the body is not decompressed twice.
+func isCompressed(out *s3.GetObjectOutput) bool {
+	return aws.StringValue(out.ContentEncoding) == "gzip" &&
+		utils.MetadataValue(out.Metadata, utils.MetaUncompressedSize) != ""
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,125 @@
+package downloads
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DefaultRetries is the number of retries per object when
+// ManifestOptions.Retries is zero.
+const DefaultRetries = 3
+
+// ManifestOptions configures FromManifest.
+type ManifestOptions struct {
+	Bucket string
+	// Prefix is prepended to every manifest key.
+	Prefix string
+	// Dir receives the files, at the manifest keys' relative paths.
+	Dir string
+	// Retries is the number of retries for each object. Zero selects
+	// DefaultRetries; negative disables retries.
+	Retries     int
+	Concurrency int
+	// Verify checks each downloaded file against the size and hash the
+	// manifest records for it, and retries on a mismatch.
+	Verify bool
+	// Bandwidth, when set, caps the combined rate of the downloads and
+	// shares it evenly between the objects in flight.
+	Bandwidth *utils.Bandwidth
+	// Logger receives log messages such as retries. Nil selects
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// Result is the outcome for one manifest entry.
+type Result struct {
+	Key      string
+	Path     string
+	Size     int64
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+}
+
+// FromManifest downloads every entry with up to opts.Concurrency objects
+// in flight and returns the results in manifest order. report, if not
+// nil, is called as each object finishes and may be called concurrently.
+func FromManifest(ctx context.Context, svc s3iface.S3API, entries []manifest.Entry, opts ManifestOptions, report func(Result)) []Result {
+	if opts.Retries == 0 {
+		opts.Retries = DefaultRetries
+	}
+	results := make([]Result, len(entries))
+	utils.ForEach(ctx, len(entries), opts.Concurrency, func(i int) {
+		results[i] = download(ctx, svc, entries[i], opts)
+		if report != nil {
+			report(results[i])
+		}
+	})
+	for i := range results {
+		if results[i].Key == "" {
+			results[i] = Result{Key: opts.Prefix + entries[i].Key, Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+func download(ctx context.Context, svc s3iface.S3API, e manifest.Entry, opts ManifestOptions) Result {
+	start := time.Now()
+	r := Result{Key: opts.Prefix + e.Key}
+	r.Path, r.Err = LocalPath(opts.Dir, e.Key)
+	if r.Err != nil {
+		return r
+	}
+	r.Err = utils.Retry(ctx, utils.NewRetryBudget(max(opts.Retries, 0)), func() error {
+		r.Attempts++
+		var err error
+		if r.Size, err = DownloadFileLimited(ctx, svc, opts.Bucket, r.Key, r.Path, opts.Bandwidth); err != nil {
+			return err
+		}
+		if opts.Verify {
+			return verify(r.Path, r.Size, e)
+		}
+		return nil
+	}, utils.LogRetry(opts.Logger, "GetObject", r.Key, 0))
+	r.Elapsed = time.Since(start)
+	return r
+}
+
+// LocalPath maps a key, relative to a prefix, to a path under dir,
+// refusing keys that would escape it and directory markers.
+func LocalPath(dir, key string) (string, error) {
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("key %q does not map to a file under %s", key, dir)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+func verify(path string, size int64, e manifest.Entry) error {
+	if e.Size != nil && size != *e.Size {
+		return fmt.Errorf("%s: got %d bytes, manifest says %d", e.Key, size, *e.Size)
+	}
+	for _, alg := range []manifest.Algorithm{manifest.SHA256, manifest.XXHash64} {
+		want := e.Sum(alg)
+		if want == "" {
+			continue
+		}
+		got, err := manifest.HashFile(path, alg)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(got, want) {
+			return fmt.Errorf("%s: %s %s, manifest says %s", e.Key, alg, got, want)
+		}
+	}
+	return nil
+}
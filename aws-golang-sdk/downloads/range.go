@@ -0,0 +1,62 @@
+package downloads
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// rangeTimer times the GETs of RangeGet with the default per-part
+// timeout, learning the throughput from every call in the process.
+var rangeTimer = utils.NewPartTimeout(0, 0)
+
+// RangeGet returns length bytes of the object starting at offset, fetched
+// with one ranged GET, for reading a header, an index or a footer without
+// the rest of the object. A range running past the end of the object is
+// cut short at the end, as S3 does; one starting past the end fails with
+// InvalidRange. A range cannot be checked against the object's checksums,
+// which cover the whole object. The GET times out as a part of a download
+// does (see utils.PartTimeout), so a hung connection fails the call
+// rather than blocking it.
+func RangeGet(ctx context.Context, svc s3iface.S3API, bucket, key string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("get %s: invalid range of %d bytes at %d", key, length, offset)
+	}
+	getCtx, cancel := rangeTimer.WithTimeout(ctx, length)
+	defer cancel()
+	start := time.Now()
+	data, out, err := getRange(getCtx, svc, bucket, key, offset, length)
+	if err != nil {
+		if getCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = fmt.Errorf("timed out after %s: %w", time.Since(start).Round(time.Second), err)
+		}
+		return nil, fmt.Errorf("get %s bytes %d-%d: %w", key, offset, offset+length-1, err)
+	}
+	rangeTimer.Observe(int64(len(data)), time.Since(start))
+	if out.ContentLength != nil && int64(len(data)) < *out.ContentLength && *out.ContentLength <= length {
+		return nil, fmt.Errorf("get %s bytes %d-%d: got %d of %d bytes", key, offset, offset+length-1, len(data), *out.ContentLength)
+	}
+	return data, nil
+}
+
+// getRange reads up to length bytes at offset with one GET.
+func getRange(ctx context.Context, svc s3iface.S3API, bucket, key string, offset, length int64) ([]byte, *s3.GetObjectOutput, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(out.Body, length))
+	return data, out, err
+}
@@ -0,0 +1,228 @@
+package downloads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+const (
+	// DefaultReadAhead is the most an ObjectReader requests per GET.
+	DefaultReadAhead int64 = 8 << 20
+	// seekSkip is the furthest an ObjectReader reads past and discards to
+	// serve a forward seek from the GET it has open, rather than issuing a
+	// new one.
+	seekSkip = 256 << 10
+)
+
+// ReaderOptions configures NewObjectReader. Zero values select the
+// defaults.
+type ReaderOptions struct {
+	// ReadAhead is the size of the range requested by each GET. Larger
+	// values suit sequential reads; smaller ones waste less on random
+	// access.
+	ReadAhead int64
+	// PartTimeoutMin and MinThroughput configure the timeout of each GET
+	// (see utils.PartTimeout). A GET that times out after delivering
+	// some bytes, as when the caller reads slowly, is reopened where it
+	// stopped; one that delivered nothing fails the read. A negative
+	// PartTimeoutMin disables the timeout.
+	PartTimeoutMin time.Duration
+	MinThroughput  int64
+}
+
+func (o *ReaderOptions) setDefaults() {
+	if o.ReadAhead <= 0 {
+		o.ReadAhead = DefaultReadAhead
+	}
+}
+
+// ObjectReader reads an object through ranged GETs issued as it is read,
+// for random access to objects too large to download, such as seeking
+// through a video or reading the index at the end of an archive. A GET is
+// only issued by Read, for up to ReadAhead bytes from the current offset,
+// and kept open while reads continue from where it left off; Seek costs
+// nothing until the next Read. Every GET carries If-Match on the ETag seen
+// when the reader was created, so reading an object that has since been
+// replaced fails rather than mixing versions. The bytes are not checked
+// against the object's checksums, which cover the whole object.
+//
+// An ObjectReader is not safe for concurrent use.
+type ObjectReader struct {
+	ctx         context.Context
+	svc         s3iface.S3API
+	bucket, key string
+	etag        *string
+	size        int64
+	opts        ReaderOptions
+	timer       *utils.PartTimeout
+
+	pos int64
+	// body is the open GET, positioned at bodyPos and ending at bodyEnd.
+	// It was opened at bodyStart at time opened, under bodyCtx.
+	body             io.ReadCloser
+	bodyPos, bodyEnd int64
+	bodyStart        int64
+	opened           time.Time
+	bodyCtx          context.Context
+	cancelBody       context.CancelFunc
+	closed           bool
+}
+
+var _ io.ReadSeekCloser = (*ObjectReader)(nil)
+
+// NewObjectReader returns a reader of the object, positioned at its start.
+// It issues one HeadObject for the size and ETag; ctx governs that and
+// every later GET.
+func NewObjectReader(ctx context.Context, svc s3iface.S3API, bucket, key string, opts ReaderOptions) (*ObjectReader, error) {
+	opts.setDefaults()
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("head %s: %w", key, err)
+	}
+	return &ObjectReader{
+		ctx:    ctx,
+		svc:    svc,
+		bucket: bucket,
+		key:    key,
+		etag:   head.ETag,
+		size:   aws.Int64Value(head.ContentLength),
+		opts:   opts,
+		timer:  newRangeTimer(opts.PartTimeoutMin, opts.MinThroughput),
+	}, nil
+}
+
+// Size returns the size of the object.
+func (r *ObjectReader) Size() int64 { return r.size }
+
+// Read reads from the current offset, issuing a GET when none is open at
+// that offset.
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if r.pos >= r.size {
+			return 0, io.EOF
+		}
+		if err := r.position(); err != nil {
+			return 0, err
+		}
+		n, err := r.body.Read(p[:min(int64(len(p)), r.bodyEnd-r.bodyPos)])
+		r.pos += int64(n)
+		r.bodyPos += int64(n)
+		if err != nil && err != io.EOF && r.bodyCtx.Err() == context.DeadlineExceeded && r.ctx.Err() == nil {
+			progressed := r.bodyPos > r.bodyStart
+			r.closeBody()
+			if progressed {
+				err = nil
+			} else {
+				err = fmt.Errorf("timed out after %s: %w", time.Since(r.opened).Round(time.Second), err)
+			}
+		}
+		if r.bodyPos == r.bodyEnd {
+			r.timer.Observe(r.bodyEnd-r.bodyStart, time.Since(r.opened))
+		}
+		if err == io.EOF || r.bodyPos == r.bodyEnd {
+			r.closeBody()
+			if err == io.EOF && r.bodyPos < r.bodyEnd {
+				err = io.ErrUnexpectedEOF
+			} else {
+				err = nil
+			}
+		}
+		if err != nil {
+			return n, fmt.Errorf("get %s: %w", r.key, err)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// position leaves an open GET at r.pos, reusing the current one when
+// r.pos is at or a short way past its position.
+func (r *ObjectReader) position() error {
+	if r.body != nil && r.pos != r.bodyPos {
+		if gap := r.pos - r.bodyPos; gap > 0 && gap <= seekSkip && r.pos < r.bodyEnd {
+			n, err := io.CopyN(io.Discard, r.body, gap)
+			r.bodyPos += n
+			if err != nil {
+				r.closeBody()
+			}
+		} else {
+			r.closeBody()
+		}
+	}
+	if r.body != nil {
+		return nil
+	}
+	end := min(r.pos+r.opts.ReadAhead, r.size)
+	ctx, cancel := r.timer.WithTimeout(r.ctx, end-r.pos)
+	start := time.Now()
+	out, err := r.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(r.bucket),
+		Key:     aws.String(r.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", r.pos, end-1)),
+		IfMatch: r.etag,
+	})
+	if err != nil {
+		cancel()
+		if ctx.Err() == context.DeadlineExceeded && r.ctx.Err() == nil {
+			err = fmt.Errorf("timed out after %s: %w", time.Since(start).Round(time.Second), err)
+		}
+		return fmt.Errorf("get %s bytes %d-%d: %w", r.key, r.pos, end-1, err)
+	}
+	r.body, r.bodyPos, r.bodyEnd = out.Body, r.pos, end
+	r.bodyStart, r.opened, r.bodyCtx, r.cancelBody = r.pos, start, ctx, cancel
+	return nil
+}
+
+func (r *ObjectReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.cancelBody()
+		r.body = nil
+	}
+}
+
+// Seek sets the offset of the next Read. Seeking past the end is allowed;
+// reads there return io.EOF.
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// Close closes the open GET, if any. Reads and seeks after Close fail.
+func (r *ObjectReader) Close() error {
+	r.closeBody()
+	r.closed = true
+	return nil
+}
@@ -0,0 +1,302 @@
+package downloads
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// PartialSuffix and ResumeStateSuffix name the files a resumable download
+// keeps next to its destination until it completes: the data written so
+// far, and the record of which byte ranges of it are valid.
+const (
+	PartialSuffix     = ".partial"
+	ResumeStateSuffix = ".partial.json"
+)
+
+// ResumeOptions configures ResumableDownload. Zero values select the
+// defaults.
+type ResumeOptions struct {
+	// PartSize is the size of each ranged GET.
+	PartSize int64
+	// Concurrency is the number of ranges fetched at once.
+	Concurrency int
+	// RetryBudget is the number of range retries allowed for the whole
+	// object. Zero selects utils.DefaultRetryBudget; negative disables
+	// retries.
+	RetryBudget int
+	// Logger receives log messages such as retries. Nil selects
+	// slog.Default().
+	Logger *slog.Logger
+	// Bandwidth, when set, limits the download to its share of a rate
+	// shared with other downloads.
+	Bandwidth *utils.Bandwidth
+	// KeepCorrupt leaves the partial file and its resume state in place
+	// when the finished download fails checksum verification, for
+	// inspection. By default both are removed so the next attempt starts
+	// over.
+	KeepCorrupt bool
+	// Listener, if set, follows the bytes received and is told of each
+	// range once it is on disk. A resumed download first reports the
+	// bytes it already has as transferred, so the total always reaches
+	// the object's size.
+	Listener utils.ProgressListener
+	// PartTimeoutMin and MinThroughput configure the per-range timeout
+	// (see utils.PartTimeout), so a hung GET is cut off and retried. A
+	// negative PartTimeoutMin disables it. With a low Bandwidth, lower
+	// MinThroughput to the expected rate of each connection.
+	PartTimeoutMin time.Duration
+	MinThroughput  int64
+}
+
+func (o *ResumeOptions) setDefaults() {
+	if o.PartSize <= 0 {
+		o.PartSize = utils.DefaultPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = utils.DefaultConcurrency
+	}
+	if o.RetryBudget == 0 {
+		o.RetryBudget = utils.DefaultRetryBudget
+	}
+}
+
+// Range is the byte range [Start, End) of an object.
+type Range struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ResumeState records a download in progress: the object version being
+// fetched and the byte ranges already written to the partial file and
+// flushed to disk. Adjacent ranges are merged, so a download cut short
+// near the end is recorded in a single range.
+type ResumeState struct {
+	Bucket  string  `json:"bucket"`
+	Key     string  `json:"key"`
+	ETag    string  `json:"etag"`
+	Size    int64   `json:"size"`
+	Written []Range `json:"written"`
+}
+
+// covers reports whether r lies within a written range.
+func (s *ResumeState) covers(r Range) bool {
+	for _, w := range s.Written {
+		if w.Start <= r.Start && r.End <= w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// add records r as written.
+func (s *ResumeState) add(r Range) {
+	s.Written = append(s.Written, r)
+	sort.Slice(s.Written, func(i, j int) bool { return s.Written[i].Start < s.Written[j].Start })
+	merged := s.Written[:1]
+	for _, w := range s.Written[1:] {
+		last := &merged[len(merged)-1]
+		if w.Start <= last.End {
+			last.End = max(last.End, w.End)
+			continue
+		}
+		merged = append(merged, w)
+	}
+	s.Written = merged
+}
+
+// save writes the state to path through a synced temporary file, so a
+// crash leaves either the old record or the new one.
+func (s *ResumeState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory so a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// loadResumeState returns the state saved at path if it describes the
+// same object version, or nil.
+func loadResumeState(path, bucket, key, etag string, size int64) *ResumeState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var s ResumeState
+	if json.Unmarshal(data, &s) != nil || s.Bucket != bucket || s.Key != key || s.ETag != etag || s.Size != size {
+		return nil
+	}
+	return &s
+}
+
+// ConcurrentMultipartDownload writes the object to path with up to
+// opts.Concurrency ranged GETs in flight, the download counterpart of
+// utils.ConcurrentMultipartUpload. It is ResumableDownload under the name
+// the upload side uses.
+func ConcurrentMultipartDownload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts ResumeOptions) (int64, error) {
+	return ResumableDownload(ctx, svc, bucket, key, path, opts)
+}
+
+// ResumableDownload writes the object to path with parallel ranged GETs,
+// each written at its offset of path+PartialSuffix as it arrives, like
+// s3manager's Downloader writing to an io.WriterAt. After each range is
+// flushed to disk it is recorded in path+ResumeStateSuffix, so when a
+// download is interrupted the next call for the same path fetches only
+// the missing ranges instead of truncating the file and starting over.
+// The partial file is renamed to path once complete.
+//
+// The record is tied to the object's ETag and size, and every range is
+// requested with If-Match on that ETag: if the object changes in between,
+// the download starts again from scratch. Once every range is written the
+// file is checked against the object's checksums as DownloadFile does,
+// before it is renamed. Objects gzipped by a
+// utils.CompressionPolicy cannot be decompressed range by range and are
+// fetched whole with DownloadFile.
+func ResumableDownload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts ResumeOptions) (int64, error) {
+	opts.setDefaults()
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("head %s: %w", key, err)
+	}
+	if aws.StringValue(head.ContentEncoding) == "gzip" && utils.MetadataValue(head.Metadata, utils.MetaUncompressedSize) != "" {
+		return DownloadFileLimited(ctx, svc, bucket, key, path, opts.Bandwidth)
+	}
+	etag, size := aws.StringValue(head.ETag), aws.Int64Value(head.ContentLength)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	partial, statePath := path+PartialSuffix, path+ResumeStateSuffix
+	state := loadResumeState(statePath, bucket, key, etag, size)
+	flags := os.O_RDWR | os.O_CREATE
+	if state == nil {
+		state = &ResumeState{Bucket: bucket, Key: key, ETag: etag, Size: size}
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+
+	var pending []utils.Part
+	var have int64
+	for _, p := range utils.PlanParts(size, opts.PartSize) {
+		if p.Size > 0 && !state.covers(Range{p.Offset, p.Offset + p.Size}) {
+			pending = append(pending, p)
+		} else {
+			have += p.Size
+		}
+	}
+	if opts.Listener != nil && have > 0 {
+		opts.Listener.OnBytesTransferred(key, have)
+	}
+
+	budget := utils.NewRetryBudget(max(opts.RetryBudget, 0))
+	timer := newRangeTimer(opts.PartTimeoutMin, opts.MinThroughput)
+	flow := opts.Bandwidth.Flow()
+	var mu sync.Mutex
+	errs := utils.ForEachErr(ctx, len(pending), opts.Concurrency, false, func(i int) error {
+		p := pending[i]
+		data, err := fetchRange(ctx, svc, bucket, key, head.ETag, p, budget, timer, flow, opts.Logger, opts.Listener)
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteAt(data, p.Offset); err != nil {
+			return err
+		}
+		// Only data that reached the disk may be recorded.
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		state.add(Range{p.Offset, p.Offset + p.Size})
+		if err := state.save(statePath); err != nil {
+			return err
+		}
+		if opts.Listener != nil {
+			opts.Listener.OnPartComplete(key, p.Number, p.Size)
+		}
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, utils.ErrSkipped) {
+			return 0, fmt.Errorf("download %s: %w", key, err)
+		}
+	}
+	v := newVerifier(key, head.Metadata, head.ChecksumCRC32C, head.ChecksumSHA256, false)
+	if _, err := io.Copy(v.writer(false), io.NewSectionReader(f, 0, size)); err != nil {
+		return 0, err
+	}
+	if err := v.verify(); err != nil {
+		f.Close()
+		if !opts.KeepCorrupt {
+			os.Remove(partial)
+			os.Remove(statePath)
+		}
+		return 0, fmt.Errorf("download %s: %w", key, err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return 0, err
+	}
+	os.Remove(statePath)
+	return size, nil
+}
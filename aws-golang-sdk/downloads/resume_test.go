@@ -0,0 +1,95 @@
+package downloads
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+// stallingGet hangs the first GET of stallRange until its context is
+// done, as a connection that stops sending does.
+type stallingGet struct {
+	s3iface.S3API
+	stallRange string
+	mu         sync.Mutex
+	stalled    bool
+}
+
+func (s *stallingGet) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	stall := !s.stalled && aws.StringValue(in.Range) == s.stallRange
+	s.stalled = s.stalled || stall
+	s.mu.Unlock()
+	if stall {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.S3API.GetObjectWithContext(ctx, in, opts...)
+}
+
+func TestConcurrentMultipartDownload(t *testing.T) {
+	const mib = 1 << 20
+	tests := []struct {
+		name  string
+		size  int64
+		fail  bool // fail the first GET of the second range
+		stall bool // hang the first GET of the second range
+	}{
+		{name: "one range", size: mib / 2},
+		{name: "several ranges", size: 5*mib + 7},
+		{name: "failed range retried", size: 3 * mib, fail: true},
+		{name: "hung range timed out and retried", size: 3 * mib, stall: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			data := objectslitetest.Data(tt.size)
+			srv.PutObject("b", "k", data)
+			secondRange := "bytes=1048576-2097151"
+			if tt.fail {
+				var once sync.Once
+				srv.Fail = func(r *http.Request) bool {
+					failed := false
+					if r.Header.Get("Range") == secondRange {
+						once.Do(func() { failed = true })
+					}
+					return failed
+				}
+			}
+			var svc s3iface.S3API = srv.Client(t)
+			if tt.stall {
+				svc = &stallingGet{S3API: svc, stallRange: secondRange}
+			}
+			path := filepath.Join(t.TempDir(), "out")
+			opts := ResumeOptions{PartSize: mib, Concurrency: 3, PartTimeoutMin: 200 * time.Millisecond, MinThroughput: 1 << 30}
+
+			n, err := ConcurrentMultipartDownload(context.Background(), svc, "b", "k", path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.size || string(got) != string(data) {
+				t.Fatalf("downloaded %d bytes, want the object's %d", n, tt.size)
+			}
+			for _, suffix := range []string{PartialSuffix, ResumeStateSuffix} {
+				if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+					t.Errorf("%s left behind: %v", path+suffix, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package downloads
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// StreamOptions configures Stream. Zero values select the defaults.
+type StreamOptions struct {
+	// PartSize is the size of each ranged GET.
+	PartSize int64
+	// Concurrency is the number of ranges fetched at once.
+	Concurrency int
+	// BufferCap bounds the bytes fetched ahead of the writer. It defaults
+	// to PartSize × Concurrency and is raised to one part if smaller.
+	BufferCap int64
+	// RetryBudget is the number of range retries allowed for the whole
+	// object. Zero selects utils.DefaultRetryBudget; negative disables
+	// retries.
+	RetryBudget int
+	// Logger receives log messages such as retries. Nil selects
+	// slog.Default().
+	Logger *slog.Logger
+	// Bandwidth, when set, limits the stream to its share of a rate
+	// shared with other downloads.
+	Bandwidth *utils.Bandwidth
+	// Listener, if set, follows the bytes received and is told of each
+	// range once it has been written to w.
+	Listener utils.ProgressListener
+	// PartTimeoutMin and MinThroughput configure the per-range timeout
+	// (see utils.PartTimeout), so a hung GET is cut off and retried. A
+	// negative PartTimeoutMin disables it. With a low Bandwidth, lower
+	// MinThroughput to the expected rate of each connection.
+	PartTimeoutMin time.Duration
+	MinThroughput  int64
+}
+
+func (o *StreamOptions) setDefaults() {
+	if o.PartSize <= 0 {
+		o.PartSize = utils.DefaultPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = utils.DefaultConcurrency
+	}
+	if o.BufferCap <= 0 {
+		o.BufferCap = o.PartSize * int64(o.Concurrency)
+	}
+	if o.RetryBudget == 0 {
+		o.RetryBudget = utils.DefaultRetryBudget
+	}
+}
+
+type chunk struct {
+	data []byte
+	err  error
+}
+
+// Stream writes the object to w in order, fetching ranges ahead of w in
+// parallel. Prefetching is bounded by opts.BufferCap: a range is only
+// requested once a buffer slot is free, and slots are freed as w accepts
+// data, so a slow consumer such as a pipe throttles the downloads instead
+// of letting fetched ranges pile up in memory. Every range is requested
+// with If-Match on the ETag seen at the start, so an object replaced
+// mid-stream fails the download instead of producing a mix of versions.
+// The bytes are checked against the object's checksums as they pass; by
+// then w has them all, so a mismatch is reported as the error of an
+// otherwise complete stream, for the caller to discard what it wrote.
+func Stream(ctx context.Context, svc s3iface.S3API, bucket, key string, w io.Writer, opts StreamOptions) (int64, error) {
+	opts.setDefaults()
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("head %s: %w", key, err)
+	}
+	// The stream carries the stored bytes, so the metadata checksum of a
+	// compressed object's content cannot be checked.
+	md := head.Metadata
+	if aws.StringValue(head.ContentEncoding) == "gzip" && utils.MetadataValue(md, utils.MetaUncompressedSize) != "" {
+		md = nil
+	}
+	v := newVerifier(key, md, head.ChecksumCRC32C, head.ChecksumSHA256, false)
+	w = io.MultiWriter(w, v.writer(false))
+	parts := utils.PlanParts(aws.Int64Value(head.ContentLength), opts.PartSize)
+	window := int(max(opts.BufferCap/opts.PartSize, 1))
+	workers := min(opts.Concurrency, window)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	budget := utils.NewRetryBudget(max(opts.RetryBudget, 0))
+	timer := newRangeTimer(opts.PartTimeoutMin, opts.MinThroughput)
+	flow := opts.Bandwidth.Flow()
+	results := make([]chan chunk, len(parts))
+	for i := range results {
+		results[i] = make(chan chunk, 1)
+	}
+
+	// Slots are taken in part order, so the part the writer needs next
+	// always holds one and the pipeline cannot deadlock.
+	slots := make(chan struct{}, window)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range parts {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for range workers {
+		go func() {
+			for i := range next {
+				data, err := fetchRange(ctx, svc, bucket, key, head.ETag, parts[i], budget, timer, flow, opts.Logger, opts.Listener)
+				results[i] <- chunk{data, err}
+			}
+		}()
+	}
+
+	var written int64
+	for i := range parts {
+		var c chunk
+		select {
+		case c = <-results[i]:
+		case <-ctx.Done():
+			return written, ctx.Err()
+		}
+		if c.err != nil {
+			return written, c.err
+		}
+		n, err := w.Write(c.data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if opts.Listener != nil {
+			opts.Listener.OnPartComplete(key, parts[i].Number, parts[i].Size)
+		}
+		<-slots
+	}
+	return written, v.verify()
+}
+
+// newRangeTimer returns the per-range timeout of a download, or nil when
+// min is negative.
+func newRangeTimer(min time.Duration, minThroughput int64) *utils.PartTimeout {
+	if min < 0 {
+		return nil
+	}
+	return utils.NewPartTimeout(min, float64(minThroughput))
+}
+
+// fetchRange reads part p of the object with one ranged GET, retried
+// within budget. Each attempt must finish within timer's timeout for the
+// part's size, and feeds its throughput back into timer.
+func fetchRange(ctx context.Context, svc s3iface.S3API, bucket, key string, etag *string, p utils.Part, budget *utils.RetryBudget, timer *utils.PartTimeout, flow *utils.Flow, logger *slog.Logger, listener utils.ProgressListener) ([]byte, error) {
+	if p.Size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, p.Size)
+	var report func(n int64)
+	if listener != nil {
+		report = func(n int64) { listener.OnBytesTransferred(key, n) }
+	}
+	body := utils.NewProgressReader(nil, report)
+	err := utils.Retry(ctx, budget, func() error {
+		rangeCtx, cancel := timer.WithTimeout(ctx, p.Size)
+		defer cancel()
+		start := time.Now()
+		err := readRange(rangeCtx, svc, bucket, key, etag, p, flow, body, buf)
+		if err != nil {
+			if rangeCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				return fmt.Errorf("timed out after %s: %w", time.Since(start).Round(time.Second), err)
+			}
+			return err
+		}
+		timer.Observe(p.Size, time.Since(start))
+		return nil
+	}, utils.LogRetry(logger, "GetObject", key, p.Number))
+	if err != nil {
+		return nil, fmt.Errorf("get %s range %d: %w", key, p.Number, err)
+	}
+	return buf, nil
+}
+
+// readRange fetches part p into buf through body.
+func readRange(ctx context.Context, svc s3iface.S3API, bucket, key string, etag *string, p utils.Part, flow *utils.Flow, body *utils.ProgressReader, buf []byte) error {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", p.Offset, p.Offset+p.Size-1)),
+		IfMatch: etag,
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	body.Reset(flow.Reader(ctx, out.Body))
+	_, err = io.ReadFull(body, buf)
+	return err
+}
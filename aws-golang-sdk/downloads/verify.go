@@ -0,0 +1,100 @@
+package downloads
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// ErrChecksumMismatch is matched, with errors.Is, by the error a download
+// returns when its content does not have the checksum stored with the
+// object.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumError describes a download that failed verification.
+type ChecksumError struct {
+	Key string
+	// Source names where the expected value came from: the
+	// x-amz-meta-sha256 metadata or an x-amz-checksum-* header.
+	Source    string
+	Want, Got string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s mismatch: got %s, expected %s", e.Source, e.Got, e.Want)
+}
+
+func (e *ChecksumError) Unwrap() error { return ErrChecksumMismatch }
+
+// check is one expected checksum and the hash computing it.
+type check struct {
+	source, want string
+	h            hash.Hash
+	encode       func([]byte) string
+	// content is set when the checksum covers the decompressed content
+	// rather than the bytes stored.
+	content bool
+}
+
+// verifier checks a download against every checksum the object carries.
+// The x-amz-meta-sha256 metadata covers the content as uploaded, before
+// any compression; x-amz-checksum-* headers cover the stored bytes. The
+// composite checksums of multipart uploads ("...-N") cover part checksums
+// rather than the object and are not checked.
+type verifier struct {
+	key    string
+	checks []*check
+}
+
+// newVerifier returns a verifier for the checksums in an object's metadata
+// and checksum headers. md may be nil to skip the metadata checksum, for
+// callers that never see the decompressed content of a compressed object.
+func newVerifier(key string, md map[string]*string, crc32c, sha *string, compressed bool) *verifier {
+	v := &verifier{key: key}
+	if want := utils.MetadataValue(md, utils.MetaSHA256); want != "" {
+		v.checks = append(v.checks, &check{source: "x-amz-meta-sha256", want: strings.ToLower(want), h: sha256.New(), encode: hex.EncodeToString, content: compressed})
+	}
+	if want := aws.StringValue(crc32c); want != "" && !strings.Contains(want, "-") {
+		v.checks = append(v.checks, &check{source: "x-amz-checksum-crc32c", want: want, h: crc32.New(crc32.MakeTable(crc32.Castagnoli)), encode: base64.StdEncoding.EncodeToString})
+	}
+	if want := aws.StringValue(sha); want != "" && !strings.Contains(want, "-") {
+		v.checks = append(v.checks, &check{source: "x-amz-checksum-sha256", want: want, h: sha256.New(), encode: base64.StdEncoding.EncodeToString})
+	}
+	return v
+}
+
+// writer returns a writer feeding the hashes of the stored bytes, or of
+// the decompressed content if content is set.
+func (v *verifier) writer(content bool) io.Writer {
+	var ws []io.Writer
+	for _, c := range v.checks {
+		if c.content == content {
+			ws = append(ws, c.h)
+		}
+	}
+	if len(ws) == 0 {
+		return io.Discard
+	}
+	return io.MultiWriter(ws...)
+}
+
+// verify returns a *ChecksumError for the first checksum that does not
+// match what was written.
+func (v *verifier) verify() error {
+	for _, c := range v.checks {
+		if got := c.encode(c.h.Sum(nil)); got != c.want {
+			return &ChecksumError{Key: v.key, Source: c.source, Want: c.want, Got: got}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package estimate predicts what a batch of transfers will cost before it
+// runs: how many requests of each kind, how many bytes in each direction
+// and, at throughput measured against the endpoint, roughly how long, so
+// a sync or migration can be fitted into a maintenance window.
+//
+// The prediction follows the rules the transfer helpers use: files above
+// the multipart threshold become CreateMultipartUpload, one UploadPart
+// per part and CompleteMultipartUpload; deletions are batched a thousand
+// per DeleteObjects. It does not know how well files compress or how many
+// requests will be retried, so it is a floor rather than a promise.
+package estimate
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+const (
+	// DefaultProbeSize is the size of each object Measure writes.
+	DefaultProbeSize int64 = 16 << 20
+	// deleteBatch is the most keys one DeleteObjects removes.
+	deleteBatch = 1000
+	// latencyProbes is the number of HeadObject round trips Measure
+	// times; the fastest is kept.
+	latencyProbes = 3
+)
+
+// Rates is the measured speed of an endpoint from this client.
+type Rates struct {
+	// Put and Get are the combined upload and download rates, in bytes
+	// per second, with several objects in flight.
+	Put, Get float64
+	// Latency is the round trip of a request without a body.
+	Latency time.Duration
+}
+
+// Estimate is the predicted cost of a batch of transfers. The zero value
+// is empty and ready to use.
+type Estimate struct {
+	// Requests counts the S3 requests by operation name.
+	Requests map[string]int
+	// Objects is the number of objects transferred or deleted.
+	Objects int
+	// Uploaded and Downloaded are the bytes this client sends and
+	// receives; Copied the bytes copied server-side.
+	Uploaded, Downloaded, Copied int64
+	// Workers is the number of objects transferred at once, over which
+	// request latency is spread.
+	Workers int
+}
+
+func (e *Estimate) add(op string, n int) {
+	if n == 0 {
+		return
+	}
+	if e.Requests == nil {
+		e.Requests = make(map[string]int)
+	}
+	e.Requests[op] += n
+}
+
+// Upload adds a file of size bytes uploaded with opts, as utils.Upload
+// and utils.UploadStream send it.
+func (e *Estimate) Upload(size int64, opts utils.UploadOptions) {
+	e.Objects++
+	e.Uploaded += size
+	e.addUpload(size, opts)
+}
+
+func (e *Estimate) addUpload(size int64, opts utils.UploadOptions) {
+	if size <= cmp.Or(opts.MultipartThreshold, utils.DefaultMultipartThreshold) {
+		e.add("PutObject", 1)
+		return
+	}
+	e.add("CreateMultipartUpload", 1)
+	e.add("UploadPart", len(utils.PlanParts(size, cmp.Or(opts.PartSize, utils.DefaultPartSize))))
+	e.add("CompleteMultipartUpload", 1)
+}
+
+// Download adds an object of size bytes fetched with one GetObject.
+func (e *Estimate) Download(size int64) {
+	e.Objects++
+	e.Downloaded += size
+	e.add("GetObject", 1)
+}
+
+// Stream adds an object of size bytes read from one endpoint and
+// uploaded to another through this client.
+func (e *Estimate) Stream(size int64, opts utils.UploadOptions) {
+	e.Objects++
+	e.Downloaded += size
+	e.Uploaded += size
+	e.add("GetObject", 1)
+	e.addUpload(size, opts)
+}
+
+// Copy adds an object of size bytes copied server-side with opts, as
+// utils.ServerSideCopy does.
+func (e *Estimate) Copy(size int64, opts utils.CopyOptions) {
+	e.Objects++
+	e.Copied += size
+	e.add("HeadObject", 1)
+	threshold := opts.Threshold
+	if threshold <= 0 || threshold > utils.MaxCopyObjectSize {
+		threshold = utils.MaxCopyObjectSize
+	}
+	if size <= threshold {
+		e.add("CopyObject", 1)
+		return
+	}
+	if opts.Tags == nil {
+		// The source's tags are read to carry them over.
+		e.add("GetObjectTagging", 1)
+	}
+	e.add("CreateMultipartUpload", 1)
+	e.add("UploadPartCopy", len(utils.PlanParts(size, cmp.Or(opts.PartSize, utils.DefaultCopyPartSize))))
+	e.add("CompleteMultipartUpload", 1)
+}
+
+// Delete adds n objects removed with DeleteObjects.
+func (e *Estimate) Delete(n int) {
+	e.Objects += n
+	e.add("DeleteObjects", (n+deleteBatch-1)/deleteBatch)
+}
+
+// Total returns the number of requests.
+func (e *Estimate) Total() int {
+	n := 0
+	for _, c := range e.Requests {
+		n += c
+	}
+	return n
+}
+
+// Duration predicts how long the transfers take at r: the bytes at the
+// measured rates, uploads and downloads overlapping, plus the latency of
+// every request spread over the workers. Server-side copies are assumed
+// to run at the upload rate. It returns zero if r has no rates.
+func (e *Estimate) Duration(r Rates) time.Duration {
+	if r.Put <= 0 || r.Get <= 0 {
+		return 0
+	}
+	transfer := max(float64(e.Uploaded+e.Copied)/r.Put, float64(e.Downloaded)/r.Get)
+	overhead := time.Duration(e.Total()) * r.Latency / time.Duration(max(e.Workers, 1))
+	return time.Duration(transfer*float64(time.Second)) + overhead
+}
+
+// Print writes the estimate, with the predicted duration if r is not
+// nil.
+func (e *Estimate) Print(w io.Writer, r *Rates) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "estimate: %d objects, %d requests", e.Objects, e.Total())
+	ops := make([]string, 0, len(e.Requests))
+	for op := range e.Requests {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for i, op := range ops {
+		sep := ", "
+		if i == 0 {
+			sep = " ("
+		}
+		fmt.Fprintf(&b, "%s%d %s", sep, e.Requests[op], op)
+	}
+	if len(ops) > 0 {
+		b.WriteString(")")
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "          %s up, %s down, %s copied server-side\n",
+		utils.FormatBytes(e.Uploaded), utils.FormatBytes(e.Downloaded), utils.FormatBytes(e.Copied))
+	if r != nil {
+		fmt.Fprintf(&b, "          about %s at %s/s up, %s/s down, %s per request\n",
+			e.Duration(*r).Round(time.Second), utils.FormatBytes(int64(r.Put)), utils.FormatBytes(int64(r.Get)),
+			r.Latency.Round(time.Millisecond))
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Measure writes workers probe objects of size bytes (DefaultProbeSize if
+// zero) under prefix at once with opts, reads them back at once and
+// deletes them, and returns the combined rates and the fastest of a few
+// HeadObject round trips. The probe objects are deleted even when the
+// measurement fails.
+func Measure(ctx context.Context, svc s3iface.S3API, bucket, prefix string, size int64, workers int, opts utils.UploadOptions) (Rates, error) {
+	size = cmp.Or(size, DefaultProbeSize)
+	workers = max(workers, 1)
+	payload := make([]byte, size)
+	if _, err := rand.Read(payload); err != nil {
+		return Rates{}, err
+	}
+	keys := make([]string, workers)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s.objectslite-estimate-probe/%d", prefix, i)
+	}
+	defer func() {
+		cleanupCtx := context.WithoutCancel(ctx)
+		utils.ForEach(cleanupCtx, len(keys), workers, func(i int) {
+			svc.DeleteObjectWithContext(cleanupCtx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(keys[i])})
+		})
+	}()
+
+	var r Rates
+	errs := make([]error, workers)
+	start := time.Now()
+	utils.ForEach(ctx, workers, workers, func(i int) {
+		_, errs[i] = utils.UploadStream(ctx, svc, bucket, keys[i], bytes.NewReader(payload), opts)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Rates{}, fmt.Errorf("measure upload rate: %w", err)
+	}
+	r.Put = float64(size*int64(workers)) / time.Since(start).Seconds()
+
+	start = time.Now()
+	utils.ForEach(ctx, workers, workers, func(i int) {
+		out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(keys[i])})
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		defer out.Body.Close()
+		_, errs[i] = io.Copy(io.Discard, out.Body)
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Rates{}, fmt.Errorf("measure download rate: %w", err)
+	}
+	r.Get = float64(size*int64(workers)) / time.Since(start).Seconds()
+
+	latencies := make([]time.Duration, latencyProbes)
+	for i := range latencies {
+		start := time.Now()
+		if _, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(keys[0])}); err != nil {
+			return Rates{}, fmt.Errorf("measure latency: %w", err)
+		}
+		latencies[i] = time.Since(start)
+	}
+	r.Latency = slices.Min(latencies)
+	return r, ctx.Err()
+}
@@ -0,0 +1,109 @@
+package estimate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// TestMatchesRequests runs the transfers an estimate predicts and checks
+// that the client sent exactly the requests it counted.
+func TestMatchesRequests(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.MinPartSize = 1
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	var mu sync.Mutex
+	sent := map[string]int{}
+	client.Handlers.Build.PushBack(func(r *request.Request) {
+		mu.Lock()
+		sent[r.Operation.Name]++
+		mu.Unlock()
+	})
+	upload := utils.UploadOptions{MultipartThreshold: 2000, PartSize: 1000}
+	copyOpts := utils.CopyOptions{Threshold: 2000, PartSize: 1000}
+
+	var e Estimate
+	for _, size := range []int64{0, 2000, 4500} {
+		key := fmt.Sprint("up/", size)
+		if _, err := utils.Upload(ctx, client, "b", key, objectslitetest.TempFile(t, size), upload); err != nil {
+			t.Fatal(err)
+		}
+		e.Upload(size, upload)
+
+		out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String(key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Body.Close()
+		e.Download(size)
+
+		if err := utils.ServerSideCopy(ctx, client, "b", key, "b", fmt.Sprint("copy/", size), copyOpts); err != nil {
+			t.Fatal(err)
+		}
+		e.Copy(size, copyOpts)
+	}
+	tagged := copyOpts
+	tagged.Tags = map[string]string{"k": "v"}
+	if err := utils.ServerSideCopy(ctx, client, "b", "up/4500", "b", "tagged", tagged); err != nil {
+		t.Fatal(err)
+	}
+	e.Copy(4500, tagged)
+	if _, err := utils.DeletePrefix(ctx, client, "b", "copy/", utils.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	e.Delete(3)
+	e.add("ListObjectsV2", 1) // DeletePrefix lists before deleting
+
+	if !maps.Equal(sent, e.Requests) {
+		t.Fatalf("sent %v, estimated %v", sent, e.Requests)
+	}
+	if e.Objects != 13 || e.Uploaded != 6500 || e.Downloaded != 6500 || e.Copied != 11000 {
+		t.Fatalf("estimate %+v", e)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	e := Estimate{Uploaded: 100 << 20, Downloaded: 50 << 20, Workers: 4}
+	e.add("PutObject", 8)
+	r := Rates{Put: 10 << 20, Get: 10 << 20, Latency: 100 * time.Millisecond}
+	if got, want := e.Duration(r), 10*time.Second+200*time.Millisecond; got != want {
+		t.Fatalf("duration %v, want %v", got, want)
+	}
+	if got := e.Duration(Rates{}); got != 0 {
+		t.Fatalf("duration without rates %v, want 0", got)
+	}
+	var b bytes.Buffer
+	if err := e.Print(&b, &r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "8 requests (8 PutObject)") || !strings.Contains(b.String(), "about 10s") {
+		t.Fatalf("printed %q", b.String())
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	r, err := Measure(context.Background(), srv.Client(t), "b", "tmp/", 64<<10, 3, utils.UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Put <= 0 || r.Get <= 0 || r.Latency <= 0 {
+		t.Fatalf("rates %+v", r)
+	}
+	objectslitetest.AssertKeys(t, srv, "b")
+}
@@ -0,0 +1,47 @@
+// Command agent keeps Objectslite credentials and warm connections open
+// behind a unix socket. Other examples use it when -agent or
+// $OBJECTSLITE_AGENT names the socket, skipping credential resolution and
+// TLS setup on every invocation.
+//
+//	go run ./examples/agent -endpoint https://10.0.0.10:9440 -username admin &
+//	export OBJECTSLITE_AGENT=$(go run ./examples/agent -print-socket)
+//	go run ./examples/upload -bucket b -key k -file f
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/agent"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	socket := flag.String("socket", agent.DefaultSocket(), "unix socket to listen on")
+	printSocket := flag.Bool("print-socket", false, "print the default socket path and exit")
+	flag.Parse()
+
+	if *printSocket {
+		fmt.Println(agent.DefaultSocket())
+		return
+	}
+	srv, err := agent.NewServer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("agent listening on %s", *socket)
+	if err := srv.ListenAndServe(ctx, *socket); err != nil {
+		log.Fatal(err)
+	}
+}
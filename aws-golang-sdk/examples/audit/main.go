@@ -0,0 +1,67 @@
+// Command audit verifies a bucket against a manifest, reporting objects
+// that are missing or whose size or checksum no longer matches. It exits
+// with status 1 when any problem is found.
+//
+//	go run ./examples/audit -bucket backups -prefix nightly/ -manifest nightly.jsonl
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/audit"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts audit.Options
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to audit (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "prefix prepended to every manifest key")
+	flag.BoolVar(&opts.Deep, "deep", false, "download every object and verify its SHA-256")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "number of objects checked in parallel")
+	manifestPath := flag.String("manifest", "", "manifest file (required)")
+	jsonOut := flag.Bool("json", false, "print every finding as a JSON line")
+	flag.Parse()
+
+	if opts.Bucket == "" || *manifestPath == "" {
+		log.Fatal("-bucket and -manifest are required")
+	}
+	entries, err := manifest.ReadFile(*manifestPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	findings := audit.Run(ctx, client, entries, opts)
+	enc := json.NewEncoder(os.Stdout)
+	for _, f := range findings {
+		switch {
+		case *jsonOut:
+			enc.Encode(f)
+		case f.Status != audit.StatusOK:
+			fmt.Printf("%-18s %s %s\n", f.Status, f.Key, f.Detail)
+		}
+	}
+
+	summary := audit.Summarize(findings)
+	fmt.Fprintf(os.Stderr, "audited %d objects: %d ok, %d missing, %d size mismatches, %d checksum mismatches, %d errors\n",
+		len(findings), summary[audit.StatusOK], summary[audit.StatusMissing], summary[audit.StatusSizeMismatch],
+		summary[audit.StatusChecksumMismatch], summary[audit.StatusError])
+	if summary.Problems() > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+// Command backup snapshots a directory to a timestamped prefix, records a
+// manifest of the snapshot for restores, and keeps only the most recent
+// snapshots. With -schedule it stays running and backs up on a cron
+// schedule; without it, it backs up once. A file that fails to upload
+// fails the backup unless -continue-on-error is given, in which case the
+// snapshot is completed without it and the run still counts as failed.
+//
+//	go run ./examples/backup -dir /srv/data -bucket backups -prefix srv-data/ -keep 7
+//	go run ./examples/backup -dir /srv/data -bucket backups -prefix srv-data/ -keep 14 -schedule "30 2 * * *"
+//	go run ./examples/backup -bucket backups -prefix srv-data/ -list
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/backup"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts backup.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	flag.StringVar(&opts.Dir, "dir", "", "directory to back up (required unless -list)")
+	flag.StringVar(&opts.Bucket, "bucket", "", "destination bucket (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "prefix holding the snapshots")
+	flag.IntVar(&opts.Keep, "keep", 7, "number of most recent snapshots kept (0 keeps all)")
+	flag.IntVar(&opts.Concurrency, "concurrency", utils.DefaultConcurrency, "files hashed and uploaded in parallel")
+	algorithm := flag.String("algorithm", string(manifest.SHA256), "content hash recorded in the manifest: sha256 or xxhash64")
+	schedule := flag.String("schedule", "", `cron expression ("30 2 * * *"), @daily and the like, or "@every 6h"; back up once if empty`)
+	list := flag.Bool("list", false, "list the snapshots under -prefix and exit")
+	flag.BoolVar(&opts.ContinueOnError, "continue-on-error", false, "upload every file even after some fail, completing the snapshot without them")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.Bucket == "" || (opts.Dir == "" && !*list) {
+		log.Fatal("-bucket and -dir are required")
+	}
+	var err error
+	if opts.Algorithm, err = manifest.ParseAlgorithm(*algorithm); err != nil {
+		log.Fatal(err)
+	}
+	var sched *backup.Schedule
+	if *schedule != "" {
+		if sched, err = backup.ParseSchedule(*schedule); err != nil {
+			log.Fatal(err)
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *list {
+		snaps, err := backup.List(ctx, client, opts.Bucket, opts.Prefix)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range snaps {
+			log.Printf("%s  %s", s.Name, s.Time.Local().Format(time.DateTime))
+		}
+		return
+	}
+
+	if sched == nil {
+		if !runBackup(ctx, client, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			log.Fatalf("schedule %q never fires", *schedule)
+		}
+		log.Printf("next backup at %s", next.Format(time.DateTime))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		// A failed backup is retried at the next scheduled time.
+		runBackup(ctx, client, opts)
+	}
+}
+
+func runBackup(ctx context.Context, client *utils.Client, opts backup.Options) bool {
+	r, err := backup.Run(ctx, client, opts, time.Now())
+	if err != nil {
+		log.Printf("backup %s failed: %v", r.Snapshot.Name, err)
+		return false
+	}
+	for _, err := range r.Failed {
+		log.Printf("FAILED %v", err)
+	}
+	log.Printf("snapshot %s: %d files, %s in %s; %d failed", r.Snapshot.Name, r.Files, utils.FormatBytes(r.Bytes), r.Elapsed.Round(time.Second), len(r.Failed))
+	for _, s := range r.Pruned {
+		log.Printf("pruned snapshot %s", s.Name)
+	}
+	return len(r.Failed) == 0
+}
@@ -0,0 +1,96 @@
+// Command bench measures PUT and GET throughput and latency for every
+// combination of object size and concurrency, then prints a report with
+// the client environment, settings and results as a table or JSON.
+//
+//	go run ./examples/bench -bucket b -sizes 1MiB,64MiB,1GiB -concurrency 1,8,32 -objects 20 -format json > report.json
+//	go run ./examples/bench -bucket b -sizes 64MiB -concurrency 16 -runs 5 -warmup 1
+//	go run ./examples/bench -bucket b -sizes 1GiB -concurrency 1 -part-size 48MiB -part-orders sequential,largest-first,random -runs 3
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/bench"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts bench.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Upload.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts of one object uploaded in parallel")
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to benchmark (required)")
+	flag.StringVar(&opts.Prefix, "prefix", bench.DefaultPrefix, "prefix for the benchmark objects, deleted after each cell")
+	sizes := flag.String("sizes", "1MiB,16MiB,128MiB", "comma-separated object sizes")
+	concurrency := flag.String("concurrency", "1,8,32", "comma-separated numbers of objects in flight")
+	orders := flag.String("part-orders", "", "comma-separated part orders to compare (default -part-order alone)")
+	flag.IntVar(&opts.Objects, "objects", 16, "objects written and read per size/concurrency combination")
+	flag.IntVar(&opts.Runs, "runs", 1, "measured runs of each combination; the report shows mean, stddev, min and max")
+	flag.IntVar(&opts.Warmup, "warmup", 0, "unmeasured runs of each combination before the measured ones")
+	format := flag.String("format", "table", "output format: table or json")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if *format != "table" && *format != "json" {
+		log.Fatalf("unknown -format %q", *format)
+	}
+	for _, s := range strings.Split(*sizes, ",") {
+		n, err := utils.ParseBytes(strings.TrimSpace(s))
+		if err != nil {
+			log.Fatalf("-sizes: %v", err)
+		}
+		opts.Sizes = append(opts.Sizes, n)
+	}
+	for _, s := range strings.Split(*concurrency, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			log.Fatalf("-concurrency: bad value %q", s)
+		}
+		opts.Concurrency = append(opts.Concurrency, n)
+	}
+	if *orders != "" {
+		for _, s := range strings.Split(*orders, ",") {
+			opts.PartOrders = append(opts.PartOrders, strings.TrimSpace(s))
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r, err := bench.Run(ctx, client, opts)
+	if r == nil {
+		log.Fatal(err)
+	}
+	if err != nil {
+		log.Printf("run interrupted, reporting completed cells: %v", err)
+	}
+	r.Environment.Endpoint = client.Config.Endpoint
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = r.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
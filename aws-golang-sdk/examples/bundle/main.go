@@ -0,0 +1,81 @@
+// Command bundle packs a directory of small files into a few large tar
+// objects with an index (-action create), unpacks them again (-action
+// extract), or writes one file from them (-action get).
+//
+//	go run ./examples/bundle -action create  -bucket logs -prefix 2024-05/ -dir ./logs -bundle-size 128MiB
+//	go run ./examples/bundle -action extract -bucket logs -prefix 2024-05/ -dir ./restored
+//	go run ./examples/bundle -action get     -bucket logs -prefix 2024-05/ -name app/01.log > 01.log
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/bundle"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	opts := bundle.Options{BundleSize: bundle.DefaultBundleSize}
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	action := flag.String("action", "", "create, extract or get (required)")
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "prefix holding the bundles and index")
+	flag.StringVar(&opts.Dir, "dir", "", "directory to bundle (create) or extract into (extract)")
+	flag.Var((*utils.ByteSize)(&opts.BundleSize), "bundle-size", "approximate size of each bundle (create)")
+	flag.IntVar(&opts.Concurrency, "concurrency", utils.DefaultConcurrency, "bundles uploaded or downloaded in parallel")
+	name := flag.String("name", "", "file to write to stdout, relative to the bundled directory (get)")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case opts.Bucket == "":
+		log.Fatal("-bucket is required")
+	case (*action == "create" || *action == "extract") && opts.Dir == "":
+		log.Fatalf("-dir is required with -action %s", *action)
+	case *action == "get" && *name == "":
+		log.Fatal("-name is required with -action get")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start := time.Now()
+	switch *action {
+	case "create":
+		idx, err := bundle.Create(ctx, client, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var size int64
+		for _, b := range idx.Bundles {
+			size += b.Size
+		}
+		log.Printf("packed %d files into %d bundles (%s) under s3://%s/%s in %s", len(idx.Members), len(idx.Bundles),
+			utils.FormatBytes(size), opts.Bucket, opts.Prefix, time.Since(start).Round(time.Millisecond))
+	case "extract":
+		files, size, err := bundle.Extract(ctx, client, opts.Bucket, opts.Prefix, opts.Dir, opts.Concurrency)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("extracted %d files (%s) to %s in %s", files, utils.FormatBytes(size), opts.Dir, time.Since(start).Round(time.Millisecond))
+	case "get":
+		if _, err := bundle.ExtractFile(ctx, client, opts.Bucket, opts.Prefix, *name, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown -action %q", *action)
+	}
+}
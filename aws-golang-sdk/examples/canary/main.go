@@ -0,0 +1,74 @@
+// Command canary continuously writes, reads back, verifies and deletes a
+// tiny object so operators can monitor Objectslite from a client's view.
+//
+//	go run ./examples/canary -endpoint https://pc:9440 -bucket health -interval 30s -metrics-addr :9102
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/canary"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts canary.Options
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to write the canary object to (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "canary/", "key prefix for canary objects")
+	flag.IntVar(&opts.Size, "size", 1024, "canary payload size in bytes")
+	flag.DurationVar(&opts.Interval, "interval", time.Minute, "delay between cycles")
+	flag.IntVar(&opts.Count, "count", 0, "stop after this many cycles (0 runs forever)")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9102")
+	flag.Parse()
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if opts.Interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	metrics := canary.NewMetrics()
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := false
+	err = canary.Run(ctx, client, opts, func(r canary.Result) {
+		metrics.Observe(r)
+		d := r.Durations
+		if r.OK() {
+			log.Printf("canary ok key=%s put=%s get=%s delete=%s",
+				r.Key, d[canary.StagePut], d[canary.StageGet], d[canary.StageDelete])
+			return
+		}
+		failed = true
+		log.Printf("canary FAILED key=%s stage=%s err=%v", r.Key, r.FailedStage, r.Err)
+	})
+	if err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
+	if failed && opts.Count > 0 {
+		os.Exit(1)
+	}
+}
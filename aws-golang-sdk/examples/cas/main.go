@@ -0,0 +1,118 @@
+// Command cas stores files by content hash, with a small pointer object at
+// each file's name, so content shared between files or between uploads
+// of similar trees is stored once (see the cas package). -action get
+// follows a pointer and downloads its content.
+//
+//	go run ./examples/cas -action put -bucket b -dir ./site -name-prefix snapshots/mon/
+//	go run ./examples/cas -action put -bucket b -dir ./site -name-prefix snapshots/tue/
+//	go run ./examples/cas -action put -bucket b -file report.pdf -name docs/report.pdf
+//	go run ./examples/cas -action get -bucket b -name docs/report.pdf -o report.pdf
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/cas"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts cas.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	action := flag.String("action", "", "put or get (required)")
+	bucket := flag.String("bucket", "", "bucket (required)")
+	flag.StringVar(&opts.Prefix, "cas-prefix", cas.DefaultPrefix, "prefix holding the content objects")
+	file := flag.String("file", "", "file to put")
+	dir := flag.String("dir", "", "directory to put, every file under it")
+	name := flag.String("name", "", "pointer key of -file (put) or to follow (get)")
+	namePrefix := flag.String("name-prefix", "", "prefix of the pointer keys of -dir")
+	output := flag.String("o", "", "output file for get (default the name's base name)")
+	flag.IntVar(&opts.Concurrency, "concurrency", utils.DefaultConcurrency, "files stored in parallel with -dir")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch *action {
+	case "put":
+		switch {
+		case *file != "" && *name != "":
+			r, err := cas.Upload(ctx, client, *bucket, *name, *file, opts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			printResult(r)
+		case *dir != "":
+			var mu sync.Mutex
+			var files, stored, failed int
+			var sent, total int64
+			err := cas.UploadDir(ctx, client, *bucket, *namePrefix, *dir, opts, func(r cas.Result) {
+				mu.Lock()
+				defer mu.Unlock()
+				files++
+				if r.Err != nil {
+					failed++
+					log.Printf("FAILED %s: %v", r.Name, r.Err)
+					return
+				}
+				total += r.Pointer.Size
+				if r.Stored {
+					stored++
+					sent += r.Pointer.Size
+				}
+				printResult(r)
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("%d files (%s): %d stored (%s sent), %d already stored, %d failed",
+				files, utils.FormatBytes(total), stored, utils.FormatBytes(sent), files-stored-failed, failed)
+			if failed > 0 {
+				os.Exit(1)
+			}
+		default:
+			log.Fatal("put needs -file and -name, or -dir")
+		}
+	case "get":
+		if *name == "" {
+			log.Fatal("-name is required to get")
+		}
+		if *output == "" {
+			*output = path.Base(*name)
+		}
+		n, err := cas.Download(ctx, client, *bucket, *name, *output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote %s from s3://%s/%s to %s", utils.FormatBytes(n), *bucket, *name, *output)
+	default:
+		log.Fatalf("unknown -action %q", *action)
+	}
+}
+
+func printResult(r cas.Result) {
+	how := "already stored"
+	if r.Stored {
+		how = "stored"
+	}
+	fmt.Printf("%s -> %s (%s, %s)\n", r.Name, r.Pointer.Object, utils.FormatBytes(r.Pointer.Size), how)
+}
@@ -0,0 +1,76 @@
+// Command cleanup-uploads lists the multipart uploads of a bucket that
+// were started and never completed or aborted, and aborts those older
+// than -older-than so their parts stop taking up space. It asks for
+// confirmation unless -force or -dry-run is given, and exits with status
+// 1 if any abort failed.
+//
+//	go run ./examples/cleanup-uploads -bucket b -dry-run
+//	go run ./examples/cleanup-uploads -bucket b -prefix backups/ -older-than 72h -force
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.CleanupOptions
+	bucket := flag.String("bucket", "", "bucket to clean up (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "only consider uploads to keys under this prefix")
+	olderThan := flag.Duration("older-than", 24*time.Hour, "abort uploads initiated longer ago than this")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list the stale uploads without aborting them")
+	flag.IntVar(&opts.Concurrency, "concurrency", utils.DefaultConcurrency, "number of uploads aborted in parallel")
+	force := flag.Bool("force", false, "abort without asking for confirmation")
+	flag.Parse()
+
+	if *bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if !*force {
+		opts.Confirm = func(stale []utils.IncompleteUpload) error {
+			return utils.Confirm(fmt.Sprintf("Abort %d incomplete uploads under s3://%s/%s older than %s?",
+				len(stale), *bucket, opts.Prefix, *olderThan))
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stale, err := utils.CleanupIncompleteUploads(ctx, client, *bucket, *olderThan, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tUPLOAD ID\tINITIATED\tSTATUS")
+	failed := 0
+	for _, u := range stale {
+		status := "aborted"
+		switch {
+		case opts.DryRun:
+			status = "would abort"
+		case u.Err != nil:
+			failed++
+			status = "FAILED: " + u.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", u.Key, u.UploadID, u.Initiated.Local().Format(time.DateTime), status)
+	}
+	tw.Flush()
+	log.Printf("%d stale uploads, %d failed", len(stale), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
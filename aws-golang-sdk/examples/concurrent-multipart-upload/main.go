@@ -0,0 +1,84 @@
+// Command concurrent-multipart-upload uploads a file with a multipart
+// upload, sending several parts in parallel. With -checkpoint, the upload
+// is recorded in a checkpoint file and left open on failure; running the
+// same command again resumes it, sending only the parts the server does
+// not hold.
+//
+//	go run ./examples/concurrent-multipart-upload -bucket b -key big.iso -file ./big.iso -max-concurrency 8
+//	go run ./examples/concurrent-multipart-upload -bucket b -key big.iso -file ./big.iso -checkpoint big.iso.upload
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/resumable"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	var progress utils.ProgressFlags
+	progress.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts uploaded in parallel")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "destination key (required)")
+	file := flag.String("file", "", "file to upload (required)")
+	checkpointPath := flag.String("checkpoint", "", "record the upload in this file and resume it from there if it exists")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var closeProgress io.Closer
+	if opts.Progress, closeProgress, err = progress.Open(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	defer client.ReportStats(os.Stderr)
+	start := time.Now()
+	var out *s3.CompleteMultipartUploadOutput
+	if *checkpointPath != "" {
+		// The checkpoint names the UploadId; keep it encrypted on shared hosts.
+		var ckey *checkpoint.Key
+		if ckey, err = checkpoint.KeyFromEnv(); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stat(*checkpointPath); err == nil {
+			log.Printf("resuming the upload recorded in %s", *checkpointPath)
+		}
+		out, err = resumable.Upload(ctx, client, *bucket, *key, *file, *checkpointPath, resumable.Options{Upload: opts, Key: ckey})
+	} else {
+		out, err = utils.ConcurrentMultipartUpload(ctx, client, *bucket, *key, *file, opts)
+	}
+	if err := closeProgress.Close(); err != nil {
+		log.Printf("progress: %v", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("uploaded %s to s3://%s/%s in %s (ETag %s)", *file, *bucket, *key,
+		time.Since(start).Round(time.Millisecond), aws.StringValue(out.ETag))
+}
@@ -0,0 +1,122 @@
+// Command cse uploads and downloads client-side encrypted objects, and
+// generates master keys for a keyring file (see the cse package for the
+// format).
+//
+//	go run ./examples/cse -action keygen -key-id 2024-06 > keyring.json
+//	go run ./examples/cse -action put -keyring keyring.json -bucket vault -key db.dump -file ./db.dump
+//	go run ./examples/cse -action get -keyring keyring.json -bucket vault -key db.dump -file ./db.restored
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/cse"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	action := flag.String("action", "", "put, get or keygen (required)")
+	keyringPath := flag.String("keyring", "", "keyring file (required for put and get)")
+	keyID := flag.String("key-id", "", "ID of the key generated by keygen (required for keygen)")
+	bucket := flag.String("bucket", "", "bucket (required for put and get)")
+	key := flag.String("key", "", "object key (required for put and get)")
+	file := flag.String("file", "-", "file to upload or download to; - is stdin or stdout")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *action == "keygen" {
+		keygen(*keyID)
+		return
+	}
+	if *action != "put" && *action != "get" {
+		log.Fatalf("unknown -action %q", *action)
+	}
+	if *keyringPath == "" || *bucket == "" || *key == "" {
+		log.Fatal("-keyring, -bucket and -key are required")
+	}
+	kr, err := cse.LoadKeyring(*keyringPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *action == "put" {
+		in := os.Stdin
+		if *file != "-" {
+			if in, err = os.Open(*file); err != nil {
+				log.Fatal(err)
+			}
+			defer in.Close()
+		}
+		out, err := cse.Put(ctx, client, *bucket, *key, in, kr, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("uploaded s3://%s/%s encrypted with key %q (%s stored)", *bucket, *key, kr.Current, utils.FormatBytes(out.Size))
+		return
+	}
+
+	body, err := cse.Get(ctx, client, *bucket, *key, kr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer body.Close()
+	out := os.Stdout
+	if *file != "-" {
+		// Decrypt into a temporary file and rename it into place only
+		// once the whole object has authenticated.
+		tmp, err := os.CreateTemp(filepath.Dir(*file), ".cse-*")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(tmp.Name())
+		out = tmp
+	}
+	n, err := io.Copy(out, body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.Rename(out.Name(), *file); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("decrypted s3://%s/%s (%s)", *bucket, *key, utils.FormatBytes(n))
+}
+
+func keygen(id string) {
+	if id == "" {
+		log.Fatal("-key-id is required")
+	}
+	k, err := cse.NewKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cse.Keyring{Current: id, Keys: map[string][]byte{id: k}}); err != nil {
+		log.Fatal(err)
+	}
+}
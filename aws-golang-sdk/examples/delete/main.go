@@ -0,0 +1,152 @@
+// Command delete removes objects: the keys given with -key or listed in
+// -keys-file, or every object under -prefix. Keys are deleted 1000 per
+// request. It asks for confirmation unless -force or -dry-run is given.
+// The first failed key stops the batches not yet sent unless
+// -continue-on-error is given; it exits with status 1 if any key could
+// not be deleted.
+//
+//	go run ./examples/delete -bucket b -key tmp/a.bin
+//	go run ./examples/delete -bucket b -prefix test-run-42/ -dry-run
+//	go run ./examples/delete -bucket b -prefix test-run-42/ -force
+//	go run ./examples/delete -bucket b -prefix test-run-42/ -force -continue-on-error
+//	cat stale.txt | go run ./examples/delete -bucket b -keys-file - -force
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.DeleteOptions
+	var keys utils.StringList
+	bucket := flag.String("bucket", "", "bucket to delete from (required)")
+	flag.Var(&keys, "key", "key to delete (repeatable)")
+	keysFile := flag.String("keys-file", "", "file of keys to delete, one per line; - for standard input")
+	prefix := flag.String("prefix", "", "delete every object under this prefix")
+	flag.BoolVar(&opts.AllowEmptyPrefix, "all", false, "with an empty -prefix, delete every object of the bucket")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list what would be deleted without deleting it")
+	flag.IntVar(&opts.Concurrency, "concurrency", utils.DefaultConcurrency, "number of delete requests in parallel")
+	continueOnError := flag.Bool("continue-on-error", false, "keep deleting after a key fails instead of stopping")
+	force := flag.Bool("force", false, "delete without asking for confirmation")
+	verbose := flag.Bool("v", false, "print every key, not only failures")
+	flag.Parse()
+	opts.StopOnError = !*continueOnError
+
+	byPrefix := *prefix != "" || opts.AllowEmptyPrefix
+	if *bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if byPrefix == (len(keys) > 0 || *keysFile != "") {
+		log.Fatal("give either -key/-keys-file or -prefix")
+	}
+	if *keysFile != "" {
+		listed, err := readKeys(*keysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, listed...)
+	}
+	if !*force {
+		target := fmt.Sprintf("s3://%s/%s", *bucket, *prefix)
+		opts.Confirm = func(count int, bytes int64) error {
+			if !byPrefix {
+				return utils.Confirm(fmt.Sprintf("Delete %d objects from s3://%s?", count, *bucket))
+			}
+			return utils.Confirm(fmt.Sprintf("Delete %d objects (%s) under %s?", count, utils.FormatBytes(bytes), target))
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var deleted []utils.DeletedObject
+	switch {
+	case byPrefix:
+		deleted, err = utils.DeletePrefix(ctx, client, *bucket, *prefix, opts)
+	case len(keys) == 1 && !opts.DryRun:
+		if !*force {
+			if err := utils.Confirm(fmt.Sprintf("Delete s3://%s/%s?", *bucket, keys[0])); err != nil {
+				log.Fatal(err)
+			}
+		}
+		deleted = []utils.DeletedObject{{Key: keys[0], Err: utils.DeleteObject(ctx, client, *bucket, keys[0])}}
+	default:
+		deleted, err = utils.DeleteObjects(ctx, client, *bucket, keys, opts)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed, skipped := 0, 0
+	var size int64
+	for _, d := range deleted {
+		switch {
+		case errors.Is(d.Err, utils.ErrSkipped):
+			skipped++
+			continue
+		case d.Err != nil:
+			failed++
+			fmt.Printf("FAILED %s: %v\n", d.Key, d.Err)
+			continue
+		case opts.DryRun:
+			fmt.Printf("would delete %s\n", d.Key)
+		case *verbose:
+			fmt.Printf("deleted %s\n", d.Key)
+		}
+		size += d.Size
+	}
+	verb := "deleted"
+	if opts.DryRun {
+		verb = "would delete"
+	}
+	done := len(deleted) - failed - skipped
+	if byPrefix {
+		log.Printf("%s %d objects (%s), %d failed, %d skipped", verb, done, utils.FormatBytes(size), failed, skipped)
+	} else {
+		log.Printf("%s %d objects, %d failed, %d skipped", verb, done, failed, skipped)
+	}
+	if skipped > 0 {
+		log.Printf("stopped after the first failure; use -continue-on-error to attempt every key")
+	}
+	if failed+skipped > 0 {
+		os.Exit(1)
+	}
+}
+
+// readKeys returns the non-empty lines of path, or of standard input for
+// "-".
+func readKeys(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var keys []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if k := strings.TrimRight(sc.Text(), "\r"); strings.TrimSpace(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys, sc.Err()
+}
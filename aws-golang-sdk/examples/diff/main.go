@@ -0,0 +1,99 @@
+// Command diff compares a local file with an object, or a local directory
+// with a prefix, and prints what differs. Content is checked against the
+// object's SHA-256 metadata or ETag when possible, hashing only the local
+// side, and otherwise by sampling ranges of the object. It exits 0 when
+// everything matches, 1 when something differs and 2 on errors.
+//
+//	go run ./examples/diff -bucket b -key images/disk.qcow2 -path ./disk.qcow2
+//	go run ./examples/diff -bucket b -key site/ -path ./public -content-type
+//	go run ./examples/diff -bucket b -key data/ -path ./data -mode sample -samples 32 -format json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/diff"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	log.SetFlags(0)
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts diff.Options
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket (required)")
+	flag.StringVar(&opts.Key, "key", "", "key, or prefix when -path is a directory")
+	flag.StringVar(&opts.Path, "path", "", "local file or directory (required)")
+	mode := flag.String("mode", "", "content comparison: auto (default), size, sample or full")
+	flag.IntVar(&opts.Samples, "samples", diff.DefaultSamples, "ranges fetched per object when sampling")
+	flag.Var((*utils.ByteSize)(&opts.SampleSize), "sample-size", "size of each sampled range (default 64KiB)")
+	flag.Var((*utils.ByteSize)(&opts.PartSize), "part-size", "part size multipart objects were uploaded with (default 8MiB)")
+	flag.IntVar(&opts.Concurrency, "concurrency", diff.DefaultConcurrency, "files compared at once")
+	flag.BoolVar(&opts.ContentType, "content-type", false, "also report a Content-Type other than the file extension's")
+	format := flag.String("format", "text", "output format: text or json")
+	all := flag.Bool("all", false, "also print files that match")
+	flag.Parse()
+
+	if opts.Bucket == "" || opts.Path == "" {
+		log.Fatal("-bucket and -path are required")
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown -format %q", *format)
+	}
+	if *mode != "auto" {
+		opts.Mode = diff.Mode(*mode)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, err := diff.Compare(ctx, client, opts)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+	}
+	differ := 0
+	for _, r := range results {
+		if r.Status != diff.Same {
+			differ++
+		}
+		if *format == "json" || (r.Status == diff.Same && !*all) {
+			continue
+		}
+		switch r.Status {
+		case diff.Same:
+			fmt.Printf("=  %s (%s)\n", r.Key, r.Method)
+		case diff.LocalOnly:
+			fmt.Printf("+  %s (local only, %s)\n", r.Key, utils.FormatBytes(r.LocalSize))
+		case diff.RemoteOnly:
+			fmt.Printf("-  %s (remote only, %s)\n", r.Key, utils.FormatBytes(r.RemoteSize))
+		default:
+			fmt.Printf("!  %s: %s\n", r.Key, strings.Join(r.Differences, "; "))
+		}
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	if *format == "text" {
+		fmt.Fprintf(os.Stderr, "%d compared, %d differ\n", len(results), differ)
+	}
+	if differ > 0 {
+		os.Exit(1)
+	}
+}
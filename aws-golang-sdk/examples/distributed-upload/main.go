@@ -0,0 +1,190 @@
+// Command distributed-upload uploads one large file from several hosts at
+// once. Each host needs its own copy (or replica) of the file at the same
+// size and modification time. First create a plan with upload-plan, then:
+//
+//	# on the coordinator (optionally uploading parts itself with -file)
+//	go run ./examples/distributed-upload -role coordinator -plan big.plan -listen :8700 -token s3cret -file /data/big.iso
+//	# on every other host
+//	go run ./examples/distributed-upload -role worker -coordinator http://coord:8700 -token s3cret -file /data/big.iso
+//
+// The coordinator leases batches of parts to workers, re-leases parts whose
+// worker failed or went silent, and completes the upload once every part
+// is in. A part failing -max-attempts times stops it with the upload kept;
+// restarting the coordinator with the same plan resumes the upload.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/coordinator"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/plan"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "parts uploaded in parallel on this host")
+	role := flag.String("role", "", "coordinator or worker (required)")
+	planPath := flag.String("plan", "", "plan file (coordinator)")
+	listen := flag.String("listen", ":8700", "coordinator listen address")
+	lease := flag.Duration("lease", coordinator.DefaultLease, "how long a worker may hold parts before they are reassigned")
+	maxAttempts := flag.Int("max-attempts", coordinator.DefaultMaxAttempts, "attempts at a part before the upload is given up")
+	url := flag.String("coordinator", "", "coordinator URL (worker)")
+	token := flag.String("token", "", "shared secret between coordinator and workers")
+	file := flag.String("file", "", "local copy of the file; on the coordinator, also upload parts from it")
+	name := flag.String("name", "", "worker name (default hostname)")
+	batch := flag.Int("batch", 0, "parts leased at a time (default 2x -max-concurrency)")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+	if *batch <= 0 {
+		*batch = 2 * opts.Concurrency
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	worker := &coordinator.Worker{
+		URL:     *url,
+		Token:   *token,
+		Name:    *name,
+		File:    *file,
+		Batch:   *batch,
+		Options: opts,
+		Report: func(pp plan.Part, err error) {
+			if err != nil {
+				log.Printf("part %d FAILED: %v", pp.Number, err)
+			} else {
+				log.Printf("part %d uploaded", pp.Number)
+			}
+		},
+	}
+
+	switch *role {
+	case "worker":
+		if *url == "" || *file == "" {
+			log.Fatal("-coordinator and -file are required for a worker")
+		}
+		if err := worker.Run(ctx, client); err != nil {
+			log.Fatal(err)
+		}
+		log.Print("upload finished")
+	case "coordinator":
+		if *planPath == "" {
+			log.Fatal("-plan is required for the coordinator")
+		}
+		runCoordinator(ctx, client, *planPath, *listen, *token, *lease, *maxAttempts, worker)
+	default:
+		log.Fatalf("unknown -role %q", *role)
+	}
+}
+
+func runCoordinator(ctx context.Context, client *utils.Client, planPath, listen, token string, lease time.Duration, maxAttempts int, worker *coordinator.Worker) {
+	key, err := checkpoint.KeyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, err := plan.Read(planPath, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var done []int64
+	if p.UploadID == "" {
+		if err := p.Create(ctx, client); err != nil {
+			log.Fatal(err)
+		}
+		if err := p.Write(planPath, key); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("created upload %s", p.UploadID)
+	} else {
+		uploaded, err := p.Uploaded(ctx, client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		missing := make(map[int64]bool)
+		for _, n := range p.Missing(uploaded) {
+			missing[n] = true
+		}
+		for _, pp := range p.Parts {
+			if !missing[pp.Number] {
+				done = append(done, pp.Number)
+			}
+		}
+		log.Printf("resuming upload %s: %d of %d parts already uploaded", p.UploadID, len(done), len(p.Parts))
+	}
+
+	coord := coordinator.New(p, done, token, lease, maxAttempts)
+	srv := &http.Server{Addr: listen, Handler: coord.Handler()}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	defer srv.Shutdown(context.Background())
+	log.Printf("coordinating %d parts on %s", len(p.Parts), listen)
+
+	if worker.File != "" {
+		worker.URL = "http://" + loopback(listen)
+		go func() {
+			if err := worker.Run(ctx, client); err != nil && ctx.Err() == nil {
+				log.Printf("local worker stopped: %v", err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- coord.Wait(ctx) }()
+	for {
+		select {
+		case err := <-waitErr:
+			if err != nil {
+				log.Fatalf("%v; the upload is kept, restart the coordinator to retry", err)
+			}
+			out, err := p.Complete(ctx, client)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("completed s3://%s/%s (ETag %s)", p.Bucket, p.Key, aws.StringValue(out.ETag))
+			return
+		case <-ticker.C:
+			s := coord.Status()
+			log.Printf("progress: %d/%d parts done, %d pending, leased %v", s.Done, s.Total, s.Pending, s.Leased)
+			if len(s.Failures) > 0 {
+				log.Printf("failed attempts by part: %v", s.Failures)
+			}
+		}
+	}
+}
+
+// loopback turns a listen address such as ":8700" into one the local
+// worker can dial.
+func loopback(listen string) string {
+	if len(listen) > 0 && listen[0] == ':' {
+		return "127.0.0.1" + listen
+	}
+	return listen
+}
@@ -0,0 +1,75 @@
+// Command download fetches an object to a file with parallel ranged GETs
+// written in place at their offsets. If it is interrupted, running it
+// again with the same -o resumes from the ranges already on disk instead
+// of starting over, as long as the object has not changed. The finished
+// file is checked against the object's sha256 metadata and checksum
+// headers; a corrupt download is deleted unless -keep-corrupt is given.
+//
+//	go run ./examples/download -bucket b -key images/disk.qcow2 -o disk.qcow2
+//	go run ./examples/download -bucket b -key images/disk.qcow2 -o disk.qcow2 -part-size 64MiB -max-concurrency 16
+//	go run ./examples/download -bucket b -key images/disk.qcow2 -o disk.qcow2 -bandwidth 50MiB
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	opts := downloads.ResumeOptions{PartSize: utils.DefaultPartSize}
+	flag.Var((*utils.ByteSize)(&opts.PartSize), "part-size", "size of each ranged GET")
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of ranges fetched in parallel")
+	flag.DurationVar(&opts.PartTimeoutMin, "part-timeout", utils.DefaultPartTimeoutMin, "minimum per-range timeout, extended by range size over the throughput estimate (negative disables)")
+	opts.MinThroughput = utils.DefaultMinThroughput
+	flag.Var((*utils.ByteSize)(&opts.MinThroughput), "min-throughput", "per-connection throughput, per second, below which a range is considered hung")
+	bucket := flag.String("bucket", "", "source bucket (required)")
+	key := flag.String("key", "", "source key (required)")
+	output := flag.String("o", "", "output file (default the key's base name)")
+	flag.BoolVar(&opts.KeepCorrupt, "keep-corrupt", false, "keep the partial file of a download that fails checksum verification")
+	var bandwidth utils.ByteSize
+	flag.Var(&bandwidth, "bandwidth", "most bytes per second read across all ranges, e.g. 50MiB (0 = unlimited)")
+	flag.Parse()
+	if bandwidth > 0 {
+		opts.Bandwidth = utils.NewBandwidth(int64(bandwidth))
+	}
+
+	if *bucket == "" || *key == "" {
+		log.Fatal("-bucket and -key are required")
+	}
+	if *output == "" {
+		*output = path.Base(*key)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if _, err := os.Stat(*output + downloads.ResumeStateSuffix); err == nil {
+		log.Printf("resuming the interrupted download into %s", *output)
+	}
+	start := time.Now()
+	n, err := downloads.ResumableDownload(ctx, client, *bucket, *key, *output, opts)
+	switch {
+	case errors.Is(err, downloads.ErrChecksumMismatch) && opts.KeepCorrupt:
+		log.Fatalf("%v (corrupt data left in %s)", err, *output+downloads.PartialSuffix)
+	case errors.Is(err, downloads.ErrChecksumMismatch):
+		log.Fatal(err)
+	case err != nil:
+		log.Fatalf("%v (run again to resume)", err)
+	}
+	log.Printf("wrote %s from s3://%s/%s to %s in %s", utils.FormatBytes(n), *bucket, *key, *output, time.Since(start).Round(time.Millisecond))
+}
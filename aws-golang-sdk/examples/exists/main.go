@@ -0,0 +1,71 @@
+// Command exists checks whether an object exists, for use in shell
+// scripts. It exits 0 when the key exists and meets the optional
+// conditions, 1 when it does not, and 2 when the check itself fails (bad
+// flags, credentials, network).
+//
+//	go run ./examples/exists -bucket b -key data/a.bin -min-size 1MiB && echo present
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	bucket := flag.String("bucket", "", "bucket (required)")
+	key := flag.String("key", "", "key (required)")
+	var minSize int64
+	flag.Var((*utils.ByteSize)(&minSize), "min-size", "also require the object to be at least this large")
+	matchETag := flag.String("match-etag", "", "also require the object to have this ETag (quotes optional)")
+	quiet := flag.Bool("q", false, "do not explain a missing or mismatched object on stderr")
+	flag.Parse()
+
+	if *bucket == "" || *key == "" {
+		fail("-bucket and -key are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		fail(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(*bucket),
+		Key:    aws.String(*key),
+	})
+	reason := ""
+	switch {
+	case utils.IsNotFound(err):
+		reason = "does not exist"
+	case err != nil:
+		fail(err)
+	case aws.Int64Value(head.ContentLength) < minSize:
+		reason = fmt.Sprintf("is %s, smaller than %s", utils.FormatBytes(aws.Int64Value(head.ContentLength)), utils.FormatBytes(minSize))
+	case *matchETag != "" && !utils.SameETag(aws.StringValue(head.ETag), *matchETag):
+		reason = fmt.Sprintf("has ETag %s", aws.StringValue(head.ETag))
+	}
+	if reason != "" {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "s3://%s/%s %s\n", *bucket, *key, reason)
+		}
+		os.Exit(1)
+	}
+}
+
+// fail reports an error that prevented the check and exits 2, so callers
+// can tell it apart from a missing object.
+func fail(v any) {
+	fmt.Fprintln(os.Stderr, "exists:", v)
+	os.Exit(2)
+}
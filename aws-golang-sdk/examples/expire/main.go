@@ -0,0 +1,100 @@
+// Command expire deletes, or transitions by copying elsewhere, objects
+// older than a given age under a prefix. It is a client-side stand-in for
+// lifecycle rules on deployments that do not support them. It asks for
+// confirmation, showing how many objects expire, unless -force or
+// -dry-run is given. The first failure stops the run unless
+// -continue-on-error is given; it exits with status 1 if any object
+// failed or was skipped.
+//
+//	go run ./examples/expire -bucket logs -prefix app/ -days 30 -dry-run
+//	go run ./examples/expire -bucket logs -prefix app/ -days 30 -force
+//	go run ./examples/expire -bucket logs -prefix app/ -days 90 -action transition -dest-bucket archive -dest-prefix app/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/expire"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts expire.Options
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to expire objects in (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "only consider objects under this prefix")
+	days := flag.Int("days", 0, "expire objects last modified more than this many days ago (required)")
+	action := flag.String("action", string(expire.ActionDelete), "what to do with expired objects: delete or transition")
+	flag.StringVar(&opts.DestBucket, "dest-bucket", "", "transition destination bucket (default -bucket)")
+	flag.StringVar(&opts.DestPrefix, "dest-prefix", "", "transition destination prefix, replacing -prefix")
+	flag.StringVar(&opts.StorageClass, "storage-class", "", "storage class for transitioned copies")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list what would expire without changing anything")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "number of parallel transitions")
+	flag.BoolVar(&opts.ContinueOnError, "continue-on-error", false, "keep expiring after a failure instead of stopping")
+	force := flag.Bool("force", false, "expire without asking for confirmation")
+	flag.Parse()
+
+	if opts.Bucket == "" || *days <= 0 {
+		log.Fatal("-bucket and a positive -days are required")
+	}
+	opts.OlderThan = time.Duration(*days) * 24 * time.Hour
+	opts.Action = expire.Action(*action)
+	if !*force {
+		opts.Confirm = func(n int, bytes int64) error {
+			verb := "Delete"
+			if opts.Action == expire.ActionTransition {
+				verb = "Transition (and delete)"
+			}
+			return utils.Confirm(fmt.Sprintf("%s %d objects (%s) under s3://%s/%s older than %d days?",
+				verb, n, utils.FormatBytes(bytes), opts.Bucket, opts.Prefix, *days))
+		}
+	}
+
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var count, failed, skipped int
+	var bytes int64
+	verb := "expired"
+	if opts.DryRun {
+		verb = "would expire"
+	}
+	err = expire.Run(ctx, client, opts, func(r expire.Result) {
+		if errors.Is(r.Err, utils.ErrSkipped) {
+			skipped++
+			return
+		}
+		if r.Err != nil {
+			failed++
+			log.Printf("FAILED %s: %v", r.Key, r.Err)
+			return
+		}
+		count++
+		bytes += r.Size
+		dest := ""
+		if r.Dest != "" {
+			dest = " -> " + r.Dest
+		}
+		fmt.Printf("%s %s (%s, modified %s)%s\n", verb, r.Key, utils.FormatBytes(r.Size), r.LastModified.Format(time.DateOnly), dest)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s %d objects (%s), %d failures, %d skipped", verb, count, utils.FormatBytes(bytes), failed, skipped)
+	if failed+skipped > 0 {
+		os.Exit(1)
+	}
+}
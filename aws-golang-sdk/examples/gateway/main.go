@@ -0,0 +1,80 @@
+// Command gateway serves a bucket prefix read-only over plain HTTP or
+// HTTPS, with optional basic auth and directory listings, for tools that
+// cannot speak S3.
+//
+//	OBJECTSLITE_GATEWAY_PASSWORD=s3cret go run ./examples/gateway -bucket releases -prefix stable/ -listen :8443 \
+//	    -tls-cert gw.crt -tls-key gw.key -auth-user mirror -listings
+//	curl -u mirror:s3cret https://gw:8443/tool-1.2.tar.gz -O
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/gateway"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// envPassword holds the basic-auth password, kept off the command line.
+const envPassword = "OBJECTSLITE_GATEWAY_PASSWORD"
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts gateway.Options
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to serve (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "serve only this prefix, as the root")
+	flag.StringVar(&opts.Username, "auth-user", "", "require basic auth with this user; the password is read from $"+envPassword)
+	flag.BoolVar(&opts.Listings, "listings", false, "serve HTML listings for paths ending in /")
+	listen := flag.String("listen", ":8080", "address to listen on")
+	certFile := flag.String("tls-cert", "", "serve HTTPS with this certificate")
+	keyFile := flag.String("tls-key", "", "private key for -tls-cert")
+	flag.Parse()
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if opts.Username != "" {
+		if opts.Password = os.Getenv(envPassword); opts.Password == "" {
+			log.Fatal("-auth-user needs a password in $" + envPassword)
+		}
+		if *certFile == "" {
+			log.Printf("warning: basic auth over plain HTTP sends the password in the clear")
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           gateway.NewHandler(client, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving s3://%s/%s on %s", opts.Bucket, opts.Prefix, *listen)
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,78 @@
+// Command jobs runs the sync and backup jobs of a configuration file
+// against every target they name (see the jobs package for the format),
+// one after another or several at once, highest "priority" first, and
+// prints the status of each job on each target. With -max-parts, jobs
+// running at once share that many part uploads, handed out by priority.
+// It exits with status 1 if any of them failed.
+//
+//	DC1_SECRET=... DR_PASSWORD=... go run ./examples/jobs -config jobs.json
+//	go run ./examples/jobs -config jobs.json -parallel 4 -only home
+//	go run ./examples/jobs -config jobs.json -parallel 2 -max-parts 16
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/jobs"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var opts jobs.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	var only utils.StringList
+	configPath := flag.String("config", "", "job configuration file (required)")
+	flag.IntVar(&opts.Parallel, "parallel", 1, "job/target pairs run at once (1 runs them in order)")
+	flag.Var(&only, "only", "run only this job (repeatable)")
+	flag.IntVar(&opts.MaxParts, "max-parts", 0, "part uploads in flight across all running jobs, given to higher-priority jobs first (0 = no shared limit)")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *configPath == "" {
+		log.Fatal("-config is required")
+	}
+	cfg, err := jobs.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.Only = only
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	statuses := jobs.Run(ctx, cfg, opts, func(s jobs.Status) {
+		switch s.State {
+		case jobs.StateRunning:
+			log.Printf("[%s → %s] started", s.Job, s.Target)
+		case jobs.StateFailed:
+			log.Printf("[%s → %s] FAILED after %s: %v", s.Job, s.Target, s.Elapsed.Round(time.Second), s.Err)
+		default:
+			log.Printf("[%s → %s] done in %s: %s", s.Job, s.Target, s.Elapsed.Round(time.Second), s.Detail)
+		}
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tTARGET\tSTATE\tELAPSED\tDETAIL")
+	failed := 0
+	for _, s := range statuses {
+		detail := s.Detail
+		if s.Err != nil {
+			failed++
+			detail = s.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Job, s.Target, s.State, s.Elapsed.Round(time.Second), detail)
+	}
+	tw.Flush()
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,97 @@
+// Command list-objects lists the keys of a bucket, or without -bucket,
+// the buckets. -delimiter / shows one level at a time, with the common
+// prefixes as "PRE" lines like `aws s3 ls`. -max-keys lists a single page
+// of that many entries and prints the token that continues the listing
+// with -continuation-token.
+//
+//	go run ./examples/list-objects
+//	go run ./examples/list-objects -bucket b -prefix logs/ -delimiter /
+//	go run ./examples/list-objects -bucket b -prefix logs/2024/ -max-keys 100
+//	go run ./examples/list-objects -bucket b -prefix logs/2024/ -max-keys 100 -continuation-token <token>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.ListOptions
+	bucket := flag.String("bucket", "", "bucket to list (default: list the buckets)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "list only keys under this prefix")
+	flag.StringVar(&opts.Delimiter, "delimiter", "", "roll keys up to common prefixes at this delimiter, e.g. /")
+	flag.StringVar(&opts.StartAfter, "start-after", "", "list only keys after this one")
+	flag.Int64Var(&opts.MaxKeys, "max-keys", 0, "list one page of at most this many entries (0 = list everything)")
+	flag.StringVar(&opts.ContinuationToken, "continuation-token", "", "continue a -max-keys listing from its printed token")
+	flag.Parse()
+
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	defer tw.Flush()
+
+	if *bucket == "" {
+		buckets, err := utils.ListBuckets(ctx, client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, b := range buckets {
+			fmt.Fprintf(tw, "%s\t %s\n", b.Created.Local().Format(time.DateTime), b.Name)
+		}
+		return
+	}
+
+	var entries, objects int
+	var bytes int64
+	show := func(e utils.ListEntry) {
+		entries++
+		if e.IsPrefix {
+			fmt.Fprintf(tw, "\tPRE\t %s\n", e.Key)
+			return
+		}
+		objects++
+		bytes += e.Size
+		fmt.Fprintf(tw, "%s\t%d\t %s\n", e.LastModified.Local().Format(time.DateTime), e.Size, e.Key)
+	}
+	if opts.MaxKeys > 0 {
+		var next string
+		err := utils.ListObjectsV2Pages(ctx, client, *bucket, opts, func(page utils.ListPage) bool {
+			for _, e := range append(page.Objects, page.Prefixes...) {
+				show(e)
+			}
+			next = page.NextToken
+			return false
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		tw.Flush()
+		if next != "" {
+			log.Printf("more entries; continue with -continuation-token %s", next)
+		}
+		return
+	}
+	it := utils.NewObjectIterator(ctx, client, *bucket, opts)
+	for it.Next() {
+		show(it.Entry())
+	}
+	if err := it.Err(); err != nil {
+		log.Fatal(err)
+	}
+	tw.Flush()
+	log.Printf("%d entries, %d objects (%s)", entries, objects, utils.FormatBytes(bytes))
+}
@@ -0,0 +1,93 @@
+// Command manifest-download downloads every object listed in a manifest
+// into a local directory, several at a time, retrying failed objects and
+// printing a summary. -bandwidth caps the rate of all downloads together,
+// divided evenly between the objects in flight. It exits with status 1 if any object could not be
+// downloaded; with -failures, those objects are written to a report that
+// examples/retry re-attempts.
+//
+//	go run ./examples/manifest-download -bucket backups -prefix nightly/ -manifest nightly.jsonl -dir ./restore -verify
+//	go run ./examples/manifest-download -bucket backups -manifest nightly.jsonl -dir ./restore -failures failed.jsonl
+//	go run ./examples/manifest-download -bucket backups -manifest nightly.jsonl -dir ./restore -concurrency 32 -bandwidth 100MiB
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/failures"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/manifest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts downloads.ManifestOptions
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to download from (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "prefix prepended to every manifest key")
+	flag.StringVar(&opts.Dir, "dir", "", "directory to download into (required)")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "number of objects downloaded in parallel")
+	flag.IntVar(&opts.Retries, "retries", downloads.DefaultRetries, "retries per object (negative disables)")
+	flag.BoolVar(&opts.Verify, "verify", false, "check each file against the manifest's size and hash")
+	manifestPath := flag.String("manifest", "", "manifest file (required)")
+	failuresPath := flag.String("failures", "", "write failed downloads to this JSONL report for examples/retry")
+	var bandwidth utils.ByteSize
+	flag.Var(&bandwidth, "bandwidth", "most bytes per second across all downloads, shared evenly between objects, e.g. 100MiB (0 = unlimited)")
+	flag.Parse()
+	if bandwidth > 0 {
+		opts.Bandwidth = utils.NewBandwidth(int64(bandwidth))
+	}
+
+	if opts.Bucket == "" || opts.Dir == "" || *manifestPath == "" {
+		log.Fatal("-bucket, -dir and -manifest are required")
+	}
+	entries, err := manifest.ReadFile(*manifestPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start := time.Now()
+	var report failures.Report
+	results := downloads.FromManifest(ctx, client, entries, opts, func(r downloads.Result) {
+		if r.Err != nil {
+			log.Printf("FAILED %s after %d attempts: %v", r.Key, r.Attempts, r.Err)
+			report.Add(failures.Entry{Op: failures.OpDownload, Bucket: opts.Bucket, Key: r.Key, Path: r.Path}, r.Err)
+		}
+	})
+	if *failuresPath != "" {
+		if err := report.WriteFile(*failuresPath); err != nil {
+			log.Printf("write failures report: %v", err)
+		}
+	}
+
+	var ok, failed int
+	var bytes int64
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			continue
+		}
+		ok++
+		bytes += r.Size
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(os.Stderr, "downloaded %d of %d objects (%s) in %s, %s/s; %d failed\n",
+		ok, len(results), utils.FormatBytes(bytes), elapsed.Round(time.Millisecond),
+		utils.FormatBytes(int64(float64(bytes)/elapsed.Seconds())), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,62 @@
+// Command multipart-upload uploads a file with a multipart upload, one
+// part at a time.
+//
+//	go run ./examples/multipart-upload -bucket b -key big.iso -file ./big.iso -part-size 64MiB
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	var progress utils.ProgressFlags
+	progress.RegisterFlags(flag.CommandLine)
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "destination key (required)")
+	file := flag.String("file", "", "file to upload (required)")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var closeProgress io.Closer
+	if opts.Progress, closeProgress, err = progress.Open(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	defer client.ReportStats(os.Stderr)
+	start := time.Now()
+	out, err := utils.MultipartUpload(ctx, client, *bucket, *key, *file, opts)
+	if err := closeProgress.Close(); err != nil {
+		log.Printf("progress: %v", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("uploaded %s to s3://%s/%s in %s (ETag %s)", *file, *bucket, *key,
+		time.Since(start).Round(time.Millisecond), aws.StringValue(out.ETag))
+}
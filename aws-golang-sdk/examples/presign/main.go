@@ -0,0 +1,144 @@
+// Command presign prints a time-limited URL that downloads (-method get)
+// or uploads (-method put) one object without credentials. The URL goes
+// to stdout; its expiry, and for PUT the headers the uploader must send,
+// go to stderr. -verify uses the URL once: a GET is read to the end, a
+// PUT sends -file.
+//
+//	go run ./examples/presign -bucket b -key reports/q3.pdf -expires 24h
+//	curl -o q3.pdf "$(go run ./examples/presign -bucket b -key reports/q3.pdf)"
+//	go run ./examples/presign -method put -bucket b -key inbox/a.csv -content-type text/csv -verify -file a.csv
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.PresignPutOptions
+	var meta utils.StringList
+	bucket := flag.String("bucket", "", "bucket (required)")
+	key := flag.String("key", "", "key (required)")
+	method := flag.String("method", "get", "get or put")
+	expires := flag.Duration("expires", utils.DefaultPresignExpiry, "how long the URL stays valid, at most 168h")
+	flag.StringVar(&opts.ContentType, "content-type", "", "Content-Type a PUT must be sent with")
+	flag.Var(&meta, "meta", "user metadata key=value a PUT must be sent with (repeatable)")
+	verify := flag.Bool("verify", false, "use the URL once and report the response")
+	file := flag.String("file", "", "body of the -verify PUT")
+	flag.Parse()
+
+	if *bucket == "" || *key == "" {
+		log.Fatal("-bucket and -key are required")
+	}
+	for _, kv := range meta {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			log.Fatalf("invalid -meta %q, want key=value", kv)
+		}
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]*string)
+		}
+		opts.Metadata[k] = &v
+	}
+	if *verify && *method == "put" && *file == "" {
+		log.Fatal("-verify with -method put needs -file")
+	}
+
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var u *utils.PresignedURL
+	switch *method {
+	case "get":
+		u, err = utils.GeneratePresignedGetURL(ctx, client, *bucket, *key, *expires)
+	case "put":
+		u, err = utils.GeneratePresignedPutURL(ctx, client, *bucket, *key, *expires, opts)
+	default:
+		log.Fatalf("unknown -method %q, want get or put", *method)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(u.URL)
+	fmt.Fprintf(os.Stderr, "expires %s\n", u.Expires.Local().Format(time.DateTime))
+	for name, values := range u.Header {
+		for _, v := range values {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, v)
+		}
+	}
+
+	if *verify {
+		httpClient, err := client.Config.HTTPClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := check(ctx, httpClient, u, *file); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// check sends one request to u, with the body of file for a PUT, and
+// fails unless the response is a success.
+func check(ctx context.Context, httpClient *http.Client, u *utils.PresignedURL, file string) error {
+	var body io.Reader
+	var size int64
+	if u.Method == http.MethodPut {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		body, size = f, info.Size()
+	}
+	req, err := http.NewRequestWithContext(ctx, u.Method, u.URL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	for name, values := range u.Header {
+		if !strings.EqualFold(name, "Host") {
+			req.Header[name] = values
+		}
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("verify: %s %s", u.Method, resp.Status)
+	}
+	switch u.Method {
+	case http.MethodGet:
+		fmt.Fprintf(os.Stderr, "verified: GET %s, %s in %s\n", resp.Status, utils.FormatBytes(n), time.Since(start).Round(time.Millisecond))
+	default:
+		fmt.Fprintf(os.Stderr, "verified: PUT %s, %s sent, ETag %s\n", resp.Status, utils.FormatBytes(size), resp.Header.Get("ETag"))
+	}
+	return nil
+}
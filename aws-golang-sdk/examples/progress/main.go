@@ -0,0 +1,145 @@
+// Command progress uploads a file, or with -get downloads an object, with
+// a live progress bar, rate and ETA on stderr, drawn from the
+// utils.ProgressListener of the transfer.
+//
+//	go run ./examples/progress -bucket b -key big.iso -file ./big.iso
+//	go run ./examples/progress -get -bucket b -key big.iso -file ./big.iso
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// rateWindow is how far back the rate behind the ETA looks, so it follows
+// changes in throughput without jumping with every part.
+const rateWindow = 5 * time.Second
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	bucket := flag.String("bucket", "", "bucket (required)")
+	key := flag.String("key", "", "key (required)")
+	file := flag.String("file", "", "file to upload, or with -get, to download to (required)")
+	get := flag.Bool("get", false, "download the object to -file instead of uploading")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var size int64
+	if *get {
+		head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(*bucket), Key: aws.String(*key)})
+		if err != nil {
+			log.Fatal(err)
+		}
+		size = aws.Int64Value(head.ContentLength)
+	} else if size, err = utils.PathSize(*file); err != nil {
+		log.Fatal(err)
+	}
+
+	b := &bar{total: size, drawn: make(chan struct{})}
+	done := make(chan struct{})
+	go b.draw(done)
+	start := time.Now()
+	if *get {
+		_, err = downloads.ResumableDownload(ctx, client, *bucket, *key, *file, downloads.ResumeOptions{
+			PartSize:    opts.PartSize,
+			Concurrency: opts.Concurrency,
+			Listener:    b,
+		})
+	} else {
+		opts.Listener = b
+		_, err = utils.Upload(ctx, client, *bucket, *key, *file, opts)
+	}
+	close(done)
+	<-b.drawn
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s in %s, %d parts", utils.FormatBytes(size), time.Since(start).Round(time.Millisecond), b.parts.Load())
+}
+
+// bar is a utils.ProgressListener drawing a one-line progress bar.
+type bar struct {
+	total int64
+	done  atomic.Int64
+	parts atomic.Int64
+	// drawn is closed once draw has drawn the final bar.
+	drawn chan struct{}
+}
+
+func (b *bar) OnBytesTransferred(key string, n int64)      { b.done.Add(n) }
+func (b *bar) OnPartComplete(key string, part, size int64) { b.parts.Add(1) }
+
+// draw redraws the bar five times a second until stop is closed, then
+// draws it a last time and ends the line.
+func (b *bar) draw(stop <-chan struct{}) {
+	defer close(b.drawn)
+	type sample struct {
+		at   time.Time
+		done int64
+	}
+	samples := []sample{{time.Now(), 0}}
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			b.line(samples[0].at, samples[0].done, b.done.Load())
+			fmt.Fprintln(os.Stderr)
+			return
+		case now := <-tick.C:
+			done := b.done.Load()
+			samples = append(samples, sample{now, done})
+			for len(samples) > 2 && now.Sub(samples[1].at) >= rateWindow {
+				samples = samples[1:]
+			}
+			b.line(samples[0].at, samples[0].done, done)
+		}
+	}
+}
+
+// line prints the bar for done bytes, with the rate since the sample of
+// since bytes taken at from.
+func (b *bar) line(from time.Time, since, done int64) {
+	const width = 30
+	frac := 1.0
+	if b.total > 0 {
+		frac = min(float64(done)/float64(b.total), 1)
+	}
+	filled := int(frac * width)
+	rate := float64(done-since) / time.Since(from).Seconds()
+	eta := "--"
+	if rate > 0 && done < b.total {
+		eta = time.Duration(float64(b.total-done) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %3.0f%%  %s / %s  %s/s  ETA %s  parts %d\033[K",
+		strings.Repeat("#", filled), strings.Repeat("-", width-filled), frac*100,
+		utils.FormatBytes(done), utils.FormatBytes(b.total), utils.FormatBytes(int64(rate)), eta, b.parts.Load())
+}
@@ -0,0 +1,131 @@
+// Command replay re-executes the operations of an -audit-log file against
+// the endpoint and bucket given, e.g. a staging cluster, with generated
+// data of the recorded sizes, then compares their latencies with the
+// recorded ones. Without -bucket or -prefix the operations would rewrite
+// the recorded objects themselves, so it asks for confirmation first
+// unless -force or -dry-run is given.
+//
+//	go run ./examples/replay -log audit.jsonl -endpoint https://staging:9440 -bucket replay -prefix run1/
+//	go run ./examples/replay -log audit.jsonl -bucket replay -speed 1 -concurrency 64
+//	go run ./examples/replay -log audit.jsonl -ops PutObject,DeleteObjects -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/replay"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts replay.Options
+	file := flag.String("log", "", "audit log to replay (required)")
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to replay into (default the recorded buckets)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "prefix added to every replayed key")
+	flag.Float64Var(&opts.Speed, "speed", 0, "replay at the recorded timing scaled by this factor, e.g. 1 or 2 (0 = as fast as -concurrency allows)")
+	flag.IntVar(&opts.Concurrency, "concurrency", replay.DefaultConcurrency, "operations in flight at most")
+	flag.BoolVar(&opts.Failed, "failed", false, "also replay operations that failed when recorded")
+	ops := flag.String("ops", "", "comma-separated operations to replay (default all)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "log the operations instead of sending them")
+	format := flag.String("format", "table", "output format: table or json")
+	force := flag.Bool("force", false, "replay into the recorded buckets and keys without asking for confirmation")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("-log is required")
+	}
+	if *format != "table" && *format != "json" {
+		log.Fatalf("unknown -format %q", *format)
+	}
+	if *ops != "" {
+		for _, op := range strings.Split(*ops, ",") {
+			opts.Ops = append(opts.Ops, strings.TrimSpace(op))
+		}
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	entries, err := replay.ReadLog(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Bucket == "" && opts.Prefix == "" && !opts.DryRun && !*force {
+		buckets := map[string]bool{}
+		for _, e := range entries {
+			buckets[e.Bucket] = true
+		}
+		q := fmt.Sprintf("Replay %d operations onto the recorded keys of %s?", len(entries), strings.Join(slices.Sorted(maps.Keys(buckets)), ", "))
+		if err := utils.Confirm(q); err != nil {
+			log.Fatalf("%v; give -bucket or -prefix to replay elsewhere", err)
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r, err := replay.Replay(ctx, client, entries, opts)
+	if r == nil {
+		log.Fatal(err)
+	}
+	if err != nil {
+		log.Printf("replay interrupted, reporting the operations sent: %v", err)
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	writeTable(r)
+}
+
+// writeTable prints the mean latency of each operation next to the
+// recorded one.
+func writeTable(r *replay.Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "op\tops\terrors\tbytes\tmean\trecorded mean\tmax\t")
+	for _, op := range slices.Sorted(maps.Keys(r.Ops)) {
+		s := r.Ops[op]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n", op, s.Ops, s.Errors, utils.FormatBytes(s.Bytes),
+			mean(s.Total, s.Ops), mean(s.Recorded, s.Ops), s.Max.Round(time.Millisecond))
+	}
+	w.Flush()
+	fmt.Printf("\nreplayed in %s, recorded over %s", r.Elapsed.Round(time.Millisecond), r.Recorded.Round(time.Millisecond))
+	if r.Late > 0 {
+		fmt.Printf(", %d operations started late", r.Late)
+	}
+	fmt.Println()
+	for _, op := range slices.Sorted(maps.Keys(r.Skipped)) {
+		fmt.Printf("skipped %d %s\n", r.Skipped[op], op)
+	}
+	if r.FirstError != "" {
+		fmt.Printf("first error: %s\n", r.FirstError)
+	}
+}
+
+func mean(total time.Duration, n int) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	return (total / time.Duration(n)).Round(time.Millisecond)
+}
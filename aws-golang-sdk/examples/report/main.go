@@ -0,0 +1,101 @@
+// Command report prints object counts and byte totals grouped by prefix,
+// as a table or JSON, for chargeback and cleanup decisions. With -prism it
+// also shows the bucket quota and consumed capacity reported by Prism
+// Central, so the S3 and management views can be compared side by side.
+//
+//	go run ./examples/report -bucket backups -depth 2 -top 20
+//	go run ./examples/report -bucket backups -prism
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/prism"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/report"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts report.Options
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to report on (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "only report objects under this prefix")
+	flag.IntVar(&opts.Depth, "depth", 1, "number of path components used for grouping")
+	flag.IntVar(&opts.Top, "top", 20, "show the N largest prefixes (0 shows all)")
+	format := flag.String("format", "table", "output format: table or json")
+	withPrism := flag.Bool("prism", false, "also report quota and consumed capacity from Prism Central")
+	storeID := flag.String("object-store", "", "Prism object store ID (default: the only one)")
+	flag.Parse()
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if *format != "table" && *format != "json" {
+		log.Fatalf("unknown -format %q", *format)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r, err := report.Build(ctx, client, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var bucket *prism.Bucket
+	if *withPrism {
+		if bucket, err = prismBucket(ctx, &client.Config, *storeID, opts.Bucket); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			*report.Report
+			Prism *prism.Bucket `json:"prism,omitempty"`
+		}{r, bucket})
+	} else {
+		err = r.WriteTable(os.Stdout)
+		if err == nil && bucket != nil {
+			printPrism(bucket, r.Total.Bytes)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func prismBucket(ctx context.Context, cfg *utils.Config, storeID, name string) (*prism.Bucket, error) {
+	if err := cfg.ResolvePrismCredentials(); err != nil {
+		return nil, err
+	}
+	pc, err := prism.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if storeID, err = pc.ResolveObjectStore(ctx, storeID); err != nil {
+		return nil, err
+	}
+	return pc.GetBucket(ctx, storeID, name)
+}
+
+func printPrism(b *prism.Bucket, listed int64) {
+	quota := "unlimited"
+	if b.QuotaBytes > 0 {
+		quota = fmt.Sprintf("%s (%.1f%% used)", utils.FormatBytes(b.QuotaBytes), 100*b.QuotaUsed())
+	}
+	fmt.Printf("\nPrism: used %s, %d objects, quota %s\n", utils.FormatBytes(b.UsedBytes), b.ObjectCount, quota)
+	fmt.Printf("S3 listing accounts for %s of the consumed capacity\n", utils.FormatBytes(listed))
+}
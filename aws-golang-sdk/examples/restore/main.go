@@ -0,0 +1,124 @@
+// Command restore downloads a snapshot written by the backup example into
+// a directory, verifying every file against the snapshot manifest. Without
+// -snapshot it asks which snapshot to restore when run on a terminal, and
+// restores the latest one otherwise. It exits with status 1 if any file
+// could not be restored.
+//
+//	go run ./examples/restore -bucket backups -prefix srv-data/ -list
+//	go run ./examples/restore -bucket backups -prefix srv-data/ -snapshot latest -dir /srv/data.restored
+//	go run ./examples/restore -bucket backups -prefix srv-data/ -snapshot 20240501T023000Z -dir ./restore
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/backup"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts downloads.ManifestOptions
+	bucket := flag.String("bucket", "", "bucket holding the snapshots (required)")
+	prefix := flag.String("prefix", "", "prefix holding the snapshots")
+	flag.StringVar(&opts.Dir, "dir", "", "directory to restore into (required unless -list)")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "number of files downloaded in parallel")
+	flag.IntVar(&opts.Retries, "retries", downloads.DefaultRetries, "retries per file (negative disables)")
+	name := flag.String("snapshot", "", "snapshot name, or \"latest\"; asked for on a terminal when unset")
+	list := flag.Bool("list", false, "list the available snapshots and exit")
+	flag.Parse()
+
+	if *bucket == "" || (opts.Dir == "" && !*list) {
+		log.Fatal("-bucket and -dir are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	snaps, err := backup.List(ctx, client, *bucket, *prefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *list {
+		for _, s := range snaps {
+			fmt.Printf("%s  %s\n", s.Name, s.Time.Local().Format(time.DateTime))
+		}
+		return
+	}
+	if *name == "" {
+		*name = backup.Latest
+		if term.IsTerminal(int(os.Stdin.Fd())) && len(snaps) > 1 {
+			*name = pick(snaps)
+		}
+	}
+	snap, err := backup.Find(snaps, *name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("restoring snapshot %s to %s", snap.Name, opts.Dir)
+	start := time.Now()
+	results, err := backup.Restore(ctx, client, *bucket, *prefix, snap, opts, func(r downloads.Result) {
+		if r.Err != nil {
+			log.Printf("FAILED %s after %d attempts: %v", r.Key, r.Attempts, r.Err)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	var failed int
+	var bytes int64
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			continue
+		}
+		bytes += r.Size
+	}
+	fmt.Fprintf(os.Stderr, "restored %d of %d files (%s) from %s in %s; %d failed\n",
+		len(results)-failed, len(results), utils.FormatBytes(bytes), snap.Name,
+		time.Since(start).Round(time.Millisecond), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// pick lists snaps newest first and reads the number of the one to
+// restore; an empty answer selects the newest.
+func pick(snaps []backup.Snapshot) string {
+	for i := len(snaps) - 1; i >= 0; i-- {
+		fmt.Fprintf(os.Stderr, "%3d) %s  %s\n", len(snaps)-i, snaps[i].Name, snaps[i].Time.Local().Format(time.DateTime))
+	}
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "snapshot to restore [1]: ")
+		if !in.Scan() {
+			log.Fatal("no snapshot chosen")
+		}
+		answer := strings.TrimSpace(in.Text())
+		if answer == "" {
+			return backup.Latest
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(snaps) {
+			return snaps[len(snaps)-n].Name
+		}
+		fmt.Fprintf(os.Stderr, "enter a number from 1 to %d\n", len(snaps))
+	}
+}
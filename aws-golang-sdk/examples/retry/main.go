@@ -0,0 +1,84 @@
+// Command retry re-attempts exactly the entries of a failures report
+// written by examples/sync or examples/manifest-download, and rewrites
+// the report with the entries that failed again (removing it once all
+// succeed). It exits with status 1 if any entry still fails.
+//
+//	go run ./examples/retry -from-report failed.jsonl
+//	go run ./examples/retry -from-report failed.jsonl -failures still-failed.jsonl -concurrency 4
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/failures"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts failures.RetryOptions
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	from := flag.String("from-report", "", "failures report to retry (required)")
+	out := flag.String("failures", "", "write entries that fail again to this report (default: rewrite -from-report)")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "entries retried in parallel")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *from == "" {
+		log.Fatal("-from-report is required")
+	}
+	if *out == "" {
+		*out = *from
+	}
+	entries, err := failures.ReadFile(*from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results := failures.Retry(ctx, client, entries, opts, func(r failures.Result) {
+		if r.Err != nil {
+			log.Printf("FAILED %s %s: %v", r.Op, describe(r.Entry), r.Err)
+		} else {
+			log.Printf("%s %s", r.Op, describe(r.Entry))
+		}
+	})
+
+	var report failures.Report
+	for _, r := range results {
+		if r.Err != nil {
+			report.Add(r.Entry, r.Err)
+		}
+	}
+	if err := report.WriteFile(*out); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("retried %d entries; %d succeeded, %d failed", len(results), len(results)-report.Len(), report.Len())
+	if report.Len() > 0 {
+		log.Printf("remaining failures written to %s", *out)
+		os.Exit(1)
+	}
+}
+
+func describe(e failures.Entry) string {
+	switch e.Op {
+	case failures.OpDeleteLocal:
+		return e.Path
+	case failures.OpCopy:
+		return e.SourceBucket + "/" + e.SourceKey + " -> " + e.Bucket + "/" + e.Key
+	}
+	return e.Bucket + "/" + e.Key
+}
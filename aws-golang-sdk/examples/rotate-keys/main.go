@@ -0,0 +1,88 @@
+// Command rotate-keys re-wraps the data keys of client-side encrypted
+// objects under a prefix with the keyring's current master key. Only
+// metadata is rewritten. Objects already under the current key are
+// skipped, so an interrupted rotation resumes by running it again.
+//
+// To rotate, add the new key to the keyring and make it "current", run
+// this until it reports no failures, then drop the old key.
+//
+//	go run ./examples/rotate-keys -keyring keyring.json -bucket vault -prefix db/ -dry-run
+//	go run ./examples/rotate-keys -keyring keyring.json -bucket vault -prefix db/ -skip-plain
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/cse"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts cse.RotateOptions
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to rotate (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "only rotate objects under this prefix")
+	flag.IntVar(&opts.Concurrency, "concurrency", 16, "number of objects rewritten in parallel")
+	flag.BoolVar(&opts.SkipPlain, "skip-plain", false, "ignore objects that are not client-side encrypted instead of failing them")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list the objects that would be rewrapped")
+	keyringPath := flag.String("keyring", "", "keyring holding the current key and the old ones (required)")
+	flag.Parse()
+
+	if opts.Bucket == "" || *keyringPath == "" {
+		log.Fatal("-bucket and -keyring are required")
+	}
+	var err error
+	if opts.Keyring, err = cse.LoadKeyring(*keyringPath); err != nil {
+		log.Fatal(err)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var mu sync.Mutex
+	var done, rewrapped, skipped, failed int
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	go func() {
+		for range ticker.C {
+			mu.Lock()
+			log.Printf("progress: %d objects, %d rewrapped, %d already current, %d failures", done, rewrapped, skipped, failed)
+			mu.Unlock()
+		}
+	}()
+
+	err = cse.Rotate(ctx, client, opts, func(r cse.RotateResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		switch {
+		case r.Err != nil:
+			failed++
+			log.Printf("FAILED %s: %v", r.Key, r.Err)
+		case r.Skipped:
+			skipped++
+		case opts.DryRun:
+			log.Printf("would rewrap %s", r.Key)
+		default:
+			rewrapped++
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("done: %d objects, %d rewrapped to %q, %d already current, %d failures", done, rewrapped, opts.Keyring.Current, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
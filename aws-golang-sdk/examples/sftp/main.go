@@ -0,0 +1,85 @@
+// Command sftp serves a bucket prefix over SFTP, so appliances and
+// partners that can only deliver files over SFTP can read and write
+// Objectslite directly. Uploaded files are streamed into (multipart)
+// uploads as they arrive.
+//
+//	ssh-keygen -t ed25519 -f host_key -N ''
+//	OBJECTSLITE_SFTP_PASSWORD=s3cret go run ./examples/sftp -bucket inbox -prefix partner-a/ -host-key host_key -user partner-a
+//	go run ./examples/sftp -bucket inbox -host-key host_key -user drop -authorized-keys ./authorized_keys -listen :2222
+//	sftp -P 2022 partner-a@gw
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/sftpbridge"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// envPassword holds the SFTP login password, kept off the command line.
+const envPassword = "OBJECTSLITE_SFTP_PASSWORD"
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts sftpbridge.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Upload.Concurrency, "max-concurrency", utils.DefaultConcurrency, "parts of each uploaded file sent in parallel")
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to serve (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "serve only this prefix, as the root")
+	flag.StringVar(&opts.Username, "user", "", "SFTP login name (required); its password is read from $"+envPassword)
+	listen := flag.String("listen", ":2022", "address to listen on")
+	hostKey := flag.String("host-key", "", "PEM private key identifying the server (required)")
+	authorizedKeys := flag.String("authorized-keys", "", "authorized_keys file of public keys accepted for -user")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.Bucket == "" || opts.Username == "" || *hostKey == "" {
+		log.Fatal("-bucket, -user and -host-key are required")
+	}
+	pem, err := os.ReadFile(*hostKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.HostKey, err = ssh.ParsePrivateKey(pem); err != nil {
+		log.Fatalf("%s: %v", *hostKey, err)
+	}
+	if *authorizedKeys != "" {
+		if opts.AuthorizedKeys, err = sftpbridge.LoadAuthorizedKeys(*authorizedKeys); err != nil {
+			log.Fatal(err)
+		}
+	}
+	opts.Password = os.Getenv(envPassword)
+	if opts.Password == "" && len(opts.AuthorizedKeys) == 0 {
+		log.Fatal("set $" + envPassword + " or -authorized-keys")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, err := sftpbridge.NewServer(client, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("serving s3://%s/%s over SFTP on %s", opts.Bucket, opts.Prefix, l.Addr())
+	if err := server.Serve(ctx, l); err != nil {
+		log.Fatal(err)
+	}
+}
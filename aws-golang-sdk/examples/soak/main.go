@@ -0,0 +1,76 @@
+// Command soak runs PUT/GET/verify/DELETE cycles at a fixed rate for
+// hours, reporting error rates and the client's own memory use at every
+// interval, to check stability before rolling out production backups.
+// It exits 1 if the overall error rate ends above -max-error-rate.
+//
+//	go run ./examples/soak -bucket soak -size 4MiB -rate 20 -concurrency 64 -duration 8h -format jsonl > soak.jsonl
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/bench"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts bench.SoakOptions
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to soak (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "soak/", "prefix for the soak objects, each deleted after its cycle")
+	size := utils.ByteSize(1 << 20)
+	flag.Var(&size, "size", "payload size of each cycle")
+	flag.Float64Var(&opts.Rate, "rate", 10, "cycles started per second")
+	flag.IntVar(&opts.Concurrency, "concurrency", 32, "most cycles in flight; cycles due beyond this are skipped and counted")
+	flag.DurationVar(&opts.Duration, "duration", time.Hour, "how long to run (0 runs until interrupted)")
+	flag.DurationVar(&opts.ReportInterval, "report-interval", time.Minute, "how often to report stats")
+	maxErrorRate := flag.Float64("max-error-rate", 0.001, "exit 1 if the overall error rate ends above this")
+	format := flag.String("format", "text", "report format: text or jsonl")
+	flag.Parse()
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	if opts.Rate <= 0 || opts.ReportInterval <= 0 {
+		log.Fatal("-rate and -report-interval must be positive")
+	}
+	if *format != "text" && *format != "jsonl" {
+		log.Fatalf("unknown -format %q", *format)
+	}
+	opts.Size = int(size)
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	show := func(s bench.SoakStats) {
+		if *format == "jsonl" {
+			enc.Encode(s)
+			return
+		}
+		log.Printf("soak %s: %d cycles (%d this interval, mean %s), %d errors (%.4f%%), %d skipped, heap %s, sys %s, %d goroutines",
+			s.Elapsed.Round(time.Second), s.Cycles, s.IntervalCycles, s.MeanCycle.Round(time.Millisecond),
+			s.Errors, 100*s.ErrorRate, s.Skipped, utils.FormatBytes(int64(s.HeapAlloc)), utils.FormatBytes(int64(s.Sys)), s.Goroutines)
+		if s.IntervalErrors > 0 {
+			log.Printf("last error: %s", s.LastError)
+		}
+	}
+	final := bench.Soak(ctx, client, opts, show)
+	show(final)
+	if final.ErrorRate > *maxErrorRate {
+		log.Printf("error rate %.4f%% is above %.4f%%", 100*final.ErrorRate, 100**maxErrorRate)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,52 @@
+// Command staged-upload uploads a file to a temporary key, verifies it,
+// and only then publishes it to the final key, so readers of the bucket
+// never see an unverified object.
+//
+//	go run ./examples/staged-upload -bucket b -key releases/app.tar -file app.tar
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/staging"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts staging.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Upload.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts uploaded in parallel")
+	flag.StringVar(&opts.Prefix, "staging-prefix", staging.DefaultPrefix, "prefix for the temporary staged object")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "final key (required)")
+	file := flag.String("file", "", "file to upload (required)")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	defer client.ReportStats(os.Stderr)
+	start := time.Now()
+	if err := staging.Upload(ctx, client, *bucket, *key, *file, opts); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("published s3://%s/%s in %s", *bucket, *key, time.Since(start).Round(time.Millisecond))
+}
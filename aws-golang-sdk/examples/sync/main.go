@@ -0,0 +1,243 @@
+// Command sync mirrors a local directory to a bucket prefix (-direction
+// up), a prefix to a directory (-direction down) or one prefix to another
+// (-direction remote), copying only files that are missing or differ.
+// With -delete it asks for confirmation, showing how many files would be
+// removed, unless -force is given. The first failed transfer stops the
+// sync unless -continue-on-error is given. -bandwidth caps the combined
+// rate of downloads. It exits with status 1 if any transfer failed or was
+// skipped; with -failures, those are written to a report that
+// examples/retry re-attempts.
+//
+// -estimate plans the sync and prints the requests, bytes and, at rates
+// measured by writing, reading and deleting a few probe objects under the
+// destination prefix, the approximate duration, then stops without
+// transferring anything. -probe-size 0 skips the measurement.
+//
+//	go run ./examples/sync -direction up   -dir ./site -bucket www -prefix site/
+//	go run ./examples/sync -direction up   -dir ./site -bucket www -prefix site/ -delete -dry-run
+//	go run ./examples/sync -direction up   -dir ./site -bucket www -prefix site/ -delete -force
+//	go run ./examples/sync -direction up   -dir ./site -bucket www -prefix site/ -continue-on-error -failures failed.jsonl
+//	go run ./examples/sync -direction down -dir ./restore -bucket backups -prefix nightly/ -list-workers 32 -download-workers 16
+//	go run ./examples/sync -direction down -dir ./restore -bucket backups -prefix nightly/ -bandwidth 100MiB
+//	go run ./examples/sync -direction remote -bucket backups -prefix nightly/ -dest-bucket dr -dest-prefix nightly/
+//	go run ./examples/sync -direction remote -bucket backups -dest-bucket backups -dest-endpoint https://dr-pc:9440
+//	go run ./examples/sync -direction up   -dir ./archive -bucket cold -prefix 2024/ -estimate
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/dirsync"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/estimate"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/failures"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts dirsync.Options
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Upload.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts of one file uploaded in parallel")
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "prefix mirrored with -dir")
+	flag.StringVar(&opts.Dir, "dir", "", "local directory (required)")
+	direction := flag.String("direction", "", "up (local to bucket), down (bucket to local) or remote (bucket to bucket) (required)")
+	destBucket := flag.String("dest-bucket", "", "destination bucket (remote)")
+	destPrefix := flag.String("dest-prefix", "", "destination prefix (remote)")
+	destEndpoint := flag.String("dest-endpoint", "", "destination endpoint if not the source's; objects are then streamed through this host instead of copied server-side (remote)")
+	destAccessKey := flag.String("dest-access-key", "", "destination access key, if it differs from the source's (remote)")
+	destSecretKey := flag.String("dest-secret-key", "", "destination secret key (remote)")
+	copyWorkers := flag.Int("copy-workers", dirsync.DefaultCopyWorkers, "objects copied in parallel (remote)")
+	flag.IntVar(&opts.ListWorkers, "list-workers", dirsync.DefaultListWorkers, "remote directories listed in parallel")
+	flag.IntVar(&opts.UploadWorkers, "upload-workers", dirsync.DefaultUploadWorkers, "files uploaded in parallel")
+	flag.IntVar(&opts.DownloadWorkers, "download-workers", dirsync.DefaultDownloadWorkers, "files downloaded in parallel")
+	sizeOnly := flag.Bool("size-only", false, "only compare sizes (fastest)")
+	exactTimestamps := flag.Bool("exact-timestamps", false, "when syncing down, also transfer same-size files whose times differ at all")
+	ignoreMtime := flag.Bool("ignore-mtime", false, "compare same-size files by content hash instead of time (slowest, most accurate)")
+	xxHash := flag.Bool("xxhash", false, "compare same-size files by an xxHash64 recorded on upload, falling back to -ignore-mtime for objects without one")
+	flag.BoolVar(&opts.Delete, "delete", false, "delete destination files that are not on the source")
+	flag.Float64Var(&opts.MaxDeletePercent, "max-delete", dirsync.DefaultMaxDeletePercent, "abort without changes if -delete would remove more than this percentage of the destination")
+	force := flag.Bool("force", false, "delete without asking for confirmation")
+	flag.StringVar(&opts.StatePath, "state", "", "cache the sync outcome in this file so unchanged files are skipped next time")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "print what would be transferred or deleted without doing it")
+	flag.BoolVar(&opts.ContinueOnError, "continue-on-error", false, "keep going after a failed transfer or deletion instead of stopping")
+	failuresPath := flag.String("failures", "", "write failed transfers and deletions to this JSONL report for examples/retry")
+	estimateOnly := flag.Bool("estimate", false, "print the requests, bytes and approximate duration of the sync, then stop without changes")
+	probeSize := utils.ByteSize(estimate.DefaultProbeSize)
+	flag.Var(&probeSize, "probe-size", "size of the probe objects -estimate measures throughput with (0 = report requests and bytes only)")
+	var bandwidth utils.ByteSize
+	flag.Var(&bandwidth, "bandwidth", "most bytes per second across all downloads, shared evenly between files, e.g. 100MiB (0 = unlimited)")
+	flag.Parse()
+	if bandwidth > 0 {
+		opts.Bandwidth = utils.NewBandwidth(int64(bandwidth))
+	}
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	remote := *direction == "remote"
+	switch {
+	case opts.Bucket == "" || *direction == "":
+		log.Fatal("-bucket and -direction are required")
+	case remote && *destBucket == "":
+		log.Fatal("-dest-bucket is required with -direction remote")
+	case !remote && opts.Dir == "":
+		log.Fatal("-dir is required")
+	case *failuresPath != "" && *destEndpoint != "":
+		log.Fatal("-failures cannot be used with -dest-endpoint")
+	}
+	opts.Direction = dirsync.Direction(*direction)
+	for _, m := range []struct {
+		set  bool
+		mode dirsync.Compare
+	}{{*sizeOnly, dirsync.CompareSizeOnly}, {*exactTimestamps, dirsync.CompareExactTimestamps}, {*ignoreMtime, dirsync.CompareIgnoreMtime}, {*xxHash, dirsync.CompareXXHash}} {
+		if !m.set {
+			continue
+		}
+		if opts.Compare != dirsync.CompareNewer {
+			log.Fatal("-size-only, -exact-timestamps, -ignore-mtime and -xxhash are mutually exclusive")
+		}
+		opts.Compare = m.mode
+	}
+	if opts.Delete && !*force {
+		where := "objects under s3://" + opts.Bucket + "/" + opts.Prefix
+		switch {
+		case remote:
+			where = "objects under s3://" + *destBucket + "/" + *destPrefix
+		case opts.Direction == dirsync.Down:
+			where = "local files under " + opts.Dir
+		}
+		opts.ConfirmDelete = func(n int, bytes int64) error {
+			return utils.Confirm(fmt.Sprintf("Delete %d %s (%s) that are not on the source?", n, where, utils.FormatBytes(bytes)))
+		}
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *estimateOnly {
+		opts.ConfirmDelete = nil
+		opts.Estimate = func(e *estimate.Estimate) error {
+			var rates *estimate.Rates
+			if probeSize > 0 {
+				bucket, prefix, workers := opts.Bucket, opts.Prefix, opts.UploadWorkers
+				switch {
+				case remote:
+					bucket, prefix, workers = *destBucket, *destPrefix, *copyWorkers
+				case opts.Direction == dirsync.Down:
+					workers = opts.DownloadWorkers
+				}
+				log.Printf("measuring throughput with %d probe objects of %s under s3://%s/%s", workers, utils.FormatBytes(int64(probeSize)), bucket, prefix)
+				r, err := estimate.Measure(ctx, client, bucket, prefix, int64(probeSize), workers, opts.Upload)
+				if err != nil {
+					return err
+				}
+				rates = &r
+			}
+			if err := e.Print(os.Stdout, rates); err != nil {
+				return err
+			}
+			return errEstimated
+		}
+	}
+
+	start := time.Now()
+	var failed failures.Report
+	report := func(r dirsync.Result) {
+		switch {
+		case r.Err != nil:
+			if !errors.Is(r.Err, utils.ErrSkipped) {
+				log.Printf("%s %s FAILED: %v", r.Op, r.Key, r.Err)
+			}
+			if remote {
+				source := dirsync.Location{Bucket: opts.Bucket, Prefix: opts.Prefix}
+				dest := dirsync.Location{Bucket: *destBucket, Prefix: *destPrefix}
+				failed.Add(failures.FromRemoteSync(source, dest, r.Action), r.Err)
+			} else {
+				failed.Add(failures.FromSync(opts, r.Action), r.Err)
+			}
+		case opts.DryRun:
+			fmt.Printf("would %s %s (%s, %s)\n", r.Op, r.Key, utils.FormatBytes(r.Size), r.Reason)
+		default:
+			log.Printf("%s %s (%s, %s)", r.Op, r.Key, utils.FormatBytes(r.Size), r.Reason)
+		}
+	}
+	var sum dirsync.Summary
+	if remote {
+		sum, err = syncRemote(ctx, client, opts, *destBucket, *destPrefix, *destEndpoint, *destAccessKey, *destSecretKey, *copyWorkers, report)
+	} else {
+		sum, err = dirsync.Run(ctx, client, opts, report)
+	}
+	if errors.Is(err, errEstimated) {
+		return
+	}
+	if *failuresPath != "" && !opts.DryRun {
+		if werr := failed.WriteFile(*failuresPath); werr != nil {
+			log.Printf("write failures report: %v", werr)
+		} else if failed.Len() > 0 {
+			log.Printf("%d failures written to %s", failed.Len(), *failuresPath)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d local and %d remote files; %d transferred (%s), %d unchanged, %d deleted, %d failed, %d skipped in %s",
+		sum.Local, sum.Remote, sum.Transferred, utils.FormatBytes(sum.Bytes), sum.Unchanged, sum.Deleted, sum.Failed, sum.Skipped,
+		time.Since(start).Round(time.Millisecond))
+	if sum.Skipped > 0 {
+		log.Printf("stopped after the first failure; use -continue-on-error to attempt every file")
+	}
+	if sum.Failed+sum.Skipped > 0 {
+		os.Exit(1)
+	}
+}
+
+// errEstimated stops a sync once -estimate has printed its estimate.
+var errEstimated = errors.New("estimated")
+
+// syncRemote copies the -bucket/-prefix to the destination, server-side
+// unless the destination is on another endpoint.
+func syncRemote(ctx context.Context, client *utils.Client, opts dirsync.Options,
+	bucket, prefix, endpoint, accessKey, secretKey string, workers int, report func(dirsync.Result)) (dirsync.Summary, error) {
+	dest := client
+	if endpoint != "" || accessKey != "" {
+		destCfg := client.Config
+		if endpoint != "" {
+			destCfg.Endpoint = endpoint
+		}
+		if accessKey != "" {
+			destCfg.AccessKey, destCfg.SecretKey = accessKey, secretKey
+		}
+		var err error
+		if dest, err = utils.NewClient(destCfg); err != nil {
+			return dirsync.Summary{}, err
+		}
+	}
+	return dirsync.RunRemote(ctx, dirsync.RemoteOptions{
+		Source:           dirsync.Location{Svc: client, Bucket: opts.Bucket, Prefix: opts.Prefix},
+		Dest:             dirsync.Location{Svc: dest, Bucket: bucket, Prefix: prefix},
+		ServerSide:       endpoint == "" || endpoint == client.Config.Endpoint,
+		Compare:          opts.Compare,
+		ListWorkers:      opts.ListWorkers,
+		CopyWorkers:      workers,
+		Upload:           opts.Upload,
+		Delete:           opts.Delete,
+		MaxDeletePercent: opts.MaxDeletePercent,
+		ConfirmDelete:    opts.ConfirmDelete,
+		DryRun:           opts.DryRun,
+		Estimate:         opts.Estimate,
+		ContinueOnError:  opts.ContinueOnError,
+	}, report)
+}
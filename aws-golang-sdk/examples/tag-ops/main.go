@@ -0,0 +1,95 @@
+// Command tag-ops lists objects under a prefix, filters them by tags and
+// applies a bulk action to the matches.
+//
+//	go run ./examples/tag-ops -bucket data -where env=dev -where '!keep' -action delete -dry-run
+//	go run ./examples/tag-ops -bucket data -where tier=cold -action copy -dest-bucket archive
+//	go run ./examples/tag-ops -bucket data -where owner=alice -action retag -set owner=bob -remove reviewed
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/tagops"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts tagops.Options
+	var where, set, remove utils.StringList
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to operate on (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "only consider objects under this prefix")
+	flag.Var(&where, "where", "tag condition: key=value, key!=value, key or !key (repeatable, all must match)")
+	action := flag.String("action", string(tagops.ActionList), "action for matches: list, delete, copy or retag")
+	flag.StringVar(&opts.DestBucket, "dest-bucket", "", "copy destination bucket (default -bucket)")
+	flag.StringVar(&opts.DestPrefix, "dest-prefix", "", "copy destination prefix, replacing -prefix")
+	flag.Var(&set, "set", "retag: set key=value (repeatable)")
+	flag.Var(&remove, "remove", "retag: remove key (repeatable)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "report matches without applying the action")
+	flag.IntVar(&opts.Concurrency, "concurrency", 16, "number of objects processed in parallel")
+	flag.Parse()
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	opts.Action = tagops.Action(*action)
+	switch opts.Action {
+	case tagops.ActionList, tagops.ActionDelete, tagops.ActionCopy, tagops.ActionRetag:
+	default:
+		log.Fatalf("unknown -action %q", *action)
+	}
+	for _, w := range where {
+		c, err := tagops.ParseCondition(w)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Conditions = append(opts.Conditions, c)
+	}
+	opts.SetTags = make(map[string]string)
+	for _, kv := range set {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			log.Fatalf("invalid -set %q, want key=value", kv)
+		}
+		opts.SetTags[k] = v
+	}
+	opts.RemoveTags = remove
+
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var matched, failed int
+	err = tagops.Run(ctx, client, opts, func(r tagops.Result) {
+		switch {
+		case r.Err != nil:
+			failed++
+			log.Printf("FAILED %s: %v", r.Key, r.Err)
+		case r.Matched:
+			matched++
+			fmt.Printf("%s %s %v\n", opts.Action, r.Key, r.Tags)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	suffix := ""
+	if opts.DryRun {
+		suffix = " (dry run)"
+	}
+	log.Printf("%d objects matched, %d failures%s", matched, failed, suffix)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,90 @@
+// Command update-metadata rewrites content-type, cache-control and user
+// metadata of every object under a prefix using copy-in-place, printing
+// progress as it goes.
+//
+//	go run ./examples/update-metadata -bucket site -prefix assets/ -cache-control "max-age=86400" -set team=web
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/metaupdate"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts metaupdate.Options
+	var set, remove utils.StringList
+	flag.StringVar(&opts.Bucket, "bucket", "", "bucket to update (required)")
+	flag.StringVar(&opts.Prefix, "prefix", "", "only update objects under this prefix")
+	flag.StringVar(&opts.Update.ContentType, "content-type", "", "new Content-Type")
+	flag.StringVar(&opts.Update.CacheControl, "cache-control", "", "new Cache-Control")
+	flag.StringVar(&opts.Update.ContentDisposition, "content-disposition", "", "new Content-Disposition")
+	flag.StringVar(&opts.Update.ContentEncoding, "content-encoding", "", "new Content-Encoding")
+	flag.Var(&set, "set", "set user metadata key=value (repeatable)")
+	flag.Var(&remove, "remove", "remove user metadata key (repeatable)")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "list the objects that would be updated")
+	flag.IntVar(&opts.Concurrency, "concurrency", 16, "number of objects updated in parallel")
+	flag.Parse()
+
+	if opts.Bucket == "" {
+		log.Fatal("-bucket is required")
+	}
+	opts.Update.SetMetadata = make(map[string]string)
+	for _, kv := range set {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			log.Fatalf("invalid -set %q, want key=value", kv)
+		}
+		opts.Update.SetMetadata[k] = v
+	}
+	opts.Update.RemoveMetadata = remove
+
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var mu sync.Mutex
+	var done, failed int
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	go func() {
+		for range ticker.C {
+			mu.Lock()
+			log.Printf("progress: %d objects processed, %d failures", done, failed)
+			mu.Unlock()
+		}
+	}()
+
+	err = metaupdate.Run(ctx, client, opts, func(r metaupdate.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if r.Err != nil {
+			failed++
+			log.Printf("FAILED %s: %v", r.Key, r.Err)
+		} else if opts.DryRun {
+			log.Printf("would update %s", r.Key)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("done: %d objects processed, %d failures", done, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
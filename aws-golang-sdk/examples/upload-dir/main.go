@@ -0,0 +1,82 @@
+// Command upload-dir uploads every file under a directory to a bucket
+// prefix, several files at a time, keeping the relative paths as keys.
+// -include and -exclude select files by glob; a pattern without a slash
+// matches file (or, for -exclude, directory) names at any depth, and "**"
+// matches any number of directories. Unlike examples/sync it uploads
+// every selected file, without comparing against the bucket. It exits
+// with status 1 if any upload failed.
+//
+//	go run ./examples/upload-dir -bucket b -dir ./site -prefix site/
+//	go run ./examples/upload-dir -bucket b -dir ./logs -prefix logs/ -include '*.gz' -exclude 'tmp' -workers 16
+//	go run ./examples/upload-dir -bucket b -dir ./repo -prefix src/ -exclude .git -exclude 'build/**' -continue-on-error
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.DirectoryOptions
+	opts.Upload.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Upload.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts of one file uploaded in parallel")
+	flag.IntVar(&opts.Workers, "workers", utils.DefaultDirectoryWorkers, "files uploaded in parallel")
+	flag.Var((*utils.StringList)(&opts.Include), "include", "upload only files matching this glob (repeatable)")
+	flag.Var((*utils.StringList)(&opts.Exclude), "exclude", "skip files and directories matching this glob (repeatable)")
+	flag.BoolVar(&opts.ContinueOnError, "continue-on-error", false, "keep uploading after a file fails")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	prefix := flag.String("prefix", "", "key prefix, e.g. site/")
+	dir := flag.String("dir", "", "directory to upload (required)")
+	flag.Parse()
+	if err := opts.Upload.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *dir == "" {
+		log.Fatal("-bucket and -dir are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var mu sync.Mutex
+	var files, failed int
+	var bytes int64
+	start := time.Now()
+	err = utils.UploadDirectory(ctx, client, *bucket, *prefix, *dir, opts, func(r utils.DirectoryResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Err != nil {
+			failed++
+			log.Printf("FAILED %s: %v", r.Path, r.Err)
+			return
+		}
+		files++
+		if r.Upload.Skipped {
+			log.Printf("skipped (identical) %s", r.Path)
+			return
+		}
+		bytes += r.Size
+		log.Printf("uploaded %s to s3://%s/%s (%s)", r.Path, *bucket, r.Key, utils.FormatBytes(r.Size))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d files (%s) uploaded in %s, %d failed", files, utils.FormatBytes(bytes),
+		time.Since(start).Round(time.Millisecond), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,146 @@
+// Command upload-plan splits a multipart upload into steps driven by a
+// plan file, so several processes or hosts with a copy of the same file
+// can upload disjoint part ranges of one UploadId.
+//
+//	go run ./examples/upload-plan -action plan     -plan big.plan -file big.iso -bucket b -key big.iso -part-size 64MiB
+//	go run ./examples/upload-plan -action create   -plan big.plan
+//	go run ./examples/upload-plan -action upload   -plan big.plan -file big.iso -parts 1-80     # host A
+//	go run ./examples/upload-plan -action upload   -plan big.plan -file big.iso -parts 81-160   # host B
+//	go run ./examples/upload-plan -action status   -plan big.plan
+//	go run ./examples/upload-plan -action complete -plan big.plan
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/plan"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts uploaded (or hashed) in parallel")
+	action := flag.String("action", "", "plan, create, upload, status, complete or abort (required)")
+	planPath := flag.String("plan", "", "plan file (required)")
+	file := flag.String("file", "", "file to plan or upload")
+	bucket := flag.String("bucket", "", "destination bucket (plan)")
+	key := flag.String("key", "", "destination key (plan)")
+	ranges := flag.String("parts", "", "parts to upload, e.g. 1-100,150 (default every part not yet checkpointed)")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *planPath == "" {
+		log.Fatal("-plan is required")
+	}
+	// The plan names the UploadId; keep it encrypted on shared hosts.
+	planKey, err := checkpoint.KeyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *action == "plan" {
+		if *file == "" || *bucket == "" || *key == "" {
+			log.Fatal("-file, -bucket and -key are required to plan")
+		}
+		p, err := plan.New(ctx, *file, *bucket, *key, opts.PartSize, opts.Concurrency)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := p.Write(*planPath, planKey); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("planned %d parts of %s for s3://%s/%s", len(p.Parts), utils.FormatBytes(p.PartSize), *bucket, *key)
+		return
+	}
+
+	p, err := plan.Read(*planPath, planKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *action {
+	case "create":
+		if err := p.Create(ctx, client); err != nil {
+			log.Fatal(err)
+		}
+		if err := p.Write(*planPath, planKey); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("created upload %s; distribute %s to the uploading hosts", p.UploadID, *planPath)
+	case "upload":
+		if *file == "" {
+			log.Fatal("-file is required to upload")
+		}
+		numbers, err := plan.ParseRanges(*ranges)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(numbers) == 0 {
+			// Resume: skip parts this host already checkpointed.
+			for _, pp := range p.Pending() {
+				numbers = append(numbers, pp.Number)
+			}
+			if len(numbers) == 0 {
+				log.Printf("every part is already checkpointed as uploaded")
+				return
+			}
+		}
+		saver := checkpoint.NewSaver(&p.Checkpoint, *planPath, planKey)
+		err = p.Upload(ctx, client, *file, numbers, opts, func(pp plan.Part, err error) {
+			if err != nil {
+				log.Printf("part %d FAILED: %v", pp.Number, err)
+				return
+			}
+			if err := saver.Record(pp.Number, pp.ETag); err != nil {
+				log.Printf("part %d uploaded but not checkpointed: %v", pp.Number, err)
+				return
+			}
+			log.Printf("part %d uploaded (%s)", pp.Number, utils.FormatBytes(pp.Size))
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		uploaded, err := p.Uploaded(ctx, client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		missing := p.Missing(uploaded)
+		fmt.Printf("upload %s: %d of %d parts uploaded\n", p.UploadID, len(p.Parts)-len(missing), len(p.Parts))
+		if len(missing) > 0 {
+			fmt.Printf("missing: %v\n", missing)
+		}
+	case "complete":
+		out, err := p.Complete(ctx, client)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("completed s3://%s/%s (ETag %s)", p.Bucket, p.Key, aws.StringValue(out.ETag))
+	case "abort":
+		if err := p.Abort(ctx, client); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("aborted upload %s", p.UploadID)
+	default:
+		log.Fatalf("unknown -action %q", *action)
+	}
+}
@@ -0,0 +1,90 @@
+// Command upload-stream uploads standard input, or any stream whose length
+// is not known up front, without staging it in a temporary file. By
+// default a stream within -multipart-threshold is sent with one PUT and a
+// longer one in parts; -mode put or -mode multipart forces either.
+//
+//	tar -cz ./data | go run ./examples/upload-stream -bucket b -key data.tar.gz
+//	pg_dump db | go run ./examples/upload-stream -bucket b -key db.sql -mode multipart -part-size 64MiB
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	var progress utils.ProgressFlags
+	progress.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts uploaded in parallel")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "destination key (required)")
+	file := flag.String("file", "-", "file or named pipe to read; - for standard input")
+	mode := flag.String("mode", "auto", "auto, put (one PutObject of at most 5GiB, held in memory) or multipart")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *key == "" {
+		log.Fatal("-bucket and -key are required")
+	}
+	upload := utils.UploadStream
+	switch *mode {
+	case "auto":
+	case "put":
+		upload = utils.PutObjectFromReader
+	case "multipart":
+		upload = utils.MultipartUploadFromReader
+	default:
+		log.Fatalf("unknown -mode %q, want auto, put or multipart", *mode)
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var closeProgress io.Closer
+	if opts.Progress, closeProgress, err = progress.Open(); err != nil {
+		log.Fatal(err)
+	}
+
+	var in io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	defer client.ReportStats(os.Stderr)
+	start := time.Now()
+	out, err := upload(ctx, client, *bucket, *key, in, opts)
+	if err := closeProgress.Close(); err != nil {
+		log.Printf("progress: %v", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	method := "a single PUT"
+	if out.Parts > 0 {
+		method = fmt.Sprintf("%d parts", out.Parts)
+	}
+	log.Printf("uploaded %s to s3://%s/%s as %s in %s (ETag %s)", utils.FormatBytes(out.Size), *bucket, *key,
+		method, time.Since(start).Round(time.Millisecond), out.ETag)
+}
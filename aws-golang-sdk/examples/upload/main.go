@@ -0,0 +1,76 @@
+// Command upload uploads a file, choosing a single PutObject for small
+// files and a concurrent multipart upload for large ones. -file may be a
+// block device, such as an LVM snapshot of a VM disk.
+//
+//	go run ./examples/upload -bucket b -key big.iso -file ./big.iso
+//	go run ./examples/upload -bucket b -key big.iso -file ./big.iso -multipart-threshold 64MiB -max-concurrency 1
+//	go run ./examples/upload -bucket b -key vm1.raw -file /dev/vg0/vm1-snap -part-size 64MiB
+//	go run ./examples/upload -bucket b -key big.iso -file ./big.iso -skip-identical
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func main() {
+	var cfg utils.Config
+	cfg.RegisterFlags(flag.CommandLine)
+	var opts utils.UploadOptions
+	opts.RegisterFlags(flag.CommandLine)
+	var progress utils.ProgressFlags
+	progress.RegisterFlags(flag.CommandLine)
+	flag.IntVar(&opts.Concurrency, "max-concurrency", utils.DefaultConcurrency, "number of parts uploaded in parallel (1 uploads parts sequentially)")
+	bucket := flag.String("bucket", "", "destination bucket (required)")
+	key := flag.String("key", "", "destination key (required)")
+	file := flag.String("file", "", "file to upload (required)")
+	flag.Parse()
+	if err := opts.ApplyPreset(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *bucket == "" || *key == "" || *file == "" {
+		log.Fatal("-bucket, -key and -file are required")
+	}
+	client, err := utils.NewClient(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var closeProgress io.Closer
+	if opts.Progress, closeProgress, err = progress.Open(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	defer client.ReportStats(os.Stderr)
+	start := time.Now()
+	out, err := utils.Upload(ctx, client, *bucket, *key, *file, opts)
+	// Close before checking err so part timings are written for failed
+	// uploads too.
+	if err := closeProgress.Close(); err != nil {
+		log.Printf("progress: %v", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if out.Skipped {
+		log.Printf("skipped (identical): s3://%s/%s already holds %s (ETag %s)", *bucket, *key, *file, out.ETag)
+		return
+	}
+	method := "a single PUT"
+	if out.Parts > 0 {
+		method = fmt.Sprintf("%d parts", out.Parts)
+	}
+	log.Printf("uploaded %s (%s) to s3://%s/%s as %s in %s (ETag %s)", *file, utils.FormatBytes(out.Size), *bucket, *key,
+		method, time.Since(start).Round(time.Millisecond), out.ETag)
+}
@@ -0,0 +1,194 @@
+// Package expire applies a client-side age-based lifecycle rule to a
+// prefix, for deployments where server-side lifecycle rules are
+// unavailable.
+package expire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Action is what happens to an expired object.
+type Action string
+
+const (
+	// ActionDelete deletes expired objects.
+	ActionDelete Action = "delete"
+	// ActionTransition copies expired objects to DestBucket/DestPrefix and
+	// then deletes the originals.
+	ActionTransition Action = "transition"
+)
+
+// Options configures an expiration run.
+type Options struct {
+	Bucket    string
+	Prefix    string
+	OlderThan time.Duration
+	Action    Action
+	// DestBucket defaults to Bucket. DestPrefix replaces Prefix in the
+	// transitioned key; when the buckets match it must not lie under
+	// Prefix, or the copies would be expired again.
+	DestBucket   string
+	DestPrefix   string
+	StorageClass string
+	DryRun       bool
+	Concurrency  int
+	// Confirm, when set, is called with the number and total size of the
+	// expired objects before any is touched; an error aborts the run
+	// without changes (see utils.Confirm). It is not called in dry-run
+	// mode.
+	Confirm func(count int, bytes int64) error
+	// ContinueOnError keeps expiring after a failure. Otherwise no
+	// further deletions or transitions start after the first one fails,
+	// and the objects left alone are reported with utils.ErrSkipped.
+	ContinueOnError bool
+}
+
+// Result is the outcome for one expired object.
+type Result struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// Dest is the transitioned key, empty for deletions.
+	Dest string
+	Err  error
+}
+
+func (o *Options) validate() error {
+	if o.DestBucket == "" {
+		o.DestBucket = o.Bucket
+	}
+	switch o.Action {
+	case ActionDelete:
+	case ActionTransition:
+		if o.DestBucket == o.Bucket && strings.HasPrefix(o.DestPrefix, o.Prefix) {
+			return errors.New("transition destination must not be under the source prefix")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", o.Action)
+	}
+	return nil
+}
+
+// Candidates lists the objects under opts.Prefix last modified before now
+// minus opts.OlderThan.
+func Candidates(ctx context.Context, svc s3iface.S3API, opts Options, now time.Time) ([]*s3.Object, error) {
+	cutoff := now.Add(-opts.OlderThan)
+	var objects []*s3.Object
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.Bucket),
+		Prefix: aws.String(opts.Prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			if aws.TimeValue(obj.LastModified).Before(cutoff) {
+				objects = append(objects, obj)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list s3://%s/%s: %w", opts.Bucket, opts.Prefix, err)
+	}
+	return objects, nil
+}
+
+// Run expires every candidate and passes each outcome to report. In
+// dry-run mode nothing is modified and every candidate is reported as if
+// it succeeded.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options, report func(Result)) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	objects, err := Candidates(ctx, svc, opts, time.Now())
+	if err != nil {
+		return err
+	}
+	if opts.Confirm != nil && !opts.DryRun && len(objects) > 0 {
+		var bytes int64
+		for _, obj := range objects {
+			bytes += aws.Int64Value(obj.Size)
+		}
+		if err := opts.Confirm(len(objects), bytes); err != nil {
+			return err
+		}
+	}
+	results := make([]Result, len(objects))
+	for i, obj := range objects {
+		results[i] = Result{
+			Key:          aws.StringValue(obj.Key),
+			Size:         aws.Int64Value(obj.Size),
+			LastModified: aws.TimeValue(obj.LastModified),
+		}
+		if opts.Action == ActionTransition {
+			results[i].Dest = opts.DestPrefix + strings.TrimPrefix(results[i].Key, opts.Prefix)
+		}
+	}
+
+	switch {
+	case opts.DryRun:
+	case opts.Action == ActionDelete:
+		err = deleteBatches(ctx, svc, opts.Bucket, results, opts.ContinueOnError)
+	default:
+		errs := utils.ForEachErr(ctx, len(results), opts.Concurrency, opts.ContinueOnError, func(i int) error {
+			return transition(ctx, svc, opts, results[i])
+		})
+		for i, err := range errs {
+			results[i].Err = err
+		}
+	}
+	for _, r := range results {
+		report(r)
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// deleteBatches deletes the objects of results with utils.DeleteObjects,
+// DefaultConcurrency batches at a time, recording each key's error in its
+// result. Unless continueOnError is set, no batch starts after one with a
+// failure. The error is that of the deletion as a whole, such as ctx
+// being cancelled; every result without an outcome of its own fails with
+// it.
+func deleteBatches(ctx context.Context, svc s3iface.S3API, bucket string, results []Result, continueOnError bool) error {
+	keys := make([]string, len(results))
+	for i, r := range results {
+		keys[i] = r.Key
+	}
+	deleted, err := utils.DeleteObjects(ctx, svc, bucket, keys, utils.DeleteOptions{StopOnError: !continueOnError})
+	for i := range results {
+		if i < len(deleted) {
+			results[i].Err = deleted[i].Err
+		} else {
+			results[i].Err = err
+		}
+	}
+	return err
+}
+
+// transition copies r to its destination with utils.ServerSideCopy, so
+// objects over 5GiB are copied part by part, and deletes the original.
+func transition(ctx context.Context, svc s3iface.S3API, opts Options, r Result) error {
+	copyOpts := utils.CopyOptions{StorageClass: opts.StorageClass}
+	if err := utils.ServerSideCopy(ctx, svc, opts.Bucket, r.Key, opts.DestBucket, r.Dest, copyOpts); err != nil {
+		return fmt.Errorf("copy to %s: %w", r.Dest, err)
+	}
+	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(r.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("delete after copy: %w", err)
+	}
+	return nil
+}
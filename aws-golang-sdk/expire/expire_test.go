@@ -0,0 +1,59 @@
+package expire
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestValidateTransitionDest(t *testing.T) {
+	tests := []struct {
+		name       string
+		destBucket string
+		destPrefix string
+		wantErr    bool
+	}{
+		{name: "same prefix", destPrefix: "logs/", wantErr: true},
+		{name: "nested under the prefix", destPrefix: "logs/archive/", wantErr: true},
+		{name: "sibling prefix", destPrefix: "archive/logs/"},
+		{name: "parent prefix", destPrefix: ""},
+		{name: "nested in another bucket", destBucket: "archive", destPrefix: "logs/archive/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{Bucket: "b", Prefix: "logs/", Action: ActionTransition, DestBucket: tt.destBucket, DestPrefix: tt.destPrefix}
+			if err := o.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunTransition(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	data := objectslitetest.Data(100)
+	srv.PutObject("b", "logs/a", data)
+	srv.PutObject("b", "logs/sub/b", data)
+
+	var results []Result
+	err := Run(context.Background(), srv.Client(t), Options{
+		Bucket:     "b",
+		Prefix:     "logs/",
+		OlderThan:  -time.Hour,
+		Action:     ActionTransition,
+		DestPrefix: "archive/",
+	}, func(r Result) { results = append(results, r) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Key, r.Err)
+		}
+	}
+	objectslitetest.AssertKeys(t, srv, "b", "archive/a", "archive/sub/b")
+	objectslitetest.AssertObject(t, srv, "b", "archive/sub/b", data)
+}
@@ -0,0 +1,184 @@
+// Package failures records the entries a batch operation could not
+// complete in a JSON-lines report, and retries exactly those entries
+// later. Each line is one Entry:
+//
+//	{"op":"upload","bucket":"b","key":"data/a.bin","path":"/srv/data/a.bin","error":"...","time":"2024-05-01T10:00:00Z"}
+package failures
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/downloads"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Op is the operation an entry failed in.
+type Op string
+
+const (
+	// OpUpload uploads Path to Bucket/Key.
+	OpUpload Op = "upload"
+	// OpDownload downloads Bucket/Key to Path.
+	OpDownload Op = "download"
+	// OpDelete deletes Bucket/Key.
+	OpDelete Op = "delete"
+	// OpDeleteLocal deletes the local file Path.
+	OpDeleteLocal Op = "delete-local"
+	// OpCopy copies SourceBucket/SourceKey to Bucket/Key server-side.
+	OpCopy Op = "copy"
+)
+
+// Entry is one failed operation.
+type Entry struct {
+	Op           Op        `json:"op"`
+	Bucket       string    `json:"bucket,omitempty"`
+	Key          string    `json:"key,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	SourceBucket string    `json:"source_bucket,omitempty"`
+	SourceKey    string    `json:"source_key,omitempty"`
+	Error        string    `json:"error"`
+	Time         time.Time `json:"time"`
+}
+
+// Report collects failures from concurrent workers.
+type Report struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Add records a failure of e with err.
+func (r *Report) Add(e Entry, err error) {
+	e.Error = err.Error()
+	e.Time = time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, e)
+}
+
+// Len returns the number of failures recorded.
+func (r *Report) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// WriteFile writes the failures to path. With no failures, any report
+// left at path by an earlier run is removed instead, so a stale report
+// is never retried.
+func (r *Report) WriteFile(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range r.entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// ReadFile parses a report written by WriteFile.
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// RetryOptions configures Retry.
+type RetryOptions struct {
+	Concurrency int
+	Upload      utils.UploadOptions
+}
+
+// Result is the outcome of retrying one entry.
+type Result struct {
+	Entry
+	Err error
+}
+
+// Retry re-attempts every entry once, with up to opts.Concurrency in
+// flight, and returns the results in entry order. report, if not nil, is
+// called as each entry finishes and may be called concurrently.
+func Retry(ctx context.Context, svc s3iface.S3API, entries []Entry, opts RetryOptions, report func(Result)) []Result {
+	results := make([]Result, len(entries))
+	utils.ForEach(ctx, len(entries), opts.Concurrency, func(i int) {
+		results[i] = Result{Entry: entries[i], Err: retry(ctx, svc, entries[i], opts)}
+		if report != nil {
+			report(results[i])
+		}
+	})
+	for i := range results {
+		if results[i].Op == "" {
+			results[i] = Result{Entry: entries[i], Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+func retry(ctx context.Context, svc s3iface.S3API, e Entry, opts RetryOptions) error {
+	switch e.Op {
+	case OpUpload:
+		_, err := utils.Upload(ctx, svc, e.Bucket, e.Key, e.Path, opts.Upload)
+		return err
+	case OpDownload:
+		_, err := downloads.DownloadFile(ctx, svc, e.Bucket, e.Key, e.Path)
+		return err
+	case OpDelete:
+		_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(e.Bucket),
+			Key:    aws.String(e.Key),
+		})
+		return err
+	case OpDeleteLocal:
+		if err := os.Remove(e.Path); !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	case OpCopy:
+		return utils.ServerSideCopy(ctx, svc, e.SourceBucket, e.SourceKey, e.Bucket, e.Key, utils.CopyOptions{})
+	}
+	return fmt.Errorf("unknown operation %q", e.Op)
+}
@@ -0,0 +1,103 @@
+package failures
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/dirsync"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.jsonl")
+	var r Report
+	r.Add(Entry{Op: OpUpload, Bucket: "b", Key: "k", Path: "/p"}, errors.New("timeout"))
+	r.Add(Entry{Op: OpCopy, Bucket: "b", Key: "k2", SourceBucket: "s", SourceKey: "k1"}, errors.New("denied"))
+	if err := r.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/p" || entries[0].Error != "timeout" ||
+		entries[1].SourceKey != "k1" || entries[1].Time.IsZero() {
+		t.Fatalf("read back %+v", entries)
+	}
+
+	// A run without failures removes the stale report.
+	if err := new(Report).WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stale report left behind: %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.PutObject("b", "get", []byte("downloaded"))
+	srv.PutObject("b", "gone", []byte("deleted"))
+	srv.PutObject("b", "src", []byte("copied"))
+	dir := t.TempDir()
+	upload := objectslitetest.TempFile(t, 100)
+	local := filepath.Join(dir, "local")
+	if err := os.WriteFile(local, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries := []Entry{
+		{Op: OpUpload, Bucket: "b", Key: "put", Path: upload},
+		{Op: OpDownload, Bucket: "b", Key: "get", Path: filepath.Join(dir, "get")},
+		{Op: OpDelete, Bucket: "b", Key: "gone"},
+		{Op: OpDeleteLocal, Path: local},
+		{Op: OpDeleteLocal, Path: filepath.Join(dir, "already-gone")},
+		{Op: OpCopy, Bucket: "b", Key: "dst", SourceBucket: "b", SourceKey: "src"},
+		{Op: OpUpload, Bucket: "b", Key: "missing", Path: filepath.Join(dir, "missing")},
+		{Op: "rename", Bucket: "b", Key: "k"},
+	}
+
+	results := Retry(context.Background(), srv.Client(t), entries, RetryOptions{Concurrency: 3}, nil)
+	for i, r := range results {
+		if wantErr := i >= 6; (r.Err != nil) != wantErr {
+			t.Errorf("retry of %s %s%s: %v", r.Op, r.Key, r.Path, r.Err)
+		}
+	}
+	objectslitetest.AssertObjectMatchesFile(t, srv, "b", "put", upload)
+	objectslitetest.AssertObject(t, srv, "b", "dst", []byte("copied"))
+	objectslitetest.AssertKeys(t, srv, "b", "dst", "get", "put", "src")
+	if got, _ := os.ReadFile(filepath.Join(dir, "get")); string(got) != "downloaded" {
+		t.Errorf("downloaded %q", got)
+	}
+	if _, err := os.Stat(local); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("local file not deleted: %v", err)
+	}
+}
+
+func TestFromSync(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction dirsync.Direction
+		action    dirsync.Action
+		want      Entry
+	}{
+		{name: "upload", direction: dirsync.Up, action: dirsync.Action{Op: dirsync.OpUpload, Key: "a", Path: "/d/a"},
+			want: Entry{Op: OpUpload, Bucket: "b", Key: "p/a", Path: "/d/a"}},
+		{name: "download", direction: dirsync.Down, action: dirsync.Action{Op: dirsync.OpDownload, Key: "a", Path: "/d/a"},
+			want: Entry{Op: OpDownload, Bucket: "b", Key: "p/a", Path: "/d/a"}},
+		{name: "remote delete", direction: dirsync.Up, action: dirsync.Action{Op: dirsync.OpDelete, Key: "a", Path: "/d/a"},
+			want: Entry{Op: OpDelete, Bucket: "b", Key: "p/a"}},
+		{name: "local delete", direction: dirsync.Down, action: dirsync.Action{Op: dirsync.OpDelete, Key: "a", Path: "/d/a"},
+			want: Entry{Op: OpDeleteLocal, Path: "/d/a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := dirsync.Options{Bucket: "b", Prefix: "p", Direction: tt.direction}
+			if got := FromSync(opts, tt.action); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
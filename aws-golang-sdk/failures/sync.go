@@ -0,0 +1,44 @@
+package failures
+
+import (
+	"strings"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/dirsync"
+)
+
+// FromSync returns the entry retrying a failed action of a directory
+// sync run with opts.
+func FromSync(opts dirsync.Options, a dirsync.Action) Entry {
+	e := Entry{Bucket: opts.Bucket, Key: withSlash(opts.Prefix) + a.Key, Path: a.Path}
+	switch {
+	case a.Op == dirsync.OpUpload:
+		e.Op = OpUpload
+	case a.Op == dirsync.OpDownload:
+		e.Op = OpDownload
+	case opts.Direction == dirsync.Up:
+		e.Op, e.Path = OpDelete, ""
+	default:
+		e.Op, e.Bucket, e.Key = OpDeleteLocal, "", ""
+	}
+	return e
+}
+
+// FromRemoteSync returns the entry retrying a failed action of a
+// bucket-to-bucket sync from source to dest. Copies between endpoints
+// cannot be retried with a single client, so only syncs on one endpoint
+// should be recorded.
+func FromRemoteSync(source, dest dirsync.Location, a dirsync.Action) Entry {
+	e := Entry{Op: OpDelete, Bucket: dest.Bucket, Key: withSlash(dest.Prefix) + a.Key}
+	if a.Op == dirsync.OpCopy {
+		e.Op = OpCopy
+		e.SourceBucket, e.SourceKey = source.Bucket, withSlash(source.Prefix)+a.Key
+	}
+	return e
+}
+
+func withSlash(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
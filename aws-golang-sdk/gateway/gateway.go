@@ -0,0 +1,264 @@
+// Package gateway serves a bucket prefix over plain HTTP, translating
+// GET and HEAD requests into GetObject, HeadObject and ListObjectsV2, so
+// legacy tools that only speak HTTP (curl, wget, package managers) can
+// read Objectslite data. The gateway is read-only.
+package gateway
+
+import (
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Options configures a Handler.
+type Options struct {
+	Bucket string
+	// Prefix is the part of the bucket served; request paths are
+	// relative to it.
+	Prefix string
+	// Username and Password, when Username is set, require HTTP basic
+	// auth. Serve over TLS when using them.
+	Username string
+	Password string
+	// Listings enables HTML directory listings for paths ending in "/".
+	Listings bool
+}
+
+// Handler is an http.Handler serving objects under Options.Prefix.
+type Handler struct {
+	svc  s3iface.S3API
+	opts Options
+}
+
+// NewHandler returns a Handler reading from svc.
+func NewHandler(svc s3iface.S3API, opts Options) *Handler {
+	if opts.Prefix != "" && !strings.HasSuffix(opts.Prefix, "/") {
+		opts.Prefix += "/"
+	}
+	return &Handler{svc: svc, opts: opts}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Username != "" && !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="objectslite"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "read-only gateway", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	// The SDK resolves dot segments in the key's URI, so "../" would
+	// reach objects beside the prefix.
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "." || seg == ".." {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if name == "" || strings.HasSuffix(name, "/") {
+		h.list(w, r, name)
+		return
+	}
+	h.object(w, r, h.opts.Prefix+name)
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(h.opts.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(h.opts.Password)) == 1
+	return ok && userOK && passOK
+}
+
+// object serves one object, passing range and conditional headers
+// through so resumable and cached downloads work.
+func (h *Handler) object(w http.ResponseWriter, r *http.Request, key string) {
+	var ims *time.Time
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		ims = &t
+	}
+	hdr := objectHeaders{}
+	var body io.ReadCloser
+	var err error
+	if r.Method == http.MethodHead {
+		var out *s3.HeadObjectOutput
+		out, err = h.svc.HeadObjectWithContext(r.Context(), &s3.HeadObjectInput{
+			Bucket:      aws.String(h.opts.Bucket),
+			Key:         aws.String(key),
+			IfNoneMatch: optional(r.Header.Get("If-None-Match")),
+		})
+		if err == nil {
+			hdr = objectHeaders{out.ContentType, out.ContentLength, out.ETag, out.LastModified, nil, out.AcceptRanges}
+		}
+	} else {
+		var out *s3.GetObjectOutput
+		out, err = h.svc.GetObjectWithContext(r.Context(), &s3.GetObjectInput{
+			Bucket:          aws.String(h.opts.Bucket),
+			Key:             aws.String(key),
+			Range:           optional(r.Header.Get("Range")),
+			IfNoneMatch:     optional(r.Header.Get("If-None-Match")),
+			IfModifiedSince: ims,
+		})
+		if err == nil {
+			hdr = objectHeaders{out.ContentType, out.ContentLength, out.ETag, out.LastModified, out.ContentRange, out.AcceptRanges}
+			body = out.Body
+		}
+	}
+	if err != nil {
+		h.fail(w, r, key, err)
+		return
+	}
+	status := hdr.write(w.Header())
+	w.WriteHeader(status)
+	if body != nil {
+		defer body.Close()
+		io.Copy(w, body)
+	}
+}
+
+type objectHeaders struct {
+	contentType   *string
+	contentLength *int64
+	etag          *string
+	lastModified  *time.Time
+	contentRange  *string
+	acceptRanges  *string
+}
+
+// write sets the response headers and returns the status to send.
+func (o objectHeaders) write(h http.Header) int {
+	set := func(name string, v *string) {
+		if v != nil {
+			h.Set(name, *v)
+		}
+	}
+	set("Content-Type", o.contentType)
+	set("ETag", o.etag)
+	set("Content-Range", o.contentRange)
+	set("Accept-Ranges", o.acceptRanges)
+	if o.contentLength != nil {
+		h.Set("Content-Length", strconv.FormatInt(*o.contentLength, 10))
+	}
+	if o.lastModified != nil {
+		h.Set("Last-Modified", o.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if o.contentRange != nil {
+		return http.StatusPartialContent
+	}
+	return http.StatusOK
+}
+
+// fail maps an S3 error to an HTTP status. A missing key that is a
+// "directory" is redirected to its listing.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, key string, err error) {
+	var reqErr awserr.RequestFailure
+	status := http.StatusBadGateway
+	switch {
+	case utils.IsNotFound(err):
+		if h.opts.Listings && h.isDir(r, key) {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		status = http.StatusNotFound
+	case errors.As(err, &reqErr) && reqErr.StatusCode() < 500:
+		status = reqErr.StatusCode()
+	}
+	if status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (h *Handler) isDir(r *http.Request, key string) bool {
+	out, err := h.svc.ListObjectsV2WithContext(r.Context(), &s3.ListObjectsV2Input{
+		Bucket:  aws.String(h.opts.Bucket),
+		Prefix:  aws.String(key + "/"),
+		MaxKeys: aws.Int64(1),
+	})
+	return err == nil && len(out.Contents) > 0
+}
+
+type entry struct {
+	Name     string
+	Size     string
+	Modified string
+}
+
+var listing = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Index of /{{.Dir}}</title></head>
+<body><h1>Index of /{{.Dir}}</h1><table>
+{{if .Dir}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Name}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.Modified}}</td></tr>
+{{end}}</table></body></html>
+`))
+
+// list renders the "directory" dir (relative to the prefix, ending in
+// "/" unless it is the root).
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, dir string) {
+	if !h.opts.Listings {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	prefix := h.opts.Prefix + dir
+	var entries []entry
+	err := h.svc.ListObjectsV2PagesWithContext(r.Context(), &s3.ListObjectsV2Input{
+		Bucket:    aws.String(h.opts.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, cp := range page.CommonPrefixes {
+			entries = append(entries, entry{Name: strings.TrimPrefix(aws.StringValue(cp.Prefix), prefix)})
+		}
+		for _, o := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(o.Key), prefix)
+			if name == "" {
+				continue
+			}
+			entries = append(entries, entry{
+				Name:     name,
+				Size:     utils.FormatBytes(aws.Int64Value(o.Size)),
+				Modified: aws.TimeValue(o.LastModified).UTC().Format(time.RFC3339),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		h.fail(w, r, prefix, err)
+		return
+	}
+	if len(entries) == 0 && dir != "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	listing.Execute(w, struct {
+		Dir     string
+		Entries []entry
+	}{dir, entries})
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
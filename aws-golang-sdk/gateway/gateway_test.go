@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestHandler(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.PutObject("b", "site/index.html", []byte("hello, world"))
+	srv.PutObject("b", "site/docs/a.txt", []byte("a"))
+	srv.PutObject("b", "private", []byte("secret"))
+	obj, _ := srv.Object("b", "site/index.html")
+
+	tests := []struct {
+		name       string
+		opts       Options
+		method     string
+		path       string
+		header     map[string]string
+		auth       bool
+		wantStatus int
+		wantBody   string // the whole body, or with wantListed a part of it
+		wantListed bool
+	}{
+		{name: "object", path: "/index.html", wantStatus: http.StatusOK, wantBody: "hello, world"},
+		{name: "head", method: http.MethodHead, path: "/index.html", wantStatus: http.StatusOK},
+		{name: "range", path: "/index.html", header: map[string]string{"Range": "bytes=7-11"},
+			wantStatus: http.StatusPartialContent, wantBody: "world"},
+		{name: "not modified", path: "/index.html", header: map[string]string{"If-None-Match": obj.ETag},
+			wantStatus: http.StatusNotModified},
+		{name: "missing", path: "/nope", wantStatus: http.StatusNotFound},
+		{name: "outside the prefix", path: "/../private", wantStatus: http.StatusNotFound},
+		{name: "outside the prefix from a subdirectory", path: "/docs/./../../private", wantStatus: http.StatusNotFound},
+		{name: "write refused", method: http.MethodPut, path: "/index.html", wantStatus: http.StatusMethodNotAllowed},
+		{name: "listings off", path: "/", wantStatus: http.StatusForbidden},
+		{name: "listing", opts: Options{Listings: true}, path: "/", wantStatus: http.StatusOK,
+			wantBody: `<a href="docs/">docs/</a>`, wantListed: true},
+		{name: "directory redirected to its listing", opts: Options{Listings: true}, path: "/docs",
+			wantStatus: http.StatusMovedPermanently},
+		{name: "no credentials", opts: Options{Username: "u", Password: "p"}, path: "/index.html",
+			wantStatus: http.StatusUnauthorized},
+		{name: "credentials", opts: Options{Username: "u", Password: "p"}, auth: true, path: "/index.html",
+			wantStatus: http.StatusOK, wantBody: "hello, world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Bucket, opts.Prefix = "b", "site"
+			h := NewHandler(srv.Client(t), opts)
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			if tt.auth {
+				req.SetBasicAuth("u", "p")
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			body := w.Body.String()
+			switch {
+			case tt.wantListed && !strings.Contains(body, tt.wantBody):
+				t.Fatalf("listing %q does not contain %q", body, tt.wantBody)
+			case !tt.wantListed && tt.wantBody != "" && body != tt.wantBody:
+				t.Fatalf("body %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk
+
+go 1.26.0
+
+require (
+	github.com/aws/aws-sdk-go v1.55.8
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/pkg/sftp v1.13.11
+	golang.org/x/crypto v0.57.0
+	golang.org/x/term v0.46.0
+)
+
+require (
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+)
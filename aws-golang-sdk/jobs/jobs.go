@@ -0,0 +1,307 @@
+// Package jobs runs sync and backup jobs against several named targets,
+// each with its own endpoint, bucket and credentials, from one JSON
+// configuration file:
+//
+//	{
+//	  "targets": {
+//	    "dc1": {"endpoint": "https://10.0.0.10:9440", "access_key": "AKIA...", "secret_key_env": "DC1_SECRET", "bucket": "data"},
+//	    "dr":  {"endpoint": "https://10.1.0.10:9440", "username": "admin", "password_env": "DR_PASSWORD", "bucket": "dr", "insecure": true}
+//	  },
+//	  "jobs": [
+//	    {"name": "home", "type": "sync", "dir": "/srv/home", "prefix": "home/", "targets": ["dc1", "dr"]},
+//	    {"name": "db", "type": "backup", "dir": "/var/backups/db", "prefix": "db/", "keep": 14, "targets": ["dr"], "priority": 10}
+//	  ]
+//	}
+//
+// Secrets are never stored in the file; targets name the environment
+// variables holding them.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/backup"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/dirsync"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Job types.
+const (
+	TypeSync   = "sync"
+	TypeBackup = "backup"
+)
+
+// Target is one destination.
+type Target struct {
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region,omitempty"`
+	// Username with the password in $PasswordEnv, or AccessKey with the
+	// secret in $SecretKeyEnv.
+	Username     string `json:"username,omitempty"`
+	PasswordEnv  string `json:"password_env,omitempty"`
+	AccessKey    string `json:"access_key,omitempty"`
+	SecretKeyEnv string `json:"secret_key_env,omitempty"`
+	Insecure     bool   `json:"insecure,omitempty"`
+	Bucket       string `json:"bucket"`
+	// Prefix is prepended to the prefix of every job using the target.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Config builds the connection settings of the target, reading its
+// secrets from the environment.
+func (t Target) Config() (utils.Config, error) {
+	cfg := utils.Config{
+		Endpoint:  t.Endpoint,
+		Region:    t.Region,
+		Username:  t.Username,
+		AccessKey: t.AccessKey,
+		Insecure:  t.Insecure,
+	}
+	env := func(name string) (string, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return "", fmt.Errorf("$%s is not set", name)
+		}
+		return v, nil
+	}
+	var err error
+	switch {
+	case t.AccessKey != "":
+		cfg.SecretKey, err = env(t.SecretKeyEnv)
+	case t.Username != "":
+		cfg.Password, err = env(t.PasswordEnv)
+	default:
+		err = fmt.Errorf("no username or access key")
+	}
+	return cfg, err
+}
+
+// Job is one sync or backup of a directory, run against each of its
+// targets.
+type Job struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Dir     string   `json:"dir"`
+	Prefix  string   `json:"prefix,omitempty"`
+	Targets []string `json:"targets"`
+	// ContinueOnError keeps the job going after a failed file instead of
+	// stopping at the first one.
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+	// Priority orders jobs: higher ones start first and, with
+	// Options.MaxParts, their parts are uploaded ahead of those of
+	// lower-priority jobs running alongside.
+	Priority int `json:"priority,omitempty"`
+	// Sync settings.
+	Direction dirsync.Direction `json:"direction,omitempty"`
+	Compare   dirsync.Compare   `json:"compare,omitempty"`
+	Delete    bool              `json:"delete,omitempty"`
+	// Backup settings.
+	Keep int `json:"keep,omitempty"`
+}
+
+// Config is a parsed configuration file.
+type Config struct {
+	Targets map[string]Target `json:"targets"`
+	Jobs    []Job             `json:"jobs"`
+}
+
+// Load reads and validates a configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, t := range c.Targets {
+		if t.Endpoint == "" || t.Bucket == "" {
+			return nil, fmt.Errorf("%s: target %q needs an endpoint and a bucket", path, name)
+		}
+	}
+	names := map[string]bool{}
+	for i := range c.Jobs {
+		j := &c.Jobs[i]
+		switch {
+		case j.Name == "" || names[j.Name]:
+			return nil, fmt.Errorf("%s: job %d needs a unique name", path, i+1)
+		case j.Type != TypeSync && j.Type != TypeBackup:
+			return nil, fmt.Errorf("%s: job %q: unknown type %q", path, j.Name, j.Type)
+		case j.Dir == "" || len(j.Targets) == 0:
+			return nil, fmt.Errorf("%s: job %q needs a dir and targets", path, j.Name)
+		}
+		names[j.Name] = true
+		for _, t := range j.Targets {
+			if _, ok := c.Targets[t]; !ok {
+				return nil, fmt.Errorf("%s: job %q: unknown target %q", path, j.Name, t)
+			}
+		}
+		if j.Type == TypeSync && j.Direction == "" {
+			j.Direction = dirsync.Up
+		}
+	}
+	return &c, nil
+}
+
+// State is the progress of one job on one target.
+type State string
+
+const (
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+// Status reports one job on one target.
+type Status struct {
+	Job     string
+	Target  string
+	State   State
+	Elapsed time.Duration
+	// Detail summarizes the outcome, such as the files transferred.
+	Detail string
+	Err    error
+}
+
+// Options configures Run.
+type Options struct {
+	// Parallel is the number of job/target pairs run at once; 1 runs
+	// them one after another in configuration order.
+	Parallel int
+	// Only, when not empty, restricts the run to these jobs.
+	Only []string
+	// Upload configures the uploads of every job.
+	Upload utils.UploadOptions
+	// MaxParts, when positive, caps the part uploads in flight across
+	// all running jobs. A job waiting for a slot is served before jobs of
+	// lower priority, so an urgent job started next to a bulk sync pauses
+	// the sync's uploads until it is done. Zero leaves each job to its
+	// own concurrency, and priorities only decide the start order.
+	MaxParts int
+}
+
+// Run executes every job on each of its targets, highest priority first,
+// and returns the final status of each pair, in configuration order.
+// report, if not nil, is
+// called when a pair starts and when it ends, possibly concurrently. One
+// pair failing does not stop the others.
+func Run(ctx context.Context, c *Config, opts Options, report func(Status)) []Status {
+	type pair struct {
+		job    Job
+		target string
+	}
+	only := map[string]bool{}
+	for _, name := range opts.Only {
+		only[name] = true
+	}
+	var pairs []pair
+	for _, j := range c.Jobs {
+		if len(only) > 0 && !only[j.Name] {
+			continue
+		}
+		for _, t := range j.Targets {
+			pairs = append(pairs, pair{j, t})
+		}
+	}
+	order := make([]int, len(pairs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return pairs[order[a]].job.Priority > pairs[order[b]].job.Priority })
+	if opts.MaxParts > 0 {
+		opts.Upload.Queue = utils.NewPriorityQueue(opts.MaxParts)
+	}
+	opts.Upload.ShareMemory()
+
+	// Connect to each target once, up front, so configuration errors
+	// surface before anything is transferred.
+	clients := map[string]*utils.Client{}
+	connErrs := map[string]error{}
+	for _, p := range pairs {
+		if _, done := clients[p.target]; done || connErrs[p.target] != nil {
+			continue
+		}
+		cfg, err := c.Targets[p.target].Config()
+		if err == nil {
+			clients[p.target], err = utils.NewClient(cfg)
+		}
+		if err != nil {
+			connErrs[p.target] = fmt.Errorf("target %s: %w", p.target, err)
+		}
+	}
+
+	statuses := make([]Status, len(pairs))
+	utils.ForEach(ctx, len(pairs), max(opts.Parallel, 1), func(n int) {
+		i := order[n]
+		p := pairs[i]
+		s := Status{Job: p.job.Name, Target: p.target, State: StateRunning}
+		if report != nil {
+			report(s)
+		}
+		start := time.Now()
+		if s.Err = connErrs[p.target]; s.Err == nil {
+			upload := opts.Upload
+			upload.Priority = p.job.Priority
+			s.Detail, s.Err = runJob(ctx, clients[p.target], c.Targets[p.target], p.job, upload)
+		}
+		s.Elapsed = time.Since(start)
+		s.State = StateDone
+		if s.Err != nil {
+			s.State = StateFailed
+		}
+		statuses[i] = s
+		if report != nil {
+			report(s)
+		}
+	})
+	for i, s := range statuses {
+		if s.State == "" {
+			statuses[i] = Status{Job: pairs[i].job.Name, Target: pairs[i].target, State: StateFailed, Err: ctx.Err()}
+		}
+	}
+	return statuses
+}
+
+func runJob(ctx context.Context, client *utils.Client, t Target, j Job, upload utils.UploadOptions) (string, error) {
+	prefix := t.Prefix + j.Prefix
+	switch j.Type {
+	case TypeSync:
+		sum, err := dirsync.Run(ctx, client, dirsync.Options{
+			Bucket:          t.Bucket,
+			Prefix:          prefix,
+			Dir:             j.Dir,
+			Direction:       j.Direction,
+			Compare:         j.Compare,
+			Delete:          j.Delete,
+			Upload:          upload,
+			ContinueOnError: j.ContinueOnError,
+		}, func(dirsync.Result) {})
+		detail := fmt.Sprintf("%d transferred (%s), %d unchanged, %d deleted, %d failed, %d skipped",
+			sum.Transferred, utils.FormatBytes(sum.Bytes), sum.Unchanged, sum.Deleted, sum.Failed, sum.Skipped)
+		if err == nil && sum.Failed > 0 {
+			err = fmt.Errorf("%d files failed", sum.Failed)
+		}
+		return detail, err
+	case TypeBackup:
+		r, err := backup.Run(ctx, client, backup.Options{
+			Bucket:          t.Bucket,
+			Prefix:          prefix,
+			Dir:             j.Dir,
+			Keep:            j.Keep,
+			Upload:          upload,
+			ContinueOnError: j.ContinueOnError,
+		}, time.Now())
+		if err == nil && len(r.Failed) > 0 {
+			err = fmt.Errorf("%d files failed, first: %w", len(r.Failed), r.Failed[0])
+		}
+		return fmt.Sprintf("snapshot %s: %d files (%s), %d pruned",
+			r.Snapshot.Name, r.Files, utils.FormatBytes(r.Bytes), len(r.Pruned)), err
+	}
+	return "", fmt.Errorf("unknown job type %q", j.Type)
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/backup"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	dc1 := objectslitetest.NewServer(t)
+	dc1.CreateBucket("data")
+	dr := objectslitetest.NewServer(t)
+	dr.CreateBucket("dr")
+	t.Setenv("DC1_SECRET", "test")
+	t.Setenv("DR_SECRET", "test")
+	home := objectslitetest.TempTree(t, map[string]int64{"a": 10, "sub/b": 1 << 20})
+	db := objectslitetest.TempTree(t, map[string]int64{"dump.sql": 100})
+	path := writeConfig(t, fmt.Sprintf(`{
+		"targets": {
+			"dc1": {"endpoint": %q, "access_key": "test", "secret_key_env": "DC1_SECRET", "bucket": "data"},
+			"dr": {"endpoint": %q, "access_key": "test", "secret_key_env": "DR_SECRET", "bucket": "dr", "prefix": "site1/"},
+			"unset": {"endpoint": %[2]q, "access_key": "test", "secret_key_env": "NO_SUCH_SECRET", "bucket": "dr"}
+		},
+		"jobs": [
+			{"name": "home", "type": "sync", "dir": %q, "prefix": "home/", "targets": ["dc1", "dr"]},
+			{"name": "db", "type": "backup", "dir": %q, "prefix": "db/", "keep": 2, "targets": ["dr", "unset"], "priority": 10}
+		]
+	}`, dc1.URL, dr.URL, home, db))
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var started []string
+	statuses := Run(context.Background(), c, Options{MaxParts: 2}, func(s Status) {
+		if s.State == StateRunning {
+			mu.Lock()
+			started = append(started, s.Job+"/"+s.Target)
+			mu.Unlock()
+		}
+	})
+	want := []struct {
+		pair  string
+		state State
+	}{{"home/dc1", StateDone}, {"home/dr", StateDone}, {"db/dr", StateDone}, {"db/unset", StateFailed}}
+	if len(statuses) != len(want) {
+		t.Fatalf("%d statuses, want %d", len(statuses), len(want))
+	}
+	for i, s := range statuses {
+		if pair := s.Job + "/" + s.Target; pair != want[i].pair || s.State != want[i].state {
+			t.Errorf("status %d is %s %s (%v), want %s %s", i, pair, s.State, s.Err, want[i].pair, want[i].state)
+		}
+	}
+	if len(started) != 4 || !strings.HasPrefix(started[0], "db/") || !strings.HasPrefix(started[1], "db/") {
+		t.Errorf("started %v, want the higher-priority db pairs first", started)
+	}
+
+	objectslitetest.AssertKeys(t, dc1, "data", "home/a", "home/sub/b")
+	objectslitetest.AssertObjectMatchesFile(t, dr, "dr", "site1/home/sub/b", filepath.Join(home, "sub", "b"))
+	snaps, err := backup.List(context.Background(), dr.Client(t), "dr", "site1/db/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 {
+		t.Fatalf("%d backup snapshots on dr, want 1", len(snaps))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	target := `"t": {"endpoint": "https://e", "bucket": "b"}`
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{name: "target without bucket", config: `{"targets": {"t": {"endpoint": "https://e"}}}`},
+		{name: "job without name", config: `{"targets": {` + target + `}, "jobs": [{"type": "sync", "dir": "/d", "targets": ["t"]}]}`},
+		{name: "duplicate names", config: `{"targets": {` + target + `}, "jobs": [
+			{"name": "j", "type": "sync", "dir": "/d", "targets": ["t"]},
+			{"name": "j", "type": "sync", "dir": "/e", "targets": ["t"]}]}`},
+		{name: "unknown type", config: `{"targets": {` + target + `}, "jobs": [{"name": "j", "type": "copy", "dir": "/d", "targets": ["t"]}]}`},
+		{name: "unknown target", config: `{"targets": {` + target + `}, "jobs": [{"name": "j", "type": "sync", "dir": "/d", "targets": ["u"]}]}`},
+		{name: "no dir", config: `{"targets": {` + target + `}, "jobs": [{"name": "j", "type": "backup", "targets": ["t"]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.config)); err == nil {
+				t.Fatal("invalid configuration loaded")
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package manifest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Writer emits manifest entries as JSON lines.
+type Writer struct {
+	enc *json.Encoder
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+// Write appends one entry.
+func (w *Writer) Write(e Entry) error {
+	return w.enc.Encode(e)
+}
+
+// WriteFile writes entries to path, replacing any existing file.
+func WriteFile(path string, entries []Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := NewWriter(f)
+	for _, e := range entries {
+		if err := w.Write(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Algorithm is the content hash recorded for each entry.
+type Algorithm string
+
+const (
+	SHA256 Algorithm = "sha256"
+	// XXHash64 is not cryptographic but hashes several times faster than
+	// SHA-256; use it to compare trees where tampering is not a concern.
+	XXHash64 Algorithm = "xxhash64"
+)
+
+// ParseAlgorithm validates an algorithm name, defaulting to SHA256.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch a := Algorithm(s); a {
+	case "":
+		return SHA256, nil
+	case SHA256, XXHash64:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown hash algorithm %q", s)
+}
+
+func (a Algorithm) new() hash.Hash {
+	if a == XXHash64 {
+		return xxhash.New()
+	}
+	return sha256.New()
+}
+
+// set records sum in the entry field for algorithm a.
+func (e *Entry) set(a Algorithm, sum string) {
+	if a == XXHash64 {
+		e.XXHash64 = sum
+	} else {
+		e.SHA256 = sum
+	}
+}
+
+// Sum returns the entry's recorded hash for algorithm a, if any.
+func (e Entry) Sum(a Algorithm) string {
+	if a == XXHash64 {
+		return e.XXHash64
+	}
+	return e.SHA256
+}
+
+// HashMode selects how hashes are obtained for remote objects.
+type HashMode string
+
+const (
+	// HashNone records only what the listing returns (size, ETag, time).
+	HashNone HashMode = "none"
+	// HashMetadata HeadObjects each key and records its sha256 metadata.
+	HashMetadata HashMode = "metadata"
+	// HashContent downloads each object and hashes the body with the
+	// configured Algorithm.
+	HashContent HashMode = "content"
+)
+
+// BucketOptions configures FromBucket.
+type BucketOptions struct {
+	Bucket string
+	Prefix string
+	Hash   HashMode
+	// Algorithm applies to HashContent; stored metadata is always SHA-256.
+	Algorithm   Algorithm
+	Concurrency int
+}
+
+// FromBucket lists every object under opts.Prefix and returns its entries
+// sorted by key. Keys are recorded relative to the prefix so the manifest
+// can be audited against another prefix or a local directory.
+func FromBucket(ctx context.Context, svc s3iface.S3API, opts BucketOptions) ([]Entry, error) {
+	var entries []Entry
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.Bucket),
+		Prefix: aws.String(opts.Prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			entries = append(entries, Entry{
+				Key:          strings.TrimPrefix(aws.StringValue(obj.Key), opts.Prefix),
+				Size:         aws.Int64(aws.Int64Value(obj.Size)),
+				ETag:         aws.StringValue(obj.ETag),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list s3://%s/%s: %w", opts.Bucket, opts.Prefix, err)
+	}
+
+	if opts.Hash == HashMetadata || opts.Hash == HashContent {
+		errs := make([]error, len(entries))
+		utils.ForEach(ctx, len(entries), opts.Concurrency, func(i int) {
+			var sum string
+			sum, errs[i] = remoteHash(ctx, svc, opts, opts.Prefix+entries[i].Key)
+			if opts.Hash == HashMetadata {
+				entries[i].SHA256 = sum
+			} else {
+				entries[i].set(opts.Algorithm, sum)
+			}
+		})
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func remoteHash(ctx context.Context, svc s3iface.S3API, opts BucketOptions, key string) (string, error) {
+	if opts.Hash == HashMetadata {
+		head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(opts.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return "", fmt.Errorf("head %s: %w", key, err)
+		}
+		return utils.MetadataValue(head.Metadata, utils.MetaSHA256), nil
+	}
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("get %s: %w", key, err)
+	}
+	defer out.Body.Close()
+	return HashReader(out.Body, opts.Algorithm)
+}
+
+// FromDir walks the regular files under root and returns their entries,
+// hashed with algorithm, sorted by key. Keys are slash-separated paths
+// relative to root.
+func FromDir(ctx context.Context, root string, algorithm Algorithm, concurrency int) ([]Entry, error) {
+	var paths []string
+	var entries []Entry
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		entries = append(entries, Entry{
+			Key:          filepath.ToSlash(rel),
+			Size:         aws.Int64(info.Size()),
+			LastModified: info.ModTime().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(entries))
+	utils.ForEach(ctx, len(entries), concurrency, func(i int) {
+		var sum string
+		sum, errs[i] = HashFile(paths[i], algorithm)
+		entries[i].set(algorithm, sum)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// HashFile returns the hex digest of the file at path.
+func HashFile(path string, algorithm Algorithm) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f, algorithm)
+}
+
+// HashReader returns the hex digest of everything read from r.
+func HashReader(r io.Reader, algorithm Algorithm) (string, error) {
+	h := algorithm.new()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+}
@@ -0,0 +1,62 @@
+// Package manifest reads and writes object manifests: JSON-lines files
+// with one entry per object describing its key, size and hashes. Manifests
+// drive integrity audits and manifest-based batch operations.
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Entry describes one object. Only Key is mandatory; consumers check the
+// other fields when they are set. Size is a pointer so that an entry
+// without one is told apart from an empty object.
+type Entry struct {
+	Key          string    `json:"key"`
+	Size         *int64    `json:"size,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	SHA256       string    `json:"sha256,omitempty"`
+	XXHash64     string    `json:"xxhash64,omitempty"`
+	LastModified time.Time `json:"last_modified,omitzero"`
+}
+
+// Read parses a manifest. Blank lines and lines starting with '#' are
+// ignored.
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("manifest line %d: %w", line, err)
+		}
+		if e.Key == "" {
+			return nil, fmt.Errorf("manifest line %d: missing key", line)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// ReadFile parses the manifest at path.
+func ReadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
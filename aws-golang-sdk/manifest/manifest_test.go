@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestFromBucketMatchesFromDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		hash      HashMode
+		algorithm Algorithm
+	}{
+		{name: "sha256 content", hash: HashContent, algorithm: SHA256},
+		{name: "xxhash64 content", hash: HashContent, algorithm: XXHash64},
+		{name: "sha256 metadata", hash: HashMetadata, algorithm: SHA256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := objectslitetest.TempTree(t, map[string]int64{"a": 10, "sub/b": 3 << 20, "sub/empty": 0})
+			local, err := FromDir(ctx, dir, tt.algorithm, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			client := srv.Client(t)
+			for _, e := range local {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(e.Key)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+					Bucket:   aws.String("b"),
+					Key:      aws.String("p/" + e.Key),
+					Body:     bytes.NewReader(data),
+					Metadata: map[string]*string{utils.MetaSHA256: aws.String(e.SHA256)},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// An object beside the prefix is not listed.
+			srv.PutObject("b", "other", []byte("x"))
+
+			remote, err := FromBucket(ctx, client, BucketOptions{Bucket: "b", Prefix: "p/", Hash: tt.hash, Algorithm: tt.algorithm, Concurrency: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(remote) != len(local) {
+				t.Fatalf("%d entries from the bucket, want the directory's %d", len(remote), len(local))
+			}
+			for i, r := range remote {
+				l := local[i]
+				if r.Key != l.Key || *r.Size != *l.Size || r.Sum(tt.algorithm) != l.Sum(tt.algorithm) {
+					t.Errorf("bucket entry %s (%d bytes, %s %q), want %s (%d bytes, %q)",
+						r.Key, *r.Size, tt.algorithm, r.Sum(tt.algorithm), l.Key, *l.Size, l.Sum(tt.algorithm))
+				}
+				if r.Sum(tt.algorithm) == "" {
+					t.Errorf("%s has no %s", r.Key, tt.algorithm)
+				}
+			}
+
+			// The written manifest reads back the same.
+			path := filepath.Join(t.TempDir(), "manifest.jsonl")
+			if err := WriteFile(path, remote); err != nil {
+				t.Fatal(err)
+			}
+			back, err := ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(back) != len(remote) || back[1].Key != remote[1].Key || *back[1].Size != *remote[1].Size {
+				t.Fatalf("read back %v, want %v", back, remote)
+			}
+		})
+	}
+}
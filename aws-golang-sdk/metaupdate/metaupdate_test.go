@@ -0,0 +1,98 @@
+package metaupdate
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// overwritingHead replaces the object right after it is read, as a
+// concurrent writer racing the update does.
+type overwritingHead struct {
+	s3iface.S3API
+	srv *objectslitetest.Server
+}
+
+func (o *overwritingHead) HeadObjectWithContext(ctx aws.Context, in *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	out, err := o.S3API.HeadObjectWithContext(ctx, in, opts...)
+	o.srv.PutObject(aws.StringValue(in.Bucket), aws.StringValue(in.Key), []byte("newer"))
+	return out, err
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		copy      utils.CopyOptions
+		overwrite bool
+	}{
+		{name: "single copy"},
+		{name: "multipart copy", copy: utils.CopyOptions{Threshold: 1 << 20, PartSize: 1 << 20}},
+		{name: "single copy of an overwritten object", overwrite: true},
+		{name: "multipart copy of an overwritten object", copy: utils.CopyOptions{Threshold: 1 << 20, PartSize: 1 << 20}, overwrite: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			client := srv.Client(t)
+			data := objectslitetest.Data(3 << 20)
+			_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket:       aws.String("b"),
+				Key:          aws.String("k"),
+				Body:         bytes.NewReader(data),
+				ContentType:  aws.String("text/plain"),
+				CacheControl: aws.String("no-cache"),
+				Metadata:     map[string]*string{"owner": aws.String("a"), "stale": aws.String("x")},
+				Tagging:      aws.String("tier=hot"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var svc s3iface.S3API = client
+			if tt.overwrite {
+				svc = &overwritingHead{S3API: client, srv: srv}
+			}
+			u := Update{
+				ContentType:    "application/json",
+				SetMetadata:    map[string]string{"Reviewed": "yes"},
+				RemoveMetadata: []string{"stale"},
+			}
+
+			err = Apply(ctx, svc, "b", "k", u, tt.copy)
+			if tt.overwrite {
+				if err == nil {
+					t.Fatal("updated an object overwritten since it was read")
+				}
+				objectslitetest.AssertObject(t, srv, "b", "k", []byte("newer"))
+				if n := srv.Uploads(); n != 0 {
+					t.Fatalf("%d multipart uploads left open", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			objectslitetest.AssertObject(t, srv, "b", "k", data)
+			obj, _ := srv.Object("b", "k")
+			if want := map[string]string{"owner": "a", "reviewed": "yes"}; !maps.Equal(obj.Metadata, want) {
+				t.Errorf("metadata %v, want %v", obj.Metadata, want)
+			}
+			if obj.ContentType != "application/json" || obj.CacheControl != "no-cache" {
+				t.Errorf("Content-Type %q and Cache-Control %q, want application/json and the unchanged no-cache", obj.ContentType, obj.CacheControl)
+			}
+			if want := map[string]string{"tier": "hot"}; !maps.Equal(obj.Tags, want) {
+				t.Errorf("tags %v, want %v", obj.Tags, want)
+			}
+		})
+	}
+}
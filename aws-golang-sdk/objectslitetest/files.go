@@ -0,0 +1,99 @@
+package objectslitetest
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// Data returns size bytes of pseudo-random content. The same size always
+// gives the same bytes, so a failing test fails the same way every run.
+func Data(size int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(size)).Read(data)
+	return data
+}
+
+// TempFile writes Data(size) to a file in a directory removed when the
+// test ends and returns its path.
+func TempFile(t testing.TB, size int64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, Data(size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TempTree creates a directory removed when the test ends holding a file
+// of the given size for each slash-separated relative path, and returns
+// the directory.
+func TempTree(t testing.TB, files map[string]int64) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, size := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, Data(size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// AssertObject fails the test unless bucket/key holds want.
+func AssertObject(t testing.TB, s *Server, bucket, key string, want []byte) {
+	t.Helper()
+	o, ok := s.Object(bucket, key)
+	if !ok {
+		t.Fatalf("s3://%s/%s does not exist", bucket, key)
+	}
+	if !bytes.Equal(o.Data, want) {
+		t.Fatalf("s3://%s/%s: got %d bytes, want %d; content differs from byte %d",
+			bucket, key, len(o.Data), len(want), firstDiff(o.Data, want))
+	}
+}
+
+// AssertObjectMatchesFile fails the test unless bucket/key holds the
+// contents of the local file at path.
+func AssertObjectMatchesFile(t testing.TB, s *Server, bucket, key, path string) {
+	t.Helper()
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertObject(t, s, bucket, key, want)
+}
+
+// AssertKeys fails the test unless the keys in bucket are exactly want,
+// in any order.
+func AssertKeys(t testing.TB, s *Server, bucket string, want ...string) {
+	t.Helper()
+	got := s.Keys(bucket)
+	want = append([]string(nil), want...)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("s3://%s: got keys %q, want %q", bucket, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("s3://%s: got keys %q, want %q", bucket, got, want)
+		}
+	}
+}
+
+// firstDiff returns the offset of the first byte at which a and b differ.
+func firstDiff(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
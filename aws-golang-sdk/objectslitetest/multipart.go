@@ -0,0 +1,218 @@
+package objectslitetest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.bucket(bucket); err != nil {
+		return err
+	}
+	s.nextID++
+	id := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[id] = &upload{bucket: bucket, key: key, initiated: time.Now().UTC(), header: r.Header.Clone(), parts: map[int64]part{}}
+	return writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: bucket, Key: key, UploadId: id})
+}
+
+// lookupUpload returns the upload with the request's uploadId. s.mu must
+// be held.
+func (s *Server) lookupUpload(bucket, key, id string) (*upload, error) {
+	u, ok := s.uploads[id]
+	if !ok || u.bucket != bucket || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, bucket, key string, q url.Values) error {
+	id := q.Get("uploadId")
+	switch r.Method {
+	case http.MethodPut:
+		return s.uploadPart(w, r, bucket, key, id, q)
+	case http.MethodPost:
+		return s.completeUpload(w, r, bucket, key, id)
+	case http.MethodDelete:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, err := s.lookupUpload(bucket, key, id); err != nil {
+			return err
+		}
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case http.MethodGet:
+		return s.listParts(w, bucket, key, id)
+	}
+	return errorf(http.StatusMethodNotAllowed, "MethodNotAllowed", "%s is not supported on uploads", r.Method)
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, id string, q url.Values) error {
+	number, err := strconv.ParseInt(q.Get("partNumber"), 10, 64)
+	if err != nil || number < 1 || number > 10000 {
+		return errorf(http.StatusBadRequest, "InvalidArgument", "part number must be between 1 and 10000")
+	}
+	copied := r.Header.Get("X-Amz-Copy-Source") != ""
+	var data []byte
+	if copied {
+		src, err := s.copySource(r)
+		if err != nil {
+			return err
+		}
+		data = src.Data
+	} else if data, err = readBody(r); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.lookupUpload(bucket, key, id)
+	if err != nil {
+		return err
+	}
+	p := part{data: data, etag: etagOf(data), time: time.Now().UTC()}
+	u.parts[number] = p
+	if !copied {
+		w.Header().Set("ETag", p.etag)
+		return nil
+	}
+	return writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyPartResult"`
+		ETag         string
+		LastModified string
+	}{ETag: p.etag, LastModified: p.time.Format(time.RFC3339)})
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key, id string) error {
+	var req struct {
+		Part []struct {
+			PartNumber int64
+			ETag       string
+		}
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return errorf(http.StatusBadRequest, "MalformedXML", "%v", err)
+	}
+	if len(req.Part) == 0 {
+		return errorf(http.StatusBadRequest, "MalformedXML", "no parts")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.lookupUpload(bucket, key, id)
+	if err != nil {
+		return err
+	}
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	sums := md5.New()
+	for i, rp := range req.Part {
+		if i > 0 && rp.PartNumber <= req.Part[i-1].PartNumber {
+			return errorf(http.StatusBadRequest, "InvalidPartOrder", "parts must be listed in ascending order")
+		}
+		p, ok := u.parts[rp.PartNumber]
+		if !ok || strings.Trim(rp.ETag, `"`) != strings.Trim(p.etag, `"`) {
+			return errorf(http.StatusBadRequest, "InvalidPart", "part %d was not uploaded or its ETag does not match", rp.PartNumber)
+		}
+		if s.MinPartSize > 0 && i < len(req.Part)-1 && int64(len(p.data)) < s.MinPartSize {
+			return errorf(http.StatusBadRequest, "EntityTooSmall", "part %d is smaller than the minimum allowed size", rp.PartNumber)
+		}
+		data = append(data, p.data...)
+		raw, _ := hex.DecodeString(strings.Trim(p.etag, `"`))
+		sums.Write(raw)
+	}
+	if err := checkWrite(r, b[key]); err != nil {
+		return err
+	}
+	o := objectHeaders(u.header)
+	o.Data, o.LastModified = data, time.Now().UTC()
+	o.ETag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(req.Part))
+	b[key] = o
+	delete(s.uploads, id)
+	return writeXML(w, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Location: s.URL + "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: o.ETag})
+}
+
+func (s *Server) listParts(w http.ResponseWriter, bucket, key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.lookupUpload(bucket, key, id)
+	if err != nil {
+		return err
+	}
+	type listedPart struct {
+		PartNumber   int64
+		ETag         string
+		Size         int64
+		LastModified string
+	}
+	res := struct {
+		XMLName     xml.Name `xml:"ListPartsResult"`
+		Bucket      string
+		Key         string
+		UploadId    string
+		IsTruncated bool
+		Part        []listedPart
+	}{Bucket: bucket, Key: key, UploadId: id}
+	for n, p := range u.parts {
+		res.Part = append(res.Part, listedPart{n, p.etag, int64(len(p.data)), p.time.Format(time.RFC3339)})
+	}
+	sort.Slice(res.Part, func(i, j int) bool { return res.Part[i].PartNumber < res.Part[j].PartNumber })
+	return writeXML(w, res)
+}
+
+func (s *Server) listUploads(w http.ResponseWriter, bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.bucket(bucket); err != nil {
+		return err
+	}
+	type listedUpload struct {
+		Key       string
+		UploadId  string
+		Initiated string
+	}
+	res := struct {
+		XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+		Bucket      string
+		IsTruncated bool
+		Upload      []listedUpload
+	}{Bucket: bucket}
+	for id, u := range s.uploads {
+		if u.bucket == bucket {
+			res.Upload = append(res.Upload, listedUpload{u.key, id, u.initiated.Format(time.RFC3339)})
+		}
+	}
+	sort.Slice(res.Upload, func(i, j int) bool {
+		if res.Upload[i].Key != res.Upload[j].Key {
+			return res.Upload[i].Key < res.Upload[j].Key
+		}
+		return res.Upload[i].UploadId < res.Upload[j].UploadId
+	})
+	return writeXML(w, res)
+}
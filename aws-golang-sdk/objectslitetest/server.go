@@ -0,0 +1,714 @@
+// Package objectslitetest helps applications built on this module test
+// their Objectslite code without a cluster. NewServer starts an
+// in-memory S3 endpoint speaking enough of the protocol for everything in
+// this module: buckets, objects with metadata, ranged and conditional
+// GETs, listings, copies, tags, batch deletes and multipart uploads. The
+// file and assertion helpers cover the usual upload and download checks:
+//
+//	srv := objectslitetest.NewServer(t)
+//	srv.CreateBucket("b")
+//	path := objectslitetest.TempFile(t, 20<<20)
+//	if _, err := utils.Upload(ctx, srv.Client(t), "b", "k", path, utils.UploadOptions{}); err != nil {
+//		t.Fatal(err)
+//	}
+//	objectslitetest.AssertObjectMatchesFile(t, srv, "b", "k", path)
+//
+// Requests are not authenticated; any credentials are accepted.
+package objectslitetest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Object is a stored object.
+type Object struct {
+	Data         []byte
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	// ContentEncoding and CacheControl are stored as sent.
+	ContentEncoding string
+	CacheControl    string
+	// Metadata holds the x-amz-meta-* headers, keyed by lower-case name
+	// without the prefix.
+	Metadata map[string]string
+	Tags     map[string]string
+}
+
+type upload struct {
+	bucket, key string
+	initiated   time.Time
+	header      http.Header
+	parts       map[int64]part
+}
+
+type part struct {
+	data []byte
+	etag string
+	time time.Time
+}
+
+// Server is an in-memory S3 endpoint. Its methods may be called while
+// requests are served.
+type Server struct {
+	*httptest.Server
+	// Fail, when set, is called for every request before it is served;
+	// returning true fails the request with 500 InternalError, so tests
+	// can exercise retries.
+	Fail func(r *http.Request) bool
+	// MinPartSize, when positive, rejects completing a multipart upload
+	// whose parts other than the last are smaller, as S3 does with
+	// utils.MinPartSize. Zero accepts any part size, so tests can use
+	// small files.
+	MinPartSize int64
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*Object
+	uploads map[string]*upload
+	nextID  int
+}
+
+// NewServer starts a server that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{buckets: map[string]map[string]*Object{}, uploads: map[string]*upload{}}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config returns connection settings for the server.
+func (s *Server) Config() utils.Config {
+	return utils.Config{Endpoint: s.URL, AccessKey: "test", SecretKey: "test"}
+}
+
+// Client returns a client connected to the server, failing the test if
+// it cannot be created.
+func (s *Server) Client(t testing.TB) *utils.Client {
+	t.Helper()
+	c, err := utils.NewClient(s.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// CreateBucket creates an empty bucket, if it does not exist.
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[name] == nil {
+		s.buckets[name] = map[string]*Object{}
+	}
+}
+
+// PutObject stores data at bucket/key directly, creating the bucket if
+// needed.
+func (s *Server) PutObject(bucket, key string, data []byte) {
+	s.CreateBucket(bucket)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets[bucket][key] = &Object{Data: bytes.Clone(data), ETag: etagOf(data), LastModified: time.Now().UTC()}
+}
+
+// Object returns a copy of the object at bucket/key.
+func (s *Server) Object(bucket, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.buckets[bucket][key]
+	if !ok {
+		return Object{}, false
+	}
+	return o.clone(), true
+}
+
+// Keys returns the keys in bucket, sorted.
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Uploads returns the number of multipart uploads neither completed nor
+// aborted, so tests can check that none leak.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (o *Object) clone() Object {
+	c := *o
+	c.Data = bytes.Clone(o.Data)
+	c.Metadata = cloneMap(o.Metadata)
+	c.Tags = cloneMap(o.Tags)
+	return c
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// s3Error is an S3 error response.
+type s3Error struct {
+	status  int
+	Code    string
+	Message string
+}
+
+func (e *s3Error) Error() string { return e.Code + ": " + e.Message }
+
+func errorf(status int, code, format string, args ...any) *s3Error {
+	return &s3Error{status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	errNoSuchBucket = errorf(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+	errNoSuchKey    = errorf(http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+	errNoSuchUpload = errorf(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	errPrecondition = errorf(http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the preconditions you specified did not hold.")
+)
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Fail != nil && s.Fail(r) {
+		writeError(w, r, errorf(http.StatusInternalServerError, "InternalError", "injected failure"))
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	var err error
+	switch {
+	case bucket == "":
+		err = errorf(http.StatusNotImplemented, "NotImplemented", "ListBuckets is not supported")
+	case key == "":
+		err = s.serveBucket(w, r, bucket, q)
+	case q.Has("uploads") && r.Method == http.MethodPost:
+		err = s.createUpload(w, r, bucket, key)
+	case q.Has("uploadId"):
+		err = s.serveUpload(w, r, bucket, key, q)
+	case q.Has("tagging"):
+		err = s.serveTagging(w, r, bucket, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		err = s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		err = s.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		err = s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		err = s.deleteObject(w, bucket, key)
+	default:
+		err = errorf(http.StatusMethodNotAllowed, "MethodNotAllowed", "%s is not supported here", r.Method)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e, ok := err.(*s3Error)
+	if !ok {
+		e = errorf(http.StatusInternalServerError, "InternalError", "%v", err)
+	}
+	w.WriteHeader(e.status)
+	if r.Method != http.MethodHead {
+		writeXMLBody(w, struct {
+			XMLName xml.Name `xml:"Error"`
+			Code    string
+			Message string
+		}{Code: e.Code, Message: e.Message})
+	}
+}
+
+func writeXML(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/xml")
+	writeXMLBody(w, v)
+	return nil
+}
+
+func writeXMLBody(w io.Writer, v any) {
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) bucket(name string) (map[string]*Object, error) {
+	b, ok := s.buckets[name]
+	if !ok {
+		return nil, errNoSuchBucket
+	}
+	return b, nil
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, name string, q url.Values) error {
+	switch {
+	case r.Method == http.MethodPut:
+		s.CreateBucket(name)
+		return nil
+	case r.Method == http.MethodPost && q.Has("delete"):
+		return s.deleteObjects(w, r, name)
+	case r.Method == http.MethodGet && q.Has("uploads"):
+		return s.listUploads(w, name)
+	case r.Method == http.MethodGet:
+		return s.listObjects(w, name, q)
+	case r.Method == http.MethodHead:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, err := s.bucket(name)
+		return err
+	}
+	return errorf(http.StatusMethodNotAllowed, "MethodNotAllowed", "%s is not supported on buckets", r.Method)
+}
+
+// objectHeaders returns the stored headers of a new object from the
+// request.
+func objectHeaders(h http.Header) *Object {
+	o := &Object{
+		ContentType:     h.Get("Content-Type"),
+		ContentEncoding: h.Get("Content-Encoding"),
+		CacheControl:    h.Get("Cache-Control"),
+	}
+	for name, values := range h {
+		if meta, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok {
+			if o.Metadata == nil {
+				o.Metadata = map[string]string{}
+			}
+			o.Metadata[meta] = values[0]
+		}
+	}
+	if tagging := h.Get("X-Amz-Tagging"); tagging != "" {
+		if values, err := url.ParseQuery(tagging); err == nil {
+			o.Tags = map[string]string{}
+			for k, v := range values {
+				o.Tags[k] = v[0]
+			}
+		}
+	}
+	return o
+}
+
+// readBody reads the request body, checking Content-MD5 when sent.
+func readBody(r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if want := r.Header.Get("Content-MD5"); want != "" {
+		sum := md5.Sum(data)
+		if base64.StdEncoding.EncodeToString(sum[:]) != want {
+			return nil, errorf(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what was received.")
+		}
+	}
+	return data, nil
+}
+
+// checkWrite applies the If-Match and If-None-Match conditions of a write
+// to the current object, which may be nil.
+func checkWrite(r *http.Request, cur *Object) error {
+	if m := r.Header.Get("If-None-Match"); m == "*" && cur != nil {
+		return errPrecondition
+	}
+	if m := r.Header.Get("If-Match"); m != "" && (cur == nil || !etagMatches(m, cur.ETag)) {
+		return errPrecondition
+	}
+	return nil
+}
+
+func etagMatches(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.Trim(v, `"`) == strings.Trim(etag, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	data, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	if err := checkWrite(r, b[key]); err != nil {
+		return err
+	}
+	o := objectHeaders(r.Header)
+	o.Data, o.ETag, o.LastModified = data, etagOf(data), time.Now().UTC()
+	b[key] = o
+	w.Header().Set("ETag", o.ETag)
+	return nil
+}
+
+// parseRange parses a single-range Range header against size.
+func parseRange(h string, size int64) (start, end int64, err error) {
+	spec, ok := strings.CutPrefix(h, "bytes=")
+	first, last, ok2 := strings.Cut(spec, "-")
+	if !ok || !ok2 || strings.Contains(spec, ",") {
+		return 0, 0, errorf(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "unsupported range %q", h)
+	}
+	invalid := errorf(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, invalid
+		}
+		return max(size-n, 0), size - 1, nil
+	}
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, invalid
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, invalid
+		}
+		end = min(end, size-1)
+	}
+	return start, end, nil
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	s.mu.Lock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	cur, ok := b[key]
+	if !ok {
+		s.mu.Unlock()
+		return errNoSuchKey
+	}
+	o := cur.clone()
+	s.mu.Unlock()
+
+	if m := r.Header.Get("If-Match"); m != "" && !etagMatches(m, o.ETag) {
+		return errPrecondition
+	}
+	h := w.Header()
+	h.Set("ETag", o.ETag)
+	h.Set("Last-Modified", o.LastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	if m := r.Header.Get("If-None-Match"); m != "" && etagMatches(m, o.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	for k, v := range map[string]string{"Content-Type": o.ContentType, "Content-Encoding": o.ContentEncoding, "Cache-Control": o.CacheControl} {
+		if v != "" {
+			h.Set(k, v)
+		}
+	}
+	if o.ContentType == "" {
+		h.Set("Content-Type", "binary/octet-stream")
+	}
+	for k, v := range o.Metadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+	if len(o.Tags) > 0 {
+		h.Set("X-Amz-Tagging-Count", strconv.Itoa(len(o.Tags)))
+	}
+	data, status := o.Data, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" && len(o.Data) > 0 {
+		start, end, err := parseRange(rng, int64(len(o.Data)))
+		if err != nil {
+			return err
+		}
+		data, status = o.Data[start:end+1], http.StatusPartialContent
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(o.Data)))
+	}
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+	return nil
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	delete(b, key)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var req struct {
+		Quiet  bool
+		Object []struct{ Key string }
+	}
+	data, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return errorf(http.StatusBadRequest, "MalformedXML", "%v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	type deleted struct{ Key string }
+	var res struct {
+		XMLName xml.Name  `xml:"DeleteResult"`
+		Deleted []deleted `xml:"Deleted"`
+	}
+	for _, o := range req.Object {
+		delete(b, o.Key)
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deleted{o.Key})
+		}
+	}
+	return writeXML(w, res)
+}
+
+type listEntry struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct{ Prefix string }
+
+func (s *Server) listObjects(w http.ResponseWriter, name string, q url.Values) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bucket(name)
+	if err != nil {
+		return err
+	}
+	v2 := q.Get("list-type") == "2"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	maxKeys := 1000
+	if n, err := strconv.Atoi(q.Get("max-keys")); err == nil && n >= 0 {
+		maxKeys = min(n, 1000)
+	}
+	after := q.Get("marker")
+	if v2 {
+		after = max(q.Get("start-after"), q.Get("continuation-token"))
+	}
+
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var contents []listEntry
+	var prefixes []commonPrefix
+	seen := map[string]bool{}
+	truncated, last := false, ""
+	for _, k := range keys {
+		p := ""
+		if i := strings.Index(k[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			p = k[:len(prefix)+i+len(delimiter)]
+		}
+		if seen[p] {
+			continue
+		}
+		if len(contents)+len(prefixes) == maxKeys {
+			truncated = true
+			break
+		}
+		if p != "" {
+			seen[p] = true
+			prefixes = append(prefixes, commonPrefix{p})
+			// The next page starts after every key under p.
+			last = p + "\U0010FFFF"
+			continue
+		}
+		o := b[k]
+		contents = append(contents, listEntry{k, o.LastModified.Format(time.RFC3339), o.ETag, int64(len(o.Data)), "STANDARD"})
+		last = k
+	}
+
+	res := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		Delimiter             string `xml:",omitempty"`
+		MaxKeys               int
+		KeyCount              int `xml:",omitempty"`
+		IsTruncated           bool
+		Marker                string `xml:",omitempty"`
+		NextMarker            string `xml:",omitempty"`
+		ContinuationToken     string `xml:",omitempty"`
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []listEntry
+		CommonPrefixes        []commonPrefix
+	}{Name: name, Prefix: prefix, Delimiter: delimiter, MaxKeys: maxKeys, IsTruncated: truncated, Contents: contents, CommonPrefixes: prefixes}
+	if v2 {
+		res.KeyCount = len(contents) + len(prefixes)
+		res.ContinuationToken = q.Get("continuation-token")
+		if truncated {
+			res.NextContinuationToken = last
+		}
+	} else {
+		res.Marker = q.Get("marker")
+		if truncated {
+			res.NextMarker = last
+		}
+	}
+	return writeXML(w, res)
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	src, err := s.copySource(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	if err := checkWrite(r, b[key]); err != nil {
+		return err
+	}
+	o := src
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		o = *objectHeaders(r.Header)
+		o.Data, o.Tags = src.Data, src.Tags
+	}
+	if r.Header.Get("X-Amz-Tagging-Directive") == "REPLACE" {
+		o.Tags = objectHeaders(r.Header).Tags
+	}
+	o.ETag, o.LastModified = etagOf(o.Data), time.Now().UTC()
+	b[key] = &o
+	return writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: o.ETag, LastModified: o.LastModified.Format(time.RFC3339)})
+}
+
+// copySource returns a copy of the object named by X-Amz-Copy-Source,
+// checking its copy conditions.
+func (s *Server) copySource(r *http.Request) (Object, error) {
+	name, err := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+	if err != nil {
+		return Object{}, errorf(http.StatusBadRequest, "InvalidArgument", "bad copy source: %v", err)
+	}
+	bucket, key, _ := strings.Cut(name, "/")
+	key, _, _ = strings.Cut(key, "?versionId=")
+	s.mu.Lock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		s.mu.Unlock()
+		return Object{}, err
+	}
+	o, ok := b[key]
+	if !ok {
+		s.mu.Unlock()
+		return Object{}, errNoSuchKey
+	}
+	src := o.clone()
+	s.mu.Unlock()
+	if m := r.Header.Get("X-Amz-Copy-Source-If-Match"); m != "" && !etagMatches(m, src.ETag) {
+		return Object{}, errPrecondition
+	}
+	if rng := r.Header.Get("X-Amz-Copy-Source-Range"); rng != "" {
+		start, end, err := parseRange(rng, int64(len(src.Data)))
+		if err != nil {
+			return Object{}, err
+		}
+		src.Data = src.Data[start : end+1]
+	}
+	return src, nil
+}
+
+func (s *Server) serveTagging(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	type tag struct{ Key, Value string }
+	type tagging struct {
+		XMLName xml.Name `xml:"Tagging"`
+		TagSet  []tag    `xml:"TagSet>Tag"`
+	}
+	var req tagging
+	if r.Method == http.MethodPut {
+		data, err := readBody(r)
+		if err != nil {
+			return err
+		}
+		if err := xml.Unmarshal(data, &req); err != nil {
+			return errorf(http.StatusBadRequest, "MalformedXML", "%v", err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	o, ok := b[key]
+	if !ok {
+		return errNoSuchKey
+	}
+	switch r.Method {
+	case http.MethodPut:
+		o.Tags = map[string]string{}
+		for _, t := range req.TagSet {
+			o.Tags[t.Key] = t.Value
+		}
+		return nil
+	case http.MethodDelete:
+		o.Tags = nil
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var res tagging
+	for k, v := range o.Tags {
+		res.TagSet = append(res.TagSet, tag{k, v})
+	}
+	sort.Slice(res.TagSet, func(i, j int) bool { return res.TagSet[i].Key < res.TagSet[j].Key })
+	return writeXML(w, res)
+}
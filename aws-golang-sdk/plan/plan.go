@@ -0,0 +1,286 @@
+// Package plan describes a multipart upload's part layout and checksums in
+// a file computed before any data is sent. Separate processes or machines
+// holding the same file can then each upload a disjoint range of parts to
+// the same UploadId, and any of them can complete it.
+package plan
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Plan is an upload checkpoint whose parts, with their MD5s, are all
+// computed before the upload starts. Plan files use the checkpoint format,
+// so files written by older versions are migrated when read.
+type Plan struct {
+	checkpoint.Checkpoint
+}
+
+// Part is one planned part.
+type Part = checkpoint.Part
+
+// New computes a plan for the file at path, hashing parts in parallel.
+func New(ctx context.Context, path, bucket, key string, partSize int64, concurrency int) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size, err := utils.FileSize(f)
+	if err != nil {
+		return nil, err
+	}
+	if partSize <= 0 {
+		partSize = utils.DefaultPartSize
+	}
+
+	layout := utils.PlanParts(size, partSize)
+	p := &Plan{checkpoint.Checkpoint{
+		Bucket:   bucket,
+		Key:      key,
+		File:     checkpoint.Fingerprint{Path: path, Size: size, ModTime: info.ModTime().UTC()},
+		PartSize: partSize,
+		Parts:    make([]Part, len(layout)),
+	}}
+	errs := make([]error, len(layout))
+	utils.ForEach(ctx, len(layout), concurrency, func(i int) {
+		l := layout[i]
+		h := md5.New()
+		if _, err := io.Copy(h, io.NewSectionReader(f, l.Offset, l.Size)); err != nil {
+			errs[i] = fmt.Errorf("hash part %d: %w", l.Number, err)
+			return
+		}
+		p.Parts[i] = Part{Number: l.Number, Offset: l.Offset, Size: l.Size, MD5: base64.StdEncoding.EncodeToString(h.Sum(nil))}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, ctx.Err()
+}
+
+// Read loads a plan file, decrypting it with key if it is encrypted.
+func Read(path string, key *checkpoint.Key) (*Plan, error) {
+	c, err := checkpoint.Read(path, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{*c}, nil
+}
+
+// CheckFile verifies that the file at path still matches the plan's size
+// and modification time, so a host does not upload parts of a different
+// copy. Content differences are caught by Content-MD5 during upload.
+func (p *Plan) CheckFile(path string) error {
+	return p.File.Check(path)
+}
+
+// Create starts the multipart upload and records its UploadId in the plan.
+func (p *Plan) Create(ctx context.Context, svc s3iface.S3API) error {
+	if p.UploadID != "" {
+		return fmt.Errorf("plan already has upload %s", p.UploadID)
+	}
+	out, err := svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("create multipart upload: %w", err)
+	}
+	p.UploadID = aws.StringValue(out.UploadId)
+	return nil
+}
+
+// Upload sends the parts listed in numbers (every part if numbers is
+// empty), reading them from the file at path. report, if not nil, is
+// called as each part finishes, with the part's ETag set on success, and
+// may be called concurrently. The plan itself is not modified; record
+// ETags through a checkpoint.Saver to persist progress.
+func (p *Plan) Upload(ctx context.Context, svc s3iface.S3API, path string, numbers []int64, opts utils.UploadOptions, report func(Part, error)) error {
+	if p.UploadID == "" {
+		return errors.New("plan has no upload ID; create the upload first")
+	}
+	if err := p.CheckFile(path); err != nil {
+		return err
+	}
+	parts, err := p.Select(numbers)
+	if err != nil {
+		return err
+	}
+	order, err := utils.UploadOrder(len(parts), func(i int) int64 { return parts[i].Size }, opts.PartOrder)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	uploader := utils.NewPartUploader(svc, p.Bucket, p.Key, p.UploadID, opts)
+	errs := make([]error, len(parts))
+	utils.ForEach(ctx, len(order), opts.Concurrency, func(j int) {
+		i := order[j]
+		pp := parts[i]
+		var done *s3.CompletedPart
+		sum := utils.PartChecksum{Algorithm: utils.ChecksumMD5, Value: pp.MD5}
+		done, errs[i] = uploader.Upload(ctx, utils.Part{Number: pp.Number, Offset: pp.Offset, Size: pp.Size}, f, sum)
+		if errs[i] == nil {
+			pp.ETag = strings.Trim(aws.StringValue(done.ETag), `"`)
+		}
+		if report != nil {
+			report(pp, errs[i])
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Select returns the planned parts with the given numbers, or every part
+// if numbers is empty.
+func (p *Plan) Select(numbers []int64) ([]Part, error) {
+	if len(numbers) == 0 {
+		return p.Parts, nil
+	}
+	parts := make([]Part, 0, len(numbers))
+	for _, n := range numbers {
+		if n < 1 || n > int64(len(p.Parts)) {
+			return nil, fmt.Errorf("part %d is outside the plan (1-%d)", n, len(p.Parts))
+		}
+		parts = append(parts, p.Parts[n-1])
+	}
+	return parts, nil
+}
+
+// Uploaded lists the parts the server holds for the plan's upload.
+func (p *Plan) Uploaded(ctx context.Context, svc s3iface.S3API) (map[int64]*s3.Part, error) {
+	uploaded := make(map[int64]*s3.Part)
+	err := svc.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(p.Bucket),
+		Key:      aws.String(p.Key),
+		UploadId: aws.String(p.UploadID),
+	}, func(page *s3.ListPartsOutput, _ bool) bool {
+		for _, part := range page.Parts {
+			uploaded[aws.Int64Value(part.PartNumber)] = part
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list parts: %w", err)
+	}
+	return uploaded, nil
+}
+
+// Missing returns the numbers of planned parts the server does not hold,
+// or holds with a size or ETag that contradicts the plan.
+func (p *Plan) Missing(uploaded map[int64]*s3.Part) []int64 {
+	var missing []int64
+	for _, pp := range p.Parts {
+		if verifyPart(pp, uploaded[pp.Number]) != nil {
+			missing = append(missing, pp.Number)
+		}
+	}
+	return missing
+}
+
+// Complete checks that every planned part has been uploaded intact, by
+// whichever host, and completes the upload with
+// utils.CompleteMultipartUpload.
+func (p *Plan) Complete(ctx context.Context, svc s3iface.S3API) (*s3.CompleteMultipartUploadOutput, error) {
+	uploaded, err := p.Uploaded(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	completed := make([]*s3.CompletedPart, len(p.Parts))
+	for i, pp := range p.Parts {
+		got := uploaded[pp.Number]
+		if err := verifyPart(pp, got); err != nil {
+			return nil, err
+		}
+		completed[i] = &s3.CompletedPart{ETag: got.ETag, PartNumber: aws.Int64(pp.Number)}
+	}
+	if err := utils.CheckCompletedParts(completed, len(p.Parts)); err != nil {
+		return nil, fmt.Errorf("plan %s: %w", p.UploadID, err)
+	}
+	return utils.CompleteMultipartUpload(ctx, svc, p.Bucket, p.Key, p.UploadID, completed, utils.UploadOptions{})
+}
+
+// Abort aborts the plan's upload.
+func (p *Plan) Abort(ctx context.Context, svc s3iface.S3API) error {
+	_, err := svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(p.Bucket),
+		Key:      aws.String(p.Key),
+		UploadId: aws.String(p.UploadID),
+	})
+	return err
+}
+
+func verifyPart(pp Part, got *s3.Part) error {
+	if got == nil {
+		return fmt.Errorf("part %d has not been uploaded", pp.Number)
+	}
+	if size := aws.Int64Value(got.Size); size != pp.Size {
+		return fmt.Errorf("part %d is %d bytes, plan expects %d", pp.Number, size, pp.Size)
+	}
+	sum, err := base64.StdEncoding.DecodeString(pp.MD5)
+	if err != nil {
+		return fmt.Errorf("part %d: bad MD5 in plan: %w", pp.Number, err)
+	}
+	if etag := strings.Trim(aws.StringValue(got.ETag), `"`); etag != hex.EncodeToString(sum) {
+		return fmt.Errorf("part %d has ETag %s, plan expects %x", pp.Number, etag, sum)
+	}
+	return nil
+}
+
+// ParseRanges parses part numbers such as "1-100,150,200-250" into a
+// sorted, de-duplicated list.
+func ParseRanges(s string) ([]int64, error) {
+	seen := make(map[int64]bool)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(field, "-")
+		first, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid part range %q", field)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.ParseInt(hi, 10, 64); err != nil || last < first {
+				return nil, fmt.Errorf("invalid part range %q", field)
+			}
+		}
+		for n := first; n <= last; n++ {
+			seen[n] = true
+		}
+	}
+	numbers := make([]int64, 0, len(seen))
+	for n := range seen {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, nil
+}
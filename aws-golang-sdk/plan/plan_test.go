@@ -0,0 +1,115 @@
+package plan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestUploadFromTwoHosts(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	path := objectslitetest.TempFile(t, 5<<20+100)
+	p, err := New(ctx, path, "b", "k", 1<<20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Create(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	// The second host reads the plan, upload ID included, from the file
+	// the first one wrote.
+	planPath := filepath.Join(t.TempDir(), "upload.plan")
+	if err := p.Write(planPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	other, err := Read(planPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := utils.UploadOptions{Concurrency: 2}
+
+	if err := p.Upload(ctx, client, path, []int64{1, 2, 3}, opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	uploaded, err := p.Uploaded(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := other.Missing(uploaded); !slices.Equal(missing, []int64{4, 5, 6}) {
+		t.Fatalf("missing parts %v, want [4 5 6]", missing)
+	}
+	if _, err := other.Complete(ctx, client); err == nil {
+		t.Fatal("completed an upload with parts missing")
+	}
+
+	if err := other.Upload(ctx, client, path, []int64{4, 5, 6}, opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Complete(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	objectslitetest.AssertObjectMatchesFile(t, srv, "b", "k", path)
+}
+
+func TestUploadRejectsChangedFile(t *testing.T) {
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	client := srv.Client(t)
+	path := objectslitetest.TempFile(t, 3<<20)
+	p, err := New(ctx, path, "b", "k", 1<<20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Create(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Upload(ctx, client, path, nil, utils.UploadOptions{}, nil); err == nil {
+		t.Fatal("uploaded parts of a file modified since it was planned")
+	}
+	if err := p.Abort(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Uploads(); n != 0 {
+		t.Fatalf("%d multipart uploads left open", n)
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int64
+		wantErr bool
+	}{
+		{in: "3", want: []int64{3}},
+		{in: "1-3,5", want: []int64{1, 2, 3, 5}},
+		{in: " 4-5 , 1,5,,", want: []int64{1, 4, 5}},
+		{in: "", want: []int64{}},
+		{in: "3-1", wantErr: true},
+		{in: "a", wantErr: true},
+		{in: "1-b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRanges(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRanges(%q) error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("ParseRanges(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package prism
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ObjectStore is an Objectslite instance managed by Prism Central.
+type ObjectStore struct {
+	ExtID string `json:"extId"`
+	Name  string `json:"name"`
+}
+
+// Bucket is the Prism view of a bucket, including capacity accounting
+// that S3 does not expose.
+type Bucket struct {
+	Name string `json:"name"`
+	// QuotaBytes is the hard quota; zero means unlimited.
+	QuotaBytes        int64 `json:"quotaBytes,omitempty"`
+	UsedBytes         int64 `json:"usedBytes,omitempty"`
+	ObjectCount       int64 `json:"objectCount,omitempty"`
+	VersioningEnabled bool  `json:"isVersioningEnabled,omitempty"`
+}
+
+// QuotaUsed returns the fraction of the quota consumed, or zero when the
+// bucket has no quota.
+func (b *Bucket) QuotaUsed() float64 {
+	if b.QuotaBytes <= 0 {
+		return 0
+	}
+	return float64(b.UsedBytes) / float64(b.QuotaBytes)
+}
+
+// ListObjectStores returns the object stores registered with Prism.
+func (c *Client) ListObjectStores(ctx context.Context) ([]ObjectStore, error) {
+	var stores []ObjectStore
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: ObjectsAPI + "/config/object-stores"}, &stores); err != nil {
+		return nil, fmt.Errorf("list object stores: %w", err)
+	}
+	return stores, nil
+}
+
+// ResolveObjectStore returns id if set, otherwise the ID of the only
+// object store Prism manages.
+func (c *Client) ResolveObjectStore(ctx context.Context, id string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	stores, err := c.ListObjectStores(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(stores) != 1 {
+		return "", fmt.Errorf("found %d object stores, select one by ID", len(stores))
+	}
+	return stores[0].ExtID, nil
+}
+
+// GetBucket returns the Prism view of a bucket.
+func (c *Client) GetBucket(ctx context.Context, storeID, name string) (*Bucket, error) {
+	b, _, err := c.getBucket(ctx, storeID, name)
+	return b, err
+}
+
+func (c *Client) getBucket(ctx context.Context, storeID, name string) (*Bucket, string, error) {
+	var b Bucket
+	etag, err := c.do(ctx, request{method: http.MethodGet, path: bucketPath(storeID, name)}, &b)
+	if err != nil {
+		return nil, "", fmt.Errorf("get bucket %s: %w", name, err)
+	}
+	return &b, etag, nil
+}
+
+// BucketSpec is the configurable part of a bucket.
+type BucketSpec struct {
+	Name              string `json:"name"`
+	QuotaBytes        int64  `json:"quotaBytes,omitempty"`
+	VersioningEnabled bool   `json:"isVersioningEnabled"`
+}
+
+// CreateBucket creates a bucket and waits for the creation task.
+func (c *Client) CreateBucket(ctx context.Context, storeID string, spec BucketSpec) error {
+	var ref TaskReference
+	_, err := c.do(ctx, request{method: http.MethodPost, path: bucketsPath(storeID), body: spec}, &ref)
+	if err != nil {
+		return fmt.Errorf("create bucket %s: %w", spec.Name, err)
+	}
+	return c.WaitForTask(ctx, ref, taskPollInterval)
+}
+
+// UpdateBucket replaces the configuration of an existing bucket and waits
+// for the update task.
+func (c *Client) UpdateBucket(ctx context.Context, storeID string, spec BucketSpec) error {
+	_, etag, err := c.getBucket(ctx, storeID, spec.Name)
+	if err != nil {
+		return err
+	}
+	var ref TaskReference
+	_, err = c.do(ctx, request{method: http.MethodPut, path: bucketPath(storeID, spec.Name), body: spec, ifMatch: etag}, &ref)
+	if err != nil {
+		return fmt.Errorf("update bucket %s: %w", spec.Name, err)
+	}
+	return c.WaitForTask(ctx, ref, taskPollInterval)
+}
+
+const taskPollInterval = 2 * time.Second
+
+func bucketsPath(storeID string) string {
+	return ObjectsAPI + "/config/object-stores/" + url.PathEscape(storeID) + "/buckets"
+}
+
+func bucketPath(storeID, name string) string {
+	return bucketsPath(storeID) + "/" + url.PathEscape(name)
+}
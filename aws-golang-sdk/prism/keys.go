@@ -0,0 +1,90 @@
+package prism
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IAMAPI is the v4 identity and access management API root.
+const IAMAPI = "/api/iam/v4.0"
+
+// KeyTypeObject marks access keys valid for the Objectslite S3 API.
+const KeyTypeObject = "OBJECT_KEY"
+
+// User is a Prism IAM user.
+type User struct {
+	ExtID    string `json:"extId"`
+	Username string `json:"username"`
+}
+
+// AccessKey is an S3 access key pair issued to a Prism user. The secret
+// is only returned when the key is created.
+type AccessKey struct {
+	ExtID           string    `json:"extId,omitempty"`
+	Name            string    `json:"name"`
+	KeyType         string    `json:"keyType"`
+	Status          string    `json:"status,omitempty"`
+	ExpiryTime      time.Time `json:"expiryTime,omitzero"`
+	CreatedTime     time.Time `json:"createdTime,omitzero"`
+	AccessKeyID     string    `json:"accessKeyId,omitempty"`
+	SecretAccessKey string    `json:"secretAccessKey,omitempty"`
+}
+
+// FindUser returns the IAM user with the given username. Quotes in the
+// username are escaped, so it cannot change the filter.
+func (c *Client) FindUser(ctx context.Context, username string) (*User, error) {
+	q := url.Values{"$filter": {fmt.Sprintf("username eq '%s'", strings.ReplaceAll(username, "'", "''"))}}
+	var users []User
+	_, err := c.do(ctx, request{method: http.MethodGet, path: IAMAPI + "/authn/users?" + q.Encode()}, &users)
+	if err != nil {
+		return nil, fmt.Errorf("find user %s: %w", username, err)
+	}
+	if len(users) == 0 {
+		return nil, &Error{StatusCode: http.StatusNotFound, Messages: []string{"no user named " + username}}
+	}
+	return &users[0], nil
+}
+
+// ListAccessKeys returns the object access keys of a user.
+func (c *Client) ListAccessKeys(ctx context.Context, userID string) ([]AccessKey, error) {
+	q := url.Values{"$filter": {"keyType eq '" + KeyTypeObject + "'"}}
+	var keys []AccessKey
+	_, err := c.do(ctx, request{method: http.MethodGet, path: keysPath(userID) + "?" + q.Encode()}, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("list access keys: %w", err)
+	}
+	return keys, nil
+}
+
+// CreateAccessKey issues a new object access key for a user. A zero ttl
+// creates a key that does not expire. The returned key carries the secret,
+// which Prism will not reveal again.
+func (c *Client) CreateAccessKey(ctx context.Context, userID, name string, ttl time.Duration) (*AccessKey, error) {
+	spec := AccessKey{Name: name, KeyType: KeyTypeObject}
+	if ttl > 0 {
+		spec.ExpiryTime = time.Now().Add(ttl).UTC()
+	}
+	var key AccessKey
+	_, err := c.do(ctx, request{method: http.MethodPost, path: keysPath(userID), body: spec}, &key)
+	if err != nil {
+		return nil, fmt.Errorf("create access key %s: %w", name, err)
+	}
+	return &key, nil
+}
+
+// RevokeAccessKey revokes a key; requests signed with it fail afterwards.
+func (c *Client) RevokeAccessKey(ctx context.Context, userID, keyID string) error {
+	path := keysPath(userID) + "/" + url.PathEscape(keyID) + "/$actions/revoke"
+	if _, err := c.do(ctx, request{method: http.MethodPost, path: path}, nil); err != nil {
+		return fmt.Errorf("revoke access key %s: %w", keyID, err)
+	}
+	return nil
+}
+
+func keysPath(userID string) string {
+	return IAMAPI + "/authn/users/" + url.PathEscape(userID) + "/keys"
+}
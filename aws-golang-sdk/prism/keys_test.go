@@ -0,0 +1,35 @@
+package prism
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFindUserFilter(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "username eq 'alice'"},
+		{"o'brien", "username eq 'o''brien'"},
+		{"x' or username ne '", "username eq 'x'' or username ne '''"},
+	}
+	for _, tt := range tests {
+		var got string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.URL.Query().Get("$filter")
+			w.Write([]byte(`{"data":[{"extId":"u1","username":"alice"}]}`))
+		}))
+		c := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+		_, err := c.FindUser(context.Background(), tt.username)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("FindUser(%q) sent $filter %q, want %q", tt.username, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package prism is a minimal client for the Prism Central v4 objects
+// REST API, used for the management operations S3 does not cover:
+// quotas, capacity and bucket provisioning.
+package prism
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// API roots on Prism Central.
+const (
+	ObjectsAPI = "/api/objects/v4.0"
+	PrismAPI   = "/api/prism/v4.0"
+)
+
+// Client talks to the Prism v4 REST APIs with basic authentication.
+type Client struct {
+	// BaseURL is the Prism Central address, e.g. https://10.0.0.10:9440.
+	BaseURL    string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+	// ReadOnly refuses every call but GETs with utils.ErrReadOnly.
+	ReadOnly bool
+}
+
+// NewClient returns a client for the Prism Central serving cfg.Endpoint,
+// reusing the same Prism credentials and TLS settings as the S3 client.
+// The Prism credentials must already be resolved (see
+// utils.Config.ResolvePrismCredentials).
+func NewClient(cfg *utils.Config) (*Client, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	u.Path, u.RawQuery = "", ""
+	// Prism calls go straight to Prism Central, never through the agent.
+	direct := *cfg
+	direct.Agent = ""
+	httpClient, err := direct.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		BaseURL:    u.String(),
+		Username:   cfg.Username,
+		Password:   cfg.Password,
+		HTTPClient: httpClient,
+		ReadOnly:   cfg.ReadOnly,
+	}, nil
+}
+
+// Error is a non-2xx response from Prism.
+type Error struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *Error) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("prism: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("prism: HTTP %d: %s", e.StatusCode, strings.Join(e.Messages, "; "))
+}
+
+// IsNotFound reports whether err is a Prism 404.
+func IsNotFound(err error) bool {
+	var perr *Error
+	return errors.As(err, &perr) && perr.StatusCode == http.StatusNotFound
+}
+
+// envelope is the v4 response wrapper; payloads live under "data".
+type envelope struct {
+	Data json.RawMessage `json:"data"`
+}
+
+type errorData struct {
+	Error []struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// request is one API call.
+type request struct {
+	method string
+	path   string
+	body   any
+	// ifMatch is sent as If-Match; v4 updates require the ETag of the
+	// entity being modified.
+	ifMatch string
+}
+
+// do sends a JSON request and decodes the "data" field of the response
+// into out, which may be nil. It returns the response ETag.
+func (c *Client) do(ctx context.Context, r request, out any) (string, error) {
+	if c.ReadOnly && r.method != http.MethodGet {
+		return "", fmt.Errorf("%s %s: %w", r.method, r.path, utils.ErrReadOnly)
+	}
+	var rd io.Reader
+	if r.body != nil {
+		b, err := json.Marshal(r.body)
+		if err != nil {
+			return "", err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, c.BaseURL+r.path, rd)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Accept", "application/json")
+	if r.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.method != http.MethodGet {
+		// Mutations must carry a unique request ID so Prism can
+		// deduplicate retries.
+		req.Header.Set("NTNX-Request-Id", newUUID())
+	}
+	if r.ifMatch != "" {
+		req.Header.Set("If-Match", r.ifMatch)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read %s %s: %w", r.method, r.path, err)
+	}
+
+	var env envelope
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &env); err != nil && resp.StatusCode/100 == 2 {
+			return "", fmt.Errorf("decode %s %s: %w", r.method, r.path, err)
+		}
+	}
+	if resp.StatusCode/100 != 2 {
+		perr := &Error{StatusCode: resp.StatusCode}
+		var ed errorData
+		if json.Unmarshal(env.Data, &ed) == nil {
+			for _, e := range ed.Error {
+				perr.Messages = append(perr.Messages, e.Message)
+			}
+		}
+		return "", perr
+	}
+	etag := resp.Header.Get("ETag")
+	if out == nil || len(env.Data) == 0 {
+		return etag, nil
+	}
+	return etag, json.Unmarshal(env.Data, out)
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,71 @@
+package prism
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TaskReference is returned by asynchronous v4 operations.
+type TaskReference struct {
+	ExtID string `json:"extId"`
+}
+
+// Task status values.
+const (
+	TaskQueued    = "QUEUED"
+	TaskRunning   = "RUNNING"
+	TaskSucceeded = "SUCCEEDED"
+	TaskFailed    = "FAILED"
+	TaskCanceled  = "CANCELED"
+)
+
+// Task is the state of an asynchronous operation.
+type Task struct {
+	ExtID              string `json:"extId"`
+	Status             string `json:"status"`
+	ProgressPercentage int    `json:"progressPercentage"`
+	ErrorMessages      []struct {
+		Message string `json:"message"`
+	} `json:"errorMessages"`
+}
+
+// GetTask returns the current state of a task.
+func (c *Client) GetTask(ctx context.Context, id string) (*Task, error) {
+	var t Task
+	_, err := c.do(ctx, request{method: http.MethodGet, path: PrismAPI + "/config/tasks/" + url.PathEscape(id)}, &t)
+	if err != nil {
+		return nil, fmt.Errorf("get task %s: %w", id, err)
+	}
+	return &t, nil
+}
+
+// WaitForTask polls a task until it finishes and returns an error unless
+// it succeeded.
+func (c *Client) WaitForTask(ctx context.Context, ref TaskReference, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t, err := c.GetTask(ctx, ref.ExtID)
+		if err != nil {
+			return err
+		}
+		switch t.Status {
+		case TaskSucceeded:
+			return nil
+		case TaskFailed, TaskCanceled:
+			msg := t.Status
+			if len(t.ErrorMessages) > 0 {
+				msg += ": " + t.ErrorMessages[0].Message
+			}
+			return fmt.Errorf("task %s %s", ref.ExtID, msg)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package rename moves every object under one prefix to another with
+// server-side copies, deleting each original only once its copy has been
+// verified.
+package rename
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Options configures a prefix rename.
+type Options struct {
+	Bucket    string
+	OldPrefix string
+	NewPrefix string
+	Copy      utils.CopyOptions
+	DryRun    bool
+	// Concurrency is the number of objects renamed in parallel; each
+	// multipart copy additionally uses Copy.Concurrency part copies.
+	Concurrency int
+}
+
+// Result is the outcome for one object.
+type Result struct {
+	Src  string
+	Dst  string
+	Size int64
+	// Resumed is set when the destination already held a verified copy
+	// from an earlier, interrupted run and only the delete was needed.
+	Resumed bool
+	Err     error
+}
+
+// Run renames every object under opts.OldPrefix. Because originals are
+// only deleted after their copy is verified, an interrupted run is resumed
+// by running it again: already-copied objects are detected and skipped.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options, report func(Result)) error {
+	if opts.OldPrefix == opts.NewPrefix ||
+		strings.HasPrefix(opts.NewPrefix, opts.OldPrefix) ||
+		strings.HasPrefix(opts.OldPrefix, opts.NewPrefix) {
+		return errors.New("old and new prefixes must not overlap")
+	}
+
+	var objects []*s3.Object
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.Bucket),
+		Prefix: aws.String(opts.OldPrefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		objects = append(objects, page.Contents...)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("list s3://%s/%s: %w", opts.Bucket, opts.OldPrefix, err)
+	}
+
+	utils.ForEach(ctx, len(objects), opts.Concurrency, func(i int) {
+		src := aws.StringValue(objects[i].Key)
+		r := Result{
+			Src:  src,
+			Dst:  opts.NewPrefix + strings.TrimPrefix(src, opts.OldPrefix),
+			Size: aws.Int64Value(objects[i].Size),
+		}
+		if !opts.DryRun {
+			r.Resumed, r.Err = move(ctx, svc, opts, r.Src, r.Dst)
+		}
+		report(r)
+	})
+	return ctx.Err()
+}
+
+func move(ctx context.Context, svc s3iface.S3API, opts Options, src, dst string) (resumed bool, err error) {
+	srcHead, err := head(ctx, svc, opts.Bucket, src)
+	if err != nil {
+		return false, fmt.Errorf("head source: %w", err)
+	}
+
+	dstHead, err := head(ctx, svc, opts.Bucket, dst)
+	switch {
+	case err == nil && verify(srcHead, dstHead) == nil:
+		resumed = true
+	case err != nil && !utils.IsNotFound(err):
+		return false, fmt.Errorf("head destination: %w", err)
+	default:
+		if err := utils.ServerSideCopy(ctx, svc, opts.Bucket, src, opts.Bucket, dst, opts.Copy); err != nil {
+			return false, fmt.Errorf("copy: %w", err)
+		}
+		if dstHead, err = head(ctx, svc, opts.Bucket, dst); err != nil {
+			return false, fmt.Errorf("head copy: %w", err)
+		}
+		if err := verify(srcHead, dstHead); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(opts.Bucket),
+		Key:    aws.String(src),
+	})
+	if err != nil {
+		return resumed, fmt.Errorf("delete original: %w", err)
+	}
+	return resumed, nil
+}
+
+func head(ctx context.Context, svc s3iface.S3API, bucket, key string) (*s3.HeadObjectOutput, error) {
+	return svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+}
+
+// verify checks that dst is a faithful copy of src. A multipart copy gets
+// a new ETag, so ETags are only compared when both are single-part, and
+// the stored sha256 metadata is compared when present.
+func verify(src, dst *s3.HeadObjectOutput) error {
+	if s, d := aws.Int64Value(src.ContentLength), aws.Int64Value(dst.ContentLength); s != d {
+		return fmt.Errorf("verify: copy is %d bytes, original %d", d, s)
+	}
+	srcETag, dstETag := aws.StringValue(src.ETag), aws.StringValue(dst.ETag)
+	if !strings.Contains(srcETag, "-") && !strings.Contains(dstETag, "-") && srcETag != dstETag {
+		return fmt.Errorf("verify: copy ETag %s differs from original %s", dstETag, srcETag)
+	}
+	srcSum := utils.MetadataValue(src.Metadata, utils.MetaSHA256)
+	if dstSum := utils.MetadataValue(dst.Metadata, utils.MetaSHA256); srcSum != dstSum {
+		return fmt.Errorf("verify: copy sha256 %q differs from original %q", dstSum, srcSum)
+	}
+	return nil
+}
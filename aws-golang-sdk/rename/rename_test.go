@@ -0,0 +1,87 @@
+package rename
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestRun(t *testing.T) {
+	data := objectslitetest.Data(3 << 20)
+	tests := []struct {
+		name        string
+		copy        utils.CopyOptions
+		copied      bool // new/a already holds a copy from an interrupted run
+		failCopy    bool
+		wantFailed  int
+		wantKeys    []string
+		wantResumed []string
+	}{
+		{name: "single copy", wantKeys: []string{"new/a", "new/sub/b", "other"}},
+		{name: "multipart copy", copy: utils.CopyOptions{Threshold: 1 << 20, PartSize: 1 << 20},
+			wantKeys: []string{"new/a", "new/sub/b", "other"}},
+		{name: "resumed", copied: true, wantKeys: []string{"new/a", "new/sub/b", "other"}, wantResumed: []string{"old/a"}},
+		{name: "failed copy keeps the original", failCopy: true, wantFailed: 2, wantKeys: []string{"old/a", "old/sub/b", "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			for _, key := range []string{"old/a", "old/sub/b", "other"} {
+				srv.PutObject("b", key, data)
+			}
+			if tt.copied {
+				srv.PutObject("b", "new/a", data)
+			}
+			if tt.failCopy {
+				srv.Fail = func(r *http.Request) bool { return r.Header.Get("X-Amz-Copy-Source") != "" }
+			}
+
+			var mu sync.Mutex
+			var resumed []string
+			failed := 0
+			err := Run(context.Background(), srv.Client(t), Options{Bucket: "b", OldPrefix: "old/", NewPrefix: "new/", Copy: tt.copy, Concurrency: 2}, func(r Result) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.Err != nil {
+					failed++
+				}
+				if r.Resumed {
+					resumed = append(resumed, r.Src)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if failed != tt.wantFailed {
+				t.Fatalf("%d objects failed, want %d", failed, tt.wantFailed)
+			}
+			sort.Strings(resumed)
+			if len(resumed) != len(tt.wantResumed) || (len(resumed) > 0 && resumed[0] != tt.wantResumed[0]) {
+				t.Fatalf("resumed %v, want %v", resumed, tt.wantResumed)
+			}
+			objectslitetest.AssertKeys(t, srv, "b", tt.wantKeys...)
+			for _, key := range tt.wantKeys {
+				objectslitetest.AssertObject(t, srv, "b", key, data)
+			}
+			if n := srv.Uploads(); n != 0 {
+				t.Fatalf("%d multipart uploads left open", n)
+			}
+		})
+	}
+}
+
+func TestRunRejectsOverlappingPrefixes(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	for _, prefixes := range [][2]string{{"a/", "a/"}, {"a/", "a/b/"}, {"a/b/", "a/"}} {
+		err := Run(context.Background(), srv.Client(t), Options{Bucket: "b", OldPrefix: prefixes[0], NewPrefix: prefixes[1]}, func(Result) {})
+		if err == nil {
+			t.Errorf("renaming %q to %q was accepted", prefixes[0], prefixes[1])
+		}
+	}
+}
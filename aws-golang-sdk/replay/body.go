@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// block is repeated to make the bodies of replayed writes. It is random
+// so that an endpoint that compresses or deduplicates data does not make
+// the replay cheaper than the workload it reproduces.
+var block = func() []byte {
+	b := make([]byte, 1<<20)
+	rand.Read(b)
+	return b
+}()
+
+// body is an io.ReadSeeker of size bytes of block, repeated, so a replayed
+// 5 GiB part needs no 5 GiB buffer and can be re-read by SDK retries.
+type body struct {
+	size, off int64
+}
+
+func newBody(size int64) *body { return &body{size: size} }
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.off >= b.size {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), b.size-b.off)]
+	n := 0
+	for n < len(p) {
+		n += copy(p[n:], block[(b.off+int64(n))%int64(len(block)):])
+	}
+	b.off += int64(n)
+	return n, nil
+}
+
+func (b *body) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.off
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, errors.New("replay: seek to a negative offset")
+	}
+	b.off = offset
+	return offset, nil
+}
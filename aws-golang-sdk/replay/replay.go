@@ -0,0 +1,402 @@
+// Package replay re-executes the operations recorded in an audit log (see
+// utils.WithAuditLog) against another endpoint or bucket, such as a
+// staging cluster, to reproduce a performance problem with the request mix
+// and timing that caused it, or to carry a workflow over to a new bucket.
+//
+// The log records what was done, not the data: a replayed PutObject or
+// UploadPart sends a generated body of the recorded size, and a
+// CopyObject copies the replayed source, which must exist on the target.
+package replay
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DefaultConcurrency is the number of operations in flight when
+// Options.Concurrency is zero.
+const DefaultConcurrency = 16
+
+// Operations that Replay re-executes; other entries are skipped.
+var replayed = map[string]bool{
+	"PutObject":               true,
+	"CopyObject":              true,
+	"DeleteObject":            true,
+	"DeleteObjects":           true,
+	"CreateMultipartUpload":   true,
+	"UploadPart":              true,
+	"CompleteMultipartUpload": true,
+	"AbortMultipartUpload":    true,
+}
+
+// Options configures Replay.
+type Options struct {
+	// Bucket replaces the bucket of every operation, and of copy sources;
+	// empty keeps the recorded buckets.
+	Bucket string
+	// Prefix is prepended to every key, so a replay can share a bucket
+	// with other data and be cleaned up afterwards.
+	Prefix string
+	// Speed scales the recorded timing: 1 starts each operation as long
+	// after the first as it was recorded, 2 twice as fast. Zero ignores
+	// the timing and runs operations back to back, Concurrency at a time.
+	Speed float64
+	// Concurrency caps the operations in flight.
+	Concurrency int
+	// Failed also replays operations that failed when recorded.
+	Failed bool
+	// Ops, if not empty, limits the replay to these operation names.
+	Ops []string
+	// DryRun logs each operation instead of sending it.
+	DryRun bool
+	Logger *slog.Logger
+}
+
+// OpStats counts the replayed operations of one kind.
+type OpStats struct {
+	Ops    int   `json:"ops"`
+	Errors int   `json:"errors"`
+	Bytes  int64 `json:"bytes"`
+	// Total is the time spent in the operations, and Max the longest.
+	Total time.Duration `json:"total_ns"`
+	Max   time.Duration `json:"max_ns"`
+	// Recorded is the time the same operations took when recorded.
+	Recorded time.Duration `json:"recorded_ns"`
+}
+
+// Result is the outcome of Replay.
+type Result struct {
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// Recorded is the span of the log, from the start of its first
+	// operation to the end of its last.
+	Recorded time.Duration      `json:"recorded_ns"`
+	Ops      map[string]OpStats `json:"ops"`
+	// Skipped counts the entries not replayed, by operation; multipart
+	// operations whose upload was not created in the log, or failed to be
+	// created on replay, are counted under their own name.
+	Skipped map[string]int `json:"skipped,omitempty"`
+	// Late counts the operations started more than a second after their
+	// scaled time because Concurrency was reached: the target kept up
+	// less well than the recorded endpoint.
+	Late int `json:"late,omitempty"`
+	// FirstError is kept so a failing replay can be diagnosed.
+	FirstError string `json:"first_error,omitempty"`
+}
+
+// ReadLog reads the entries of an audit log, in the order they were
+// written. Blank lines are ignored.
+func ReadLog(r io.Reader) ([]utils.AuditEntry, error) {
+	var entries []utils.AuditEntry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var e utils.AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// upload is a multipart upload created by the replay. Its parts wait for
+// created; its completion or abort waits for the parts before it.
+type upload struct {
+	created chan struct{}
+	id      string
+	parts   sync.WaitGroup
+
+	mu    sync.Mutex
+	etags map[int64]string
+}
+
+type replayer struct {
+	svc  s3iface.S3API
+	opts Options
+
+	mu     sync.Mutex
+	result Result
+}
+
+// Replay re-executes entries against svc. Entries are started in the
+// order they started when recorded, which their time and duration give;
+// with opts.Speed set, at the recorded offsets. A multipart upload's
+// parts run once the replayed CreateMultipartUpload has returned its new
+// upload ID, and its completion once they are done, with the ETags of the
+// replayed parts. Failed operations are counted rather than ending the
+// replay; only ctx ends it early, after the operations in flight finish.
+func Replay(ctx context.Context, svc s3iface.S3API, entries []utils.AuditEntry, opts Options) (*Result, error) {
+	if opts.Speed < 0 {
+		return nil, fmt.Errorf("replay speed %g is negative", opts.Speed)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	r := &replayer{svc: svc, opts: opts, result: Result{Ops: map[string]OpStats{}, Skipped: map[string]int{}}}
+
+	var todo []utils.AuditEntry
+	for _, e := range entries {
+		if !replayed[e.Operation] || (len(opts.Ops) > 0 && !slices.Contains(opts.Ops, e.Operation)) ||
+			(!opts.Failed && e.Result != "ok" && e.Result != "partial") {
+			r.result.Skipped[e.Operation]++
+			continue
+		}
+		todo = append(todo, e)
+	}
+	slices.SortStableFunc(todo, func(a, b utils.AuditEntry) int { return startTime(a).Compare(startTime(b)) })
+	if len(todo) > 0 {
+		var last time.Time
+		for _, e := range todo {
+			if e.Time.After(last) {
+				last = e.Time
+			}
+		}
+		r.result.Recorded = last.Sub(startTime(todo[0]))
+	}
+
+	// Operations run to completion after ctx is done, so no upload is left
+	// waiting for parts that were never started.
+	opCtx := context.WithoutCancel(ctx)
+	slots := make(chan struct{}, opts.Concurrency)
+	uploads := make(map[string]*upload)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, e := range todo {
+		var due time.Time
+		if opts.Speed > 0 {
+			due = start.Add(time.Duration(float64(startTime(e).Sub(startTime(todo[0]))) / opts.Speed))
+			if err := sleepUntil(ctx, due); err != nil {
+				break
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if !due.IsZero() && time.Since(due) > time.Second {
+			r.result.Late++
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Uploads are tracked here, in order, so that every part is
+		// counted before the completion that waits for it is started.
+		var u *upload
+		switch e.Operation {
+		case "CreateMultipartUpload":
+			u = &upload{created: make(chan struct{}), etags: map[int64]string{}}
+			uploads[e.UploadID] = u
+		case "UploadPart", "CompleteMultipartUpload", "AbortMultipartUpload":
+			if u = uploads[e.UploadID]; u == nil {
+				<-slots
+				r.skip(e.Operation)
+				continue
+			}
+			if e.Operation == "UploadPart" {
+				u.parts.Add(1)
+			} else {
+				delete(uploads, e.UploadID)
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.run(opCtx, e, u)
+		}()
+	}
+	wg.Wait()
+	r.result.Elapsed = time.Since(start)
+	return &r.result, ctx.Err()
+}
+
+// run replays one entry and records its outcome.
+func (r *replayer) run(ctx context.Context, e utils.AuditEntry, u *upload) {
+	if u != nil && e.Operation != "CreateMultipartUpload" {
+		if e.Operation == "UploadPart" {
+			defer u.parts.Done()
+		} else {
+			u.parts.Wait()
+		}
+		<-u.created
+		if u.id == "" {
+			r.skip(e.Operation)
+			return
+		}
+	}
+	bucket, key := r.target(e.Bucket, e.Key)
+	if r.opts.DryRun {
+		orDefault(r.opts.Logger).Info("replay", "op", e.Operation, "bucket", bucket, "key", key, "size", e.Size)
+		if u != nil && e.Operation == "CreateMultipartUpload" {
+			u.id = "dry-run"
+			close(u.created)
+		}
+		r.record(e, 0, nil)
+		return
+	}
+
+	start := time.Now()
+	var err error
+	switch e.Operation {
+	case "PutObject":
+		_, err = r.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			Body:          newBody(e.Size),
+			ContentLength: aws.Int64(e.Size),
+		})
+	case "CopyObject":
+		srcBucket, srcKey, ok := strings.Cut(e.CopySource, "/")
+		if !ok {
+			err = fmt.Errorf("copy source %q not recorded", e.CopySource)
+			break
+		}
+		srcBucket, srcKey = r.target(srcBucket, srcKey)
+		_, err = r.svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			CopySource: aws.String(srcBucket + "/" + srcKey),
+		})
+	case "DeleteObject":
+		_, err = r.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	case "DeleteObjects":
+		del := &s3.Delete{Quiet: aws.Bool(true)}
+		for _, k := range e.Keys {
+			_, k = r.target("", k)
+			del.Objects = append(del.Objects, &s3.ObjectIdentifier{Key: aws.String(k)})
+		}
+		var out *s3.DeleteObjectsOutput
+		out, err = r.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{Bucket: aws.String(bucket), Delete: del})
+		if err == nil && len(out.Errors) > 0 {
+			err = fmt.Errorf("%d of %d keys not deleted, first %s: %s", len(out.Errors), len(e.Keys),
+				aws.StringValue(out.Errors[0].Key), aws.StringValue(out.Errors[0].Code))
+		}
+	case "CreateMultipartUpload":
+		var out *s3.CreateMultipartUploadOutput
+		out, err = r.svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err == nil {
+			u.id = aws.StringValue(out.UploadId)
+		}
+		close(u.created)
+	case "UploadPart":
+		var out *s3.UploadPartOutput
+		out, err = r.svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			UploadId:      aws.String(u.id),
+			PartNumber:    aws.Int64(e.PartNumber),
+			Body:          newBody(e.Size),
+			ContentLength: aws.Int64(e.Size),
+		})
+		if err == nil {
+			u.mu.Lock()
+			u.etags[e.PartNumber] = aws.StringValue(out.ETag)
+			u.mu.Unlock()
+		}
+	case "CompleteMultipartUpload":
+		_, err = utils.CompleteMultipartUpload(ctx, r.svc, bucket, key, u.id, u.completedParts(), utils.UploadOptions{Logger: r.opts.Logger})
+	case "AbortMultipartUpload":
+		_, err = r.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(u.id),
+		})
+	}
+	if err != nil {
+		err = fmt.Errorf("%s %s/%s: %w", e.Operation, bucket, key, err)
+		orDefault(r.opts.Logger).Warn("replay failed", "op", e.Operation, "key", key, "err", err)
+	}
+	r.record(e, time.Since(start), err)
+}
+
+// completedParts lists the parts uploaded by the replay, in order.
+func (u *upload) completedParts() []*s3.CompletedPart {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	parts := make([]*s3.CompletedPart, 0, len(u.etags))
+	for n, etag := range u.etags {
+		parts = append(parts, &s3.CompletedPart{PartNumber: aws.Int64(n), ETag: aws.String(etag)})
+	}
+	slices.SortFunc(parts, func(a, b *s3.CompletedPart) int { return cmp.Compare(*a.PartNumber, *b.PartNumber) })
+	return parts
+}
+
+// target maps a recorded bucket and key to the ones replayed to.
+func (r *replayer) target(bucket, key string) (string, string) {
+	if r.opts.Bucket != "" {
+		bucket = r.opts.Bucket
+	}
+	return bucket, r.opts.Prefix + key
+}
+
+func (r *replayer) skip(op string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.result.Skipped[op]++
+}
+
+func (r *replayer) record(e utils.AuditEntry, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.result.Ops[e.Operation]
+	s.Ops++
+	s.Total += elapsed
+	s.Max = max(s.Max, elapsed)
+	s.Recorded += time.Duration(e.DurationMS) * time.Millisecond
+	if err != nil {
+		s.Errors++
+		if r.result.FirstError == "" {
+			r.result.FirstError = err.Error()
+		}
+	} else {
+		s.Bytes += e.Size
+	}
+	r.result.Ops[e.Operation] = s
+}
+
+// startTime is when a recorded operation started: entries are written,
+// and timed, when it ends.
+func startTime(e utils.AuditEntry) time.Time {
+	return e.Time.Add(-time.Duration(e.DurationMS) * time.Millisecond)
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func orDefault(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
@@ -0,0 +1,103 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// record runs a small workload against a fresh server and returns its
+// audit log.
+func record(t *testing.T) []utils.AuditEntry {
+	t.Helper()
+	ctx := context.Background()
+	srv := objectslitetest.NewServer(t)
+	srv.MinPartSize = 1
+	srv.CreateBucket("src")
+	srv.Fail = func(r *http.Request) bool { return strings.HasSuffix(r.URL.Path, "/refused") }
+	var log bytes.Buffer
+	client, err := utils.NewClient(srv.Config(), utils.WithAuditLog(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := utils.UploadOptions{MultipartThreshold: 2000, PartSize: 1000, Retry: utils.RetryPolicy{MaxAttempts: 1}}
+
+	for key, size := range map[string]int64{"small": 100, "large": 4500, "gone": 10} {
+		if _, err := utils.Upload(ctx, client, "src", key, objectslitetest.TempFile(t, size), upload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := utils.Upload(ctx, client, "src", "refused", objectslitetest.TempFile(t, 10), upload); err == nil {
+		t.Fatal("upload of refused succeeded")
+	}
+	if err := utils.ServerSideCopy(ctx, client, "src", "small", "src", "small-copy", utils.CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DeleteObject(ctx, client, "src", "gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadLog(&log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestReplay(t *testing.T) {
+	entries := record(t)
+	srv := objectslitetest.NewServer(t)
+	srv.MinPartSize = 1
+	srv.CreateBucket("dst")
+
+	res, err := Replay(context.Background(), srv.Client(t), entries, Options{Bucket: "dst", Prefix: "r/", Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FirstError != "" {
+		t.Fatalf("replay failed: %s", res.FirstError)
+	}
+	if res.Skipped["PutObject"] != 1 {
+		t.Fatalf("skipped %v, want the refused PutObject", res.Skipped)
+	}
+	if s := res.Ops["UploadPart"]; s.Ops != 5 || s.Bytes != 4500 {
+		t.Fatalf("replayed %+v of UploadPart, want 5 parts of 4500 bytes", s)
+	}
+	objectslitetest.AssertKeys(t, srv, "dst", "r/large", "r/small", "r/small-copy")
+	for key, size := range map[string]int{"r/small": 100, "r/large": 4500, "r/small-copy": 100} {
+		if obj, _ := srv.Object("dst", key); len(obj.Data) != size {
+			t.Errorf("%s holds %d bytes, want %d", key, len(obj.Data), size)
+		}
+	}
+	if srv.Uploads() != 0 {
+		t.Fatalf("%d multipart uploads left open", srv.Uploads())
+	}
+}
+
+func TestReplayDryRunAndFilters(t *testing.T) {
+	entries := record(t)
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("dst")
+
+	res, err := Replay(context.Background(), srv.Client(t), entries, Options{Bucket: "dst", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Ops["CompleteMultipartUpload"].Ops != 1 || len(srv.Keys("dst")) != 0 {
+		t.Fatalf("dry run replayed %v and wrote %v", res.Ops, srv.Keys("dst"))
+	}
+
+	res, err = Replay(context.Background(), srv.Client(t), entries, Options{Bucket: "dst", Ops: []string{"UploadPart"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Parts of an upload that is not replayed have nowhere to go.
+	if len(res.Ops) != 0 || res.Skipped["UploadPart"] != 5 {
+		t.Fatalf("replayed %v, skipped %v", res.Ops, res.Skipped)
+	}
+}
@@ -0,0 +1,132 @@
+// Package report summarises bucket usage by prefix for chargeback and
+// cleanup decisions.
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// OtherPrefix labels the group that aggregates everything outside the top
+// N prefixes.
+const OtherPrefix = "(other)"
+
+// Options configures a report.
+type Options struct {
+	Bucket string
+	Prefix string
+	// Depth is the number of path components below Prefix used for
+	// grouping. Objects shallower than Depth are grouped under their
+	// parent directory.
+	Depth int
+	// Top keeps the N largest groups by bytes; the rest are folded into
+	// OtherPrefix. Zero keeps every group.
+	Top int
+}
+
+// Group is the usage of one prefix.
+type Group struct {
+	Prefix  string `json:"prefix"`
+	Objects int64  `json:"objects"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Report is the result of Build.
+type Report struct {
+	Bucket string  `json:"bucket"`
+	Prefix string  `json:"prefix"`
+	Depth  int     `json:"depth"`
+	Groups []Group `json:"groups"`
+	Total  Group   `json:"total"`
+}
+
+// Build lists every object under opts.Prefix and aggregates it by prefix.
+func Build(ctx context.Context, svc s3iface.S3API, opts Options) (*Report, error) {
+	groups := make(map[string]*Group)
+	total := Group{Prefix: opts.Prefix}
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.Bucket),
+		Prefix: aws.String(opts.Prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			prefix := GroupPrefix(aws.StringValue(obj.Key), opts.Prefix, opts.Depth)
+			g, ok := groups[prefix]
+			if !ok {
+				g = &Group{Prefix: prefix}
+				groups[prefix] = g
+			}
+			size := aws.Int64Value(obj.Size)
+			g.Objects++
+			g.Bytes += size
+			total.Objects++
+			total.Bytes += size
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list s3://%s/%s: %w", opts.Bucket, opts.Prefix, err)
+	}
+
+	r := &Report{Bucket: opts.Bucket, Prefix: opts.Prefix, Depth: opts.Depth, Total: total}
+	for _, g := range groups {
+		r.Groups = append(r.Groups, *g)
+	}
+	sort.Slice(r.Groups, func(i, j int) bool {
+		if r.Groups[i].Bytes != r.Groups[j].Bytes {
+			return r.Groups[i].Bytes > r.Groups[j].Bytes
+		}
+		return r.Groups[i].Prefix < r.Groups[j].Prefix
+	})
+	if opts.Top > 0 && len(r.Groups) > opts.Top {
+		other := Group{Prefix: OtherPrefix}
+		for _, g := range r.Groups[opts.Top:] {
+			other.Objects += g.Objects
+			other.Bytes += g.Bytes
+		}
+		r.Groups = append(r.Groups[:opts.Top], other)
+	}
+	return r, nil
+}
+
+// GroupPrefix returns the group key belongs to: base followed by at most
+// depth directory components of the remainder of key.
+func GroupPrefix(key, base string, depth int) string {
+	rest := strings.TrimPrefix(key, base)
+	parts := strings.Split(rest, "/")
+	dirs := parts[:len(parts)-1]
+	if len(dirs) > depth {
+		dirs = dirs[:depth]
+	}
+	if len(dirs) == 0 {
+		return base
+	}
+	return base + strings.Join(dirs, "/") + "/"
+}
+
+// WriteTable renders r as an aligned table with human-readable sizes.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "PREFIX\tOBJECTS\tBYTES\tSIZE\t%\t")
+	for _, g := range append(r.Groups, Group{Prefix: "TOTAL", Objects: r.Total.Objects, Bytes: r.Total.Bytes}) {
+		share := 0.0
+		if r.Total.Bytes > 0 {
+			share = 100 * float64(g.Bytes) / float64(r.Total.Bytes)
+		}
+		prefix := g.Prefix
+		if prefix == "" {
+			prefix = "/"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%.1f\t\n", prefix, g.Objects, g.Bytes, utils.FormatBytes(g.Bytes), share)
+	}
+	return tw.Flush()
+}
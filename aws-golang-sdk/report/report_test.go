@@ -0,0 +1,66 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+func TestBuild(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	for key, size := range map[string]int64{
+		"data/logs/2024/a": 100,
+		"data/logs/2025/b": 200,
+		"data/img/c":       1000,
+		"data/d":           5,
+		"data/tmp/e":       1,
+		"elsewhere":        99,
+	} {
+		srv.PutObject("b", key, objectslitetest.Data(size))
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []Group
+	}{
+		{name: "depth 1", opts: Options{Depth: 1}, want: []Group{
+			{"data/img/", 1, 1000}, {"data/logs/", 2, 300}, {"data/", 1, 5}, {"data/tmp/", 1, 1}}},
+		{name: "depth 2", opts: Options{Depth: 2}, want: []Group{
+			{"data/img/", 1, 1000}, {"data/logs/2025/", 1, 200}, {"data/logs/2024/", 1, 100}, {"data/", 1, 5}, {"data/tmp/", 1, 1}}},
+		{name: "top 2", opts: Options{Depth: 1, Top: 2}, want: []Group{
+			{"data/img/", 1, 1000}, {"data/logs/", 2, 300}, {OtherPrefix, 2, 6}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Bucket, opts.Prefix = "b", "data/"
+			r, err := Build(context.Background(), srv.Client(t), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Total != (Group{"data/", 5, 1306}) {
+				t.Fatalf("total %+v", r.Total)
+			}
+			if len(r.Groups) != len(tt.want) {
+				t.Fatalf("groups %+v, want %+v", r.Groups, tt.want)
+			}
+			for i := range tt.want {
+				if r.Groups[i] != tt.want[i] {
+					t.Fatalf("groups %+v, want %+v", r.Groups, tt.want)
+				}
+			}
+
+			var b bytes.Buffer
+			if err := r.WriteTable(&b); err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Count(b.String(), "\n"); lines != len(tt.want)+2 {
+				t.Fatalf("table has %d lines, want a header, %d groups and the total:\n%s", lines, len(tt.want), b.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Package resumable uploads files with multipart uploads that outlive the
+// process sending them. The UploadId, part layout and ETag of every
+// acknowledged part are kept in a checkpoint file; when the upload is
+// interrupted, by an error, a signal or a crash, the upload is left open
+// on the server and ResumeMultipartUpload picks it up from the
+// checkpoint, asking the server which parts it holds, and sends only the
+// rest.
+package resumable
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/checkpoint"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Options configures a resumable upload.
+type Options struct {
+	// Upload tunes the part uploads. Checksum may be ChecksumNone or
+	// ChecksumMD5; compression is not applied. When resuming, the part
+	// size recorded in the checkpoint is used.
+	Upload utils.UploadOptions
+	// Key encrypts the checkpoint file; nil writes it in plaintext.
+	Key *checkpoint.Key
+}
+
+// Upload uploads the file at path to bucket/key with a multipart upload
+// recorded in the checkpoint at checkpointPath. If that checkpoint exists
+// and is for the same object, the upload it records is resumed instead of
+// starting a new one. The checkpoint is removed once the upload is
+// complete. On failure the upload is not aborted: the parts sent so far
+// stay on the server for ResumeMultipartUpload, or for an abort if the
+// upload is abandoned.
+func Upload(ctx context.Context, svc s3iface.S3API, bucket, key, path, checkpointPath string, opts Options) (*s3.CompleteMultipartUploadOutput, error) {
+	c, err := checkpoint.Read(checkpointPath, opts.Key)
+	switch {
+	case err == nil:
+		if c.Bucket != bucket || c.Key != key {
+			return nil, fmt.Errorf("checkpoint %s is for s3://%s/%s, not s3://%s/%s", checkpointPath, c.Bucket, c.Key, bucket, key)
+		}
+		return ResumeMultipartUpload(ctx, svc, checkpointPath, path, opts)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	if err := checkOptions(opts.Upload); err != nil {
+		return nil, err
+	}
+
+	fp, err := checkpoint.FingerprintFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fit := opts.Upload
+	if fit.PartSize <= 0 {
+		fit.PartSize = utils.DefaultPartSize
+	}
+	if err := fit.FitMemory(); err != nil {
+		return nil, err
+	}
+	partSize := fit.PartSize
+	c = &checkpoint.Checkpoint{Bucket: bucket, Key: key, File: fp, PartSize: partSize}
+	for _, p := range utils.PlanParts(fp.Size, partSize) {
+		c.Parts = append(c.Parts, checkpoint.Part{Number: p.Number, Offset: p.Offset, Size: p.Size})
+	}
+
+	in := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		Metadata: opts.Upload.Metadata,
+	}
+	if opts.Upload.ContentEncoding != "" {
+		in.ContentEncoding = aws.String(opts.Upload.ContentEncoding)
+	}
+	create, err := svc.CreateMultipartUploadWithContext(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("create multipart upload: %w", err)
+	}
+	c.UploadID = aws.StringValue(create.UploadId)
+	// An upload whose ID was never saved cannot be resumed; abort it
+	// rather than leave its parts unaccounted for.
+	if err := c.Write(checkpointPath, opts.Key); err != nil {
+		svc.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: create.UploadId,
+		})
+		return nil, fmt.Errorf("write checkpoint: %w", err)
+	}
+	return run(ctx, svc, c, path, checkpointPath, opts)
+}
+
+// ResumeMultipartUpload continues the upload recorded in the checkpoint at
+// checkpointPath, reading the file at path, which must still have the
+// size and modification time the checkpoint recorded. The server's list
+// of parts, from ListParts, decides what is sent again: a part it holds
+// is kept when its ETag matches the checkpoint or, for a part uploaded
+// just before a crash and never recorded, the MD5 of the local part.
+// Anything else is uploaded again before the upload is completed.
+func ResumeMultipartUpload(ctx context.Context, svc s3iface.S3API, checkpointPath, path string, opts Options) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := checkOptions(opts.Upload); err != nil {
+		return nil, err
+	}
+	c, err := checkpoint.Read(checkpointPath, opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	if c.UploadID == "" {
+		return nil, fmt.Errorf("checkpoint %s has no upload ID", checkpointPath)
+	}
+	if err := c.File.Check(path); err != nil {
+		return nil, err
+	}
+	uploaded, err := listParts(ctx, svc, c)
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			return nil, fmt.Errorf("upload %s no longer exists (aborted or expired); remove %s to start over: %w", c.UploadID, checkpointPath, err)
+		}
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	for i, p := range c.Parts {
+		c.Parts[i].ETag = ""
+		got := uploaded[p.Number]
+		if got == nil || aws.Int64Value(got.Size) != p.Size {
+			continue
+		}
+		etag := strings.Trim(aws.StringValue(got.ETag), `"`)
+		if p.ETag == "" {
+			h := md5.New()
+			if _, err := io.Copy(h, io.NewSectionReader(f, p.Offset, p.Size)); err != nil {
+				return nil, fmt.Errorf("hash part %d: %w", p.Number, err)
+			}
+			if etag != hex.EncodeToString(h.Sum(nil)) {
+				continue
+			}
+		} else if etag != p.ETag {
+			continue
+		}
+		c.Parts[i].ETag = etag
+	}
+	if err := c.Write(checkpointPath, opts.Key); err != nil {
+		return nil, fmt.Errorf("write checkpoint: %w", err)
+	}
+	return run(ctx, svc, c, path, checkpointPath, opts)
+}
+
+func checkOptions(opts utils.UploadOptions) error {
+	switch opts.Checksum {
+	case "", utils.ChecksumNone, utils.ChecksumMD5:
+		return nil
+	}
+	return fmt.Errorf("resumable uploads support checksum %s or %s, not %q", utils.ChecksumNone, utils.ChecksumMD5, opts.Checksum)
+}
+
+// listParts returns the parts the server holds for the checkpoint's
+// upload, by number.
+func listParts(ctx context.Context, svc s3iface.S3API, c *checkpoint.Checkpoint) (map[int64]*s3.Part, error) {
+	uploaded := make(map[int64]*s3.Part)
+	err := svc.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(c.Bucket),
+		Key:      aws.String(c.Key),
+		UploadId: aws.String(c.UploadID),
+	}, func(page *s3.ListPartsOutput, _ bool) bool {
+		for _, part := range page.Parts {
+			uploaded[aws.Int64Value(part.PartNumber)] = part
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list parts: %w", err)
+	}
+	return uploaded, nil
+}
+
+// run uploads the parts of c without an ETag, recording each in the
+// checkpoint as it is acknowledged, then completes the upload and removes
+// the checkpoint.
+func run(ctx context.Context, svc s3iface.S3API, c *checkpoint.Checkpoint, path, checkpointPath string, opts Options) (*s3.CompleteMultipartUploadOutput, error) {
+	o := opts.Upload
+	if o.MaxElapsedTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.MaxElapsedTime)
+		defer cancel()
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = utils.DefaultConcurrency
+	}
+	// The part size is fixed by the checkpoint, so only the concurrency
+	// can give way to MaxMemory.
+	if err := o.LimitConcurrency(c.Parts[0].Size); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pending := c.Pending()
+	order, err := utils.UploadOrder(len(pending), func(i int) int64 { return pending[i].Size }, o.PartOrder)
+	if err != nil {
+		return nil, err
+	}
+	saver := checkpoint.NewSaver(c, checkpointPath, opts.Key)
+	uploader := utils.NewPartUploader(svc, c.Bucket, c.Key, c.UploadID, o)
+	errs := utils.ForEachErr(ctx, len(order), o.Concurrency, false, func(j int) error {
+		p := pending[order[j]]
+		part := utils.Part{Number: p.Number, Offset: p.Offset, Size: p.Size}
+		var sum utils.PartChecksum
+		if o.Checksum == utils.ChecksumMD5 {
+			h := md5.New()
+			if _, err := io.Copy(h, io.NewSectionReader(f, p.Offset, p.Size)); err != nil {
+				return fmt.Errorf("hash part %d: %w", p.Number, err)
+			}
+			sum = utils.PartChecksum{Algorithm: utils.ChecksumMD5, Value: base64.StdEncoding.EncodeToString(h.Sum(nil))}
+		}
+		done, err := uploader.Upload(ctx, part, f, sum)
+		if err != nil {
+			return err
+		}
+		if err := saver.Record(p.Number, strings.Trim(aws.StringValue(done.ETag), `"`)); err != nil {
+			return fmt.Errorf("part %d uploaded but not checkpointed: %w", p.Number, err)
+		}
+		return nil
+	})
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, utils.ErrSkipped) {
+			return nil, fmt.Errorf("upload interrupted, resume from %s: %w", checkpointPath, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("upload interrupted, resume from %s: %w", checkpointPath, err)
+	}
+
+	completed := make([]*s3.CompletedPart, len(c.Parts))
+	for i, p := range c.Parts {
+		completed[i] = &s3.CompletedPart{ETag: aws.String(`"` + p.ETag + `"`), PartNumber: aws.Int64(p.Number)}
+	}
+	if err := utils.CheckCompletedParts(completed, len(c.Parts)); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", checkpointPath, err)
+	}
+	out, err := utils.CompleteMultipartUpload(ctx, svc, c.Bucket, c.Key, c.UploadID, completed, o)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(checkpointPath)
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package resumable
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		maxMemory int64
+		failPart  string // partNumber whose upload fails in the first run
+		wantSent  int64  // parts sent by the run that completes
+	}{
+		{name: "one run", size: 2*utils.MinPartSize + 100, wantSent: 3},
+		// One part at a time: the first run stops at part 2, so the
+		// second sends parts 2 and 3 only.
+		{name: "resumed after a failed part", size: 2*utils.MinPartSize + 100, failPart: "2", wantSent: 2},
+		{name: "empty file with max memory", size: 0, maxMemory: 16 << 20, wantSent: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			path := objectslitetest.TempFile(t, tt.size)
+			ckpt := filepath.Join(t.TempDir(), "upload.ckpt")
+			var sent atomic.Int64
+			failing := tt.failPart != ""
+			srv.Fail = func(r *http.Request) bool {
+				part := r.URL.Query().Get("partNumber")
+				if r.Method != http.MethodPut || part == "" {
+					return false
+				}
+				if failing && part == tt.failPart {
+					return true
+				}
+				sent.Add(1)
+				return false
+			}
+			opts := Options{Upload: utils.UploadOptions{
+				PartSize:    utils.MinPartSize,
+				Concurrency: 1,
+				MaxMemory:   tt.maxMemory,
+				RetryBudget: -1,
+			}}
+
+			if failing {
+				if _, err := Upload(ctx, srv.Client(t), "b", "k", path, ckpt, opts); err == nil {
+					t.Fatal("upload with a failing part succeeded")
+				}
+				if _, err := os.Stat(ckpt); err != nil {
+					t.Fatalf("no checkpoint left to resume from: %v", err)
+				}
+				failing = false
+				sent.Store(0)
+			}
+			if _, err := Upload(ctx, srv.Client(t), "b", "k", path, ckpt, opts); err != nil {
+				t.Fatal(err)
+			}
+			if n := sent.Load(); n != tt.wantSent {
+				t.Fatalf("%d parts sent, want %d", n, tt.wantSent)
+			}
+			objectslitetest.AssertObjectMatchesFile(t, srv, "b", "k", path)
+			if _, err := os.Stat(ckpt); !os.IsNotExist(err) {
+				t.Fatalf("checkpoint left after the upload completed: %v", err)
+			}
+			if n := srv.Uploads(); n != 0 {
+				t.Fatalf("%d multipart uploads left open", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package sftpbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/sftp"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// maxPending caps the bytes of out-of-order writes held while waiting for
+// the gap before them. Clients pipeline writes but send them in order, so
+// only a little reordering is expected.
+const maxPending = 64 << 20
+
+// handlers implements the sftp request-server interfaces for one session.
+// Uploads run under the session's ctx rather than the request's, since
+// they finish only when the file handle is closed.
+type handlers struct {
+	*Server
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+func (s *Server) handlers(ctx context.Context, logger *slog.Logger) sftp.Handlers {
+	h := &handlers{Server: s, ctx: ctx, logger: logger}
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+// key maps an SFTP path to an object key. The empty key is the root.
+func (h *handlers) key(p string) string {
+	rel := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if rel == "" {
+		return h.opts.Prefix
+	}
+	return h.opts.Prefix + rel
+}
+
+// Fileread implements sftp.FileReader.
+func (h *handlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	key := h.key(r.Filepath)
+	out, err := h.svc.HeadObjectWithContext(r.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(h.opts.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, sftpErr(err)
+	}
+	h.logger.Info("get", "key", key, "size", aws.Int64Value(out.ContentLength))
+	return &objectReader{ctx: h.ctx, h: h, key: key, etag: out.ETag}, nil
+}
+
+// Filewrite implements sftp.FileWriter.
+func (h *handlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	key := h.key(r.Filepath)
+	if key == h.opts.Prefix || strings.HasSuffix(r.Filepath, "/") {
+		return nil, sftp.ErrSSHFxFailure
+	}
+	pr, pw := io.Pipe()
+	w := &uploadWriter{pw: pw, pending: map[int64][]byte{}, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		start := time.Now()
+		out, err := utils.UploadStream(h.ctx, h.svc, h.opts.Bucket, key, pr, h.opts.Upload)
+		pr.CloseWithError(err)
+		if err != nil {
+			w.err = err
+			h.logger.Warn("put failed", "key", key, "err", err)
+			return
+		}
+		h.logger.Info("put", "key", key, "size", out.Size, "elapsed", time.Since(start).Round(time.Millisecond))
+	}()
+	return w, nil
+}
+
+// Filecmd implements sftp.FileCmder. Directories are represented by
+// zero-byte "dir/" marker objects so that an empty directory made with
+// mkdir can be listed and entered.
+func (h *handlers) Filecmd(r *sftp.Request) error {
+	ctx := r.Context()
+	key := h.key(r.Filepath)
+	switch r.Method {
+	case "Setstat":
+		// Times and modes cannot be set on objects; accept so that
+		// clients preserving them do not fail the transfer.
+		return nil
+	case "Remove":
+		return sftpErr(h.delete(ctx, key))
+	case "Mkdir":
+		_, err := h.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(h.opts.Bucket),
+			Key:    aws.String(withSlash(key)),
+		})
+		return sftpErr(err)
+	case "Rmdir":
+		_, nonEmpty, err := h.dirState(ctx, withSlash(key))
+		if err != nil {
+			return sftpErr(err)
+		}
+		if nonEmpty {
+			return fmt.Errorf("%s: directory not empty", r.Filepath)
+		}
+		return sftpErr(h.delete(ctx, withSlash(key)))
+	case "Rename":
+		dst := h.key(r.Target)
+		if err := utils.ServerSideCopy(ctx, h.svc, h.opts.Bucket, key, h.opts.Bucket, dst, utils.CopyOptions{}); err != nil {
+			return sftpErr(err)
+		}
+		return sftpErr(h.delete(ctx, key))
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// Filelist implements sftp.FileLister.
+func (h *handlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	ctx := r.Context()
+	key := h.key(r.Filepath)
+	switch r.Method {
+	case "List":
+		return h.list(ctx, withSlash(key))
+	case "Stat":
+		if key == h.opts.Prefix {
+			return listerAt{dirInfo("/")}, nil
+		}
+		out, err := h.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(h.opts.Bucket),
+			Key:    aws.String(key),
+		})
+		if err == nil {
+			return listerAt{fileInfo{name: path.Base(key), size: aws.Int64Value(out.ContentLength), mtime: aws.TimeValue(out.LastModified)}}, nil
+		}
+		if !utils.IsNotFound(err) {
+			return nil, sftpErr(err)
+		}
+		exists, _, err := h.dirState(ctx, withSlash(key))
+		if err != nil {
+			return nil, sftpErr(err)
+		}
+		if exists {
+			return listerAt{dirInfo(path.Base(key))}, nil
+		}
+		return nil, sftp.ErrSSHFxNoSuchFile
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handlers) list(ctx context.Context, dir string) (sftp.ListerAt, error) {
+	var infos listerAt
+	err := h.svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(h.opts.Bucket),
+		Prefix:    aws.String(dir),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, p := range page.CommonPrefixes {
+			infos = append(infos, dirInfo(path.Base(aws.StringValue(p.Prefix))))
+		}
+		for _, o := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(o.Key), dir)
+			if name == "" {
+				continue // the directory's own marker
+			}
+			infos = append(infos, fileInfo{name: name, size: aws.Int64Value(o.Size), mtime: aws.TimeValue(o.LastModified)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, sftpErr(err)
+	}
+	return infos, nil
+}
+
+// dirState reports whether any key, its marker included, lies under dir
+// and whether any key other than the marker does.
+func (h *handlers) dirState(ctx context.Context, dir string) (exists, nonEmpty bool, err error) {
+	out, err := h.svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(h.opts.Bucket),
+		Prefix:  aws.String(dir),
+		MaxKeys: aws.Int64(2),
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, o := range out.Contents {
+		if aws.StringValue(o.Key) != dir {
+			nonEmpty = true
+		}
+	}
+	return len(out.Contents) > 0, nonEmpty, nil
+}
+
+func (h *handlers) delete(ctx context.Context, key string) error {
+	_, err := h.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(h.opts.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// sftpErr maps S3 errors to the SFTP status codes clients understand.
+func sftpErr(err error) error {
+	var aerr awserr.RequestFailure
+	switch {
+	case err == nil:
+		return nil
+	case utils.IsNotFound(err):
+		return sftp.ErrSSHFxNoSuchFile
+	case errors.As(err, &aerr) && aerr.StatusCode() == http.StatusForbidden:
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	return err
+}
+
+func withSlash(key string) string {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return key
+	}
+	return key + "/"
+}
+
+// objectReader reads an object for an open SFTP handle. Clients read
+// files front to back, so one GET is kept open from the last offset and
+// only reopened when a read jumps elsewhere. Each GET is pinned to the
+// ETag seen at open, so a concurrent overwrite fails the read instead of
+// mixing versions.
+type objectReader struct {
+	ctx  context.Context
+	h    *handlers
+	key  string
+	etag *string
+
+	mu   sync.Mutex
+	body io.ReadCloser
+	off  int64
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.body == nil || off != r.off {
+		r.closeBody()
+		out, err := r.h.svc.GetObjectWithContext(r.ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(r.h.opts.Bucket),
+			Key:     aws.String(r.key),
+			Range:   aws.String(fmt.Sprintf("bytes=%d-", off)),
+			IfMatch: r.etag,
+		})
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusRequestedRangeNotSatisfiable {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, sftpErr(err)
+		}
+		r.body, r.off = out.Body, off
+	}
+	n, err := io.ReadFull(r.body, p)
+	r.off += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		r.closeBody()
+		return n, io.EOF
+	}
+	if err != nil {
+		r.closeBody()
+	}
+	return n, err
+}
+
+// Close releases the open GET, if any.
+func (r *objectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeBody()
+	return nil
+}
+
+func (r *objectReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+// uploadWriter feeds the writes of an open SFTP handle, in offset order,
+// into a pipe read by UploadStream. Writes ahead of the current offset
+// are held until the gap before them is filled.
+//
+// SFTP has no way to tell an aborted transfer from a finished one, so a
+// client that disconnects mid-file leaves a truncated object, as it would
+// leave a truncated file on a disk-backed server.
+type uploadWriter struct {
+	mu           sync.Mutex
+	pw           *io.PipeWriter
+	off          int64
+	pending      map[int64][]byte
+	pendingBytes int64
+
+	done chan struct{}
+	err  error
+}
+
+// WriteAt implements io.WriterAt.
+func (w *uploadWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case off < w.off:
+		return 0, fmt.Errorf("write at %d: rewriting uploaded data is not supported", off)
+	case off > w.off:
+		if w.pendingBytes+int64(len(p)) > maxPending {
+			return 0, fmt.Errorf("write at %d: too far ahead of offset %d", off, w.off)
+		}
+		w.pending[off] = append([]byte(nil), p...)
+		w.pendingBytes += int64(len(p))
+		return len(p), nil
+	}
+	if _, err := w.pw.Write(p); err != nil {
+		return 0, err
+	}
+	w.off += int64(len(p))
+	for {
+		next, ok := w.pending[w.off]
+		if !ok {
+			return len(p), nil
+		}
+		delete(w.pending, w.off)
+		w.pendingBytes -= int64(len(next))
+		if _, err := w.pw.Write(next); err != nil {
+			return 0, err
+		}
+		w.off += int64(len(next))
+	}
+}
+
+// Close ends the stream and waits for the upload to complete.
+func (w *uploadWriter) Close() error {
+	w.mu.Lock()
+	if len(w.pending) > 0 {
+		w.pw.CloseWithError(fmt.Errorf("file has a gap at offset %d", w.off))
+	} else {
+		w.pw.Close()
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.err
+}
+
+// listerAt implements sftp.ListerAt over a fixed slice.
+type listerAt []os.FileInfo
+
+// ListAt implements sftp.ListerAt.
+func (l listerAt) ListAt(ls []os.FileInfo, off int64) (int, error) {
+	if off >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[off:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+	dir   bool
+}
+
+func dirInfo(name string) fileInfo { return fileInfo{name: name, dir: true} }
+
+func (f fileInfo) Name() string       { return f.name }
+func (f fileInfo) Size() int64        { return f.size }
+func (f fileInfo) ModTime() time.Time { return f.mtime }
+func (f fileInfo) IsDir() bool        { return f.dir }
+func (f fileInfo) Sys() any           { return nil }
+
+func (f fileInfo) Mode() os.FileMode {
+	if f.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
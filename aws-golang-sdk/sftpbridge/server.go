@@ -0,0 +1,184 @@
+// Package sftpbridge serves a bucket prefix over SFTP for appliances and
+// partners that can only deliver files that way. Directory listings map
+// to ListObjectsV2, downloads to ranged GetObject calls and uploads to a
+// streamed (multipart) upload, so files of any size pass through without
+// being staged on local disk.
+package sftpbridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Options configures a Server.
+type Options struct {
+	Bucket string
+	// Prefix is the part of the bucket exposed; it appears as "/" to
+	// SFTP clients.
+	Prefix string
+	// HostKey identifies the server to clients. Required.
+	HostKey ssh.Signer
+	// Username is the only login accepted. It authenticates with
+	// Password, when set, or with any of AuthorizedKeys.
+	Username       string
+	Password       string
+	AuthorizedKeys []ssh.PublicKey
+	// Upload configures the uploads of files that clients put.
+	Upload utils.UploadOptions
+	// Logger receives connection and transfer messages. Nil selects
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// Server accepts SSH connections and serves the SFTP subsystem on them.
+type Server struct {
+	svc    s3iface.S3API
+	opts   Options
+	config *ssh.ServerConfig
+}
+
+// NewServer returns a Server reading from and writing to svc.
+func NewServer(svc s3iface.S3API, opts Options) (*Server, error) {
+	if opts.HostKey == nil {
+		return nil, errors.New("sftpbridge: a host key is required")
+	}
+	if opts.Username == "" || (opts.Password == "" && len(opts.AuthorizedKeys) == 0) {
+		return nil, errors.New("sftpbridge: a username with a password or authorized keys is required")
+	}
+	if opts.Prefix != "" && !strings.HasSuffix(opts.Prefix, "/") {
+		opts.Prefix += "/"
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	s := &Server{svc: svc, opts: opts}
+	s.config = &ssh.ServerConfig{MaxAuthTries: 3}
+	if opts.Password != "" {
+		s.config.PasswordCallback = s.checkPassword
+	}
+	if len(opts.AuthorizedKeys) > 0 {
+		s.config.PublicKeyCallback = s.checkKey
+	}
+	s.config.AddHostKey(opts.HostKey)
+	return s, nil
+}
+
+func (s *Server) checkPassword(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	userOK := subtle.ConstantTimeCompare([]byte(c.User()), []byte(s.opts.Username)) == 1
+	passOK := subtle.ConstantTimeCompare(password, []byte(s.opts.Password)) == 1
+	if userOK && passOK {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("password rejected for %q", c.User())
+}
+
+func (s *Server) checkKey(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if c.User() == s.opts.Username {
+		for _, k := range s.opts.AuthorizedKeys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("key %s rejected for %q", ssh.FingerprintSHA256(key), c.User())
+}
+
+// Serve accepts connections on l until ctx is cancelled, then closes l
+// and waits for open sessions to finish. It returns nil after a
+// cancellation.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		s.opts.Logger.Warn("ssh handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		return
+	}
+	defer sconn.Close()
+	stop := context.AfterFunc(ctx, func() { sconn.Close() })
+	defer stop()
+	logger := s.opts.Logger.With("remote", conn.RemoteAddr(), "user", sconn.User())
+	logger.Info("sftp session opened")
+	defer logger.Info("sftp session closed")
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			logger.Warn("accept channel", "err", err)
+			continue
+		}
+		go acceptSFTP(requests)
+		server := sftp.NewRequestServer(ch, s.handlers(ctx, logger))
+		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			logger.Warn("sftp session ended", "err", err)
+		}
+		server.Close()
+	}
+}
+
+// acceptSFTP agrees to the "sftp" subsystem request and refuses shells,
+// exec and everything else.
+func acceptSFTP(in <-chan *ssh.Request) {
+	for req := range in {
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+	}
+}
+
+// LoadAuthorizedKeys reads public keys in OpenSSH authorized_keys format.
+func LoadAuthorizedKeys(path string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys, nil
+}
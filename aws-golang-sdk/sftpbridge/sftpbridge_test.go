@@ -0,0 +1,149 @@
+package sftpbridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+)
+
+// startBridge serves srv's bucket b under in/ until the test ends and
+// returns the address to connect to.
+func startBridge(t *testing.T, srv *objectslitetest.Server) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(srv.Client(t), Options{
+		Bucket:   "b",
+		Prefix:   "in",
+		HostKey:  hostKey,
+		Username: "partner",
+		Password: "s3cret",
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return l.Addr().String()
+}
+
+func dial(addr, password string) (*ssh.Client, error) {
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "partner",
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+func TestBridge(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.PutObject("b", "outside", []byte("not exposed"))
+	addr := startBridge(t, srv)
+	conn, err := dial(addr, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	data := objectslitetest.Data(3<<20 + 17)
+	f, err := client.Create("/drop/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	objectslitetest.AssertObject(t, srv, "b", "in/drop/file.bin", data)
+
+	f, err = client.Open("/drop/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read back %d bytes (%v), want the %d written", len(got), err, len(data))
+	}
+
+	if err := client.Mkdir("/empty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Rename("/drop/file.bin", "/drop/renamed.bin"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := client.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"drop", "empty"}) {
+		t.Fatalf("root lists %v, want [drop empty]", names)
+	}
+	if info, err := client.Stat("/drop/renamed.bin"); err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("stat of the renamed file: %v, %v", info, err)
+	}
+	// Only the prefix is reachable, however the path is spelled.
+	if _, err := client.Stat("/../outside"); err == nil {
+		t.Fatal("stat reached an object outside the prefix")
+	}
+
+	if err := client.Remove("/drop/renamed.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveDirectory("/empty"); err != nil {
+		t.Fatal(err)
+	}
+	objectslitetest.AssertKeys(t, srv, "b", "outside")
+}
+
+func TestBridgeRejectsWrongPassword(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	addr := startBridge(t, srv)
+	conn, err := dial(addr, "guess")
+	if err == nil {
+		conn.Close()
+		t.Fatal("logged in with a wrong password")
+	}
+}
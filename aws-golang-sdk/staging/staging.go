@@ -0,0 +1,80 @@
+// Package staging uploads to a temporary key and publishes to the final
+// key only after the staged copy has been verified, so consumers of the
+// bucket never see partially written or unverified objects under the
+// final name.
+package staging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// DefaultPrefix is where staged objects are written.
+const DefaultPrefix = ".staging/"
+
+// Options configures a staged upload.
+type Options struct {
+	// Prefix is prepended to the final key, with a random suffix, to form
+	// the staging key.
+	Prefix string
+	Upload utils.UploadOptions
+	Copy   utils.CopyOptions
+}
+
+// Upload stages the file at path, verifies the staged object's size and
+// composite ETag against the local file, server-side copies it to key and
+// removes the staged object. The staged object is also removed when
+// verification fails; the final key is never written in that case.
+func Upload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts Options) error {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.Upload.PartSize <= 0 {
+		opts.Upload.PartSize = utils.DefaultPartSize
+	}
+	// The expected ETag is computed from parts of one fixed size.
+	opts.Upload.MaxPartSize = 0
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	staged := opts.Prefix + key + "." + hex.EncodeToString(suffix)
+
+	expected, err := utils.CompositeETag(path, opts.Upload.PartSize)
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", path, err)
+	}
+	out, err := utils.ConcurrentMultipartUpload(ctx, svc, bucket, staged, path, opts.Upload)
+	if err != nil {
+		return fmt.Errorf("stage: %w", err)
+	}
+	defer svc.DeleteObjectWithContext(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(staged),
+	})
+
+	if got := aws.StringValue(out.ETag); !utils.SameETag(got, expected) {
+		return fmt.Errorf("verify: staged object has ETag %s, local file %s", got, expected)
+	}
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(staged),
+	})
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if !utils.SameETag(aws.StringValue(head.ETag), expected) {
+		return fmt.Errorf("verify: staged object has ETag %s, local file %s", aws.StringValue(head.ETag), expected)
+	}
+
+	if err := utils.ServerSideCopy(ctx, svc, bucket, staged, bucket, key, opts.Copy); err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	return nil
+}
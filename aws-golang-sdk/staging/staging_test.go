@@ -0,0 +1,65 @@
+package staging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// changedHead reports another ETag for every object, as if the staged
+// copy had been overwritten after it was uploaded.
+type changedHead struct {
+	s3iface.S3API
+}
+
+func (c changedHead) HeadObjectWithContext(ctx aws.Context, in *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	out, err := c.S3API.HeadObjectWithContext(ctx, in, opts...)
+	if err == nil {
+		out.ETag = aws.String(`"00000000000000000000000000000000-1"`)
+	}
+	return out, err
+}
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed bool
+	}{
+		{name: "published"},
+		{name: "verification failed", changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			srv.MinPartSize = 1
+			srv.CreateBucket("b")
+			var svc s3iface.S3API = srv.Client(t)
+			if tt.changed {
+				svc = changedHead{svc}
+			}
+			path := objectslitetest.TempFile(t, 2500)
+			opts := Options{Upload: utils.UploadOptions{PartSize: 1000}, Copy: utils.CopyOptions{Threshold: 1000, PartSize: 1000}}
+
+			err := Upload(context.Background(), svc, "b", "final", path, opts)
+			if tt.changed {
+				if err == nil {
+					t.Fatal("published an object that failed verification")
+				}
+				objectslitetest.AssertKeys(t, srv, "b")
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			objectslitetest.AssertObjectMatchesFile(t, srv, "b", "final", path)
+			objectslitetest.AssertKeys(t, srv, "b", "final")
+		})
+	}
+}
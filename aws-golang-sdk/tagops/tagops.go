@@ -0,0 +1,202 @@
+// Package tagops selects objects by their tags and applies a bulk action
+// to the matches, enabling policy-like workflows driven from the client.
+package tagops
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// Condition is one tag predicate.
+type Condition struct {
+	Key    string
+	Value  string
+	Negate bool
+	// AnyValue matches on the presence (or, negated, absence) of Key.
+	AnyValue bool
+}
+
+// ParseCondition parses "key=value", "key!=value", "key" (present) or
+// "!key" (absent).
+func ParseCondition(s string) (Condition, error) {
+	var c Condition
+	switch {
+	case strings.Contains(s, "!="):
+		c.Key, c.Value, _ = strings.Cut(s, "!=")
+		c.Negate = true
+	case strings.Contains(s, "="):
+		c.Key, c.Value, _ = strings.Cut(s, "=")
+	case strings.HasPrefix(s, "!"):
+		c.Key, c.Negate, c.AnyValue = s[1:], true, true
+	default:
+		c.Key, c.AnyValue = s, true
+	}
+	if c.Key == "" {
+		return c, fmt.Errorf("invalid tag condition %q", s)
+	}
+	return c, nil
+}
+
+// Match reports whether tags satisfy c.
+func (c Condition) Match(tags map[string]string) bool {
+	v, ok := tags[c.Key]
+	if !c.AnyValue {
+		ok = ok && v == c.Value
+	}
+	return ok != c.Negate
+}
+
+// Action is the bulk operation applied to matching objects.
+type Action string
+
+const (
+	ActionList   Action = "list"
+	ActionDelete Action = "delete"
+	ActionCopy   Action = "copy"
+	ActionRetag  Action = "retag"
+)
+
+// Options configures a run.
+type Options struct {
+	Bucket     string
+	Prefix     string
+	Conditions []Condition
+	Action     Action
+	// DestBucket and DestPrefix are the ActionCopy destination; the
+	// source Prefix is replaced by DestPrefix. Tags are copied along.
+	DestBucket string
+	DestPrefix string
+	Copy       utils.CopyOptions
+	// SetTags and RemoveTags are applied by ActionRetag.
+	SetTags     map[string]string
+	RemoveTags  []string
+	DryRun      bool
+	Concurrency int
+}
+
+// Result is the outcome for one listed object.
+type Result struct {
+	Key     string
+	Tags    map[string]string
+	Matched bool
+	Err     error
+}
+
+// Run lists opts.Prefix, fetches each object's tags, and applies
+// opts.Action to those matching every condition. report is called for
+// every listed object, matched or not, in key order.
+func Run(ctx context.Context, svc s3iface.S3API, opts Options, report func(Result)) error {
+	if opts.DestBucket == "" {
+		opts.DestBucket = opts.Bucket
+	}
+	if opts.Action == ActionCopy && opts.DestBucket == opts.Bucket && opts.DestPrefix == opts.Prefix {
+		return fmt.Errorf("copy destination must differ from the source prefix")
+	}
+
+	var keys []string
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.Bucket),
+		Prefix: aws.String(opts.Prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("list s3://%s/%s: %w", opts.Bucket, opts.Prefix, err)
+	}
+
+	results := make([]Result, len(keys))
+	utils.ForEach(ctx, len(keys), opts.Concurrency, func(i int) {
+		results[i] = process(ctx, svc, opts, keys[i])
+	})
+	for _, r := range results {
+		if r.Key != "" {
+			report(r)
+		}
+	}
+	return ctx.Err()
+}
+
+func process(ctx context.Context, svc s3iface.S3API, opts Options, key string) Result {
+	r := Result{Key: key}
+	r.Tags, r.Err = GetTags(ctx, svc, opts.Bucket, key)
+	if r.Err != nil {
+		return r
+	}
+	r.Matched = true
+	for _, c := range opts.Conditions {
+		if !c.Match(r.Tags) {
+			r.Matched = false
+			break
+		}
+	}
+	if !r.Matched || opts.DryRun {
+		return r
+	}
+
+	switch opts.Action {
+	case ActionDelete:
+		_, r.Err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(opts.Bucket),
+			Key:    aws.String(key),
+		})
+	case ActionCopy:
+		copyOpts := opts.Copy
+		copyOpts.Tags = r.Tags
+		r.Err = utils.ServerSideCopy(ctx, svc, opts.Bucket, key, opts.DestBucket, opts.DestPrefix+strings.TrimPrefix(key, opts.Prefix), copyOpts)
+	case ActionRetag:
+		tags := make(map[string]string, len(r.Tags)+len(opts.SetTags))
+		for k, v := range r.Tags {
+			tags[k] = v
+		}
+		for _, k := range opts.RemoveTags {
+			delete(tags, k)
+		}
+		for k, v := range opts.SetTags {
+			tags[k] = v
+		}
+		r.Err = PutTags(ctx, svc, opts.Bucket, key, tags)
+	}
+	return r
+}
+
+// GetTags returns the tag set of bucket/key as a map.
+func GetTags(ctx context.Context, svc s3iface.S3API, bucket, key string) (map[string]string, error) {
+	out, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(out.TagSet))
+	for _, t := range out.TagSet {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return tags, nil
+}
+
+// PutTags replaces the tag set of bucket/key.
+func PutTags(ctx context.Context, svc s3iface.S3API, bucket, key string, tags map[string]string) error {
+	set := make([]*s3.Tag, 0, len(tags))
+	for k, v := range tags {
+		set = append(set, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	sort.Slice(set, func(i, j int) bool { return *set[i].Key < *set[j].Key })
+	_, err := svc.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: set},
+	})
+	return err
+}
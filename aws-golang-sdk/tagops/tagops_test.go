@@ -0,0 +1,87 @@
+package tagops
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestRun(t *testing.T) {
+	data := objectslitetest.Data(3 << 20)
+	tests := []struct {
+		name     string
+		opts     Options
+		wantKeys []string
+		wantTags map[string]string // tags of the object at the first wanted key
+	}{
+		{name: "list", opts: Options{Action: ActionList},
+			wantKeys: []string{"src/hot", "src/keep"}, wantTags: map[string]string{"tier": "hot"}},
+		{name: "delete", opts: Options{Action: ActionDelete},
+			wantKeys: []string{"src/keep"}},
+		{name: "dry run", opts: Options{Action: ActionDelete, DryRun: true},
+			wantKeys: []string{"src/hot", "src/keep"}},
+		{name: "single copy", opts: Options{Action: ActionCopy, DestPrefix: "dst/"},
+			wantKeys: []string{"dst/hot", "src/hot", "src/keep"}, wantTags: map[string]string{"tier": "hot"}},
+		{name: "multipart copy", opts: Options{Action: ActionCopy, DestPrefix: "dst/", Copy: utils.CopyOptions{Threshold: 1 << 20, PartSize: 1 << 20}},
+			wantKeys: []string{"dst/hot", "src/hot", "src/keep"}, wantTags: map[string]string{"tier": "hot"}},
+		{name: "retag", opts: Options{Action: ActionRetag, SetTags: map[string]string{"tier": "cold", "moved": "yes"}},
+			wantKeys: []string{"src/hot", "src/keep"}, wantTags: map[string]string{"tier": "cold", "moved": "yes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			client := srv.Client(t)
+			for key, tagging := range map[string]string{"src/hot": "tier=hot", "src/keep": "tier=cold"} {
+				_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+					Bucket:  aws.String("b"),
+					Key:     aws.String(key),
+					Body:    bytes.NewReader(data),
+					Tagging: aws.String(tagging),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := tt.opts
+			opts.Bucket, opts.Prefix = "b", "src/"
+			opts.Conditions = []Condition{{Key: "tier", Value: "hot"}}
+
+			var matched []string
+			err := Run(ctx, client, opts, func(r Result) {
+				if r.Err != nil {
+					t.Errorf("%s: %v", r.Key, r.Err)
+				}
+				if r.Matched {
+					matched = append(matched, r.Key)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(matched) != 1 || matched[0] != "src/hot" {
+				t.Fatalf("matched %v, want only src/hot", matched)
+			}
+			objectslitetest.AssertKeys(t, srv, "b", tt.wantKeys...)
+			if tt.wantTags == nil {
+				return
+			}
+			key := tt.wantKeys[0]
+			objectslitetest.AssertObject(t, srv, "b", key, data)
+			if obj, _ := srv.Object("b", key); !maps.Equal(obj.Tags, tt.wantTags) {
+				t.Fatalf("%s has tags %v, want %v", key, obj.Tags, tt.wantTags)
+			}
+			if n := srv.Uploads(); n != 0 {
+				t.Fatalf("%d multipart uploads left open", n)
+			}
+		})
+	}
+}
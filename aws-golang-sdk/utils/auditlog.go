@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// AuditEntry is one line of the audit log: the final outcome of one
+// mutating operation, after any retries.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"op"`
+	Bucket    string    `json:"bucket,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	// Keys lists the keys of a DeleteObjects batch.
+	Keys       []string `json:"keys,omitempty"`
+	UploadID   string   `json:"upload_id,omitempty"`
+	PartNumber int64    `json:"part,omitempty"`
+	// Size is the length of the body sent by a PutObject or UploadPart.
+	Size int64 `json:"size,omitempty"`
+	// CopySource is the bucket/key a CopyObject copied.
+	CopySource string `json:"copy_source,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	// Result is "ok" or the error code.
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	Attempts   int    `json:"attempts"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// mutatingPrefixes are the operation name prefixes that change data:
+// PutObject, DeleteObjects, CopyObject, CreateMultipartUpload,
+// UploadPart, CompleteMultipartUpload, AbortMultipartUpload and the
+// like.
+var mutatingPrefixes = []string{"Put", "Delete", "Copy", "Create", "Upload", "Complete", "Abort", "Restore"}
+
+// IsMutating reports whether the S3 operation changes data.
+func IsMutating(op string) bool {
+	for _, p := range mutatingPrefixes {
+		if strings.HasPrefix(op, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithAuditLog appends an AuditEntry as a JSON line to w for every
+// mutating operation the client completes, successful or not. Each entry
+// is written with a single Write, so an O_APPEND file may be shared by
+// concurrent runs.
+func WithAuditLog(w io.Writer) ClientOption {
+	var mu sync.Mutex
+	return func(c *Client) {
+		c.Handlers.Complete.PushBack(func(r *request.Request) {
+			if !IsMutating(r.Operation.Name) {
+				return
+			}
+			line, err := json.Marshal(auditEntry(r))
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				orDefault(c.Logger).Error("write audit log", "err", err)
+			}
+		})
+	}
+}
+
+func auditEntry(r *request.Request) AuditEntry {
+	e := AuditEntry{
+		Time:       time.Now().UTC(),
+		Operation:  r.Operation.Name,
+		Bucket:     paramString(r.Params, "Bucket"),
+		Key:        paramString(r.Params, "Key"),
+		UploadID:   paramString(r.Params, "UploadId"),
+		CopySource: paramString(r.Params, "CopySource"),
+		RequestID:  r.RequestID,
+		Attempts:   r.RetryCount + 1,
+		DurationMS: time.Since(r.Time).Milliseconds(),
+		Result:     "ok",
+	}
+	if n, ok := paramField(r.Params, "PartNumber").(*int64); ok {
+		e.PartNumber = aws.Int64Value(n)
+	}
+	if paramField(r.Params, "Body") != nil {
+		e.Size = r.HTTPRequest.ContentLength
+		if n, ok := paramField(r.Params, "ContentLength").(*int64); ok && n != nil {
+			e.Size = *n
+		}
+	}
+	if out, ok := r.Data.(*s3.CreateMultipartUploadOutput); ok && r.Error == nil {
+		// Parts and the completion name the upload; so does its creation,
+		// for them to be matched up.
+		e.UploadID = aws.StringValue(out.UploadId)
+	}
+	if in, ok := r.Params.(*s3.DeleteObjectsInput); ok && in.Delete != nil {
+		for _, o := range in.Delete.Objects {
+			e.Keys = append(e.Keys, aws.StringValue(o.Key))
+		}
+	}
+	if r.HTTPResponse != nil {
+		e.Status = r.HTTPResponse.StatusCode
+	}
+	if r.Error != nil {
+		e.Result, e.Error = "error", r.Error.Error()
+		var aerr awserr.Error
+		if errors.As(r.Error, &aerr) {
+			e.Result, e.Error = aerr.Code(), aerr.Message()
+		}
+	} else if out, ok := r.Data.(*s3.DeleteObjectsOutput); ok && len(out.Errors) > 0 {
+		// DeleteObjects succeeds as a whole while failing single keys.
+		e.Result = "partial"
+		e.Error = aws.StringValue(out.Errors[0].Key) + ": " + aws.StringValue(out.Errors[0].Code)
+	}
+	return e
+}
+
+// paramField returns the named field of an operation's input struct, or
+// nil.
+func paramField(params any, name string) any {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	f := v.Elem().FieldByName(name)
+	if !f.IsValid() {
+		return nil
+	}
+	return f.Interface()
+}
+
+func paramString(params any, name string) string {
+	s, _ := paramField(params, name).(*string)
+	return aws.StringValue(s)
+}
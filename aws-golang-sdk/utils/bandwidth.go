@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthChunk is the most a limited reader reads per grant, so that
+// flows take turns at a fine grain.
+const bandwidthChunk = 32 << 10
+
+// Bandwidth is a transfer rate shared by every transfer in a process.
+// Limiting each transfer separately oversubscribes the link as soon as
+// several run at once; a Bandwidth instead paces all of them together and
+// divides the rate fairly between objects. Each object gets a Flow, and
+// the flows with data waiting are served in turn, so a download reading
+// sixteen ranges at once gets the same share as one reading a single
+// range. A nil *Bandwidth does not limit anything.
+type Bandwidth struct {
+	rate float64
+
+	mu      sync.Mutex
+	waiting []*Flow
+	running bool
+	// free is when the rate allows the next read.
+	free time.Time
+}
+
+// NewBandwidth returns a Bandwidth of bytesPerSecond.
+func NewBandwidth(bytesPerSecond int64) *Bandwidth {
+	return &Bandwidth{rate: float64(max(bytesPerSecond, 1))}
+}
+
+// Flow is the share of a Bandwidth used by one object, however many
+// readers it has. A nil *Flow does not limit anything.
+type Flow struct {
+	b       *Bandwidth
+	pending []*grant
+}
+
+type grant struct {
+	n         int
+	ready     chan struct{}
+	cancelled bool
+}
+
+// Flow returns a new flow of b.
+func (b *Bandwidth) Flow() *Flow {
+	if b == nil {
+		return nil
+	}
+	return &Flow{b: b}
+}
+
+// Reader returns a reader of r that waits for its turn of the flow's
+// bandwidth before each read. The wait ends early, with ctx's error, when
+// ctx is done.
+func (f *Flow) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if f == nil {
+		return r
+	}
+	return &flowReader{ctx: ctx, f: f, r: r}
+}
+
+type flowReader struct {
+	ctx context.Context
+	f   *Flow
+	r   io.Reader
+}
+
+func (fr *flowReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+	if err := fr.f.wait(fr.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return fr.r.Read(p)
+}
+
+// wait blocks until the flow may read n bytes.
+func (f *Flow) wait(ctx context.Context, n int) error {
+	b := f.b
+	g := &grant{n: n, ready: make(chan struct{})}
+	b.mu.Lock()
+	if len(f.pending) == 0 {
+		b.waiting = append(b.waiting, f)
+	}
+	f.pending = append(f.pending, g)
+	if !b.running {
+		b.running = true
+		go b.schedule()
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-g.ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		g.cancelled = true
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// schedule grants reads one at a time, each flow with reads waiting in
+// turn, spacing them by their size over the rate. The next read is only
+// chosen once the rate allows it, so a flow whose read was just granted
+// has had time to queue its next one and keeps its turn. It runs while
+// there are reads waiting.
+func (b *Bandwidth) schedule() {
+	for {
+		time.Sleep(time.Until(b.free))
+		b.mu.Lock()
+		g := b.next()
+		if g == nil {
+			b.running = false
+			b.mu.Unlock()
+			return
+		}
+		// An idle link does not bank time for a later burst.
+		b.free = time.Now().Add(time.Duration(float64(g.n) / b.rate * float64(time.Second)))
+		close(g.ready)
+		b.mu.Unlock()
+	}
+}
+
+// next removes and returns the first live grant of the flow whose turn it
+// is, moving the flow to the back of the line, or nil if nothing is
+// waiting. b.mu must be held.
+func (b *Bandwidth) next() *grant {
+	for len(b.waiting) > 0 {
+		f := b.waiting[0]
+		b.waiting = b.waiting[1:]
+		g := f.pending[0]
+		f.pending = f.pending[1:]
+		if len(f.pending) > 0 {
+			b.waiting = append(b.waiting, f)
+		}
+		if !g.cancelled {
+			return g
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package utils
+
+import "os"
+
+// FileSize returns the size of the open file f. Stat reports a block
+// device such as /dev/sdb or an LVM snapshot as zero bytes, so for those
+// the size is asked of the device instead: with the BLKGETSIZE64 ioctl on
+// Linux, by seeking to the end elsewhere. Upload and the multipart
+// uploads size their input this way, so a disk can be uploaded straight
+// from its device without first copying it to an image file.
+func FileSize(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Mode()&os.ModeDevice == 0 || info.Mode()&os.ModeCharDevice != 0 {
+		return info.Size(), nil
+	}
+	return blockDeviceSize(f)
+}
+
+// PathSize returns FileSize of the file at path.
+func PathSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return FileSize(f)
+}
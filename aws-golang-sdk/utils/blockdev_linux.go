@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// blkGetSize64 is BLKGETSIZE64 from <linux/fs.h>: _IOR(0x12, 114, size_t).
+const blkGetSize64 = 0x80081272
+
+func blockDeviceSize(f *os.File) (int64, error) {
+	var size uint64
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), blkGetSize64, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return 0, fmt.Errorf("%s: BLKGETSIZE64: %w", f.Name(), errno)
+	}
+	return int64(size), nil
+}
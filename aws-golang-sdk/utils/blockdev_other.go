@@ -0,0 +1,19 @@
+//go:build !linux
+
+package utils
+
+import (
+	"io"
+	"os"
+)
+
+// blockDeviceSize seeks to the end of f, which gives the size of a block
+// device on the BSDs and macOS.
+func blockDeviceSize(f *os.File) (int64, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return size, err
+}
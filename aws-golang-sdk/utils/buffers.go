@@ -0,0 +1,24 @@
+package utils
+
+import "sync"
+
+// bufferPool recycles part buffers between parts of one upload, so
+// buffered uploads allocate roughly one buffer per worker rather than one
+// per part.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// get returns a buffer of exactly size bytes.
+func (b *bufferPool) get(size int64) *[]byte {
+	if buf, ok := b.pool.Get().(*[]byte); ok && int64(cap(*buf)) >= size {
+		*buf = (*buf)[:size]
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+func (b *bufferPool) put(buf *[]byte) {
+	b.pool.Put(buf)
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Per-part checksum algorithms for UploadOptions.Checksum.
+const (
+	ChecksumNone   = "none"
+	ChecksumMD5    = "md5"
+	ChecksumCRC32C = "crc32c"
+	ChecksumSHA256 = "sha256"
+)
+
+// ErrETagMismatch is matched by the error of an upload with
+// UploadOptions.VerifyUpload when an ETag the server returned is not the
+// one computed from the data sent: the MD5 of an object or part, or the
+// multipart ETag of the parts.
+var ErrETagMismatch = errors.New("ETag does not match the data sent")
+
+// castagnoli is the CRC32C table. hash/crc32 computes it with the SSE4.2
+// CRC32 instruction on amd64 and the CRC32C instructions on arm64, which
+// keeps up with 10GbE on a single core where MD5 does not.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func checkChecksum(algorithm string) error {
+	switch algorithm {
+	case "", ChecksumNone, ChecksumMD5, ChecksumCRC32C, ChecksumSHA256:
+		return nil
+	}
+	return fmt.Errorf("unknown checksum algorithm %q", algorithm)
+}
+
+// PartChecksum is a precomputed checksum of one part.
+type PartChecksum struct {
+	// Algorithm is ChecksumMD5, ChecksumCRC32C or ChecksumSHA256; empty
+	// means none.
+	Algorithm string
+	// Value is the base64 digest, as sent in the request header.
+	Value string
+}
+
+// apply sets the checksum on an UploadPart request.
+func (c PartChecksum) apply(in *s3.UploadPartInput) {
+	if c.Value == "" {
+		return
+	}
+	switch c.Algorithm {
+	case ChecksumMD5:
+		in.ContentMD5 = aws.String(c.Value)
+	case ChecksumCRC32C:
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmCrc32c)
+		in.ChecksumCRC32C = aws.String(c.Value)
+	case ChecksumSHA256:
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+		in.ChecksumSHA256 = aws.String(c.Value)
+	}
+}
+
+// applyPut sets the checksum on a PutObject request.
+func (c PartChecksum) applyPut(in *s3.PutObjectInput) {
+	if c.Value == "" {
+		return
+	}
+	switch c.Algorithm {
+	case ChecksumMD5:
+		in.ContentMD5 = aws.String(c.Value)
+	case ChecksumCRC32C:
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmCrc32c)
+		in.ChecksumCRC32C = aws.String(c.Value)
+	case ChecksumSHA256:
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+		in.ChecksumSHA256 = aws.String(c.Value)
+	}
+}
+
+// partChecksum returns the checksum of part p of r.
+func partChecksum(r io.ReaderAt, p Part, algorithm string) (PartChecksum, error) {
+	var h hash.Hash
+	switch algorithm {
+	case ChecksumCRC32C:
+		h = crc32.New(castagnoli)
+	case ChecksumSHA256:
+		h = sha256.New()
+	default:
+		h = md5.New()
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(r, p.Offset, p.Size)); err != nil {
+		return PartChecksum{}, fmt.Errorf("hash part %d: %w", p.Number, err)
+	}
+	return PartChecksum{Algorithm: algorithm, Value: base64.StdEncoding.EncodeToString(h.Sum(nil))}, nil
+}
+
+// partMD5 returns the hex MD5 of part p of r, the ETag S3 gives it, taken
+// from sum when that already is its MD5.
+func partMD5(r io.ReaderAt, p Part, sum PartChecksum) (string, error) {
+	if sum.Algorithm == ChecksumMD5 && sum.Value != "" {
+		b, err := base64.StdEncoding.DecodeString(sum.Value)
+		return hex.EncodeToString(b), err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, p.Offset, p.Size)); err != nil {
+		return "", fmt.Errorf("hash part %d: %w", p.Number, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// partSums hashes parts on a background goroutine, in part order, so the
+// checksum of the next part is ready by the time a worker picks it up
+// instead of being computed on the upload's critical path. The hasher
+// stays at most a window of parts ahead of the uploads, which keeps the
+// parts it reads likely to still be in the page cache when they are sent.
+type partSums struct {
+	sums  []PartChecksum
+	errs  []error
+	ready []chan struct{}
+	slots chan struct{}
+}
+
+// hashAhead starts hashing parts of r. The goroutine exits once every
+// part is hashed or ctx is done.
+func hashAhead(ctx context.Context, r io.ReaderAt, parts []Part, algorithm string, window int) *partSums {
+	s := &partSums{
+		sums:  make([]PartChecksum, len(parts)),
+		errs:  make([]error, len(parts)),
+		ready: make([]chan struct{}, len(parts)),
+		slots: make(chan struct{}, max(window, 1)),
+	}
+	for i := range s.ready {
+		s.ready[i] = make(chan struct{})
+	}
+	go func() {
+		for i, p := range parts {
+			select {
+			case s.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			s.sums[i], s.errs[i] = partChecksum(r, p, algorithm)
+			close(s.ready[i])
+		}
+	}()
+	return s
+}
+
+// take waits for the checksum of part i and lets the hasher move on.
+func (s *partSums) take(ctx context.Context, i int) (PartChecksum, error) {
+	select {
+	case <-s.ready[i]:
+	case <-ctx.Done():
+		return PartChecksum{}, ctx.Err()
+	}
+	<-s.slots
+	return s.sums[i], s.errs[i]
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// IncompleteUpload is a multipart upload that was started and neither
+// completed nor aborted. Its parts stay on the server, and count against
+// the bucket's capacity, until it is aborted.
+type IncompleteUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+	// Err is the error of aborting the upload, if it failed.
+	Err error
+}
+
+// CleanupOptions configures CleanupIncompleteUploads. Zero values select
+// the defaults.
+type CleanupOptions struct {
+	// Prefix restricts the cleanup to keys under it.
+	Prefix string
+	// DryRun lists the stale uploads without aborting them.
+	DryRun bool
+	// Concurrency is the number of uploads aborted at once.
+	Concurrency int
+	// Confirm, when set, is called with the stale uploads before any is
+	// aborted; an error stops the cleanup without changes (see Confirm).
+	// It is not called in dry-run mode.
+	Confirm func([]IncompleteUpload) error
+}
+
+// ListIncompleteUploads returns the multipart uploads in progress under
+// prefix in bucket, oldest first within each key as the server lists
+// them.
+func ListIncompleteUploads(ctx context.Context, svc s3iface.S3API, bucket, prefix string) ([]IncompleteUpload, error) {
+	var uploads []IncompleteUpload
+	err := svc.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, _ bool) bool {
+		for _, u := range page.Uploads {
+			uploads = append(uploads, IncompleteUpload{
+				Key:       aws.StringValue(u.Key),
+				UploadID:  aws.StringValue(u.UploadId),
+				Initiated: aws.TimeValue(u.Initiated),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list multipart uploads: %w", err)
+	}
+	return uploads, nil
+}
+
+// CleanupIncompleteUploads aborts the multipart uploads in bucket that
+// were initiated more than olderThan ago, releasing their parts. Uploads
+// interrupted by a crash, a killed process or a lost connection are never
+// aborted by the uploader, and S3 keeps their parts indefinitely unless a
+// lifecycle rule expires them. olderThan should leave a margin over the
+// longest upload that may still be running, since aborting it fails that
+// upload. It returns the stale uploads with the outcome of each abort; a
+// failed abort does not stop the others.
+func CleanupIncompleteUploads(ctx context.Context, svc s3iface.S3API, bucket string, olderThan time.Duration, opts CleanupOptions) ([]IncompleteUpload, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	all, err := ListIncompleteUploads(ctx, svc, bucket, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var stale []IncompleteUpload
+	for _, u := range all {
+		if u.Initiated.Before(cutoff) {
+			stale = append(stale, u)
+		}
+	}
+	if opts.DryRun || len(stale) == 0 {
+		return stale, nil
+	}
+	if opts.Confirm != nil {
+		if err := opts.Confirm(stale); err != nil {
+			return nil, err
+		}
+	}
+	errs := ForEachErr(ctx, len(stale), opts.Concurrency, true, func(i int) error {
+		_, err := svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(stale[i].Key),
+			UploadId: aws.String(stale[i].UploadID),
+		})
+		return err
+	})
+	for i, err := range errs {
+		stale[i].Err = err
+	}
+	return stale, ctx.Err()
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ErrCodeRequestTimeTooSkewed is the error code of a request whose
+// signing time is too far (15 minutes for SigV4) from the server's clock.
+const ErrCodeRequestTimeTooSkewed = "RequestTimeTooSkewed"
+
+// ClockSkew is the offset of the server's clock from the local one, as
+// last measured from a RequestTimeTooSkewed response. Lab Prism Centrals
+// often drift without NTP, and SigV4 rejects every request once the two
+// clocks are 15 minutes apart; signing with Now instead of time.Now keeps
+// requests within the window. The zero value assumes no skew and is safe
+// for concurrent use.
+type ClockSkew struct {
+	offset atomic.Int64
+}
+
+// Now returns the local time corrected by the measured skew.
+func (s *ClockSkew) Now() time.Time {
+	return time.Now().Add(s.Offset())
+}
+
+// Offset returns how far the server's clock is ahead of the local one.
+func (s *ClockSkew) Offset() time.Duration {
+	return time.Duration(s.offset.Load())
+}
+
+// Correct measures the skew from the Date header of resp and reports
+// whether it could. The header has a resolution of a second, well inside
+// the signing window.
+func (s *ClockSkew) Correct(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	s.offset.Store(int64(time.Until(date)))
+	return true
+}
+
+// correctClockSkew retries, once, a request rejected as
+// RequestTimeTooSkewed after measuring the skew from the response, so the
+// retry is signed with the server's time. Later requests are signed with
+// the corrected time from the start.
+func (c *Client) correctClockSkew(skew *ClockSkew) {
+	c.Handlers.Retry.PushFront(func(r *request.Request) {
+		var aerr awserr.Error
+		if r.RetryCount > 0 || !errors.As(r.Error, &aerr) || aerr.Code() != ErrCodeRequestTimeTooSkewed {
+			return
+		}
+		if !skew.Correct(r.HTTPResponse) {
+			return
+		}
+		orDefault(c.Logger).Warn("local clock is skewed from the server; signing with the server's time", "op", r.Operation.Name, "offset", skew.Offset().Round(time.Second))
+		r.Retryable = aws.Bool(true)
+	})
+}
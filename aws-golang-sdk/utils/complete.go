@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DefaultCompleteAttempts is the number of times CompleteMultipartUpload
+// is sent when UploadOptions.CompleteAttempts is zero.
+const DefaultCompleteAttempts = 3
+
+// ErrInvalidParts is matched, with errors.Is, by the error of
+// CheckCompletedParts, and so of every upload helper that refuses to
+// complete an upload whose part list is wrong.
+var ErrInvalidParts = errors.New("invalid part list")
+
+// ErrCompleteUnconfirmed is matched by the error of CompleteMultipartUpload
+// when a completion failed ambiguously and the upload is gone, but the
+// object under the key is not the one the parts make up: the upload was
+// aborted by someone else, or the key was overwritten since.
+var ErrCompleteUnconfirmed = errors.New("multipart upload completion could not be confirmed")
+
+// errStillOpen and errStateUnknown mark a failed completion that is safe
+// to send again: the upload was found still open, or could not be looked
+// up, in which case the next attempt finds out again.
+var (
+	errStillOpen    = errors.New("upload still open")
+	errStateUnknown = errors.New("upload state unknown")
+)
+
+// maxListedParts bounds the part numbers quoted per problem in the error
+// of CheckCompletedParts.
+const maxListedParts = 10
+
+// CheckCompletedParts checks the part list of a CompleteMultipartUpload
+// before it is sent: parts numbered 1 to n in ascending order, each once
+// and with an ETag, and n equal to want when want is positive. The server
+// answers a wrong list with an InvalidPart or InvalidPartOrder error that
+// does not say which part is at fault; the error returned here lists
+// every problem found. Different parts with the same ETag are allowed,
+// as parts with the same content, such as runs of zeros in a disk image,
+// have the same MD5.
+func CheckCompletedParts(parts []*s3.CompletedPart, want int) error {
+	var unnumbered int
+	var missing, duplicate, outOfOrder, noETag []int64
+	seen := make(map[int64]bool, len(parts))
+	var last, highest int64
+	for _, p := range parts {
+		if p == nil {
+			// A part that was never completed; reported as missing.
+			continue
+		}
+		if p.PartNumber == nil {
+			unnumbered++
+			continue
+		}
+		n := *p.PartNumber
+		switch {
+		case seen[n]:
+			duplicate = append(duplicate, n)
+		case n < last:
+			outOfOrder = append(outOfOrder, n)
+		}
+		seen[n], last, highest = true, n, max(highest, n)
+		if strings.Trim(aws.StringValue(p.ETag), `"`) == "" {
+			noETag = append(noETag, n)
+		}
+	}
+	for n := int64(1); n <= max(highest, int64(want)); n++ {
+		if !seen[n] {
+			missing = append(missing, n)
+		}
+	}
+
+	var problems []string
+	if want > 0 && len(parts) != want {
+		problems = append(problems, fmt.Sprintf("%d parts, want %d", len(parts), want))
+	}
+	if len(parts) > MaxParts {
+		problems = append(problems, fmt.Sprintf("%d parts, over the limit of %d", len(parts), MaxParts))
+	}
+	if unnumbered > 0 {
+		problems = append(problems, fmt.Sprintf("%d without a part number", unnumbered))
+	}
+	problems = appendParts(problems, "missing", missing)
+	problems = appendParts(problems, "listed twice", duplicate)
+	problems = appendParts(problems, "out of order", outOfOrder)
+	problems = appendParts(problems, "without an ETag", noETag)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidParts, strings.Join(problems, "; "))
+}
+
+// appendParts adds "parts 1, 2, 3 what" to problems if numbers is not
+// empty, quoting at most maxListedParts numbers.
+func appendParts(problems []string, what string, numbers []int64) []string {
+	if len(numbers) == 0 {
+		return problems
+	}
+	quoted := make([]string, 0, min(len(numbers), maxListedParts))
+	for _, n := range numbers[:min(len(numbers), maxListedParts)] {
+		quoted = append(quoted, strconv.FormatInt(n, 10))
+	}
+	list := strings.Join(quoted, ", ")
+	if len(numbers) > maxListedParts {
+		list += fmt.Sprintf(" and %d more", len(numbers)-maxListedParts)
+	}
+	label := "part"
+	if len(numbers) > 1 {
+		label = "parts"
+	}
+	return append(problems, fmt.Sprintf("%s %s %s", label, list, what))
+}
+
+// CompleteMultipartUpload completes an upload from its parts. A call can
+// fail without saying whether it took effect: the response is lost to a
+// timeout or reset connection, or the SDK's own retry of a 5xx finds the
+// upload already completed and answers NoSuchUpload. Sending it again
+// blindly would fail, and aborting could throw away an upload that is
+// still open, so after such a failure the upload is looked up first.
+// If ListParts still finds it, Complete is retried, up to
+// opts.CompleteAttempts times with the backoff of opts.Retry. If it is
+// gone, HeadObject decides: an object whose ETag is the one the parts
+// make up means the earlier call succeeded, and its output is returned;
+// anything else fails with ErrCompleteUnconfirmed. Failures the server
+// states plainly, such as InvalidPart, are returned at once.
+func CompleteMultipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key, uploadID string, parts []*s3.CompletedPart, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	opts.setDefaults()
+	retryable := opts.Retry.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	policy := opts.Retry
+	policy.MaxAttempts = opts.CompleteAttempts
+	policy.Retryable = func(err error) bool {
+		return errors.Is(err, errStillOpen) || errors.Is(err, errStateUnknown)
+	}
+	logRetry := LogRetry(opts.Logger, "CompleteMultipartUpload", key, 0)
+
+	var out *s3.CompleteMultipartUploadOutput
+	err := RetryWithPolicy(ctx, policy, NewRetryBudget(opts.CompleteAttempts), func() error {
+		var err error
+		out, err = svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		if err == nil || ctx.Err() != nil || !(retryable(err) || IsNotFound(err)) {
+			return err
+		}
+		done, open, lookupErr := completionState(ctx, svc, bucket, key, uploadID, parts)
+		switch {
+		case done != nil:
+			orDefault(opts.Logger).Info("multipart upload had completed despite the error", "key", key, "upload_id", uploadID, "error", err)
+			out = done
+			return nil
+		case open:
+			return fmt.Errorf("%w: %w", errStillOpen, err)
+		case lookupErr != nil:
+			return fmt.Errorf("%w: %w (after %w)", ErrCompleteUnconfirmed, lookupErr, err)
+		}
+		return fmt.Errorf("%w: %w", errStateUnknown, err)
+	}, func(attempt int, wait time.Duration, err error) {
+		logRetry(attempt, wait, err)
+		opts.emit(Event{Type: EventRetry, Key: key, Attempt: attempt, Wait: wait, Error: err.Error()})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return out, nil
+}
+
+// completionState looks up an upload whose completion failed ambiguously.
+// It returns the output of the completion if the upload became the object
+// under key, open if it still exists, or an error if it is gone and the
+// object is not its result. All three are empty when the lookup failed.
+func completionState(ctx context.Context, svc s3iface.S3API, bucket, key, uploadID string, parts []*s3.CompletedPart) (done *s3.CompleteMultipartUploadOutput, open bool, err error) {
+	_, err = svc.ListPartsWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+		MaxParts: aws.Int64(1),
+	})
+	if err == nil {
+		return nil, true, nil
+	}
+	if !IsNotFound(err) {
+		return nil, false, nil
+	}
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if IsNotFound(err) {
+		return nil, false, fmt.Errorf("upload %s is gone and %s does not exist", uploadID, key)
+	}
+	if err != nil {
+		return nil, false, nil
+	}
+	want, ok := partsETag(parts)
+	if !ok {
+		return nil, false, fmt.Errorf("upload %s is gone and the ETags of its parts cannot be combined to check %s", uploadID, key)
+	}
+	if !SameETag(aws.StringValue(head.ETag), want) {
+		return nil, false, fmt.Errorf("upload %s is gone and %s has ETag %s, not %s", uploadID, key, aws.StringValue(head.ETag), want)
+	}
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		ETag:      head.ETag,
+		VersionId: head.VersionId,
+	}, false, nil
+}
+
+// partsETag returns the ETag of the object the parts make up: the MD5 of
+// their concatenated binary MD5s, a dash and the part count. It reports
+// false if a part ETag is not an MD5, as with some server-side
+// encryption.
+func partsETag(parts []*s3.CompletedPart) (string, bool) {
+	h := md5.New()
+	for _, p := range parts {
+		sum, err := hex.DecodeString(strings.Trim(aws.StringValue(p.ETag), `"`))
+		if err != nil || len(sum) != md5.Size {
+			return "", false
+		}
+		h.Write(sum)
+	}
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(h.Sum(nil)), len(parts)), true
+}
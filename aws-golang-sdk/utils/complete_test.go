@@ -0,0 +1,177 @@
+package utils_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// flakyComplete runs fail around each CompleteMultipartUpload call; fail
+// decides whether the real call is made and which error is returned.
+type flakyComplete struct {
+	s3iface.S3API
+	calls int
+	fail  func(call int, complete func() error) error
+}
+
+func (f *flakyComplete) CompleteMultipartUploadWithContext(ctx aws.Context, in *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	f.calls++
+	var out *s3.CompleteMultipartUploadOutput
+	err := f.fail(f.calls, func() error {
+		var err error
+		out, err = f.S3API.CompleteMultipartUploadWithContext(ctx, in, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// completeEnv is what a flakyComplete failure may act on.
+type completeEnv struct {
+	srv      *objectslitetest.Server
+	svc      s3iface.S3API
+	uploadID string
+}
+
+// startUpload creates an upload of two parts of data under b/k and
+// returns its ID and parts.
+func startUpload(t *testing.T, svc s3iface.S3API, data []byte) (string, []*s3.CompletedPart) {
+	t.Helper()
+	ctx := context.Background()
+	created, err := svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []*s3.CompletedPart
+	for i, chunk := range [][]byte{data[:len(data)/2], data[len(data)/2:]} {
+		out, err := svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String("b"),
+			Key:        aws.String("k"),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int64(int64(i) + 1),
+			Body:       bytes.NewReader(chunk),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, &s3.CompletedPart{PartNumber: aws.Int64(int64(i) + 1), ETag: out.ETag})
+	}
+	return aws.StringValue(created.UploadId), parts
+}
+
+func TestCompleteMultipartUploadReconciles(t *testing.T) {
+	errLost := errors.New("read: connection reset by peer")
+	tests := []struct {
+		name      string
+		fail      func(e completeEnv, call int, complete func() error) error
+		badETag   bool
+		wantCalls int
+		wantErr   error
+		wantData  bool
+	}{
+		{
+			name: "response lost after completing",
+			fail: func(_ completeEnv, _ int, complete func() error) error {
+				if err := complete(); err != nil {
+					return err
+				}
+				return errLost
+			},
+			wantCalls: 1,
+			wantData:  true,
+		},
+		{
+			name: "failed while still open is sent again",
+			fail: func(_ completeEnv, call int, complete func() error) error {
+				if call == 1 {
+					return errLost
+				}
+				return complete()
+			},
+			wantCalls: 2,
+			wantData:  true,
+		},
+		{
+			name: "aborted by someone else",
+			fail: func(e completeEnv, _ int, _ func() error) error {
+				e.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("k"), UploadId: aws.String(e.uploadID)})
+				return errLost
+			},
+			wantCalls: 1,
+			wantErr:   utils.ErrCompleteUnconfirmed,
+		},
+		{
+			name: "key overwritten after completing",
+			fail: func(e completeEnv, _ int, complete func() error) error {
+				if err := complete(); err != nil {
+					return err
+				}
+				e.srv.PutObject("b", "k", []byte("someone else's"))
+				return errLost
+			},
+			wantCalls: 1,
+			wantErr:   utils.ErrCompleteUnconfirmed,
+		},
+		{
+			name: "invalid part fails at once",
+			fail: func(_ completeEnv, _ int, complete func() error) error {
+				return complete()
+			},
+			badETag:   true,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			client := srv.Client(t)
+			data := objectslitetest.Data(1 << 20)
+			uploadID, parts := startUpload(t, client, data)
+			if tt.badETag {
+				parts[1].ETag = aws.String(`"0123456789abcdef0123456789abcdef"`)
+			}
+			env := completeEnv{srv: srv, svc: client, uploadID: uploadID}
+			svc := &flakyComplete{S3API: client, fail: func(call int, complete func() error) error {
+				return tt.fail(env, call, complete)
+			}}
+			opts := utils.UploadOptions{Retry: utils.RetryPolicy{BaseDelay: time.Millisecond}}
+
+			out, err := utils.CompleteMultipartUpload(context.Background(), svc, "b", "k", uploadID, parts, opts)
+			if svc.calls != tt.wantCalls {
+				t.Fatalf("Complete sent %d times, want %d", svc.calls, tt.wantCalls)
+			}
+			switch {
+			case tt.wantData:
+				if err != nil {
+					t.Fatal(err)
+				}
+				obj, _ := srv.Object("b", "k")
+				if aws.StringValue(out.ETag) != obj.ETag {
+					t.Fatalf("returned ETag %s, object has %s", aws.StringValue(out.ETag), obj.ETag)
+				}
+				objectslitetest.AssertObject(t, srv, "b", "k", data)
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || errors.Is(err, utils.ErrCompleteUnconfirmed) {
+					t.Fatalf("err = %v, want the server's InvalidPart", err)
+				}
+			}
+		})
+	}
+}
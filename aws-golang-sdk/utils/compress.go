@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// MetaUncompressedSize is the user metadata key (x-amz-meta-*) holding
+// the original size of an object compressed by a CompressionPolicy. Its
+// presence also tells downloads to decompress the object.
+const MetaUncompressedSize = "uncompressed-size"
+
+// DefaultCompressionMinSize is CompressionPolicy.MinSize when unset;
+// smaller files gain too little to be worth compressing.
+const DefaultCompressionMinSize int64 = 4 << 10
+
+// CompressionPolicy decides by file name which uploads are gzipped. It is
+// usually loaded from a JSON file:
+//
+//	{"compress": ["*.log", "*.csv", "*.json"], "skip": ["*.gz", "*.jpg"], "min_size": 4096}
+//
+// Patterns use path.Match syntax and are matched, case-insensitively,
+// against the base name. Skip wins over Compress, and names matching
+// neither are uploaded as they are.
+type CompressionPolicy struct {
+	Compress []string `json:"compress"`
+	Skip     []string `json:"skip"`
+	// MinSize is the smallest file compressed. Zero selects
+	// DefaultCompressionMinSize.
+	MinSize int64 `json:"min_size"`
+	// Level is the gzip level; zero selects gzip.DefaultCompression.
+	Level int `json:"level"`
+}
+
+// LoadCompressionPolicy reads and validates a policy file.
+func LoadCompressionPolicy(file string) (*CompressionPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p CompressionPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for _, pattern := range append(p.Compress, p.Skip...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: pattern %q: %w", file, pattern, err)
+		}
+	}
+	if p.Level < gzip.HuffmanOnly || p.Level > gzip.BestCompression {
+		return nil, fmt.Errorf("%s: invalid gzip level %d", file, p.Level)
+	}
+	return &p, nil
+}
+
+// Matches reports whether the policy compresses files called name,
+// whatever their size. A nil policy matches nothing.
+func (p *CompressionPolicy) Matches(name string) bool {
+	if p == nil {
+		return false
+	}
+	base := strings.ToLower(filepath.Base(name))
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToLower(pattern), base); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return !match(p.Skip) && match(p.Compress)
+}
+
+// ShouldCompress reports whether a file called name of size bytes is
+// compressed.
+func (p *CompressionPolicy) ShouldCompress(name string, size int64) bool {
+	if !p.Matches(name) {
+		return false
+	}
+	minSize := p.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	return size >= minSize
+}
+
+// uploadCompressed gzips the file at file while streaming it to
+// UploadStream, recording the original size in the metadata.
+func uploadCompressed(ctx context.Context, svc s3iface.S3API, bucket, key, file string, size int64, opts UploadOptions) (*UploadResult, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	level := opts.Compression.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	md := make(map[string]*string, len(opts.Metadata)+1)
+	for k, v := range opts.Metadata {
+		md[k] = v
+	}
+	md[MetaUncompressedSize] = aws.String(strconv.FormatInt(size, 10))
+	opts.Metadata = md
+	opts.ContentEncoding = "gzip"
+	opts.Compression = nil
+
+	pr, pw := io.Pipe()
+	go func() {
+		zw, err := gzip.NewWriterLevel(pw, level)
+		if err == nil {
+			_, err = io.Copy(zw, f)
+			if cerr := zw.Close(); err == nil {
+				err = cerr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	out, err := UploadStream(ctx, svc, bucket, key, pr, opts)
+	// Unblock the compressor if the upload stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	return out, err
+}
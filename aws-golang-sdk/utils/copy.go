@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// CopySource returns the x-amz-copy-source value for bucket/key, escaping
+// each path segment of the key.
+func CopySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+const (
+	// MaxCopyObjectSize is the largest object CopyObject accepts; bigger
+	// objects must be copied part by part with UploadPartCopy.
+	MaxCopyObjectSize int64 = 5 << 30
+	// DefaultCopyPartSize is the UploadPartCopy range size.
+	DefaultCopyPartSize int64 = 512 << 20
+	// MaxParts is the S3 limit on parts per multipart upload.
+	MaxParts = 10000
+)
+
+// CopyOptions tunes ServerSideCopy. Zero values select the defaults.
+type CopyOptions struct {
+	// Threshold is the size above which a multipart copy is used.
+	Threshold   int64
+	PartSize    int64
+	Concurrency int
+	// Metadata, when not nil, replaces the source's user metadata on the
+	// copy; the content headers are carried over either way.
+	Metadata map[string]*string
+	// IfMatch, when set, is the ETag the source must still have, for
+	// callers that decided on the copy from an earlier HeadObject.
+	IfMatch string
+	// StorageClass, when set, is the storage class of the copy.
+	StorageClass string
+	// ContentType, CacheControl, ContentDisposition and ContentEncoding,
+	// when set, replace the source's headers on the copy.
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	// Tags, when not nil, is the tag set of the copy; otherwise the
+	// source's tags are kept.
+	Tags map[string]string
+}
+
+// ServerSideCopy copies srcBucket/srcKey to dstBucket/dstKey without
+// moving data through the client. Objects above opts.Threshold are copied
+// with UploadPartCopy, carrying the source headers, metadata and tags over
+// explicitly since a multipart upload does not inherit them. A failed
+// multipart copy is aborted.
+func ServerSideCopy(ctx context.Context, svc s3iface.S3API, srcBucket, srcKey, dstBucket, dstKey string, opts CopyOptions) error {
+	if opts.Threshold <= 0 || opts.Threshold > MaxCopyObjectSize {
+		opts.Threshold = MaxCopyObjectSize
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultCopyPartSize
+	}
+	source := CopySource(srcBucket, srcKey)
+
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return fmt.Errorf("head source: %w", err)
+	}
+	if opts.IfMatch != "" {
+		head.ETag = aws.String(opts.IfMatch)
+	}
+	metadata := head.Metadata
+	if opts.Metadata != nil {
+		metadata = opts.Metadata
+	}
+	if opts.ContentType != "" {
+		head.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.CacheControl != "" {
+		head.CacheControl = aws.String(opts.CacheControl)
+	}
+	if opts.ContentDisposition != "" {
+		head.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if opts.ContentEncoding != "" {
+		head.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	replace := opts.Metadata != nil || opts.ContentType != "" || opts.CacheControl != "" ||
+		opts.ContentDisposition != "" || opts.ContentEncoding != ""
+	size := aws.Int64Value(head.ContentLength)
+	if size <= opts.Threshold {
+		in := &s3.CopyObjectInput{
+			Bucket:            aws.String(dstBucket),
+			Key:               aws.String(dstKey),
+			CopySource:        aws.String(source),
+			CopySourceIfMatch: head.ETag,
+		}
+		if opts.StorageClass != "" {
+			in.StorageClass = aws.String(opts.StorageClass)
+		}
+		if opts.Tags != nil {
+			in.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+			in.Tagging = aws.String(encodeTags(opts.Tags))
+		}
+		if replace {
+			in.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+			in.Metadata = metadata
+			in.ContentType = head.ContentType
+			in.CacheControl = head.CacheControl
+			in.ContentDisposition = head.ContentDisposition
+			in.ContentEncoding = head.ContentEncoding
+		}
+		_, err := svc.CopyObjectWithContext(ctx, in)
+		return err
+	}
+
+	parts := PlanParts(size, opts.PartSize)
+
+	createIn := &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(dstBucket),
+		Key:                aws.String(dstKey),
+		ContentType:        head.ContentType,
+		CacheControl:       head.CacheControl,
+		ContentDisposition: head.ContentDisposition,
+		ContentEncoding:    head.ContentEncoding,
+		Metadata:           metadata,
+	}
+	if opts.StorageClass != "" {
+		createIn.StorageClass = aws.String(opts.StorageClass)
+	}
+	tags := opts.Tags
+	if tags == nil {
+		tagging, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+			Bucket: aws.String(srcBucket),
+			Key:    aws.String(srcKey),
+		})
+		if err != nil {
+			return fmt.Errorf("get source tags: %w", err)
+		}
+		tags = make(map[string]string, len(tagging.TagSet))
+		for _, t := range tagging.TagSet {
+			tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+	}
+	if len(tags) > 0 {
+		createIn.Tagging = aws.String(encodeTags(tags))
+	}
+	create, err := svc.CreateMultipartUploadWithContext(ctx, createIn)
+	if err != nil {
+		return fmt.Errorf("create multipart copy: %w", err)
+	}
+	uploadID := create.UploadId
+
+	completed := make([]*s3.CompletedPart, len(parts))
+	errs := make([]error, len(parts))
+	ForEach(ctx, len(parts), opts.Concurrency, func(i int) {
+		p := parts[i]
+		out, err := svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(dstBucket),
+			Key:               aws.String(dstKey),
+			UploadId:          uploadID,
+			PartNumber:        aws.Int64(p.Number),
+			CopySource:        aws.String(source),
+			CopySourceIfMatch: head.ETag,
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", p.Offset, p.Offset+p.Size-1)),
+		})
+		if err != nil {
+			errs[i] = fmt.Errorf("copy part %d: %w", p.Number, err)
+			return
+		}
+		completed[i] = &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int64(p.Number)}
+	})
+	err = errors.Join(errs...)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = CheckCompletedParts(completed, len(parts))
+	}
+	if err == nil {
+		_, err = CompleteMultipartUpload(ctx, svc, dstBucket, dstKey, aws.StringValue(uploadID), completed, UploadOptions{})
+	}
+	if err != nil {
+		svc.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(dstBucket),
+			Key:      aws.String(dstKey),
+			UploadId: uploadID,
+		})
+		return err
+	}
+	return nil
+}
+
+// encodeTags returns tags in the query-string form of the x-amz-tagging
+// header.
+func encodeTags(tags map[string]string) string {
+	q := make(url.Values, len(tags))
+	for k, v := range tags {
+		q.Set(k, v)
+	}
+	return q.Encode()
+}
@@ -0,0 +1,77 @@
+package utils_test
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestServerSideCopy(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+		metadata  map[string]*string
+		staleETag bool
+		wantMeta  map[string]string
+		wantErr   bool
+	}{
+		{name: "single copy keeps metadata", wantMeta: map[string]string{"owner": "a"}},
+		{name: "multipart copy keeps metadata", threshold: 1 << 20, wantMeta: map[string]string{"owner": "a"}},
+		{name: "single copy replaces metadata", metadata: map[string]*string{"owner": aws.String("b")},
+			wantMeta: map[string]string{"owner": "b"}},
+		{name: "multipart copy replaces metadata", threshold: 1 << 20, metadata: map[string]*string{"owner": aws.String("b")},
+			wantMeta: map[string]string{"owner": "b"}},
+		{name: "single copy of a changed source", staleETag: true, wantErr: true},
+		{name: "multipart copy of a changed source", threshold: 1 << 20, staleETag: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := objectslitetest.NewServer(t)
+			srv.CreateBucket("b")
+			client := srv.Client(t)
+			data := objectslitetest.Data(3 << 20)
+			_, err := client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket:      aws.String("b"),
+				Key:         aws.String("src"),
+				Body:        bytes.NewReader(data),
+				ContentType: aws.String("text/plain"),
+				Metadata:    map[string]*string{"owner": aws.String("a")},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := utils.CopyOptions{Threshold: tt.threshold, PartSize: 1 << 20, Metadata: tt.metadata}
+			if tt.staleETag {
+				opts.IfMatch = `"0123456789abcdef0123456789abcdef"`
+			}
+
+			err = utils.ServerSideCopy(ctx, client, "b", "src", "b", "dst", opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("copied a source whose ETag no longer matches")
+				}
+				objectslitetest.AssertKeys(t, srv, "b", "src")
+				if n := srv.Uploads(); n != 0 {
+					t.Fatalf("%d multipart uploads left open", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			objectslitetest.AssertObject(t, srv, "b", "dst", data)
+			obj, _ := srv.Object("b", "dst")
+			if !maps.Equal(obj.Metadata, tt.wantMeta) || obj.ContentType != "text/plain" {
+				t.Fatalf("copy has metadata %v and type %q, want %v and text/plain", obj.Metadata, obj.ContentType, tt.wantMeta)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"golang.org/x/term"
+)
+
+// BasicAuthProviderName identifies credentials from a BasicAuthProvider.
+const BasicAuthProviderName = "ObjectsliteBasicAuthProvider"
+
+// BasicAuthProvider is a credentials.Provider for the Objectslite
+// basic-auth scheme (see EncodeCredentials). Unlike static credentials it
+// can expire, after which the next request calls Fetch again, so a
+// long-running process picks up a rotated Prism password without a
+// restart.
+//
+// The SDK serializes calls to Retrieve and IsExpired, so a provider must
+// only be used through a single credentials.Credentials.
+type BasicAuthProvider struct {
+	// Fetch returns the current username and password. It is called for
+	// the first request and again after every expiry.
+	Fetch func() (username, password string, err error)
+	// TTL, when positive, expires fetched credentials after this long.
+	// Credentials also expire when the endpoint rejects them (see
+	// RefreshOnAuthFailure).
+	TTL time.Duration
+
+	fetched bool
+	expires time.Time
+}
+
+// Retrieve fetches and encodes the username and password.
+func (p *BasicAuthProvider) Retrieve() (credentials.Value, error) {
+	username, password, err := p.Fetch()
+	if err != nil {
+		return credentials.Value{ProviderName: BasicAuthProviderName}, fmt.Errorf("fetch credentials: %w", err)
+	}
+	if username == "" || password == "" {
+		return credentials.Value{ProviderName: BasicAuthProviderName}, errors.New("fetch credentials: empty username or password")
+	}
+	p.fetched = true
+	if p.TTL > 0 {
+		p.expires = time.Now().Add(p.TTL)
+	}
+	encoded := EncodeCredentials(username, password)
+	return credentials.Value{
+		AccessKeyID:     encoded,
+		SecretAccessKey: encoded,
+		ProviderName:    BasicAuthProviderName,
+	}, nil
+}
+
+// IsExpired reports whether Fetch must be called before the next request.
+func (p *BasicAuthProvider) IsExpired() bool {
+	return !p.fetched || (p.TTL > 0 && time.Now().After(p.expires))
+}
+
+// RefreshOnAuthFailure adds a handler to handlers that expires creds and
+// retries once when a request is rejected for its credentials, so a
+// rotated password is fetched again instead of failing every request
+// until the TTL runs out. Requests signed with other credentials, such as
+// a tenant's (see Config.Tenants), are left alone.
+func RefreshOnAuthFailure(handlers *request.Handlers, creds *credentials.Credentials) {
+	handlers.Retry.PushFront(func(r *request.Request) {
+		var aerr awserr.Error
+		if r.RetryCount > 0 || r.Config.Credentials != creds || !errors.As(r.Error, &aerr) {
+			return
+		}
+		switch aerr.Code() {
+		case "InvalidAccessKeyId", "SignatureDoesNotMatch", "AccessDenied":
+			creds.Expire()
+			r.Retryable = aws.Bool(true)
+		}
+	})
+}
+
+// fetchPrismCredentials returns the Fetch function for the configured
+// Prism user. The first call returns the resolved username and password.
+// Later calls use c.Refresh when set; otherwise, on a terminal, they
+// prompt for the password again, and elsewhere they keep the current one.
+func (c *Config) fetchPrismCredentials() func() (string, string, error) {
+	first := true
+	return func() (string, string, error) {
+		switch {
+		case first:
+			first = false
+		case c.Refresh != nil:
+			username, password, err := c.Refresh()
+			if err != nil {
+				return "", "", err
+			}
+			c.Username, c.Password = username, password
+		case term.IsTerminal(int(os.Stdin.Fd())):
+			password, err := PromptPassword(fmt.Sprintf("Credentials for %s were rejected or expired; password: ", c.Username))
+			if err != nil {
+				return "", "", err
+			}
+			c.Password = password
+		}
+		return c.Username, c.Password, nil
+	}
+}
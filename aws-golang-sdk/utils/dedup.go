@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// identical checks whether the object at key already holds the content of
+// the file at path, and if so returns it as a skipped upload. The
+// object's x-amz-meta-sha256 is compared when it has one, since it
+// survives compression and any part size; otherwise its ETag is
+// recomputed from the file, which for a multipart object needs the part
+// size it was uploaded with (see MatchesETag). A missing object is not
+// identical; other HeadObject failures are returned.
+func identical(ctx context.Context, svc s3iface.S3API, bucket, key, path string, size int64, opts UploadOptions) (*UploadResult, error) {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("head %s: %w", key, err)
+	}
+	stored := aws.Int64Value(head.ContentLength)
+	if raw := MetadataValue(head.Metadata, MetaUncompressedSize); raw != "" {
+		stored, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	if stored != size {
+		return nil, nil
+	}
+
+	etag := aws.StringValue(head.ETag)
+	var same bool
+	if want := MetadataValue(head.Metadata, MetaSHA256); want != "" {
+		got, err := fileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		same = strings.EqualFold(got, want)
+	} else if MetadataValue(head.Metadata, MetaUncompressedSize) == "" {
+		same, err = MatchesETag(path, etag, ETagPartSize(etag, size, opts.PartSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !same {
+		return nil, nil
+	}
+	return &UploadResult{
+		ETag:      etag,
+		VersionID: aws.StringValue(head.VersionId),
+		Size:      size,
+		Skipped:   true,
+	}, nil
+}
+
+// ETagPartSize returns the part size to recompute a multipart ETag of an
+// object of size bytes with: partSize if it gives the part count in the
+// ETag, or else the smallest whole number of MiB that does, which is what
+// most clients choose. Parts grown with throughput (see PartSizer) fit
+// neither, and the recomputed ETag will not match.
+func ETagPartSize(etag string, size, partSize int64) int64 {
+	_, count, ok := strings.Cut(strings.Trim(etag, `"`), "-")
+	if !ok {
+		return partSize
+	}
+	n, err := strconv.ParseInt(count, 10, 64)
+	if err != nil || n < 1 || int64(len(PlanParts(size, partSize))) == n {
+		return partSize
+	}
+	const mib = 1 << 20
+	guess := ((size+n-1)/n + mib - 1) / mib * mib
+	if int64(len(PlanParts(size, guess))) == n {
+		return guess
+	}
+	return partSize
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
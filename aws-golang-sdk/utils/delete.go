@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// MaxDeleteBatch is the most keys one DeleteObjects request may name.
+const MaxDeleteBatch = 1000
+
+// ErrEmptyPrefix is returned by DeletePrefix for an empty prefix, which
+// would delete the whole bucket, unless DeleteOptions.AllowEmptyPrefix is
+// set.
+var ErrEmptyPrefix = errors.New("refusing to delete every object of the bucket with an empty prefix")
+
+// DeletedObject is the outcome of deleting one key.
+type DeletedObject struct {
+	Key string
+	// Size is the object's size as listed by DeletePrefix; it is zero for
+	// keys given to DeleteObjects.
+	Size int64
+	// Err is the error of deleting the key, if it failed.
+	Err error
+}
+
+// DeleteOptions configures DeleteObjects and DeletePrefix. Zero values
+// select the defaults.
+type DeleteOptions struct {
+	// DryRun returns the keys that would be deleted without deleting
+	// them.
+	DryRun bool
+	// Concurrency is the number of DeleteObjects batches in flight.
+	Concurrency int
+	// Confirm, when set, is called with the number and total listed size
+	// of the objects before any is deleted; an error stops the deletion
+	// without changes (see Confirm). It is not called in dry-run mode.
+	Confirm func(count int, bytes int64) error
+	// AllowEmptyPrefix lets DeletePrefix empty the whole bucket.
+	AllowEmptyPrefix bool
+	// StopOnError starts no further batch once a key fails to delete;
+	// the keys of the batches never sent fail with ErrSkipped.
+	StopOnError bool
+}
+
+// DeleteObject deletes bucket/key. Deleting a key that does not exist
+// succeeds, as S3 answers it like any other delete. In a versioned bucket
+// it adds a delete marker and keeps the versions.
+func DeleteObject(ctx context.Context, svc s3iface.S3API, bucket, key string) error {
+	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteObjects deletes keys from bucket with DeleteObjects requests of up
+// to MaxDeleteBatch keys, opts.Concurrency at a time, and returns the
+// outcome of each key in the order given. A failed request fails every
+// key of its batch; a key the server refuses alone fails by itself, as
+// do the other copies of it when keys repeats it. Neither stops the other
+// batches unless opts.StopOnError is set.
+func DeleteObjects(ctx context.Context, svc s3iface.S3API, bucket string, keys []string, opts DeleteOptions) ([]DeletedObject, error) {
+	objects := make([]DeletedObject, len(keys))
+	for i, k := range keys {
+		objects[i].Key = k
+	}
+	return deleteAll(ctx, svc, bucket, objects, opts)
+}
+
+// DeletePrefix lists every object under prefix in bucket, then deletes
+// them as DeleteObjects does and returns them with the outcome of each.
+// Listing comes first, so opts.Confirm sees the full count and size, and
+// objects written under prefix meanwhile are left alone. With
+// opts.DryRun only the listing is done. An empty prefix fails with
+// ErrEmptyPrefix unless opts.AllowEmptyPrefix is set.
+func DeletePrefix(ctx context.Context, svc s3iface.S3API, bucket, prefix string, opts DeleteOptions) ([]DeletedObject, error) {
+	if prefix == "" && !opts.AllowEmptyPrefix {
+		return nil, ErrEmptyPrefix
+	}
+	var objects []DeletedObject
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, DeletedObject{Key: aws.StringValue(o.Key), Size: aws.Int64Value(o.Size)})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", prefix, err)
+	}
+	return deleteAll(ctx, svc, bucket, objects, opts)
+}
+
+// errKeysFailed stops the batches of a StopOnError deletion after one in
+// which the server refused some keys; their errors are already recorded.
+var errKeysFailed = errors.New("keys failed to delete")
+
+// deleteAll deletes objects in batches, recording each key's error.
+func deleteAll(ctx context.Context, svc s3iface.S3API, bucket string, objects []DeletedObject, opts DeleteOptions) ([]DeletedObject, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.DryRun || len(objects) == 0 {
+		return objects, nil
+	}
+	if opts.Confirm != nil {
+		var size int64
+		for _, o := range objects {
+			size += o.Size
+		}
+		if err := opts.Confirm(len(objects), size); err != nil {
+			return nil, err
+		}
+	}
+	batches := (len(objects) + MaxDeleteBatch - 1) / MaxDeleteBatch
+	errs := ForEachErr(ctx, batches, opts.Concurrency, !opts.StopOnError, func(b int) error {
+		batch := objects[b*MaxDeleteBatch : min((b+1)*MaxDeleteBatch, len(objects))]
+		ids := make([]*s3.ObjectIdentifier, len(batch))
+		index := make(map[string][]int, len(batch))
+		for i, o := range batch {
+			ids[i] = &s3.ObjectIdentifier{Key: aws.String(o.Key)}
+			index[o.Key] = append(index[o.Key], i)
+		}
+		out, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		var failed error
+		for _, e := range out.Errors {
+			for _, i := range index[aws.StringValue(e.Key)] {
+				batch[i].Err = fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message))
+				failed = errKeysFailed
+			}
+		}
+		return failed
+	})
+	for b, err := range errs {
+		if err == nil || err == errKeysFailed {
+			continue
+		}
+		for i := b * MaxDeleteBatch; i < min((b+1)*MaxDeleteBatch, len(objects)); i++ {
+			objects[i].Err = err
+		}
+	}
+	return objects, ctx.Err()
+}
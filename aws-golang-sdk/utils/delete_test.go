@@ -0,0 +1,117 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// refusingDelete refuses to delete the keys in refuse, as a server does
+// with keys it has no permission on, and counts the requests.
+type refusingDelete struct {
+	s3iface.S3API
+	refuse map[string]bool
+	mu     sync.Mutex
+	calls  int
+}
+
+func (r *refusingDelete) DeleteObjectsWithContext(ctx aws.Context, in *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	r.mu.Lock()
+	r.calls++
+	r.mu.Unlock()
+	var keep []*s3.ObjectIdentifier
+	var errs []*s3.Error
+	for _, id := range in.Delete.Objects {
+		if r.refuse[aws.StringValue(id.Key)] {
+			errs = append(errs, &s3.Error{Key: id.Key, Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")})
+		} else {
+			keep = append(keep, id)
+		}
+	}
+	out := &s3.DeleteObjectsOutput{Errors: errs}
+	if len(keep) == 0 {
+		return out, nil
+	}
+	in.Delete.Objects = keep
+	if _, err := r.S3API.DeleteObjectsWithContext(ctx, in, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func TestDeleteObjects(t *testing.T) {
+	// keys spans three batches: k0000-k0999, k1000-k1999 and k2000-k2001.
+	var keys []string
+	for i := range 2*utils.MaxDeleteBatch + 2 {
+		keys = append(keys, fmt.Sprintf("k%04d", i))
+	}
+	tests := []struct {
+		name        string
+		keys        []string
+		refuse      string
+		stopOnError bool
+		wantFailed  []int // indexes of keys whose delete failed
+		wantSkipped int
+		wantCalls   int
+	}{
+		{name: "all deleted", keys: keys, wantCalls: 3},
+		{name: "refused key fails alone", keys: keys, refuse: "k0005", wantFailed: []int{5}, wantCalls: 3},
+		{name: "every copy of a refused key fails", keys: []string{"a", "b", "a"}, refuse: "a", wantFailed: []int{0, 2}, wantCalls: 1},
+		{name: "stop on error skips later batches", keys: keys, refuse: "k0005", stopOnError: true,
+			wantFailed: []int{5}, wantSkipped: utils.MaxDeleteBatch + 2, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := objectslitetest.NewServer(t)
+			for _, k := range tt.keys {
+				srv.PutObject("b", k, []byte(k))
+			}
+			svc := &refusingDelete{S3API: srv.Client(t), refuse: map[string]bool{tt.refuse: true}}
+			// One batch at a time, so StopOnError stops after the first.
+			opts := utils.DeleteOptions{Concurrency: 1, StopOnError: tt.stopOnError}
+
+			deleted, err := utils.DeleteObjects(context.Background(), svc, "b", tt.keys, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if svc.calls != tt.wantCalls {
+				t.Fatalf("%d DeleteObjects requests, want %d", svc.calls, tt.wantCalls)
+			}
+			var failed []int
+			skipped := 0
+			for i, d := range deleted {
+				switch {
+				case d.Key != tt.keys[i]:
+					t.Fatalf("outcome %d is for %s, want %s", i, d.Key, tt.keys[i])
+				case errors.Is(d.Err, utils.ErrSkipped):
+					skipped++
+				case d.Err != nil:
+					failed = append(failed, i)
+				}
+			}
+			if !slices.Equal(failed, tt.wantFailed) || skipped != tt.wantSkipped {
+				t.Fatalf("failed %v and skipped %d, want %v and %d", failed, skipped, tt.wantFailed, tt.wantSkipped)
+			}
+			// Exactly the keys reported as failed or skipped are left.
+			var left []string
+			for _, d := range deleted {
+				if d.Err != nil {
+					left = append(left, d.Key)
+				}
+			}
+			slices.Sort(left)
+			objectslitetest.AssertKeys(t, srv, "b", slices.Compact(left)...)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DefaultDirectoryWorkers is the number of files UploadDirectory uploads
+// at once when DirectoryOptions.Workers is zero.
+const DefaultDirectoryWorkers = 4
+
+// DirectoryOptions configures UploadDirectory. Zero values select the
+// defaults.
+type DirectoryOptions struct {
+	// Upload configures each file's upload; its Concurrency is the number
+	// of parts of one file in flight.
+	Upload UploadOptions
+	// Workers is the number of files uploaded at once.
+	Workers int
+	// Include and Exclude are glob patterns (see MatchGlob) selecting
+	// the files to upload: those matching any Include pattern, or every
+	// file when there are none, and no Exclude pattern. A directory
+	// matching an Exclude pattern is not descended into.
+	Include []string
+	Exclude []string
+	// ContinueOnError keeps uploading after a file fails. Otherwise no
+	// further uploads start and the files not attempted are reported
+	// with ErrSkipped.
+	ContinueOnError bool
+}
+
+// DirectoryResult is the outcome of uploading one file of a directory.
+type DirectoryResult struct {
+	// Path is the local file and Key the object it was uploaded to.
+	Path string
+	Key  string
+	Size int64
+	// Upload is set when the upload succeeded.
+	Upload *UploadResult
+	Err    error
+}
+
+// UploadDirectory uploads every regular file under dir selected by
+// opts.Include and opts.Exclude to prefix followed by the file's
+// slash-separated path relative to dir, so dir/a/b.txt becomes
+// prefix+"a/b.txt"; a prefix meant as a directory should end in "/".
+// Each file is sent with Upload. report, when set, is called with the
+// outcome of every selected file, from several goroutines at once. The
+// returned error is for walking dir or bad patterns; failed uploads are
+// only reported.
+func UploadDirectory(ctx context.Context, svc s3iface.S3API, bucket, prefix, dir string, opts DirectoryOptions, report func(DirectoryResult)) error {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultDirectoryWorkers
+	}
+	opts.Upload.ShareMemory()
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		for _, elem := range strings.Split(pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return fmt.Errorf("pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	files, err := selectFiles(dir, prefix, opts.Include, opts.Exclude)
+	if err != nil {
+		return err
+	}
+	attempted := make([]bool, len(files))
+	errs := ForEachErr(ctx, len(files), opts.Workers, opts.ContinueOnError, func(i int) error {
+		attempted[i] = true
+		f := files[i]
+		f.Upload, f.Err = Upload(ctx, svc, bucket, f.Key, f.Path, opts.Upload)
+		if report != nil {
+			report(f)
+		}
+		return f.Err
+	})
+	if report != nil {
+		for i, err := range errs {
+			if !attempted[i] {
+				f := files[i]
+				f.Err = err
+				report(f)
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// selectFiles walks dir for the regular files to upload, keyed under
+// prefix, in lexical order.
+func selectFiles(dir, prefix string, include, exclude []string) ([]DirectoryResult, error) {
+	var files []DirectoryResult
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchAny(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (len(include) > 0 && !matchAny(include, rel)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, DirectoryResult{Path: p, Key: prefix + rel, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := MatchGlob(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether the slash-separated relative path rel matches
+// pattern. A pattern without a slash, such as "*.log", matches the last
+// element of rel, at any depth. Otherwise the pattern matches the whole
+// of rel element by element with path.Match syntax, and a "**" element
+// matches any number of elements: "logs/**/*.gz" matches
+// "logs/2024/05/a.gz" and "logs/a.gz".
+func MatchGlob(pattern, rel string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		return path.Match(pattern, path.Base(rel))
+	}
+	return matchElems(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchElems(pattern, elems []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(elems); skip++ {
+				if ok, err := matchElems(pattern[1:], elems[skip:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(elems) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], elems[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0, nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// IsNotFound reports whether err means the bucket or key does not exist.
+// HeadObject responses carry no body, so a missing key surfaces as a bare
+// 404 rather than a NoSuchKey code.
+func IsNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataValue looks up a user metadata value case-insensitively. The SDK
+// canonicalises x-amz-meta-* header names, so "sha256" comes back as
+// "Sha256".
+func MetadataValue(md map[string]*string, name string) string {
+	for k, v := range md {
+		if strings.EqualFold(k, name) && v != nil {
+			return *v
+		}
+	}
+	return ""
+}
+
+// MetaSHA256 is the user metadata key (x-amz-meta-sha256) under which the
+// examples store the hex SHA-256 of an object's content.
+const MetaSHA256 = "sha256"
+
+// MetaXXHash64 is the user metadata key (x-amz-meta-xxhash64) under which
+// dirsync records the hex xxHash64 of a file it uploads, for
+// dirsync.CompareXXHash.
+const MetaXXHash64 = "xxhash64"
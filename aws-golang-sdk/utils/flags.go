@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StringList is a repeatable string flag.
+type StringList []string
+
+// String implements flag.Value.
+func (l *StringList) String() string { return strings.Join(*l, ",") }
+
+// Set implements flag.Value.
+func (l *StringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// ByteSize is a flag holding a size in bytes that accepts unit suffixes
+// such as "64MiB" or "10GB" (see ParseBytes).
+type ByteSize int64
+
+// String implements flag.Value.
+func (b *ByteSize) String() string { return strconv.FormatInt(int64(*b), 10) }
+
+// Set implements flag.Value.
+func (b *ByteSize) Set(v string) error {
+	n, err := ParseBytes(v)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+// HeaderFlag is a repeatable "Name: value" flag that collects HTTP
+// headers.
+type HeaderFlag http.Header
+
+// String implements flag.Value.
+func (h *HeaderFlag) String() string {
+	var lines []string
+	for name, values := range *h {
+		for _, v := range values {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	return strings.Join(lines, ", ")
+}
+
+// Set implements flag.Value.
+func (h *HeaderFlag) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header %q is not of the form \"Name: value\"", v)
+	}
+	if *h == nil {
+		*h = HeaderFlag{}
+	}
+	http.Header(*h).Add(name, strings.TrimSpace(value))
+	return nil
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Bucket is one entry of ListBuckets.
+type Bucket struct {
+	Name    string
+	Created time.Time
+}
+
+// ListBuckets returns the buckets the credentials can see.
+func ListBuckets(ctx context.Context, svc s3iface.S3API) ([]Bucket, error) {
+	out, err := svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("list buckets: %w", err)
+	}
+	buckets := make([]Bucket, len(out.Buckets))
+	for i, b := range out.Buckets {
+		buckets[i] = Bucket{Name: aws.StringValue(b.Name), Created: aws.TimeValue(b.CreationDate)}
+	}
+	return buckets, nil
+}
+
+// ListOptions selects the keys listed by ListObjectsV2Pages and
+// ObjectIterator.
+type ListOptions struct {
+	Prefix string
+	// Delimiter, usually "/", rolls the keys that contain it after
+	// Prefix up into one common prefix each, like directories.
+	Delimiter string
+	// StartAfter lists only the keys after it.
+	StartAfter string
+	// ContinuationToken resumes a listing from the NextToken of a page.
+	ContinuationToken string
+	// MaxKeys is the number of entries per page, at most 1000, the
+	// default.
+	MaxKeys int64
+}
+
+// ListEntry is an object, or with a delimiter, a common prefix.
+type ListEntry struct {
+	// Key is the object key, or the common prefix including its
+	// delimiter.
+	Key string
+	// IsPrefix marks a common prefix; the fields below are then unset.
+	IsPrefix     bool
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	StorageClass string
+}
+
+// ListPage is one page of a listing: the objects, then the common
+// prefixes, each in key order.
+type ListPage struct {
+	Objects  []ListEntry
+	Prefixes []ListEntry
+	// NextToken continues the listing after this page
+	// (ListOptions.ContinuationToken); it is empty on the last page.
+	NextToken string
+}
+
+// ErrListLoop is returned when the server says a listing is truncated but
+// gives no way to continue it, which would otherwise list the first page
+// forever.
+var ErrListLoop = errors.New("listing truncated without a continuation token")
+
+// ListObjectsV2Pages lists bucket page by page as opts selects, calling fn
+// with each page until fn returns false, the last page is listed, or a
+// request fails. Unlike the SDK's paginator it exposes the continuation
+// token of each page, so a listing can be stopped and resumed later.
+func ListObjectsV2Pages(ctx context.Context, svc s3iface.S3API, bucket string, opts ListOptions, fn func(ListPage) bool) error {
+	in := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if opts.Prefix != "" {
+		in.Prefix = aws.String(opts.Prefix)
+	}
+	if opts.Delimiter != "" {
+		in.Delimiter = aws.String(opts.Delimiter)
+	}
+	if opts.StartAfter != "" {
+		in.StartAfter = aws.String(opts.StartAfter)
+	}
+	if opts.ContinuationToken != "" {
+		in.ContinuationToken = aws.String(opts.ContinuationToken)
+	}
+	if opts.MaxKeys > 0 {
+		in.MaxKeys = aws.Int64(opts.MaxKeys)
+	}
+	for {
+		out, err := svc.ListObjectsV2WithContext(ctx, in)
+		if err != nil {
+			return fmt.Errorf("list s3://%s/%s: %w", bucket, opts.Prefix, err)
+		}
+		page := ListPage{
+			Objects:  make([]ListEntry, len(out.Contents)),
+			Prefixes: make([]ListEntry, len(out.CommonPrefixes)),
+		}
+		for i, o := range out.Contents {
+			page.Objects[i] = ListEntry{
+				Key:          aws.StringValue(o.Key),
+				Size:         aws.Int64Value(o.Size),
+				ETag:         aws.StringValue(o.ETag),
+				LastModified: aws.TimeValue(o.LastModified),
+				StorageClass: aws.StringValue(o.StorageClass),
+			}
+		}
+		for i, p := range out.CommonPrefixes {
+			page.Prefixes[i] = ListEntry{Key: aws.StringValue(p.Prefix), IsPrefix: true}
+		}
+		truncated := aws.BoolValue(out.IsTruncated)
+		if truncated {
+			page.NextToken = aws.StringValue(out.NextContinuationToken)
+			if page.NextToken == "" {
+				return fmt.Errorf("list s3://%s/%s: %w", bucket, opts.Prefix, ErrListLoop)
+			}
+		}
+		if !fn(page) || !truncated {
+			return nil
+		}
+		in.ContinuationToken = aws.String(page.NextToken)
+	}
+}
+
+// ObjectIterator walks a listing one entry at a time, fetching pages as
+// needed:
+//
+//	it := utils.NewObjectIterator(ctx, svc, bucket, utils.ListOptions{Prefix: "logs/"})
+//	for it.Next() {
+//		fmt.Println(it.Entry().Key)
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// Within each page objects come before common prefixes, so with a
+// delimiter the entries are in key order per page only.
+type ObjectIterator struct {
+	ctx    context.Context
+	svc    s3iface.S3API
+	bucket string
+	opts   ListOptions
+
+	entries []ListEntry
+	entry   ListEntry
+	token   string
+	done    bool
+	err     error
+}
+
+// NewObjectIterator returns an iterator over the entries of bucket that
+// opts selects. Nothing is listed until the first call to Next.
+func NewObjectIterator(ctx context.Context, svc s3iface.S3API, bucket string, opts ListOptions) *ObjectIterator {
+	return &ObjectIterator{ctx: ctx, svc: svc, bucket: bucket, opts: opts, token: opts.ContinuationToken}
+}
+
+// Next advances to the next entry, listing the next page if needed, and
+// reports whether there is one. It returns false at the end of the
+// listing and on errors; Err tells them apart.
+func (it *ObjectIterator) Next() bool {
+	for len(it.entries) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		opts := it.opts
+		opts.ContinuationToken = it.token
+		it.err = ListObjectsV2Pages(it.ctx, it.svc, it.bucket, opts, func(page ListPage) bool {
+			it.entries = append(page.Objects, page.Prefixes...)
+			it.token = page.NextToken
+			it.done = page.NextToken == ""
+			return false
+		})
+	}
+	it.entry, it.entries = it.entries[0], it.entries[1:]
+	return true
+}
+
+// Entry returns the entry Next advanced to.
+func (it *ObjectIterator) Entry() ListEntry { return it.entry }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ObjectIterator) Err() error { return it.err }
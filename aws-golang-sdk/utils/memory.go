@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FitMemory lowers Concurrency, then PartSize, so that the part data a
+// transfer can hold at once, PartSize × Concurrency, stays within
+// MaxMemory. Part size is never lowered below MinPartSize. Parts that
+// grow stop at MaxMemory / Concurrency. It does nothing when MaxMemory is
+// zero.
+func (o *UploadOptions) FitMemory() error {
+	if o.MaxMemory <= 0 {
+		return nil
+	}
+	if o.MaxMemory < MinPartSize {
+		return fmt.Errorf("max memory %s is below the minimum part size of %s", FormatBytes(o.MaxMemory), FormatBytes(MinPartSize))
+	}
+	o.PartSize = min(o.PartSize, o.MaxMemory)
+	if err := o.LimitConcurrency(o.PartSize); err != nil {
+		return err
+	}
+	if o.MaxPartSize > o.PartSize {
+		// Growing parts must still fit the cap with every worker busy.
+		o.MaxPartSize = max(o.PartSize, min(o.MaxPartSize, o.MaxMemory/int64(max(o.Concurrency, 1))))
+	}
+	return nil
+}
+
+// LimitConcurrency caps Concurrency so that parts of partSize fit
+// MaxMemory. partSize may exceed PartSize, when a large file needs bigger
+// parts to fit MaxParts or a checkpoint fixed it earlier.
+func (o *UploadOptions) LimitConcurrency(partSize int64) error {
+	// An empty file is a single empty part, which needs no memory.
+	if o.MaxMemory <= 0 || partSize <= 0 {
+		return nil
+	}
+	if partSize > o.MaxMemory {
+		return fmt.Errorf("parts of %s do not fit the max memory of %s", FormatBytes(partSize), FormatBytes(o.MaxMemory))
+	}
+	o.Concurrency = max(1, min(o.Concurrency, int(o.MaxMemory/partSize)))
+	return nil
+}
+
+// ShareMemory gives o a MemoryBudget of MaxMemory when it has a cap but
+// no budget yet, so that the uploads made with copies of o, such as the
+// files of a directory sent several at a time, hold at most MaxMemory
+// between them rather than each up to MaxMemory.
+func (o *UploadOptions) ShareMemory() {
+	if o.MaxMemory > 0 && o.Memory == nil {
+		o.Memory = NewMemoryBudget(o.MaxMemory)
+	}
+}
+
+// MemoryBudget bounds the bytes of part buffers held at once by every
+// upload sharing it. Each buffered part takes its size from the budget
+// before it is read and gives it back once sent, so parts wait, in
+// arrival order, while the budget is spent. A part larger than the whole
+// budget waits for it to be unused and then runs alone. A nil
+// *MemoryBudget does not limit anything.
+type MemoryBudget struct {
+	mu      sync.Mutex
+	size    int64
+	used    int64
+	waiters []*memoryWaiter
+}
+
+type memoryWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewMemoryBudget returns a budget of size bytes.
+func NewMemoryBudget(size int64) *MemoryBudget {
+	return &MemoryBudget{size: max(size, 1)}
+}
+
+// Acquire waits until n bytes of the budget are free and takes them. They
+// must be returned with Release.
+func (m *MemoryBudget) Acquire(ctx context.Context, n int64) error {
+	if m == nil {
+		return nil
+	}
+	n = min(n, m.size)
+	m.mu.Lock()
+	if len(m.waiters) == 0 && m.used+n <= m.size {
+		m.used += n
+		m.mu.Unlock()
+		return nil
+	}
+	w := &memoryWaiter{n: n, ready: make(chan struct{})}
+	m.waiters = append(m.waiters, w)
+	m.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted while giving up: pass the bytes on.
+			m.release(n)
+		default:
+			for i, other := range m.waiters {
+				if other == w {
+					m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+					break
+				}
+			}
+			// The parts queued behind w may fit now.
+			m.release(0)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release returns n bytes taken by Acquire.
+func (m *MemoryBudget) Release(n int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release(min(n, m.size))
+}
+
+func (m *MemoryBudget) release(n int64) {
+	m.used -= n
+	for len(m.waiters) > 0 && m.used+m.waiters[0].n <= m.size {
+		w := m.waiters[0]
+		m.waiters = m.waiters[1:]
+		m.used += w.n
+		close(w.ready)
+	}
+}
@@ -0,0 +1,138 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/objectslitetest"
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+// countingParts records the most UploadPart requests in flight at once,
+// holding each briefly so that parts allowed to overlap do.
+type countingParts struct {
+	s3iface.S3API
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (c *countingParts) UploadPartWithContext(ctx aws.Context, in *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	return c.S3API.UploadPartWithContext(ctx, in, opts...)
+}
+
+func TestConcurrentMultipartUploadEmptyFileWithMaxMemory(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	path := objectslitetest.TempFile(t, 0)
+	opts := utils.UploadOptions{Concurrency: 4, MaxMemory: 16 << 20}
+
+	if _, err := utils.ConcurrentMultipartUpload(context.Background(), srv.Client(t), "b", "k", path, opts); err != nil {
+		t.Fatal(err)
+	}
+	objectslitetest.AssertObjectMatchesFile(t, srv, "b", "k", path)
+}
+
+func TestUploadDirectorySharesMaxMemory(t *testing.T) {
+	srv := objectslitetest.NewServer(t)
+	srv.CreateBucket("b")
+	files := map[string]int64{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files[name] = 2 * utils.MinPartSize
+	}
+	dir := objectslitetest.TempTree(t, files)
+	svc := &countingParts{S3API: srv.Client(t)}
+	// Two parts fit the cap: each file alone may send both of its parts
+	// at once, but the four files together must not exceed two either.
+	opts := utils.DirectoryOptions{Workers: 4, Upload: utils.UploadOptions{
+		PartSize:           utils.MinPartSize,
+		Concurrency:        4,
+		MaxMemory:          2 * utils.MinPartSize,
+		BufferParts:        true,
+		MultipartThreshold: utils.MinPartSize,
+	}}
+
+	err := utils.UploadDirectory(context.Background(), svc, "b", "", dir, opts, func(r utils.DirectoryResult) {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Key, r.Err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.peak > 2 {
+		t.Fatalf("%d parts in flight at once, want at most the 2 that fit -max-memory", svc.peak)
+	}
+	objectslitetest.AssertKeys(t, srv, "b", "a", "b", "c", "d")
+}
+
+func TestMemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	m := utils.NewMemoryBudget(10)
+	if err := m.Acquire(ctx, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	// 6 of 10 bytes are taken: a request for 5 waits, and one giving up
+	// takes nothing.
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := m.Acquire(short, 5); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire over the budget returned %v, want it to wait until the deadline", err)
+	}
+
+	granted := make(chan int64, 2)
+	var wg sync.WaitGroup
+	for _, n := range []int64{5, 20} { // 20 is clamped to the whole budget
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Acquire(ctx, n); err != nil {
+				t.Error(err)
+				return
+			}
+			granted <- n
+			m.Release(n)
+		}()
+		time.Sleep(10 * time.Millisecond) // queue 5 before 20
+	}
+	select {
+	case n := <-granted:
+		t.Fatalf("%d bytes granted while 6 of 10 were held", n)
+	case <-time.After(20 * time.Millisecond):
+	}
+	m.Release(6)
+	wg.Wait()
+	close(granted)
+	var order []int64
+	for n := range granted {
+		order = append(order, n)
+	}
+	if len(order) != 2 || order[0] != 5 {
+		t.Fatalf("granted %v, want 5 and then the whole budget in arrival order", order)
+	}
+	// Everything was given back: the whole budget is free again.
+	free, cancelFree := context.WithTimeout(ctx, time.Second)
+	defer cancelFree()
+	if err := m.Acquire(free, 10); err != nil {
+		t.Fatalf("whole budget not free after every release: %v", err)
+	}
+}
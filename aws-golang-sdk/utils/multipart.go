@@ -0,0 +1,483 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const (
+	// MinPartSize is the smallest part S3 accepts, except for the last.
+	MinPartSize int64 = 5 << 20
+	// DefaultPartSize is used when UploadOptions.PartSize is zero.
+	DefaultPartSize int64 = 8 << 20
+	// DefaultConcurrency is the number of parts uploaded in parallel by
+	// ConcurrentMultipartUpload when UploadOptions.Concurrency is zero.
+	DefaultConcurrency = 4
+)
+
+// UploadOptions tunes the multipart upload helpers. Zero values select the
+// defaults.
+type UploadOptions struct {
+	PartSize    int64
+	Concurrency int
+	// MaxPartSize, when above PartSize, lets the parts of files and
+	// streams grow from PartSize up to it as throughput allows, each
+	// sized to take about PartDuration (see PartSizer). Zero keeps every
+	// part at PartSize.
+	MaxPartSize int64
+	// PartDuration is the time each part should take to send when parts
+	// grow. Zero selects DefaultPartDuration.
+	PartDuration time.Duration
+	// MaxElapsedTime bounds the whole upload, retries included. Zero
+	// means no limit.
+	MaxElapsedTime time.Duration
+	// RetryBudget is the number of part retries allowed across the whole
+	// upload. Zero selects DefaultRetryBudget; negative disables retries.
+	RetryBudget int
+	// Retry decides which part failures are retried, how often and after
+	// what backoff.
+	Retry RetryPolicy
+	// PartTimeoutMin and MinThroughput configure the per-part timeout
+	// (see PartTimeout). A negative PartTimeoutMin disables it.
+	PartTimeoutMin time.Duration
+	MinThroughput  int64
+	// Checksum selects a checksum sent with each part so the server
+	// rejects parts corrupted in transit: ChecksumNone (or empty),
+	// ChecksumMD5, ChecksumCRC32C or ChecksumSHA256. Checksums are
+	// computed ahead of the uploads.
+	Checksum string
+	// MaxMemory caps the part data held in memory across all parts in
+	// flight; Concurrency and then PartSize are reduced to respect it
+	// (see FitMemory). Zero means no cap.
+	MaxMemory int64
+	// Memory, when set, is shared with other uploads: each part buffer,
+	// of a stream or of a file sent with BufferParts, is taken from it
+	// while the part is held (see MemoryBudget and ShareMemory).
+	Memory *MemoryBudget
+	// BufferParts reads each part into a pooled in-memory buffer once,
+	// instead of streaming it from the file for both signing and sending.
+	BufferParts bool
+	// Preset names a performance preset applied by ApplyPreset.
+	Preset string
+	// MultipartThreshold is the size above which a stream is promoted
+	// from a single PutObject to a multipart upload. Zero selects
+	// DefaultMultipartThreshold.
+	MultipartThreshold int64
+	// Progress, if set, receives progress events. It may be called
+	// concurrently from several parts.
+	Progress func(Event)
+	// Listener, if set, follows the bytes sent and the parts stored.
+	Listener ProgressListener
+	// Logger receives log messages such as retries. Nil selects
+	// slog.Default().
+	Logger *slog.Logger
+	// Metadata is stored with the object as x-amz-meta-* headers.
+	Metadata map[string]*string
+	// ContentEncoding is stored as the object's Content-Encoding.
+	ContentEncoding string
+	// Compression, when set, gzips the files Upload sends whose names it
+	// matches (see CompressionPolicy).
+	Compression *CompressionPolicy
+	// Queue, when set, is shared with other uploads: each part waits for
+	// a slot of it, and Priority decides which upload's parts go first
+	// (see PriorityQueue).
+	Queue    *PriorityQueue
+	Priority int
+	// SkipIdentical makes Upload check the object already under the key
+	// first, and send nothing if it holds the same content (see
+	// UploadResult.Skipped).
+	SkipIdentical bool
+	// PartOrder is the order in which the parts of a multipart upload
+	// from a file are sent: PartOrderSequential (or empty),
+	// PartOrderLargestFirst or PartOrderRandom. Streams are always sent
+	// in order.
+	PartOrder string
+	// VerifyUpload checks every ETag the server returns against the
+	// MD5s of the data sent, retrying a part whose ETag differs and
+	// failing the upload with ErrETagMismatch if the object's does. Upload
+	// also stores the file's SHA-256 as x-amz-meta-sha256, which
+	// downloads check. It needs a server whose ETags are MD5s.
+	VerifyUpload bool
+	// CompleteAttempts is the number of times CompleteMultipartUpload is
+	// sent while the upload is found still open after an ambiguous
+	// failure (see CompleteMultipartUpload). Zero selects
+	// DefaultCompleteAttempts.
+	CompleteAttempts int
+}
+
+// RegisterFlags binds the options shared by the multipart examples to fs.
+// Concurrency is registered separately by the examples that use it.
+func (o *UploadOptions) RegisterFlags(fs *flag.FlagSet) {
+	o.PartSize = DefaultPartSize
+	fs.Var((*ByteSize)(&o.PartSize), "part-size", "part size, e.g. 8MiB or 64MiB")
+	fs.Var((*ByteSize)(&o.MaxPartSize), "max-part-size", "grow parts from -part-size up to this size as throughput allows (0 = fixed part size)")
+	fs.DurationVar(&o.PartDuration, "part-duration", DefaultPartDuration, "time each part should take to send when parts grow with -max-part-size")
+	fs.DurationVar(&o.MaxElapsedTime, "max-elapsed-time", 0, "give up if the upload takes longer than this (0 = no limit)")
+	fs.IntVar(&o.RetryBudget, "retry-budget", DefaultRetryBudget, "part retries allowed across the whole upload (negative disables retries)")
+	fs.IntVar(&o.Retry.MaxAttempts, "retry-max-attempts", 0, "attempts per part, the first included (0 = limited by -retry-budget only)")
+	fs.DurationVar(&o.Retry.BaseDelay, "retry-base-delay", DefaultRetryBaseDelay, "backoff before the first retry of a part, doubled for each retry after it")
+	fs.DurationVar(&o.Retry.MaxDelay, "retry-max-delay", DefaultRetryMaxDelay, "longest backoff between retries of a part")
+	fs.Float64Var(&o.Retry.Jitter, "retry-jitter", DefaultRetryJitter, "fraction of each backoff drawn at random, 0 to 1 (negative disables)")
+	fs.IntVar(&o.CompleteAttempts, "complete-attempts", DefaultCompleteAttempts, "times CompleteMultipartUpload is sent while the upload is found still open after an ambiguous failure")
+	fs.DurationVar(&o.PartTimeoutMin, "part-timeout", DefaultPartTimeoutMin, "minimum per-part timeout, extended by part size over the throughput estimate (negative disables)")
+	o.MinThroughput = DefaultMinThroughput
+	fs.Var((*ByteSize)(&o.MinThroughput), "min-throughput", "per-connection throughput, per second, below which a part is considered hung")
+	fs.StringVar(&o.Checksum, "checksum", ChecksumNone, "checksum sent with each part: none, md5, crc32c or sha256")
+	fs.BoolVar(&o.VerifyUpload, "verify-upload", false, "check every returned ETag against the MD5s of the data sent, and store the file's SHA-256 as x-amz-meta-sha256")
+	fs.Var((*ByteSize)(&o.MaxMemory), "max-memory", "cap on part size × concurrency; both are reduced to fit (0 = no cap)")
+	fs.BoolVar(&o.BufferParts, "buffer-parts", false, "read each part into a pooled memory buffer instead of streaming it from the file twice")
+	fs.Var((*ByteSize)(&o.MultipartThreshold), "multipart-threshold", "objects up to this size are sent with a single PutObject (default 16MiB)")
+	fs.Func("compression-policy", "JSON file of name patterns whose files are gzipped before upload", func(file string) error {
+		p, err := LoadCompressionPolicy(file)
+		o.Compression = p
+		return err
+	})
+	fs.BoolVar(&o.SkipIdentical, "skip-identical", false, "skip the upload if the key already holds the same content, by SHA-256 metadata or recomputed ETag")
+	fs.StringVar(&o.PartOrder, "part-order", PartOrderSequential, "order parts are sent in: sequential, largest-first or random (completed in order either way)")
+	fs.StringVar(&o.Preset, "profile-preset", "", "tune part size, concurrency, memory cap and buffering together: "+strings.Join(PresetNames(), ", "))
+}
+
+func (o *UploadOptions) setDefaults() {
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.RetryBudget == 0 {
+		o.RetryBudget = DefaultRetryBudget
+	}
+	if o.MultipartThreshold <= 0 {
+		o.MultipartThreshold = DefaultMultipartThreshold
+	}
+	if o.CompleteAttempts <= 0 {
+		o.CompleteAttempts = DefaultCompleteAttempts
+	}
+}
+
+// Part is one byte range of a multipart upload.
+type Part struct {
+	Number int64
+	Offset int64
+	Size   int64
+}
+
+// PlanParts splits size bytes into parts of partSize, growing the part
+// size if needed to stay within MaxParts. An empty file is a single empty
+// part.
+func PlanParts(size, partSize int64) []Part {
+	if size/partSize >= MaxParts {
+		partSize = size/MaxParts + 1
+	}
+	if size == 0 {
+		return []Part{{Number: 1}}
+	}
+	parts := make([]Part, 0, (size+partSize-1)/partSize)
+	for off := int64(0); off < size; off += partSize {
+		parts = append(parts, Part{Number: int64(len(parts)) + 1, Offset: off, Size: min(partSize, size-off)})
+	}
+	return parts
+}
+
+// MultipartUpload uploads the file at path one part at a time.
+func MultipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	opts.Concurrency = 1
+	return multipartUpload(ctx, svc, bucket, key, path, opts)
+}
+
+// ConcurrentMultipartUpload uploads the file at path with up to
+// opts.Concurrency parts in flight.
+func ConcurrentMultipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	return multipartUpload(ctx, svc, bucket, key, path, opts)
+}
+
+func multipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	opts.setDefaults()
+	if err := checkChecksum(opts.Checksum); err != nil {
+		return nil, err
+	}
+	if err := opts.FitMemory(); err != nil {
+		return nil, err
+	}
+	if opts.MaxElapsedTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxElapsedTime)
+		defer cancel()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size, err := FileSize(f)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxPartSize > opts.PartSize {
+		return adaptiveMultipartUpload(ctx, svc, bucket, key, f, size, opts)
+	}
+	parts := PlanParts(size, opts.PartSize)
+	if err := opts.LimitConcurrency(parts[0].Size); err != nil {
+		return nil, err
+	}
+	order, err := UploadOrder(len(parts), func(i int) int64 { return parts[i].Size }, opts.PartOrder)
+	if err != nil {
+		return nil, err
+	}
+	ordered := make([]Part, len(parts))
+	for j, i := range order {
+		ordered[j] = parts[i]
+	}
+
+	start := time.Now()
+	opts.emit(Event{Type: EventUploadStarted, Key: key, Bytes: size})
+	uploadID, err := createMultipartUpload(ctx, svc, bucket, key, opts)
+	if err != nil {
+		opts.emitDone(key, size, start, err)
+		return nil, err
+	}
+
+	// Parts are hashed in the order they are sent; completed keeps them
+	// by number for CompleteMultipartUpload.
+	var sums *partSums
+	if opts.Checksum != "" && opts.Checksum != ChecksumNone {
+		hashCtx, stopHashing := context.WithCancel(ctx)
+		defer stopHashing()
+		sums = hashAhead(hashCtx, f, ordered, opts.Checksum, 2*opts.Concurrency)
+	}
+
+	// The first part to fail for good cancels the parts in flight, and no
+	// more start, so the upload is aborted as soon as they return.
+	partCtx, stopParts := context.WithCancelCause(ctx)
+	defer stopParts(nil)
+	uploader := NewPartUploader(svc, bucket, key, aws.StringValue(uploadID), opts)
+	completed := make([]*s3.CompletedPart, len(parts))
+	errs := make([]error, len(parts))
+	ForEach(partCtx, len(ordered), opts.Concurrency, func(j int) {
+		if partCtx.Err() != nil {
+			// ForEach may hand out one more index as it stops.
+			return
+		}
+		i := order[j]
+		var sum PartChecksum
+		if sums != nil {
+			sum, errs[i] = sums.take(partCtx, j)
+		}
+		if errs[i] == nil {
+			completed[i], errs[i] = uploader.Upload(partCtx, ordered[j], f, sum)
+		}
+		if errs[i] != nil {
+			stopParts(errs[i])
+		}
+	})
+
+	out, err := finishMultipartUpload(ctx, svc, bucket, key, uploadID, completed, len(parts), partFailure(ctx, partCtx, errs), opts)
+	opts.emitDone(key, size, start, err)
+	return out, err
+}
+
+// partFailure returns the error that failed the parts of an upload run
+// under parts, a context cancelled with the first part error as its
+// cause: that first error alone, since the parts it cancelled only fail
+// with context.Canceled. If ctx itself ended, every part error is kept.
+func partFailure(ctx, parts context.Context, errs []error) error {
+	if cause := context.Cause(parts); cause != nil && ctx.Err() == nil {
+		return cause
+	}
+	return errors.Join(errs...)
+}
+
+func createMultipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key string, opts UploadOptions) (*string, error) {
+	in := &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		Metadata: opts.Metadata,
+	}
+	if opts.ContentEncoding != "" {
+		in.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	switch opts.Checksum {
+	case ChecksumCRC32C:
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmCrc32c)
+	case ChecksumSHA256:
+		in.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+	}
+	create, err := svc.CreateMultipartUploadWithContext(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("create multipart upload: %w", err)
+	}
+	return create.UploadId, nil
+}
+
+// finishMultipartUpload completes the upload from the completed parts, or
+// aborts it if err, or ctx, says the parts did not all make it, or the
+// part list fails CheckCompletedParts against want parts (any number
+// when want is zero).
+func finishMultipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key string, uploadID *string, completed []*s3.CompletedPart, want int, err error, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = CheckCompletedParts(completed, want)
+	}
+	var out *s3.CompleteMultipartUploadOutput
+	if err == nil {
+		out, err = CompleteMultipartUpload(ctx, svc, bucket, key, aws.StringValue(uploadID), completed, opts)
+	}
+	if err == nil && opts.VerifyUpload {
+		// Every part ETag was checked against its MD5 as it was sent.
+		if want, ok := partsETag(completed); !ok || !SameETag(aws.StringValue(out.ETag), want) {
+			return nil, fmt.Errorf("%w: %s has ETag %s, want %s", ErrETagMismatch, key, aws.StringValue(out.ETag), want)
+		}
+	}
+	if err != nil {
+		_, abortErr := svc.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: uploadID,
+		})
+		if abortErr != nil {
+			// The parts stay on the server until CleanupIncompleteUploads
+			// or a lifecycle rule removes them.
+			orDefault(opts.Logger).Warn("abort failed; upload left incomplete", "key", key, "upload_id", aws.StringValue(uploadID), "error", abortErr)
+		}
+		if errors.Is(err, context.DeadlineExceeded) && opts.MaxElapsedTime > 0 {
+			return nil, fmt.Errorf("upload exceeded max elapsed time of %s: %w", opts.MaxElapsedTime, err)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// PartUploader uploads individual parts of one multipart upload, applying
+// the retry budget and per-part timeouts of UploadOptions. It is safe for
+// concurrent use.
+type PartUploader struct {
+	svc      s3iface.S3API
+	bucket   string
+	key      string
+	uploadID string
+	budget   *RetryBudget
+	timer    *PartTimeout
+	sizer    *PartSizer
+	buffers  *bufferPool
+	opts     UploadOptions
+}
+
+// NewPartUploader returns a PartUploader for an existing upload.
+func NewPartUploader(svc s3iface.S3API, bucket, key, uploadID string, opts UploadOptions) *PartUploader {
+	opts.setDefaults()
+	u := &PartUploader{
+		svc:      svc,
+		bucket:   bucket,
+		key:      key,
+		uploadID: uploadID,
+		budget:   NewRetryBudget(max(opts.RetryBudget, 0)),
+		opts:     opts,
+	}
+	if opts.PartTimeoutMin >= 0 {
+		u.timer = NewPartTimeout(opts.PartTimeoutMin, float64(opts.MinThroughput))
+	}
+	if opts.BufferParts {
+		u.buffers = &bufferPool{}
+	}
+	if opts.MaxPartSize > opts.PartSize {
+		u.sizer = NewPartSizer(opts.PartSize, opts.MaxPartSize, opts.PartDuration)
+	}
+	return u
+}
+
+// Upload sends part p, read from r at p.Offset. sum, when set, is sent
+// with the part and lets the server reject corrupted data.
+func (u *PartUploader) Upload(ctx context.Context, p Part, r io.ReaderAt, sum PartChecksum) (*s3.CompletedPart, error) {
+	// Memory is taken before the queue slot, as streams do, so an upload
+	// holding a slot never waits for memory held by one waiting for a
+	// slot.
+	if u.buffers != nil {
+		if err := u.opts.Memory.Acquire(ctx, p.Size); err != nil {
+			return nil, fmt.Errorf("upload part %d: %w", p.Number, err)
+		}
+		defer u.opts.Memory.Release(p.Size)
+	}
+	release, err := u.opts.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("upload part %d: %w", p.Number, err)
+	}
+	defer release()
+	if u.buffers != nil {
+		buf := u.buffers.get(p.Size)
+		defer u.buffers.put(buf)
+		if n, err := r.ReadAt(*buf, p.Offset); n < len(*buf) {
+			return nil, fmt.Errorf("read part %d: %w", p.Number, err)
+		}
+		r, p.Offset = bytes.NewReader(*buf), 0
+	}
+	var wantETag string
+	if u.opts.VerifyUpload {
+		if wantETag, err = partMD5(r, p, sum); err != nil {
+			return nil, err
+		}
+	}
+	var completed *s3.CompletedPart
+	attempt := 1
+	partStart := time.Now()
+	u.opts.emit(Event{Type: EventPartStarted, Key: u.key, Part: p.Number, Bytes: p.Size, Attempt: attempt})
+	logRetry := LogRetry(u.opts.Logger, "UploadPart", u.key, p.Number)
+	sent := u.opts.trackSent(u.key)
+	err = RetryWithPolicy(ctx, u.opts.Retry, u.budget, func() error {
+		partCtx, cancel := u.timer.WithTimeout(ctx, p.Size)
+		defer cancel()
+		in := &s3.UploadPartInput{
+			Bucket:        aws.String(u.bucket),
+			Key:           aws.String(u.key),
+			UploadId:      aws.String(u.uploadID),
+			PartNumber:    aws.Int64(p.Number),
+			Body:          io.NewSectionReader(r, p.Offset, p.Size),
+			ContentLength: aws.Int64(p.Size),
+		}
+		sum.apply(in)
+		start := time.Now()
+		out, err := u.svc.UploadPartWithContext(partCtx, in, sent...)
+		if err != nil {
+			if partCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				return fmt.Errorf("timed out after %s: %w", time.Since(start).Round(time.Second), err)
+			}
+			return err
+		}
+		u.timer.Observe(p.Size, time.Since(start))
+		u.sizer.Observe(p.Size, time.Since(start))
+		if wantETag != "" && !SameETag(aws.StringValue(out.ETag), wantETag) {
+			// Sent again, as a part damaged on the way would be.
+			return fmt.Errorf("%w: part %d has ETag %s, want %s", ErrETagMismatch, p.Number, aws.StringValue(out.ETag), wantETag)
+		}
+		completed = &s3.CompletedPart{ETag: out.ETag, ChecksumCRC32C: out.ChecksumCRC32C, ChecksumSHA256: out.ChecksumSHA256, PartNumber: aws.Int64(p.Number)}
+		return nil
+	}, func(n int, wait time.Duration, err error) {
+		attempt = n
+		logRetry(n, wait, err)
+		u.opts.emit(Event{Type: EventRetry, Key: u.key, Part: p.Number, Bytes: p.Size, Attempt: n, Wait: wait, Error: err.Error()})
+	})
+	if err != nil {
+		err = fmt.Errorf("upload part %d: %w", p.Number, err)
+		u.opts.emit(Event{Type: EventPartFailed, Key: u.key, Part: p.Number, Bytes: p.Size, Attempt: attempt, Elapsed: time.Since(partStart), Error: err.Error()})
+		return nil, err
+	}
+	u.opts.emit(Event{Type: EventPartCompleted, Key: u.key, Part: p.Number, Bytes: p.Size, Attempt: attempt, Elapsed: time.Since(partStart)})
+	if u.opts.Listener != nil {
+		u.opts.Listener.OnPartComplete(u.key, p.Number, p.Size)
+	}
+	return completed, nil
+}
@@ -0,0 +1,81 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+func TestPlanParts(t *testing.T) {
+	tests := []struct {
+		name          string
+		size, partSz  int64
+		wantParts     int
+		wantFirstSize int64
+		wantLastSize  int64
+	}{
+		{"empty file is one empty part", 0, 8 << 20, 1, 0, 0},
+		{"smaller than a part", 100, 8 << 20, 1, 100, 100},
+		{"exact multiple", 24 << 20, 8 << 20, 3, 8 << 20, 8 << 20},
+		{"short last part", 20 << 20, 8 << 20, 3, 8 << 20, 4 << 20},
+		{"grown to stay within MaxParts", utils.MaxParts*1000 + 5, 1, 9991, 1001, 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := utils.PlanParts(tt.size, tt.partSz)
+			if len(parts) != tt.wantParts || len(parts) > utils.MaxParts {
+				t.Fatalf("%d parts, want %d", len(parts), tt.wantParts)
+			}
+			if parts[0].Size != tt.wantFirstSize || parts[len(parts)-1].Size != tt.wantLastSize {
+				t.Fatalf("first and last parts are %d and %d bytes, want %d and %d",
+					parts[0].Size, parts[len(parts)-1].Size, tt.wantFirstSize, tt.wantLastSize)
+			}
+			var off int64
+			for i, p := range parts {
+				if p.Number != int64(i)+1 || p.Offset != off {
+					t.Fatalf("part %d is number %d at %d, want number %d at %d", i, p.Number, p.Offset, i+1, off)
+				}
+				off += p.Size
+			}
+			if off != tt.size {
+				t.Fatalf("parts cover %d bytes, want %d", off, tt.size)
+			}
+		})
+	}
+}
+
+func TestPartSizer(t *testing.T) {
+	const mib = 1 << 20
+	type sample struct {
+		size    int64
+		elapsed time.Duration
+	}
+	tests := []struct {
+		name                 string
+		observed             []sample
+		remaining, partsLeft int64
+		want                 int64
+	}{
+		{name: "starts at Min", remaining: -1, want: 8 * mib},
+		{name: "grows with throughput", observed: []sample{{3 * mib, time.Second}}, remaining: -1, want: 30 * mib},
+		{name: "rounded down to a MiB", observed: []sample{{3*mib + mib/2, 2 * time.Second}}, remaining: -1, want: 17 * mib},
+		{name: "capped at Max", observed: []sample{{100 * mib, time.Second}}, remaining: -1, want: 64 * mib},
+		{name: "never below Min", observed: []sample{{mib / 4, time.Second}}, remaining: -1, want: 8 * mib},
+		{name: "ignores zero durations", observed: []sample{{100 * mib, 0}}, remaining: -1, want: 8 * mib},
+		{name: "weighted towards recent parts", observed: []sample{{10 * mib, 10 * time.Second}, {mib * 21 / 10, time.Second}}, remaining: -1, want: 13 * mib},
+		{name: "large enough for the parts left", remaining: 1000 * mib, partsLeft: 10, want: 100 * mib},
+		{name: "remaining fits already", remaining: 10 * mib, partsLeft: 10, want: 8 * mib},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := utils.NewPartSizer(8*mib, 64*mib, 10*time.Second)
+			for _, o := range tt.observed {
+				s.Observe(o.size, o.elapsed)
+			}
+			if got := s.Next(tt.remaining, tt.partsLeft); got != tt.want {
+				t.Fatalf("Next(%d, %d) = %d MiB, want %d MiB", tt.remaining, tt.partsLeft, got/mib, tt.want/mib)
+			}
+		})
+	}
+}
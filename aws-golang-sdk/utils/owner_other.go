@@ -0,0 +1,12 @@
+//go:build !unix
+
+package utils
+
+import "os"
+
+// CheckOwner only checks that path exists: files have no owning uid
+// outside unix.
+func CheckOwner(path string, also ...int) error {
+	_, err := os.Stat(path)
+	return err
+}
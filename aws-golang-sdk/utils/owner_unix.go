@@ -0,0 +1,24 @@
+//go:build unix
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"syscall"
+)
+
+// CheckOwner returns an error unless the file at path, following links,
+// belongs to the current user or to one of the uids in also.
+func CheckOwner(path string, also ...int) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	uid := int(fi.Sys().(*syscall.Stat_t).Uid)
+	if uid == os.Getuid() || slices.Contains(also, uid) {
+		return nil
+	}
+	return fmt.Errorf("%s is owned by uid %d, not by the current user", path, uid)
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+)
+
+// Part orders accepted by UploadOptions.PartOrder. Whatever the order,
+// the upload is completed with the parts listed by number, so the object
+// is the same.
+const (
+	// PartOrderSequential uploads parts by number (the default).
+	PartOrderSequential = "sequential"
+	// PartOrderLargestFirst starts the largest parts first, so that when
+	// parts differ in size (the last part, or parts of a plan split
+	// unevenly) a slow connection is not left carrying a large part at
+	// the very end of the upload.
+	PartOrderLargestFirst = "largest-first"
+	// PartOrderRandom shuffles the parts, so parts in flight at once are
+	// spread over the file rather than adjacent: with connections of
+	// mixed speed no region of the file queues behind a slow one, and
+	// behind a load balancer neighbouring parts land on different nodes.
+	PartOrderRandom = "random"
+)
+
+// UploadOrder returns the indices of n parts, whose sizes are given by
+// size, in the order they are uploaded under order.
+func UploadOrder(n int, size func(i int) int64, order string) ([]int, error) {
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	switch order {
+	case "", PartOrderSequential:
+	case PartOrderLargestFirst:
+		slices.SortStableFunc(indices, func(a, b int) int { return cmp.Compare(size(b), size(a)) })
+	case PartOrderRandom:
+		rand.Shuffle(n, func(i, j int) { indices[i], indices[j] = indices[j], indices[i] })
+	default:
+		return nil, fmt.Errorf("unknown part order %q (want %s, %s or %s)", order, PartOrderSequential, PartOrderLargestFirst, PartOrderRandom)
+	}
+	return indices, nil
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const (
+	// DefaultPartDuration is how long each part should take to send when
+	// part sizes follow throughput (see PartSizer).
+	DefaultPartDuration = 10 * time.Second
+	// MaxUploadPartSize is the largest part S3 accepts.
+	MaxUploadPartSize int64 = 5 << 30
+)
+
+// PartSizer picks the size of each part of an upload as it is planned,
+// from the per-connection throughput of the parts sent so far: the size
+// that takes about Target to send, rounded down to a whole MiB, between
+// Min and Max. Parts start at Min. On a fast link they grow, saving
+// requests and their overhead; on a slow one they stay small, so a
+// failed part costs little to retry and progress stays visible. It is
+// safe for concurrent use.
+type PartSizer struct {
+	Min, Max int64
+	Target   time.Duration
+
+	mu       sync.Mutex
+	estimate float64
+}
+
+// NewPartSizer returns a sizer growing parts from min to max; a zero
+// target selects DefaultPartDuration.
+func NewPartSizer(min, max int64, target time.Duration) *PartSizer {
+	if target <= 0 {
+		target = DefaultPartDuration
+	}
+	return &PartSizer{Min: min, Max: max, Target: target}
+}
+
+// Observe feeds a part sent in elapsed into the throughput estimate, an
+// average weighted towards recent parts as PartTimeout keeps.
+func (s *PartSizer) Observe(size int64, elapsed time.Duration) {
+	if s == nil || elapsed <= 0 {
+		return
+	}
+	rate := float64(size) / elapsed.Seconds()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.estimate == 0 {
+		s.estimate = rate
+	} else {
+		s.estimate = throughputSmoothing*rate + (1-throughputSmoothing)*s.estimate
+	}
+}
+
+// Next returns the size of the next part. When remaining, the bytes not
+// yet planned, is known (not negative), the part is made large enough
+// for them to fit in partsLeft parts, whatever the estimate.
+func (s *PartSizer) Next(remaining, partsLeft int64) int64 {
+	s.mu.Lock()
+	size := int64(s.estimate * s.Target.Seconds())
+	s.mu.Unlock()
+	size = min(max(size&^(1<<20-1), s.Min), s.Max)
+	if remaining >= 0 && partsLeft > 0 {
+		size = max(size, (remaining+partsLeft-1)/partsLeft)
+	}
+	return size
+}
+
+// checkMaxPartSize validates MaxPartSize for uploads whose parts grow.
+func (o *UploadOptions) checkMaxPartSize() error {
+	if o.MaxPartSize > MaxUploadPartSize {
+		return fmt.Errorf("max part size %s is above the S3 limit of %s", FormatBytes(o.MaxPartSize), FormatBytes(MaxUploadPartSize))
+	}
+	return nil
+}
+
+// adaptiveMultipartUpload is multipartUpload with parts planned one at a
+// time by a PartSizer, as workers become free, rather than all at once.
+// Checksums are computed by each worker just before its part is sent.
+func adaptiveMultipartUpload(ctx context.Context, svc s3iface.S3API, bucket, key string, f io.ReaderAt, size int64, opts UploadOptions) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := opts.checkMaxPartSize(); err != nil {
+		return nil, err
+	}
+	if opts.PartOrder != "" && opts.PartOrder != PartOrderSequential {
+		return nil, fmt.Errorf("part order %s needs every part planned up front, which growing parts do not allow", opts.PartOrder)
+	}
+	start := time.Now()
+	opts.emit(Event{Type: EventUploadStarted, Key: key, Bytes: size})
+	uploadID, err := createMultipartUpload(ctx, svc, bucket, key, opts)
+	if err != nil {
+		opts.emitDone(key, size, start, err)
+		return nil, err
+	}
+
+	// A failed part cancels the others in flight; see multipartUpload.
+	partCtx, stopParts := context.WithCancelCause(ctx)
+	defer stopParts(nil)
+	uploader := NewPartUploader(svc, bucket, key, aws.StringValue(uploadID), opts)
+	var (
+		mu        sync.Mutex
+		offset    int64
+		planned   int64
+		completed []*s3.CompletedPart
+		errs      []error
+	)
+	// next plans the part after the last one handed out; an empty file
+	// is a single empty part.
+	next := func() (Part, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if planned > 0 && offset >= size {
+			return Part{}, false
+		}
+		planned++
+		p := Part{Number: planned, Offset: offset}
+		p.Size = min(uploader.sizer.Next(size-offset, MaxParts-planned+1), size-offset)
+		offset += p.Size
+		completed = append(completed, nil)
+		return p, true
+	}
+	var wg sync.WaitGroup
+	for range opts.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partCtx.Err() == nil {
+				p, ok := next()
+				if !ok {
+					return
+				}
+				var sum PartChecksum
+				var err error
+				if opts.Checksum != "" && opts.Checksum != ChecksumNone {
+					sum, err = partChecksum(f, p, opts.Checksum)
+				}
+				var cp *s3.CompletedPart
+				if err == nil {
+					cp, err = uploader.Upload(partCtx, p, f, sum)
+				}
+				mu.Lock()
+				completed[p.Number-1] = cp
+				if err != nil {
+					errs = append(errs, err)
+					stopParts(err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	out, err := finishMultipartUpload(ctx, svc, bucket, key, uploadID, completed, len(completed), partFailure(ctx, partCtx, errs), opts)
+	opts.emitDone(key, size, start, err)
+	return out, err
+}
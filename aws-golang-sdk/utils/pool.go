@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSkipped is the error of a batch item that was never attempted
+// because an earlier item failed and the batch stopped early.
+var ErrSkipped = errors.New("skipped after an earlier failure")
+
+// ForEach calls fn for every index in [0, n) on up to workers goroutines
+// and waits for them to finish. No new indexes are handed out once ctx is
+// done; fn is responsible for recording its own per-item errors.
+func ForEach(ctx context.Context, n, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			i = n
+		}
+	}
+	close(next)
+	wg.Wait()
+}
+
+// ForEachErr is ForEach for items that can fail: fn returns the error of
+// index i, and the errors are returned by index. Unless continueOnError
+// is set, the first error stops further indexes from being handed out
+// (items already running finish), and the items never started get
+// ErrSkipped, or ctx.Err() once ctx is done.
+func ForEachErr(ctx context.Context, n, workers int, continueOnError bool, fn func(i int) error) []error {
+	dispatch, stop := context.WithCancel(ctx)
+	defer stop()
+	errs := make([]error, n)
+	started := make([]bool, n)
+	ForEach(dispatch, n, workers, func(i int) {
+		// ForEach may hand out one more index as the batch stops.
+		if dispatch.Err() != nil {
+			return
+		}
+		started[i] = true
+		if errs[i] = fn(i); errs[i] != nil && !continueOnError {
+			stop()
+		}
+	})
+	for i := range errs {
+		if !started[i] {
+			errs[i] = ErrSkipped
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
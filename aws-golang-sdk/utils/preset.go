@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Performance presets for UploadOptions.Preset.
+const (
+	PresetLowMemory     = "low-memory"
+	PresetBalanced      = "balanced"
+	PresetMaxThroughput = "max-throughput"
+)
+
+type preset struct {
+	partSize    int64
+	concurrency int
+	maxMemory   int64
+	bufferParts bool
+}
+
+var presets = map[string]preset{
+	// Minimum-size parts, two at a time, read straight from the file:
+	// suits small jump hosts.
+	PresetLowMemory: {partSize: MinPartSize, concurrency: 2, maxMemory: 2 * MinPartSize},
+	// The defaults.
+	PresetBalanced: {partSize: DefaultPartSize, concurrency: DefaultConcurrency},
+	// Large parts, many in flight, each read into a pooled buffer once so
+	// signing and sending do not both hit the disk.
+	PresetMaxThroughput: {partSize: 64 << 20, concurrency: 16, bufferParts: true},
+}
+
+// presetFlags maps the flags a preset sets to the option they control.
+var presetFlags = map[string]func(o *UploadOptions, p preset){
+	"part-size":       func(o *UploadOptions, p preset) { o.PartSize = p.partSize },
+	"max-concurrency": func(o *UploadOptions, p preset) { o.Concurrency = p.concurrency },
+	"max-memory":      func(o *UploadOptions, p preset) { o.MaxMemory = p.maxMemory },
+	"buffer-parts":    func(o *UploadOptions, p preset) { o.BufferParts = p.bufferParts },
+}
+
+// PresetNames lists the available presets.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyPreset applies o.Preset and then the upload defaults of the
+// profile selected with -profile (see Profile), leaving alone every option
+// whose flag was given explicitly on fs, so "-profile-preset low-memory
+// -part-size 16MiB" keeps the 16MiB parts. A profile's preset is used when
+// -profile-preset is not given. Call it after fs.Parse.
+func (o *UploadOptions) ApplyPreset(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	prof, ok, err := uploadProfile(fs)
+	if err != nil {
+		return err
+	}
+	if ok && !explicit["profile-preset"] && prof.Preset != "" {
+		o.Preset = prof.Preset
+	}
+	if o.Preset != "" {
+		p, found := presets[o.Preset]
+		if !found {
+			return fmt.Errorf("unknown preset %q (want one of %s)", o.Preset, strings.Join(PresetNames(), ", "))
+		}
+		for name, set := range presetFlags {
+			if !explicit[name] {
+				set(o, p)
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	if prof.PartSize != "" && !explicit["part-size"] {
+		if o.PartSize, err = ParseBytes(prof.PartSize); err != nil {
+			return fmt.Errorf("profile part size: %w", err)
+		}
+	}
+	if prof.Concurrency > 0 && !explicit["max-concurrency"] {
+		o.Concurrency = prof.Concurrency
+	}
+	return nil
+}
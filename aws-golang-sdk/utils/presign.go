@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const (
+	// DefaultPresignExpiry is how long a presigned URL stays valid when
+	// no expiry is given.
+	DefaultPresignExpiry = 15 * time.Minute
+	// MaxPresignExpiry is the longest expiry SigV4 allows.
+	MaxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// PresignedURL is a time-limited link to one operation on an object.
+type PresignedURL struct {
+	URL    string
+	Method string
+	// Header holds the headers the signature covers besides Host. Whoever
+	// uses the URL must send them with exactly these values, or the
+	// request is refused.
+	Header  http.Header
+	Expires time.Time
+}
+
+// PresignPutOptions sets the headers a presigned PUT URL is signed with.
+// The uploader must send the same values.
+type PresignPutOptions struct {
+	ContentType string
+	// Metadata is stored with the object as x-amz-meta-* headers.
+	Metadata map[string]*string
+}
+
+// GeneratePresignedGetURL returns a URL that downloads bucket/key without
+// credentials until expiry has passed. A zero expiry selects
+// DefaultPresignExpiry. A URL signed with temporary credentials, such as
+// those fetched from Prism, stops working when they expire, whatever its
+// own expiry.
+func GeneratePresignedGetURL(ctx context.Context, svc s3iface.S3API, bucket, key string, expiry time.Duration) (*PresignedURL, error) {
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	return presign(ctx, req, http.MethodGet, expiry)
+}
+
+// GeneratePresignedPutURL returns a URL that uploads a body to bucket/key
+// with a single PUT, without credentials, until expiry has passed, as
+// GeneratePresignedGetURL. A client in read-only mode refuses to sign it.
+func GeneratePresignedPutURL(ctx context.Context, svc s3iface.S3API, bucket, key string, expiry time.Duration, opts PresignPutOptions) (*PresignedURL, error) {
+	in := &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Metadata: opts.Metadata}
+	if opts.ContentType != "" {
+		in.ContentType = aws.String(opts.ContentType)
+	}
+	req, _ := svc.PutObjectRequest(in)
+	return presign(ctx, req, http.MethodPut, expiry)
+}
+
+func presign(ctx context.Context, req *request.Request, method string, expiry time.Duration) (*PresignedURL, error) {
+	if expiry == 0 {
+		expiry = DefaultPresignExpiry
+	}
+	if expiry < 0 || expiry > MaxPresignExpiry {
+		return nil, fmt.Errorf("presign expiry %s out of range (at most %s)", expiry, MaxPresignExpiry)
+	}
+	req.SetContext(ctx)
+	expires := time.Now().Add(expiry)
+	url, header, err := req.PresignRequest(expiry)
+	if err != nil {
+		return nil, fmt.Errorf("presign %s: %w", req.Operation.Name, err)
+	}
+	if req.HTTPRequest.Header.Get("Authorization") != "" {
+		// SigV2 signs headers only; a URL carrying no signature would
+		// look valid and be refused.
+		return nil, errors.New("presigned URLs need SigV4; use -signature v4")
+	}
+	return &PresignedURL{URL: url, Method: method, Header: header, Expires: expires}, nil
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// PriorityQueue limits the part uploads in flight across every upload
+// sharing it and hands free slots to the highest-priority waiter first.
+// Uploads acquire a slot for each part (or single PutObject) and give it
+// back when the part is done, so when an urgent upload starts next to a
+// long bulk sync, the sync's parts in flight finish but its next ones wait
+// until the urgent upload has no more parts queued: the sync is paused
+// between parts rather than cancelled. Waiters of equal priority are
+// served in arrival order.
+type PriorityQueue struct {
+	mu      sync.Mutex
+	free    int
+	seq     uint64
+	waiters waiterHeap
+}
+
+// NewPriorityQueue returns a queue allowing slots part uploads at once.
+func NewPriorityQueue(slots int) *PriorityQueue {
+	return &PriorityQueue{free: max(slots, 1)}
+}
+
+// Acquire waits for a slot for an upload of the given priority; higher
+// values go first. The slot must be returned with Release.
+func (q *PriorityQueue) Acquire(ctx context.Context, priority int) error {
+	q.mu.Lock()
+	if q.free > 0 && len(q.waiters) == 0 {
+		q.free--
+		q.mu.Unlock()
+		return nil
+	}
+	q.seq++
+	w := &waiter{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiters, w)
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted while giving up: pass the slot on.
+			q.release()
+		default:
+			heap.Remove(&q.waiters, w.index)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot taken by Acquire.
+func (q *PriorityQueue) Release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release()
+}
+
+func (q *PriorityQueue) release() {
+	if len(q.waiters) == 0 {
+		q.free++
+		return
+	}
+	close(heap.Pop(&q.waiters).(*waiter).ready)
+}
+
+// acquire takes a slot of o.Queue for o.Priority, if there is a queue,
+// and returns the function releasing it.
+func (o *UploadOptions) acquire(ctx context.Context) (func(), error) {
+	if o.Queue == nil {
+		return func() {}, nil
+	}
+	if err := o.Queue.Acquire(ctx, o.Priority); err != nil {
+		return nil, err
+	}
+	return o.Queue.Release, nil
+}
+
+type waiter struct {
+	priority int
+	seq      uint64
+	index    int
+	ready    chan struct{}
+}
+
+// waiterHeap orders waiters by descending priority, then arrival.
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int { return len(h) }
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *waiterHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() any {
+	old := *h
+	w := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return w
+}
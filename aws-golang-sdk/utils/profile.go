@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// EnvProfile names the profile used when -profile is not given.
+	EnvProfile = "OBJECTSLITE_PROFILE"
+	// EnvProfiles overrides the location of the profiles file, by
+	// default ~/.objectslite/profiles.json.
+	EnvProfiles = "OBJECTSLITE_PROFILES"
+)
+
+// Profile is a named set of connection and upload defaults. Flags given
+// on the command line win over the profile. Like job targets, profiles
+// never hold secrets; they name the environment variables that do.
+type Profile struct {
+	// Endpoint is a URL or the name of an endpoint alias.
+	Endpoint     string `json:"endpoint,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Username     string `json:"username,omitempty"`
+	PasswordEnv  string `json:"password_env,omitempty"`
+	AccessKey    string `json:"access_key,omitempty"`
+	SecretKeyEnv string `json:"secret_key_env,omitempty"`
+	Insecure     bool   `json:"insecure,omitempty"`
+	ReadOnly     bool   `json:"read_only,omitempty"`
+	// PartSize ("16MiB"), Concurrency and Preset are upload defaults,
+	// applied by UploadOptions.ApplyPreset.
+	PartSize    string `json:"part_size,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+	Preset      string `json:"preset,omitempty"`
+}
+
+// Profiles is the parsed profiles file:
+//
+//	{
+//	  "endpoint_aliases": {"dc1": "https://10.0.0.10:9440", "dr": "https://10.1.0.10:9440"},
+//	  "profiles": {
+//	    "lab":  {"endpoint": "dc1", "username": "admin", "password_env": "LAB_PASSWORD", "insecure": true},
+//	    "prod": {"endpoint": "dr", "access_key": "AKIA...", "secret_key_env": "PROD_SECRET", "part_size": "64MiB", "concurrency": 16}
+//	  },
+//	  "tenants": [
+//	    {"buckets": ["acme-*"], "profile": "prod"}
+//	  ]
+//	}
+type Profiles struct {
+	EndpointAliases map[string]string  `json:"endpoint_aliases"`
+	Profiles        map[string]Profile `json:"profiles"`
+	// Tenants route buckets to profiles for clients with Config.Tenants
+	// set; the first matching route wins.
+	Tenants []TenantRoute `json:"tenants,omitempty"`
+}
+
+// ProfilesPath returns $OBJECTSLITE_PROFILES, or
+// ~/.objectslite/profiles.json.
+func ProfilesPath() string {
+	if p := os.Getenv(EnvProfiles); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".objectslite", "profiles.json")
+}
+
+// LoadProfiles reads a profiles file.
+func LoadProfiles(path string) (*Profiles, error) {
+	if path == "" {
+		return nil, errors.New("no profiles file: set $" + EnvProfiles)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Profiles
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Profile returns the named profile, with its endpoint alias resolved.
+func (p *Profiles) Profile(name string) (Profile, error) {
+	prof, ok := p.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	if url, ok := p.EndpointAliases[prof.Endpoint]; ok {
+		prof.Endpoint = url
+	}
+	return prof, nil
+}
+
+// Endpoint returns the URL of an endpoint alias.
+func (p *Profiles) Endpoint(alias string) (string, error) {
+	url, ok := p.EndpointAliases[alias]
+	if !ok {
+		return "", fmt.Errorf("unknown endpoint alias %q", alias)
+	}
+	return url, nil
+}
+
+// applyProfile fills the fields left unset from the endpoint alias and
+// the profile, if either is selected.
+func (c *Config) applyProfile() error {
+	name := cmp.Or(c.Profile, os.Getenv(EnvProfile))
+	if name == "" && c.EndpointAlias == "" {
+		return nil
+	}
+	profiles, err := LoadProfiles(ProfilesPath())
+	if err != nil {
+		return err
+	}
+	if c.EndpointAlias != "" {
+		if c.Endpoint != "" {
+			return errors.New("-endpoint and -endpoint-alias are mutually exclusive")
+		}
+		if c.Endpoint, err = profiles.Endpoint(c.EndpointAlias); err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	p, err := profiles.Profile(name)
+	if err != nil {
+		return err
+	}
+	c.Endpoint = cmp.Or(c.Endpoint, p.Endpoint)
+	c.Region = cmp.Or(c.Region, p.Region)
+	c.Insecure = c.Insecure || p.Insecure
+	c.ReadOnly = c.ReadOnly || p.ReadOnly
+	// Credentials come as a pair: a username or access key given on the
+	// command line is not combined with the profile's secret.
+	if c.Username == "" && c.AccessKey == "" {
+		c.Username, c.AccessKey = p.Username, p.AccessKey
+		if p.PasswordEnv != "" {
+			c.Password = cmp.Or(c.Password, os.Getenv(p.PasswordEnv))
+		}
+		if p.SecretKeyEnv != "" {
+			c.SecretKey = cmp.Or(c.SecretKey, os.Getenv(p.SecretKeyEnv))
+		}
+	}
+	return nil
+}
+
+// uploadProfile returns the profile selected by the -profile flag of fs,
+// or $OBJECTSLITE_PROFILE, and whether one is.
+func uploadProfile(fs *flag.FlagSet) (Profile, bool, error) {
+	name := os.Getenv(EnvProfile)
+	if f := fs.Lookup("profile"); f != nil && f.Value.String() != "" {
+		name = f.Value.String()
+	}
+	if name == "" {
+		return Profile{}, false, nil
+	}
+	profiles, err := LoadProfiles(ProfilesPath())
+	if err != nil {
+		return Profile{}, false, err
+	}
+	p, err := profiles.Profile(name)
+	return p, err == nil, err
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Progress event types.
+const (
+	EventUploadStarted   = "upload_started"
+	EventUploadCompleted = "upload_completed"
+	EventUploadFailed    = "upload_failed"
+	EventUploadSkipped   = "upload_skipped"
+	EventPartStarted     = "part_started"
+	EventPartCompleted   = "part_completed"
+	EventPartFailed      = "part_failed"
+	EventRetry           = "retry"
+)
+
+// Event is one progress notification from an upload.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Key  string    `json:"key"`
+	// Part is the part number; zero for events about the whole upload or
+	// a single PutObject.
+	Part int64 `json:"part,omitempty"`
+	// Bytes is the size of the part, or of the object when known.
+	Bytes int64 `json:"bytes,omitempty"`
+	// Attempt counts from 1 and is set on retry and part events.
+	Attempt int `json:"attempt,omitempty"`
+	// Elapsed is how long the part or upload took; Wait is the backoff
+	// before a retry.
+	Elapsed time.Duration `json:"elapsed_ns,omitempty"`
+	Wait    time.Duration `json:"wait_ns,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Progress formats for ProgressFlags.
+const (
+	ProgressNone  = "none"
+	ProgressJSONL = "jsonl"
+)
+
+// ProgressFlags selects where progress events are written.
+type ProgressFlags struct {
+	Format string
+	File   string
+	// Timings, when set, is a file that receives per-part timings (see
+	// PartTimings) once the transfer is done.
+	Timings string
+}
+
+// RegisterFlags binds -progress-format, -progress-file and -part-timings
+// to fs.
+func (p *ProgressFlags) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.Format, "progress-format", ProgressNone, "progress events to emit: none or jsonl")
+	fs.StringVar(&p.File, "progress-file", "", "write progress events to this file instead of stderr")
+	fs.StringVar(&p.Timings, "part-timings", "", "write start/end, size, attempts and throughput of every part to this file when done (.csv or .json)")
+}
+
+// Open returns the progress callback the flags select, or nil when
+// progress is off. The returned closer must be closed when the transfer
+// is done.
+func (p *ProgressFlags) Open() (func(Event), io.Closer, error) {
+	progress, closer, err := p.openEvents()
+	if err != nil || p.Timings == "" {
+		return progress, closer, err
+	}
+	timings := &PartTimings{}
+	both := func(e Event) {
+		timings.Observe(e)
+		if progress != nil {
+			progress(e)
+		}
+	}
+	return both, closerFunc(func() error {
+		err := timings.WriteFile(p.Timings)
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}), nil
+}
+
+func (p *ProgressFlags) openEvents() (func(Event), io.Closer, error) {
+	switch p.Format {
+	case "", ProgressNone:
+		return nil, io.NopCloser(nil), nil
+	case ProgressJSONL:
+	default:
+		return nil, nil, fmt.Errorf("unknown progress format %q", p.Format)
+	}
+	if p.File == "" {
+		return JSONLProgress(os.Stderr), io.NopCloser(nil), nil
+	}
+	f, err := os.Create(p.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	return JSONLProgress(f), f, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// JSONLProgress returns a progress callback writing one JSON object per
+// event to w. It is safe for concurrent use.
+func JSONLProgress(w io.Writer) func(Event) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
+
+// emit sends e to the Progress callback, if any, stamping its time.
+func (o *UploadOptions) emit(e Event) {
+	if o.Progress == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	o.Progress(e)
+}
+
+// emitDone reports the outcome of a whole upload.
+func (o *UploadOptions) emitDone(key string, size int64, start time.Time, err error) {
+	e := Event{Type: EventUploadCompleted, Key: key, Bytes: size, Elapsed: time.Since(start)}
+	if err != nil {
+		e.Type, e.Error = EventUploadFailed, err.Error()
+	}
+	o.emit(e)
+}
+
+// ProgressListener follows a transfer byte by byte, for progress bars and
+// ETAs; Event reports only starts and ends. Its methods may be called
+// from several goroutines at once and must not block.
+type ProgressListener interface {
+	// OnBytesTransferred is called as the bytes of key are sent or
+	// received, with the number of new bytes since the previous call.
+	OnBytesTransferred(key string, n int64)
+	// OnPartComplete is called once part of key, size bytes, is stored:
+	// an uploaded part, a downloaded range, or for a single PutObject,
+	// part 0 with the whole object.
+	OnPartComplete(key string, part, size int64)
+}
+
+// ProgressReader passes reads through to a body, reporting the bytes
+// read to a callback. Reset starts the body over for a retry; bytes that
+// an earlier attempt already reported are not reported again, so the
+// total never exceeds the body's size and progress never goes backwards.
+// It is safe for concurrent use.
+type ProgressReader struct {
+	mu       sync.Mutex
+	r        io.Reader
+	pos      int64
+	reported int64
+	report   func(n int64)
+}
+
+// NewProgressReader returns a ProgressReader reading r and reporting to
+// report, which may be nil.
+func NewProgressReader(r io.Reader, report func(n int64)) *ProgressReader {
+	return &ProgressReader{r: r, report: report}
+}
+
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	r := p.r
+	p.mu.Unlock()
+	n, err := r.Read(b)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r != p.r {
+		// Reset while reading: this attempt no longer counts.
+		return n, err
+	}
+	p.pos += int64(n)
+	if p.pos > p.reported && p.report != nil {
+		p.report(p.pos - p.reported)
+	}
+	p.reported = max(p.reported, p.pos)
+	return n, err
+}
+
+// Reset makes r the body, read again from its start.
+func (p *ProgressReader) Reset(r io.Reader) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.r, p.pos = r, 0
+}
+
+// Close closes the body if it is an io.Closer.
+func (p *ProgressReader) Close() error {
+	p.mu.Lock()
+	r := p.r
+	p.mu.Unlock()
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// trackSent returns the request options reporting the body bytes of key
+// sent by one request to o.Listener, or none without a listener. The
+// bytes are counted as the HTTP client reads them, each attempt through
+// the same ProgressReader, so the signer hashing the body and retries
+// sending it again do not count twice.
+func (o *UploadOptions) trackSent(key string) []request.Option {
+	if o.Listener == nil {
+		return nil
+	}
+	listener := o.Listener
+	body := NewProgressReader(nil, func(n int64) { listener.OnBytesTransferred(key, n) })
+	return []request.Option{func(r *request.Request) {
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			if r.HTTPRequest.Body == nil || r.HTTPRequest.Body == http.NoBody {
+				return
+			}
+			body.Reset(r.HTTPRequest.Body)
+			r.HTTPRequest.Body = body
+		})
+	}}
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DefaultMultipartThreshold is the size above which uploads switch from a
+// single PutObject to a multipart upload when
+// UploadOptions.MultipartThreshold is zero.
+const DefaultMultipartThreshold int64 = 16 << 20
+
+// UploadResult describes a finished upload, whichever method sent it.
+type UploadResult struct {
+	ETag      string
+	VersionID string
+	Size      int64
+	// Parts is the number of parts of a multipart upload, or zero when
+	// the object was sent with a single PutObject.
+	Parts int
+	// Skipped is set when UploadOptions.SkipIdentical found the content
+	// already stored under the key and nothing was sent; ETag and
+	// VersionID are then those of the existing object.
+	Skipped bool
+}
+
+// PutObject uploads the file at path with a single PutObject request,
+// which S3 limits to 5GiB. Upload picks between this and a multipart
+// upload by size.
+func PutObject(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts UploadOptions) (*UploadResult, error) {
+	opts.setDefaults()
+	if err := checkChecksum(opts.Checksum); err != nil {
+		return nil, err
+	}
+	if opts.MaxElapsedTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxElapsedTime)
+		defer cancel()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size, err := FileSize(f)
+	if err != nil {
+		return nil, err
+	}
+	return putObject(ctx, svc, bucket, key, f, size, opts)
+}
+
+// Upload uploads the file at path with the method that suits its size: a
+// single PutObject up to opts.MultipartThreshold, otherwise a multipart
+// upload with up to opts.Concurrency parts in flight (one at a time when
+// Concurrency is 1, as MultipartUpload does). Files matching
+// opts.Compression are gzipped on the way and streamed instead. With
+// opts.SkipIdentical, nothing is sent if the key already holds the same
+// content.
+func Upload(ctx context.Context, svc s3iface.S3API, bucket, key, path string, opts UploadOptions) (*UploadResult, error) {
+	opts.setDefaults()
+	if err := opts.FitMemory(); err != nil {
+		return nil, err
+	}
+	size, err := PathSize(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.VerifyUpload && MetadataValue(opts.Metadata, MetaSHA256) == "" {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return nil, err
+		}
+		opts.Metadata = maps.Clone(opts.Metadata)
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]*string)
+		}
+		opts.Metadata[MetaSHA256] = aws.String(sum)
+	}
+	if opts.SkipIdentical {
+		res, err := identical(ctx, svc, bucket, key, path, size, opts)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			opts.emit(Event{Type: EventUploadSkipped, Key: key, Bytes: size})
+			return res, nil
+		}
+	}
+	if opts.Compression.ShouldCompress(path, size) {
+		return uploadCompressed(ctx, svc, bucket, key, path, size, opts)
+	}
+	if size <= opts.MultipartThreshold {
+		return PutObject(ctx, svc, bucket, key, path, opts)
+	}
+	out, err := multipartUpload(ctx, svc, bucket, key, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	parts := len(PlanParts(size, opts.PartSize))
+	if opts.MaxPartSize > opts.PartSize {
+		// Grown parts are only counted in the ETag, "<md5>-<parts>".
+		_, count, _ := strings.Cut(strings.Trim(aws.StringValue(out.ETag), `"`), "-")
+		parts, _ = strconv.Atoi(count)
+	}
+	return &UploadResult{
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionId),
+		Size:      size,
+		Parts:     parts,
+	}, nil
+}
+
+// putObject sends size bytes of r with a single PutObject, applying the
+// retry budget and checksum of opts.
+func putObject(ctx context.Context, svc s3iface.S3API, bucket, key string, r io.ReaderAt, size int64, opts UploadOptions) (*UploadResult, error) {
+	var sum PartChecksum
+	if opts.Checksum != "" && opts.Checksum != ChecksumNone {
+		var err error
+		if sum, err = partChecksum(r, Part{Number: 1, Size: size}, opts.Checksum); err != nil {
+			return nil, err
+		}
+	}
+	var wantETag string
+	if opts.VerifyUpload {
+		var err error
+		if wantETag, err = partMD5(r, Part{Number: 1, Size: size}, sum); err != nil {
+			return nil, err
+		}
+	}
+	release, err := opts.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("put object: %w", err)
+	}
+	defer release()
+	start := time.Now()
+	opts.emit(Event{Type: EventUploadStarted, Key: key, Bytes: size})
+	var out *s3.PutObjectOutput
+	logRetry := LogRetry(opts.Logger, "PutObject", key, 0)
+	sent := opts.trackSent(key)
+	err = RetryWithPolicy(ctx, opts.Retry, NewRetryBudget(max(opts.RetryBudget, 0)), func() error {
+		in := &s3.PutObjectInput{
+			Bucket:        aws.String(bucket),
+			Key:           aws.String(key),
+			Body:          io.NewSectionReader(r, 0, size),
+			ContentLength: aws.Int64(size),
+			Metadata:      opts.Metadata,
+		}
+		if opts.ContentEncoding != "" {
+			in.ContentEncoding = aws.String(opts.ContentEncoding)
+		}
+		sum.applyPut(in)
+		var err error
+		out, err = svc.PutObjectWithContext(ctx, in, sent...)
+		if err == nil && wantETag != "" && !SameETag(aws.StringValue(out.ETag), wantETag) {
+			err = fmt.Errorf("%w: %s has ETag %s, want %s", ErrETagMismatch, key, aws.StringValue(out.ETag), wantETag)
+		}
+		return err
+	}, func(attempt int, wait time.Duration, err error) {
+		logRetry(attempt, wait, err)
+		opts.emit(Event{Type: EventRetry, Key: key, Bytes: size, Attempt: attempt, Wait: wait, Error: err.Error()})
+	})
+	if err != nil {
+		err = fmt.Errorf("put object: %w", err)
+	}
+	opts.emitDone(key, size, start, err)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Listener != nil {
+		opts.Listener.OnPartComplete(key, 0, size)
+	}
+	return &UploadResult{
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionId),
+		Size:      size,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// EnvReadOnly, when set to a true value ("1", "true"), turns on read-only
+// mode as if -read-only had been given.
+const EnvReadOnly = "OBJECTSLITE_READ_ONLY"
+
+// ErrReadOnly is returned for every mutating operation attempted by a
+// client in read-only mode. The request is never sent.
+var ErrReadOnly = errors.New("refused in read-only mode")
+
+// readOnlyFromEnv reports whether $OBJECTSLITE_READ_ONLY asks for
+// read-only mode.
+func readOnlyFromEnv() bool {
+	v, err := strconv.ParseBool(os.Getenv(EnvReadOnly))
+	return err == nil && v
+}
+
+// refuseMutations fails every mutating operation (see IsMutating) of
+// handlers before it is built, so neither the request nor a presigned URL
+// for it is ever produced.
+func refuseMutations(handlers *request.Handlers) {
+	handlers.Validate.PushFront(func(r *request.Request) {
+		if IsMutating(r.Operation.Name) {
+			r.Error = fmt.Errorf("%s: %w", r.Operation.Name, ErrReadOnly)
+		}
+	})
+}
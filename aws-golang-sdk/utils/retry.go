@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// DefaultRetryBudget is the number of part retries an upload may spend in
+// total when UploadOptions.RetryBudget is zero.
+const DefaultRetryBudget = 10
+
+// Defaults of RetryPolicy.
+const (
+	DefaultRetryBaseDelay = time.Second
+	DefaultRetryMaxDelay  = 30 * time.Second
+	DefaultRetryJitter    = 0.5
+)
+
+var (
+	// ErrRetryBudgetExhausted is returned (wrapped around the last
+	// failure) when a transfer has used up its shared retry budget.
+	ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+	// ErrRetryAttemptsExhausted is returned (wrapped around the last
+	// failure) when one request has been tried RetryPolicy.MaxAttempts
+	// times.
+	ErrRetryAttemptsExhausted = errors.New("retry attempts exhausted")
+)
+
+// RetryPolicy decides which failures of a part or range are retried and
+// how long to wait before each retry. Zero values select the defaults.
+type RetryPolicy struct {
+	// MaxAttempts caps the attempts of a single request, the first
+	// included. Zero leaves only the shared RetryBudget as the limit.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled for each
+	// retry after it up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the fraction of each wait drawn at random, between 0 and
+	// 1, so parts failing together do not retry in lockstep: 0.5 waits
+	// between half and all of the backoff, 1 anywhere from zero to all
+	// of it. Zero selects DefaultRetryJitter; negative disables it.
+	Jitter float64
+	// Retryable reports whether a failure is worth retrying. Nil selects
+	// IsRetryable.
+	Retryable func(error) bool
+}
+
+func (p *RetryPolicy) setDefaults() {
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryMaxDelay
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultRetryJitter
+	}
+	p.Jitter = min(max(p.Jitter, 0), 1)
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+}
+
+// backoff returns the wait before retry n, counting from 1.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	return d - time.Duration(p.Jitter*rand.Float64()*float64(d))
+}
+
+// retryableCodes are the error codes of 4xx responses that a later
+// attempt can succeed on.
+var retryableCodes = map[string]bool{
+	"RequestTimeout":            true,
+	"RequestTimeTooSkewed":      true,
+	"BadDigest":                 true,
+	"IncompleteBody":            true,
+	"XAmzContentSHA256Mismatch": true,
+	"SlowDown":                  true,
+	"Throttling":                true,
+	"ThrottlingException":       true,
+}
+
+// IsRetryable is the default RetryPolicy.Retryable. It retries server
+// errors (5xx), throttling (429) and timeouts (408), the 4xx responses
+// caused by a request damaged or delayed in transit, such as BadDigest
+// and RequestTimeout, and failures without a response at all, such as a
+// reset connection or a part timeout. Other client errors, such as
+// AccessDenied or NoSuchUpload, fail the same way every time and are not
+// retried, nor is ErrReadOnly.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrReadOnly) {
+		return false
+	}
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) || reqErr.StatusCode() == 0 {
+		return true
+	}
+	switch code := reqErr.StatusCode(); {
+	case code >= 500, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code >= 400:
+		return retryableCodes[reqErr.Code()]
+	}
+	return true
+}
+
+// RetryBudget is a pool of retries shared by every part of a transfer, so
+// a persistently failing upload gives up after a predictable number of
+// attempts instead of each part retrying on its own.
+type RetryBudget struct {
+	remaining atomic.Int64
+}
+
+// NewRetryBudget returns a budget allowing n retries in total.
+func NewRetryBudget(n int) *RetryBudget {
+	b := &RetryBudget{}
+	b.remaining.Store(int64(n))
+	return b
+}
+
+// Take consumes one retry, reporting false if none are left.
+func (b *RetryBudget) Take() bool {
+	return b.remaining.Add(-1) >= 0
+}
+
+// Remaining returns the number of retries left.
+func (b *RetryBudget) Remaining() int {
+	return int(max(b.remaining.Load(), 0))
+}
+
+// Retry is RetryWithPolicy with the default policy.
+func Retry(ctx context.Context, budget *RetryBudget, fn func() error, onRetry func(attempt int, wait time.Duration, err error)) error {
+	return RetryWithPolicy(ctx, RetryPolicy{}, budget, fn, onRetry)
+}
+
+// RetryWithPolicy calls fn until it succeeds, fails in a way policy does
+// not retry, ctx is done, or the attempts or budget run out. It backs off
+// exponentially with jitter between attempts, or waits as long as the
+// server asked when the error is a RetryAfterError. onRetry, if not nil,
+// is told about each retry before its backoff.
+func RetryWithPolicy(ctx context.Context, policy RetryPolicy, budget *RetryBudget, fn func() error, onRetry func(attempt int, wait time.Duration, err error)) error {
+	policy.setDefaults()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return fmt.Errorf("%w after %d: %w", ErrRetryAttemptsExhausted, attempt, err)
+		}
+		if !budget.Take() {
+			return fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+		}
+		wait := policy.backoff(attempt)
+		if d, ok := retryAfterDelay(err); ok {
+			wait = d
+		}
+		if onRetry != nil {
+			onRetry(attempt+1, wait, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// LogRetry returns an onRetry callback for Retry that logs each retry of
+// op at info level to logger (slog.Default() if nil), so transient
+// failures being handled are visible rather than looking like a stall.
+// part is omitted when zero.
+func LogRetry(logger *slog.Logger, op, key string, part int64) func(attempt int, wait time.Duration, err error) {
+	logger = orDefault(logger)
+	return func(attempt int, wait time.Duration, err error) {
+		args := []any{"op", op, "key", key}
+		if part > 0 {
+			args = append(args, "part", part)
+		}
+		args = append(args, "attempt", attempt, "wait", wait, "error", err)
+		logger.Info("retrying", args...)
+	}
+}
+
+// logSDKRetries logs the retries the SDK itself makes for throttling and
+// 5xx responses, which happen inside a single operation and are
+// otherwise silent, to c.Logger. It must run before the SDK's own
+// AfterRetry handler, which clears the error once it decides to retry.
+func (c *Client) logSDKRetries() {
+	handlers := &c.Handlers
+	handlers.AfterRetry.PushFront(func(r *request.Request) {
+		if r.Error == nil || r.RetryCount >= r.MaxRetries() {
+			return
+		}
+		if (r.Retryable != nil && !*r.Retryable) || (r.Retryable == nil && !r.ShouldRetry(r)) {
+			return
+		}
+		orDefault(c.Logger).Info("retrying", "op", r.Operation.Name, "attempt", r.RetryCount+2, "error", r.Error)
+	})
+}
+
+// orDefault returns logger, or slog.Default() if it is nil.
+func orDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
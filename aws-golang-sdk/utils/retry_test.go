@@ -0,0 +1,121 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	"github.com/ishantgntnx/objectslite-code-snippets/aws-golang-sdk/utils"
+)
+
+var (
+	errReset        = errors.New("connection reset by peer")
+	errAccessDenied = awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "req")
+	errSlowDown     = awserr.NewRequestFailure(awserr.New("SlowDown", "Reduce your request rate", nil), http.StatusServiceUnavailable, "req")
+)
+
+func TestRetryWithPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    []error // returned by the attempts in turn, then success
+		maxAttempts int
+		budget      int
+		wantCalls   int
+		wantErr     error
+	}{
+		{name: "first attempt succeeds", budget: 3, wantCalls: 1},
+		{name: "transient failures retried", failures: []error{errReset, errSlowDown}, budget: 3, wantCalls: 3},
+		{name: "client error not retried", failures: []error{errAccessDenied}, budget: 3, wantCalls: 1, wantErr: errAccessDenied},
+		{name: "attempts exhausted", failures: []error{errReset, errReset, errReset}, maxAttempts: 2, budget: 10, wantCalls: 2, wantErr: utils.ErrRetryAttemptsExhausted},
+		{name: "budget exhausted", failures: []error{errReset, errReset, errReset}, budget: 1, wantCalls: 2, wantErr: utils.ErrRetryBudgetExhausted},
+		{name: "no budget", failures: []error{errReset}, budget: 0, wantCalls: 1, wantErr: utils.ErrRetryBudgetExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := utils.RetryPolicy{MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond, Jitter: -1}
+			calls, retries := 0, 0
+			err := utils.RetryWithPolicy(context.Background(), policy, utils.NewRetryBudget(tt.budget), func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			}, func(attempt int, _ time.Duration, _ error) {
+				retries++
+				if attempt != retries+1 {
+					t.Errorf("retry %d reported as attempt %d", retries, attempt)
+				}
+			})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("fn called %d times, want %d", calls, tt.wantCalls)
+			}
+			if retries != calls-1 {
+				t.Fatalf("onRetry called %d times for %d calls", retries, calls)
+			}
+		})
+	}
+}
+
+func TestRetryWithPolicyStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := utils.RetryWithPolicy(ctx, utils.RetryPolicy{BaseDelay: time.Hour}, utils.NewRetryBudget(10), func() error {
+		calls++
+		return errReset
+	}, func(int, time.Duration, error) { cancel() })
+	if !errors.Is(err, errReset) || calls != 1 {
+		t.Fatalf("got %v after %d calls, want the first failure after 1", err, calls)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		size, takes   int
+		wantTaken     int
+		wantRemaining int
+	}{
+		{size: 0, takes: 1, wantTaken: 0, wantRemaining: 0},
+		{size: 3, takes: 2, wantTaken: 2, wantRemaining: 1},
+		{size: 3, takes: 5, wantTaken: 3, wantRemaining: 0},
+	}
+	for _, tt := range tests {
+		b := utils.NewRetryBudget(tt.size)
+		taken := 0
+		for range tt.takes {
+			if b.Take() {
+				taken++
+			}
+		}
+		if taken != tt.wantTaken || b.Remaining() != tt.wantRemaining {
+			t.Errorf("budget of %d after %d takes: took %d, %d left; want %d, %d left",
+				tt.size, tt.takes, taken, b.Remaining(), tt.wantTaken, tt.wantRemaining)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errReset, true},
+		{errSlowDown, true},
+		{errAccessDenied, false},
+		{awserr.NewRequestFailure(awserr.New("BadDigest", "", nil), http.StatusBadRequest, "req"), true},
+		{awserr.NewRequestFailure(awserr.New("NoSuchUpload", "", nil), http.StatusNotFound, "req"), false},
+		{utils.ErrReadOnly, false},
+	}
+	for _, tt := range tests {
+		if got := utils.IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
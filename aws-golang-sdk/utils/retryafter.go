@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// maxRetryAfter caps the wait asked for by a Retry-After header, so a
+// misconfigured proxy cannot stall a transfer indefinitely.
+const maxRetryAfter = 5 * time.Minute
+
+// RetryAfterError wraps the error of an operation whose final response
+// carried a Retry-After header, typically a 503 during maintenance or a
+// 429 SlowDown, so that Retry waits as long as the server asked rather
+// than its own backoff. It reads as the error it wraps.
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return e.Err.Error() }
+
+func (e *RetryAfterError) Unwrap() error { return e.Err }
+
+// RetryAfter returns the wait asked for by the Retry-After header of
+// resp, given either in seconds or as an HTTP date, capped at five
+// minutes.
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	} else {
+		return 0, false
+	}
+	return min(max(d, 0), maxRetryAfter), true
+}
+
+// retryAfterDelay returns the wait carried by err, if any.
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var ra *RetryAfterError
+	if errors.As(err, &ra) {
+		return ra.Delay, true
+	}
+	return 0, false
+}
+
+// retryAfterRetryer is the SDK's default retryer, except that it waits as
+// long as a Retry-After header asks before retrying within an operation.
+type retryAfterRetryer struct {
+	client.DefaultRetryer
+}
+
+func (r retryAfterRetryer) RetryRules(req *request.Request) time.Duration {
+	if d, ok := RetryAfter(req.HTTPResponse); ok {
+		return d
+	}
+	return r.DefaultRetryer.RetryRules(req)
+}
+
+// honorRetryAfter makes the SDK's retries within an operation wait as
+// long as Retry-After asks, and wraps the error of an operation that
+// still fails in a RetryAfterError so retries around the operation do
+// too.
+func honorRetryAfter(handlers *request.Handlers) {
+	handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error == nil {
+			return
+		}
+		if d, ok := RetryAfter(r.HTTPResponse); ok {
+			r.Error = &RetryAfterError{Err: r.Error, Delay: d}
+		}
+	})
+}
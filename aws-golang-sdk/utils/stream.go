@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// ErrStreamTooLarge is returned by PutObjectFromReader for a stream
+// longer than a single PutObject may be.
+var ErrStreamTooLarge = errors.New("stream too large for a single PutObject")
+
+// UploadStream uploads everything read from r, whose length need not be
+// known in advance: a pipe, a socket or stdin. Up to
+// opts.MultipartThreshold bytes are buffered first; a stream that ends
+// within the threshold is sent with a single PutObject, and a longer one
+// is promoted to a multipart upload starting with the buffered bytes.
+func UploadStream(ctx context.Context, svc s3iface.S3API, bucket, key string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	ctx, cancel, err := opts.prepareStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	head := make([]byte, opts.MultipartThreshold+1)
+	n, err := io.ReadFull(r, head)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		return putObject(ctx, svc, bucket, key, bytes.NewReader(head[:n]), int64(n), opts)
+	case nil:
+		return streamMultipart(ctx, svc, bucket, key, io.MultiReader(bytes.NewReader(head), r), opts)
+	}
+	return nil, fmt.Errorf("read stream: %w", err)
+}
+
+// PutObjectFromReader uploads everything read from r with a single
+// PutObject. The request needs the length up front, so a reader that can
+// seek and read at offsets, such as an *os.File or *bytes.Reader, is sent
+// from its current offset to its end as it is, and any other is read into
+// memory first, up to the 5GiB a PutObject may hold; a longer stream
+// fails with ErrStreamTooLarge before anything is sent. Use UploadStream
+// or MultipartUploadFromReader for streams that may be large.
+func PutObjectFromReader(ctx context.Context, svc s3iface.S3API, bucket, key string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	ctx, cancel, err := opts.prepareStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		off, err := ra.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		end, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		return putObject(ctx, svc, bucket, key, io.NewSectionReader(ra, off, end-off), end-off, opts)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, MaxUploadPartSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if int64(len(body)) > MaxUploadPartSize {
+		return nil, fmt.Errorf("%w: over %s", ErrStreamTooLarge, FormatBytes(MaxUploadPartSize))
+	}
+	return putObject(ctx, svc, bucket, key, bytes.NewReader(body), int64(len(body)), opts)
+}
+
+// MultipartUploadFromReader uploads everything read from r with a
+// multipart upload, however short the stream, buffering each part as
+// streamMultipart describes. An empty stream becomes an empty object.
+func MultipartUploadFromReader(ctx context.Context, svc s3iface.S3API, bucket, key string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	ctx, cancel, err := opts.prepareStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return streamMultipart(ctx, svc, bucket, key, r, opts)
+}
+
+// prepareStream applies the defaults and checks of the stream uploads,
+// and bounds ctx by opts.MaxElapsedTime. The returned cancel must be
+// called once the upload is done.
+func (o *UploadOptions) prepareStream(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	o.setDefaults()
+	if err := checkChecksum(o.Checksum); err != nil {
+		return nil, nil, err
+	}
+	if err := o.FitMemory(); err != nil {
+		return nil, nil, err
+	}
+	if o.MaxElapsedTime > 0 {
+		ctx, cancel := context.WithTimeout(ctx, o.MaxElapsedTime)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+// streamMultipart uploads r as a multipart upload. Each part is buffered
+// in memory while it is sent, so at most opts.Concurrency parts of
+// opts.PartSize (plus the one being read) are held at once, and with
+// opts.Memory each buffer waits for its share of the budget. The stream
+// must fit in MaxParts parts: raise opts.PartSize for very large streams,
+// or set opts.MaxPartSize so parts grow with throughput.
+func streamMultipart(ctx context.Context, svc s3iface.S3API, bucket, key string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	// Parts already are in memory; buffering them again would only copy.
+	opts.BufferParts = false
+	if err := opts.checkMaxPartSize(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	opts.emit(Event{Type: EventUploadStarted, Key: key})
+	uploadID, err := createMultipartUpload(ctx, svc, bucket, key, opts)
+	if err != nil {
+		opts.emitDone(key, 0, start, err)
+		return nil, err
+	}
+	uploader := NewPartUploader(svc, bucket, key, aws.StringValue(uploadID), opts)
+	// A failed part cancels the others in flight; see multipartUpload.
+	partCtx, stopParts := context.WithCancelCause(ctx)
+	defer stopParts(nil)
+
+	var (
+		pool      bufferPool
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		completed []*s3.CompletedPart
+		errs      []error
+		failed    atomic.Bool
+		size      int64
+	)
+	slots := make(chan struct{}, opts.Concurrency)
+	var readErr error
+	for number := int64(1); !failed.Load(); number++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			readErr = ctx.Err()
+		}
+		if readErr != nil {
+			break
+		}
+		partSize := opts.PartSize
+		if uploader.sizer != nil {
+			partSize = uploader.sizer.Next(-1, 0)
+		}
+		if err := opts.Memory.Acquire(ctx, partSize); err != nil {
+			<-slots
+			readErr = err
+			break
+		}
+		buf := pool.get(partSize)
+		n, err := io.ReadFull(r, *buf)
+		// An empty stream is uploaded as a single empty part; otherwise
+		// a read that returns nothing means the previous part was last.
+		if err == io.EOF && number > 1 {
+			pool.put(buf)
+			opts.Memory.Release(partSize)
+			<-slots
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			pool.put(buf)
+			opts.Memory.Release(partSize)
+			<-slots
+			readErr = fmt.Errorf("read part %d: %w", number, err)
+			break
+		}
+		if number > MaxParts {
+			pool.put(buf)
+			opts.Memory.Release(partSize)
+			<-slots
+			readErr = fmt.Errorf("stream exceeds %d parts of up to %s; use a larger part size", MaxParts, FormatBytes(partSize))
+			break
+		}
+		*buf = (*buf)[:n]
+		size += int64(n)
+
+		wg.Add(1)
+		go func(number int64, buf *[]byte, held int64) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer opts.Memory.Release(held)
+			defer pool.put(buf)
+			part := Part{Number: number, Size: int64(len(*buf))}
+			body := bytes.NewReader(*buf)
+			var sum PartChecksum
+			var cp *s3.CompletedPart
+			var err error
+			if opts.Checksum != "" && opts.Checksum != ChecksumNone {
+				sum, err = partChecksum(body, part, opts.Checksum)
+			}
+			if err == nil {
+				cp, err = uploader.Upload(partCtx, part, body, sum)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed.Store(true)
+				stopParts(err)
+				errs = append(errs, err)
+				return
+			}
+			completed = append(completed, cp)
+		}(number, buf, partSize)
+
+		if err != nil {
+			break // io.EOF or io.ErrUnexpectedEOF: that was the last part
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(completed, func(i, j int) bool {
+		return aws.Int64Value(completed[i].PartNumber) < aws.Int64Value(completed[j].PartNumber)
+	})
+	out, err := finishMultipartUpload(ctx, svc, bucket, key, uploadID, completed, 0, partFailure(ctx, partCtx, append(errs, readErr)), opts)
+	opts.emitDone(key, size, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadResult{
+		ETag:      aws.StringValue(out.ETag),
+		VersionID: aws.StringValue(out.VersionId),
+		Size:      size,
+		Parts:     len(completed),
+	}, nil
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// TenantRoute sends the requests for the buckets matching any of Buckets,
+// path.Match patterns such as "acme-*", through the connection settings
+// of Profile, for hosts managing several Objectslite tenants.
+type TenantRoute struct {
+	Buckets []string `json:"buckets"`
+	Profile string   `json:"profile"`
+}
+
+// TenantProfile returns the profile of the first tenant route matching
+// bucket, and whether one does.
+func (p *Profiles) TenantProfile(bucket string) (string, bool) {
+	for _, t := range p.Tenants {
+		for _, pattern := range t.Buckets {
+			if ok, _ := path.Match(pattern, bucket); ok {
+				return t.Profile, true
+			}
+		}
+	}
+	return "", false
+}
+
+// tenant is the connection of one tenant profile.
+type tenant struct {
+	profile    string
+	endpoint   *url.URL
+	region     string
+	creds      *credentials.Credentials
+	httpClient *http.Client
+	readOnly   bool
+	// refresh is set for Prism credentials, which are fetched again
+	// when rejected.
+	refresh bool
+}
+
+// tenants resolves the connection of every profile named by the tenant
+// routes of the profiles file. TLS settings, the credentials TTL and
+// read-only mode carry over from c; a tenant profile can add read-only
+// mode but not remove it.
+func (c *Config) tenants() (*Profiles, map[string]*tenant, error) {
+	if c.Agent != "" {
+		return nil, nil, errors.New("-tenants cannot be combined with -agent")
+	}
+	profiles, err := LoadProfiles(ProfilesPath())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(profiles.Tenants) == 0 {
+		return nil, nil, fmt.Errorf("-tenants given but %s has no tenants", ProfilesPath())
+	}
+	byProfile := make(map[string]*tenant)
+	for _, route := range profiles.Tenants {
+		for _, pattern := range route.Buckets {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, nil, fmt.Errorf("tenant %q: bucket pattern %q: %w", route.Profile, pattern, err)
+			}
+		}
+		if byProfile[route.Profile] != nil {
+			continue
+		}
+		tc := Config{
+			Profile:         route.Profile,
+			TLSMinVersion:   c.TLSMinVersion,
+			TLSCipherSuites: c.TLSCipherSuites,
+			CredentialsTTL:  c.CredentialsTTL,
+			ReadOnly:        c.ReadOnly,
+		}
+		if err := tc.Resolve(); err != nil {
+			return nil, nil, fmt.Errorf("tenant %q: %w", route.Profile, err)
+		}
+		endpoint, err := url.Parse(tc.Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return nil, nil, fmt.Errorf("tenant %q: invalid endpoint %q", route.Profile, tc.Endpoint)
+		}
+		httpClient, err := tc.HTTPClient()
+		if err != nil {
+			return nil, nil, fmt.Errorf("tenant %q: %w", route.Profile, err)
+		}
+		byProfile[route.Profile] = &tenant{
+			profile:    route.Profile,
+			endpoint:   endpoint,
+			region:     tc.Region,
+			creds:      tc.Credentials(),
+			httpClient: httpClient,
+			readOnly:   tc.ReadOnly,
+			refresh:    !tc.Anonymous && tc.AccessKey == "",
+		}
+	}
+	return profiles, byProfile, nil
+}
+
+// routeTenants adds a Build handler to handlers that sends each request
+// for a tenant's bucket to that tenant's endpoint, signed with its
+// credentials. Requests without a bucket, such as ListBuckets, and for
+// unmatched buckets keep the client's own connection. The endpoint
+// addressing is path-style, so only the scheme and host change. A copy
+// between tenants is signed for the destination bucket's tenant, which
+// needs read access to the source.
+func routeTenants(handlers *request.Handlers, profiles *Profiles, tenants map[string]*tenant) {
+	handlers.Build.PushBack(func(r *request.Request) {
+		bucket := requestBucket(r.Params)
+		if bucket == "" {
+			return
+		}
+		name, ok := profiles.TenantProfile(bucket)
+		if !ok {
+			return
+		}
+		t := tenants[name]
+		if t.readOnly && IsMutating(r.Operation.Name) {
+			r.Error = fmt.Errorf("%s (tenant %s): %w", r.Operation.Name, t.profile, ErrReadOnly)
+			return
+		}
+		r.HTTPRequest.URL.Scheme = t.endpoint.Scheme
+		r.HTTPRequest.URL.Host = t.endpoint.Host
+		r.HTTPRequest.Host = ""
+		r.Config.Endpoint = aws.String(t.endpoint.String())
+		r.Config.Region = aws.String(t.region)
+		r.ClientInfo.SigningRegion = t.region
+		r.Config.Credentials = t.creds
+		r.Config.HTTPClient = t.httpClient
+		if t.refresh {
+			// r.Handlers is this request's own copy.
+			RefreshOnAuthFailure(&r.Handlers, t.creds)
+		}
+	})
+}
+
+// requestBucket returns the Bucket field of an S3 operation's input, or
+// "" if it has none.
+func requestBucket(params any) string {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.Elem().FieldByName("Bucket")
+	if !f.IsValid() {
+		return ""
+	}
+	bucket, _ := f.Interface().(*string)
+	return aws.StringValue(bucket)
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPartTimeoutMin is the shortest timeout given to any part.
+	DefaultPartTimeoutMin = 30 * time.Second
+	// DefaultMinThroughput is the per-connection rate, in bytes per
+	// second, below which a part transfer is considered hung.
+	DefaultMinThroughput = 256 << 10
+	// partTimeoutSlack multiplies the expected transfer time so normal
+	// throughput variance does not trip the timeout.
+	partTimeoutSlack = 4
+	// throughputSmoothing is the EWMA weight of the newest sample.
+	throughputSmoothing = 0.3
+)
+
+// PartTimeout computes a deadline for each part request from the part
+// size and an estimate of per-connection throughput, so one hung
+// connection is cut off and retried instead of stalling a transfer. The
+// estimate starts at MinThroughput and follows observed transfers. It is
+// safe for concurrent use.
+type PartTimeout struct {
+	// Min is the floor for any part's timeout.
+	Min time.Duration
+	// MinThroughput, in bytes per second, bounds the estimate from below
+	// so a slow start does not produce enormous timeouts.
+	MinThroughput float64
+
+	mu       sync.Mutex
+	estimate float64
+}
+
+// NewPartTimeout returns a timer with the given floor and minimum
+// throughput; zero values select the defaults.
+func NewPartTimeout(min time.Duration, minThroughput float64) *PartTimeout {
+	if min <= 0 {
+		min = DefaultPartTimeoutMin
+	}
+	if minThroughput <= 0 {
+		minThroughput = DefaultMinThroughput
+	}
+	return &PartTimeout{Min: min, MinThroughput: minThroughput}
+}
+
+// WithTimeout derives the context for transferring size bytes. A nil
+// PartTimeout imposes no deadline.
+func (t *PartTimeout) WithTimeout(ctx context.Context, size int64) (context.Context, context.CancelFunc) {
+	if t == nil {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, t.For(size))
+}
+
+// For returns the timeout for transferring size bytes.
+func (t *PartTimeout) For(size int64) time.Duration {
+	t.mu.Lock()
+	rate := max(t.estimate, t.MinThroughput)
+	t.mu.Unlock()
+	expected := time.Duration(partTimeoutSlack * float64(size) / rate * float64(time.Second))
+	return t.Min + expected
+}
+
+// Observe feeds a completed transfer into the throughput estimate.
+func (t *PartTimeout) Observe(size int64, elapsed time.Duration) {
+	if t == nil || elapsed <= 0 {
+		return
+	}
+	rate := float64(size) / elapsed.Seconds()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.estimate == 0 {
+		t.estimate = rate
+	} else {
+		t.estimate = throughputSmoothing*rate + (1-throughputSmoothing)*t.estimate
+	}
+}
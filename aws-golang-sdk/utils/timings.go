@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PartTiming is the record of one multipart part kept by PartTimings.
+type PartTiming struct {
+	Key   string    `json:"key"`
+	Part  int64     `json:"part"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Bytes int64     `json:"bytes"`
+	// Attempts includes the first try; End-Start covers all of them and
+	// the backoff between.
+	Attempts int `json:"attempts"`
+	// Throughput is Bytes over End-Start, in bytes per second.
+	Throughput float64 `json:"bytes_per_second"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type partID struct {
+	key  string
+	part int64
+}
+
+// PartTimings collects a PartTiming for every part from progress events,
+// for offline analysis of where the time in a large upload goes. Pass
+// Observe as (or from) UploadOptions.Progress. It is safe for concurrent
+// use.
+type PartTimings struct {
+	mu      sync.Mutex
+	started map[partID]time.Time
+	parts   []PartTiming
+}
+
+// Observe records e if it starts or finishes a part.
+func (t *PartTimings) Observe(e Event) {
+	if e.Part == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := partID{e.Key, e.Part}
+	switch e.Type {
+	case EventPartStarted:
+		if t.started == nil {
+			t.started = map[partID]time.Time{}
+		}
+		t.started[id] = e.Time
+	case EventPartCompleted, EventPartFailed:
+		start, ok := t.started[id]
+		if !ok {
+			start = e.Time.Add(-e.Elapsed)
+		}
+		delete(t.started, id)
+		pt := PartTiming{Key: e.Key, Part: e.Part, Start: start, End: e.Time, Bytes: e.Bytes, Attempts: e.Attempt, Error: e.Error}
+		if d := pt.End.Sub(pt.Start); d > 0 {
+			pt.Throughput = float64(pt.Bytes) / d.Seconds()
+		}
+		t.parts = append(t.parts, pt)
+	}
+}
+
+// Parts returns the finished parts ordered by key and part number.
+func (t *PartTimings) Parts() []PartTiming {
+	t.mu.Lock()
+	parts := slices.Clone(t.parts)
+	t.mu.Unlock()
+	slices.SortFunc(parts, func(a, b PartTiming) int {
+		return cmp.Or(strings.Compare(a.Key, b.Key), cmp.Compare(a.Part, b.Part))
+	})
+	return parts
+}
+
+// WriteJSON writes the parts to w as a JSON array.
+func (t *PartTimings) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t.Parts())
+}
+
+// WriteCSV writes the parts to w as CSV with a header row. Times are
+// RFC 3339 with nanoseconds.
+func (t *PartTimings) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"key", "part", "start", "end", "bytes", "attempts", "bytes_per_second", "error"})
+	for _, p := range t.Parts() {
+		cw.Write([]string{
+			p.Key,
+			strconv.FormatInt(p.Part, 10),
+			p.Start.Format(time.RFC3339Nano),
+			p.End.Format(time.RFC3339Nano),
+			strconv.FormatInt(p.Bytes, 10),
+			strconv.Itoa(p.Attempts),
+			strconv.FormatFloat(p.Throughput, 'f', 0, 64),
+			p.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteFile writes the parts to path, as CSV if it ends in .csv and as
+// JSON otherwise.
+func (t *PartTimings) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = t.WriteCSV(f)
+	} else {
+		err = t.WriteJSON(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
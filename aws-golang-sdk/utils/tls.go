@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// CipherSuitesFIPS selects the AES-GCM ECDHE suites approved under FIPS
+// 140-2 when given as the -tls-ciphers value.
+const CipherSuitesFIPS = "fips"
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// TLSConfig returns the TLS settings for connections to Objectslite and
+// Prism Central. TLSMinVersion is "1.2" or "1.3" (older versions are
+// accepted for legacy lab setups); TLSCipherSuites is a comma-separated
+// list of Go cipher suite names, or CipherSuitesFIPS. Cipher suites only
+// apply up to TLS 1.2; Go does not allow configuring TLS 1.3 suites.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: c.Insecure, MinVersion: tls.VersionTLS12}
+	if c.TLSMinVersion != "" {
+		v, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q (want 1.2 or 1.3)", c.TLSMinVersion)
+		}
+		cfg.MinVersion = v
+	}
+	switch c.TLSCipherSuites {
+	case "":
+	case CipherSuitesFIPS:
+		cfg.CipherSuites = fipsCipherSuites
+	default:
+		ids := make(map[string]uint16)
+		for _, s := range tls.CipherSuites() {
+			ids[s.Name] = s.ID
+		}
+		for _, name := range strings.Split(c.TLSCipherSuites, ",") {
+			id, ok := ids[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+			}
+			cfg.CipherSuites = append(cfg.CipherSuites, id)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TransportStats collects connection-level events for the requests of a
+// client, so slow transfers can be attributed to the network (DNS,
+// connection setup, TLS, poor connection reuse) or to the server (time
+// from sending a request to its first response byte). It is safe for
+// concurrent use.
+type TransportStats struct {
+	open atomic.Int64
+
+	mu        sync.Mutex
+	peak      int64
+	requests  int
+	reused    int
+	dns       timing
+	connect   timing
+	handshake timing
+	server    timing
+}
+
+type timing struct {
+	total time.Duration
+	n     int
+}
+
+func (t *timing) add(d time.Duration) {
+	t.total += d
+	t.n++
+}
+
+func (t timing) mean() time.Duration {
+	if t.n == 0 {
+		return 0
+	}
+	return t.total / time.Duration(t.n)
+}
+
+// TransportSummary is a snapshot of TransportStats.
+type TransportSummary struct {
+	Requests int
+	// Reused counts requests sent on an already open connection.
+	Reused int
+	// OpenConns is the number of connections open now; PeakConns the
+	// most open at once.
+	OpenConns, PeakConns int64
+	// Mean durations of each phase, over the requests that went through
+	// it. ServerTime runs from the request being written to the first
+	// response byte.
+	DNS, Connect, TLS, ServerTime time.Duration
+}
+
+// ReuseRate is the fraction of requests that reused a connection.
+func (s TransportSummary) ReuseRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Reused) / float64(s.Requests)
+}
+
+// WriteTo prints the summary in a human-readable form.
+func (s TransportSummary) WriteTo(w io.Writer) (int64, error) {
+	n, err := fmt.Fprintf(w, "connections: %d requests, %.0f%% on reused connections, %d open (peak %d)\n"+
+		"mean timings: dns %s, connect %s, tls %s, server %s\n",
+		s.Requests, 100*s.ReuseRate(), s.OpenConns, s.PeakConns,
+		s.DNS.Round(time.Microsecond), s.Connect.Round(time.Microsecond),
+		s.TLS.Round(time.Microsecond), s.ServerTime.Round(time.Microsecond))
+	return int64(n), err
+}
+
+// Summary returns the statistics collected so far. It is safe to call on
+// a nil TransportStats.
+func (s *TransportStats) Summary() TransportSummary {
+	if s == nil {
+		return TransportSummary{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return TransportSummary{
+		Requests:   s.requests,
+		Reused:     s.reused,
+		OpenConns:  s.open.Load(),
+		PeakConns:  s.peak,
+		DNS:        s.dns.mean(),
+		Connect:    s.connect.mean(),
+		TLS:        s.handshake.mean(),
+		ServerTime: s.server.mean(),
+	}
+}
+
+// Instrument wraps transport so its connections and requests are
+// recorded in s.
+func (s *TransportStats) Instrument(transport *http.Transport) http.RoundTripper {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		open := s.open.Add(1)
+		s.mu.Lock()
+		s.peak = max(s.peak, open)
+		s.mu.Unlock()
+		return &trackedConn{Conn: conn, stats: s}, nil
+	}
+	return &tracingTransport{base: transport, stats: s}
+}
+
+type trackedConn struct {
+	net.Conn
+	stats *TransportStats
+	once  sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.stats.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+type tracingTransport struct {
+	base  http.RoundTripper
+	stats *TransportStats
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.stats
+	// The callbacks run on the transport's dial, write and read
+	// goroutines, so the start times are shared atomically.
+	var dnsStart, connectStart, tlsStart, wrote atomic.Int64
+	mark := func(t *atomic.Int64) { t.Store(time.Now().UnixNano()) }
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			s.mu.Lock()
+			s.requests++
+			if info.Reused {
+				s.reused++
+			}
+			s.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err == nil {
+				s.record(&s.dns, &dnsStart)
+			}
+		},
+		ConnectStart: func(_, _ string) { mark(&connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				s.record(&s.connect, &connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				s.record(&s.handshake, &tlsStart)
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&wrote) },
+		GotFirstResponseByte: func() { s.record(&s.server, &wrote) },
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+func (s *TransportStats) record(t *timing, start *atomic.Int64) {
+	ns := start.Load()
+	if ns == 0 {
+		return
+	}
+	d := time.Since(time.Unix(0, ns))
+	s.mu.Lock()
+	t.add(d)
+	s.mu.Unlock()
+}
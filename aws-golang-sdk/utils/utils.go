@@ -0,0 +1,445 @@
+// Package utils contains the helpers shared by every Objectslite example:
+// connection settings, credential handling and S3 client construction.
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/term"
+)
+
+const (
+	// DefaultRegion is the signing region used when none is configured.
+	// Objectslite ignores the region but SigV4 requires one.
+	DefaultRegion = "us-east-1"
+
+	// EnvEndpoint, EnvUsername and EnvPassword are consulted when the
+	// corresponding flag is left empty.
+	EnvEndpoint = "OBJECTSLITE_ENDPOINT"
+	EnvUsername = "OBJECTSLITE_USERNAME"
+	EnvPassword = "OBJECTSLITE_PASSWORD"
+
+	// EnvAccessKey and EnvSecretKey select key-based authentication
+	// with keys issued through Prism IAM instead of the Prism password.
+	EnvAccessKey = "OBJECTSLITE_ACCESS_KEY"
+	EnvSecretKey = "OBJECTSLITE_SECRET_KEY"
+
+	// EnvAgent names the unix socket of a running agent (see
+	// examples/agent) to send S3 requests through.
+	EnvAgent = "OBJECTSLITE_AGENT"
+
+	// agentEndpoint is the placeholder endpoint for requests sent to the
+	// agent; the agent rewrites them to the real endpoint.
+	agentEndpoint = "http://objectslite-agent"
+)
+
+// Config holds the connection settings shared by every example.
+type Config struct {
+	// Endpoint is the Objectslite S3 endpoint, e.g. https://10.0.0.10:9440.
+	Endpoint string
+	Region   string
+	Username string
+	Password string
+	// AccessKey and SecretKey, when set, are used instead of the encoded
+	// Prism username and password.
+	AccessKey string
+	SecretKey string
+	// Anonymous sends unsigned requests, for buckets that allow public
+	// read. No username, password or access key is needed.
+	Anonymous bool
+	// Signature selects how requests are signed: SignatureV4 (default),
+	// SignatureV4Unsigned or SignatureV2. Requests sent through an agent
+	// are signed by the agent with SigV4 regardless.
+	Signature string
+	// Headers are added to every S3 request, for load balancers or
+	// gateways in front of Objectslite that expect extra headers.
+	Headers http.Header
+	// Insecure skips TLS certificate verification. Prism Central ships
+	// with a self-signed certificate, so lab setups usually need this.
+	Insecure bool
+	// TLSMinVersion and TLSCipherSuites harden the TLS connection (see
+	// TLSConfig). Empty values keep Go's defaults, with TLS 1.2 minimum.
+	TLSMinVersion   string
+	TLSCipherSuites string
+	// Agent is the unix socket of a running agent. When set, S3 requests
+	// go through the agent, which holds the endpoint and credentials, and
+	// the settings above are not needed.
+	Agent string
+	// CredentialsTTL, when positive, expires the Prism credentials after
+	// this long so they are fetched again (see BasicAuthProvider).
+	CredentialsTTL time.Duration
+	// Refresh, when set, is called to fetch the Prism username and
+	// password again after they expire or are rejected. Without it the
+	// password is prompted for again on a terminal.
+	Refresh func() (username, password string, err error)
+	// ShowHeaders prints ShownHeaders of every response to stderr.
+	ShowHeaders bool
+	// AuditLog is a file to which every mutating operation is appended
+	// as a JSON line (see WithAuditLog).
+	AuditLog string
+	// TransportStats records connection reuse and DNS, connect, TLS and
+	// server timings for the client's requests (see Client.Stats).
+	TransportStats bool
+	// Profile names a profile of the profiles file (see Profiles) whose
+	// settings fill those left unset; it defaults to $OBJECTSLITE_PROFILE.
+	// EndpointAlias sets Endpoint from the file's endpoint aliases.
+	Profile       string
+	EndpointAlias string
+	// ReadOnly refuses every mutating S3 operation and Prism call with
+	// ErrReadOnly, for handing the tools to auditors or running inventory
+	// with production credentials. A profile can turn it on but not off.
+	ReadOnly bool
+	// Tenants sends the requests for each bucket matched by the tenant
+	// routes of the profiles file through the endpoint and credentials of
+	// the route's profile (see TenantRoute); other requests use the
+	// settings above.
+	Tenants bool
+}
+
+// RegisterFlags binds the connection flags to fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Endpoint, "endpoint", "", "Objectslite endpoint URL (default $"+EnvEndpoint+")")
+	fs.StringVar(&c.Region, "region", "", "signing region (default "+DefaultRegion+")")
+	fs.StringVar(&c.Profile, "profile", "", "take unset connection and upload settings from this profile of the profiles file (default $"+EnvProfile+")")
+	fs.StringVar(&c.EndpointAlias, "endpoint-alias", "", "use the endpoint with this alias in the profiles file")
+	fs.StringVar(&c.Username, "username", "", "Prism username (default $"+EnvUsername+")")
+	fs.StringVar(&c.Password, "password", "", "Prism password (default $"+EnvPassword+", otherwise prompted)")
+	fs.StringVar(&c.AccessKey, "access-key", "", "S3 access key (default $"+EnvAccessKey+"); replaces username/password")
+	fs.StringVar(&c.SecretKey, "secret-key", "", "S3 secret key (default $"+EnvSecretKey+")")
+	fs.BoolVar(&c.Anonymous, "anonymous", false, "send unsigned requests (public-read buckets); no credentials needed")
+	fs.StringVar(&c.Signature, "signature", SignatureV4, "request signing: "+SignatureV4+", "+SignatureV4Unsigned+" or "+SignatureV2)
+	fs.Var((*HeaderFlag)(&c.Headers), "header", "add a \"Name: value\" header to every S3 request (repeatable)")
+	fs.BoolVar(&c.Insecure, "insecure", false, "skip TLS certificate verification")
+	fs.BoolVar(&c.ShowHeaders, "show-headers", false, "print the request ID, version ID, server and date headers of every response to stderr")
+	fs.StringVar(&c.AuditLog, "audit-log", "", "append every put, delete, copy and multipart operation to this JSONL file")
+	fs.BoolVar(&c.TransportStats, "transport-stats", false, "report connection reuse and DNS/connect/TLS/server timings when done")
+	fs.DurationVar(&c.CredentialsTTL, "credentials-ttl", 0, "fetch the Prism credentials again after this long (default only when rejected)")
+	fs.StringVar(&c.TLSMinVersion, "tls-min-version", "1.2", "minimum TLS version: 1.2 or 1.3")
+	// The agent socket defaults from the environment at registration
+	// rather than in Resolve, so the agent itself can clear it.
+	fs.StringVar(&c.Agent, "agent", os.Getenv(EnvAgent), "send S3 requests through the agent listening on this unix socket (default $"+EnvAgent+")")
+	fs.BoolVar(&c.ReadOnly, "read-only", readOnlyFromEnv(), "refuse every operation that would change data (default $"+EnvReadOnly+")")
+	fs.BoolVar(&c.Tenants, "tenants", false, "route each bucket matched by the tenants of the profiles file to that tenant's profile")
+	fs.StringVar(&c.TLSCipherSuites, "tls-ciphers", "", "comma-separated TLS 1.2 cipher suites, or \"fips\" for FIPS-approved AES-GCM suites (default Go's)")
+}
+
+// Resolve fills unset fields from the selected profile, then from the
+// environment, and prompts for the password on the terminal as a last
+// resort. Username and password are not needed when an access key pair
+// is configured or in anonymous mode, and nothing is needed when an agent
+// is.
+func (c *Config) Resolve() error {
+	if err := c.applyProfile(); err != nil {
+		return err
+	}
+	if c.Region == "" {
+		c.Region = DefaultRegion
+	}
+	if c.Agent != "" {
+		return nil
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = os.Getenv(EnvEndpoint)
+	}
+	if c.Endpoint == "" {
+		return errors.New("no endpoint configured: set -endpoint or $" + EnvEndpoint)
+	}
+	if c.Anonymous {
+		return nil
+	}
+	if c.AccessKey == "" && c.Username == "" {
+		c.AccessKey = os.Getenv(EnvAccessKey)
+	}
+	if c.SecretKey == "" {
+		c.SecretKey = os.Getenv(EnvSecretKey)
+	}
+	if c.AccessKey != "" {
+		if c.SecretKey == "" {
+			return errors.New("access key configured without a secret key: set -secret-key or $" + EnvSecretKey)
+		}
+		return nil
+	}
+	return c.ResolvePrismCredentials()
+}
+
+// ResolvePrismCredentials fills the Prism username and password from the
+// environment, prompting for the password if needed. Prism management
+// calls always need them, even when S3 uses an access key pair.
+func (c *Config) ResolvePrismCredentials() error {
+	if c.Username == "" {
+		c.Username = os.Getenv(EnvUsername)
+	}
+	if c.Username == "" {
+		return errors.New("no username configured: set -username or $" + EnvUsername)
+	}
+	if c.Password == "" {
+		c.Password = os.Getenv(EnvPassword)
+	}
+	if c.Password == "" {
+		password, err := PromptPassword(fmt.Sprintf("Password for %s: ", c.Username))
+		if err != nil {
+			return err
+		}
+		c.Password = password
+	}
+	return nil
+}
+
+// PromptPassword reads a password from the terminal without echoing it.
+func PromptPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("password required but stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+// ErrNotConfirmed is returned by Confirm when the answer is not yes.
+var ErrNotConfirmed = errors.New("not confirmed")
+
+// Confirm asks a yes/no question on the terminal and returns nil only if
+// the answer is yes. Without a terminal it fails instead of assuming an
+// answer, so scripts must skip the question explicitly (the examples'
+// -force flag).
+func Confirm(question string) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("confirmation required but stdin is not a terminal; use -force")
+	}
+	fmt.Fprint(os.Stderr, question+" [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return ErrNotConfirmed
+}
+
+// EncodeCredentials returns the key Objectslite expects for a Prism user.
+// Objectslite authenticates S3 requests with the Prism basic-auth pair, so
+// the base64 encoding of "username:password" is used as both the access
+// key and the secret key.
+func EncodeCredentials(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// HTTPClient returns the HTTP client used for S3 and Prism traffic.
+func (c *Config) HTTPClient() (*http.Client, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if c.Agent != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			// Whoever owns the socket receives every request, and could
+			// answer them, so only an agent of the same user is used.
+			if err := CheckOwner(c.Agent); err != nil {
+				return nil, fmt.Errorf("agent socket: %w", err)
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", c.Agent)
+		}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// Credentials returns the S3 credentials for the resolved config.
+func (c *Config) Credentials() *credentials.Credentials {
+	if c.Agent != "" || c.Anonymous {
+		// The agent signs requests itself; anonymous requests are
+		// not signed at all.
+		return credentials.AnonymousCredentials
+	}
+	if c.AccessKey != "" {
+		return credentials.NewStaticCredentials(c.AccessKey, c.SecretKey, "")
+	}
+	return credentials.NewCredentials(&BasicAuthProvider{
+		Fetch: c.fetchPrismCredentials(),
+		TTL:   c.CredentialsTTL,
+	})
+}
+
+// NewSession creates an SDK session for the configured endpoint. The
+// config must already be resolved.
+func NewSession(cfg *Config) (*session.Session, error) {
+	httpClient, err := cfg.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	endpoint := cfg.Endpoint
+	if cfg.Agent != "" {
+		endpoint = agentEndpoint
+	}
+	creds := cfg.Credentials()
+	awsCfg := aws.NewConfig().
+		WithEndpoint(endpoint).
+		WithRegion(cfg.Region).
+		WithCredentials(creds).
+		WithHTTPClient(httpClient).
+		WithS3ForcePathStyle(true)
+	awsCfg = request.WithRetryer(awsCfg, retryAfterRetryer{client.DefaultRetryer{NumMaxRetries: client.DefaultRetryerMaxNumRetries}})
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	honorRetryAfter(&sess.Handlers)
+	if len(cfg.Headers) > 0 {
+		headers := cfg.Headers.Clone()
+		sess.Handlers.Build.PushBack(func(r *request.Request) {
+			for name, values := range headers {
+				r.HTTPRequest.Header[name] = append(r.HTTPRequest.Header[name], values...)
+			}
+		})
+	}
+	if cfg.Agent == "" && !cfg.Anonymous && cfg.AccessKey == "" {
+		RefreshOnAuthFailure(&sess.Handlers, creds)
+	}
+	if cfg.ReadOnly {
+		refuseMutations(&sess.Handlers)
+	}
+	return sess, nil
+}
+
+// Client bundles an S3 service client with the session it was built from.
+// It embeds *s3.S3, so it can be passed wherever an s3iface.S3API is
+// expected.
+type Client struct {
+	*s3.S3
+	Session *session.Session
+	Config  Config
+	// Logger receives the client's log messages, such as SDK-level
+	// retries. Nil selects slog.Default().
+	Logger *slog.Logger
+	// Stats collects transport statistics when Config.TransportStats is
+	// set, and is nil otherwise.
+	Stats *TransportStats
+}
+
+// ReportStats prints the transport statistics to w if they were
+// collected.
+func (c *Client) ReportStats(w io.Writer) {
+	if c.Stats != nil {
+		c.Stats.Summary().WriteTo(w)
+	}
+}
+
+// ClientOption customizes a client built by NewClient.
+type ClientOption func(*Client)
+
+// WithRequestHook calls fn with every request once it is built and
+// before it is signed, so fn may add or change headers. It runs once per
+// operation, not per retry.
+func WithRequestHook(fn func(*request.Request)) ClientOption {
+	return func(c *Client) { c.Handlers.Build.PushBack(fn) }
+}
+
+// WithLogger sends the client's log messages to logger, so library users
+// can route them into their own logging stack.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) { c.Logger = logger }
+}
+
+// WithResponseHook calls fn after every attempt of every request,
+// including attempts that failed and are retried. r.Error is set on
+// failure, and r.HTTPResponse is nil when no response was received.
+func WithResponseHook(fn func(*request.Request)) ClientOption {
+	return func(c *Client) { c.Handlers.CompleteAttempt.PushBack(fn) }
+}
+
+// ShownHeaders are the response headers printed by WithHeaderLog.
+var ShownHeaders = []string{"X-Amz-Request-Id", "X-Amz-Version-Id", "Server", "Date"}
+
+// WithHeaderLog writes the operation name and ShownHeaders of every
+// response to w, one line per operation.
+func WithHeaderLog(w io.Writer) ClientOption {
+	return func(c *Client) {
+		c.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.HTTPResponse == nil {
+				return
+			}
+			line := r.Operation.Name + " " + strconv.Itoa(r.HTTPResponse.StatusCode)
+			for _, name := range ShownHeaders {
+				if v := r.HTTPResponse.Header.Get(name); v != "" {
+					line += " " + strings.ToLower(name) + "=" + strconv.Quote(v)
+				}
+			}
+			fmt.Fprintln(w, line)
+		})
+	}
+}
+
+// NewClient resolves cfg and returns a client for it, customized by opts.
+func NewClient(cfg Config, opts ...ClientOption) (*Client, error) {
+	if err := cfg.Resolve(); err != nil {
+		return nil, err
+	}
+	var skew ClockSkew
+	sign, err := signHandler(cfg.Signature, &skew)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := NewSession(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{S3: s3.New(sess), Session: sess, Config: cfg}
+	client.Handlers.Sign.SwapNamed(sign)
+	client.correctClockSkew(&skew)
+	client.logSDKRetries()
+	if cfg.Tenants {
+		profiles, tenants, err := cfg.tenants()
+		if err != nil {
+			return nil, err
+		}
+		routeTenants(&client.Handlers, profiles, tenants)
+	}
+	if cfg.ShowHeaders {
+		opts = append(opts, WithHeaderLog(os.Stderr))
+	}
+	if cfg.AuditLog != "" {
+		// The file stays open for the life of the process.
+		f, err := os.OpenFile(cfg.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open audit log: %w", err)
+		}
+		opts = append(opts, WithAuditLog(f))
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if cfg.TransportStats {
+		client.Stats = &TransportStats{}
+		httpClient := sess.Config.HTTPClient
+		httpClient.Transport = client.Stats.Instrument(httpClient.Transport.(*http.Transport))
+	}
+	return client, nil
+}